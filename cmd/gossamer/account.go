@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"crypto/ed25519"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/ChainSafe/gossamer/cmd/utils"
@@ -153,7 +156,7 @@ func listKeys(datadir string) ([]string, error) {
 // it returns the resulting filepath of the new key
 func generateKeypair(keytype, datadir string, password []byte) (string, error) {
 	if password == nil {
-		password = getPassword()
+		password = getPassword("Enter password to encrypt keystore file:")
 	}
 
 	if keytype == "" {
@@ -239,9 +242,9 @@ func keystoreDir(datadir string) (keystorepath string, err error) {
 }
 
 // prompt user to enter password for encrypted keystore
-func getPassword() []byte {
+func getPassword(msg string) []byte {
 	for {
-		fmt.Println("Enter password to encrypt keystore file:")
+		fmt.Println(msg)
 		fmt.Print("> ")
 		password, err := terminal.ReadPassword(int(syscall.Stdin))
 		if err != nil {
@@ -251,3 +254,146 @@ func getPassword() []byte {
 		}
 	}
 }
+
+// unlockAuthorityKey finds the sr25519 key in the keystore that is specified with --unlock, or otherwise the first
+// key whose public key is one of the authorities, and decrypts it using the password from --password,
+// --password-file or a prompt. It returns nil if no key was specified and the keystore holds no authority key.
+func unlockAuthorityKey(ctx *cli.Context, datadir string, authorities [][]byte) (*crypto.Sr25519Keypair, error) {
+	unlock := strings.TrimPrefix(strings.ToLower(ctx.GlobalString(utils.UnlockFlag.Name)), "0x")
+	priv, pub, err := unlockKey(ctx, datadir, crypto.Sr25519Type, unlock, authorities)
+	if err != nil || priv == nil {
+		return nil, err
+	}
+
+	srpriv, ok := priv.(*crypto.Sr25519PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key %s is not a sr25519 key", pub)
+	}
+
+	return crypto.NewSr25519KeypairFromPrivate(srpriv)
+}
+
+// unlockGrandpaKey finds the first ed25519 key in the keystore whose public key is one of the GRANDPA authorities,
+// and decrypts it like unlockAuthorityKey. It returns nil if the keystore holds no GRANDPA authority key.
+func unlockGrandpaKey(ctx *cli.Context, datadir string, authorities [][]byte) (*crypto.Ed25519Keypair, error) {
+	priv, pub, err := unlockKey(ctx, datadir, crypto.Ed25519Type, "", authorities)
+	if err != nil || priv == nil {
+		return nil, err
+	}
+
+	edpriv, ok := priv.(*crypto.Ed25519PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key %s is not a ed25519 key", pub)
+	}
+
+	return crypto.NewEd25519Keypair(ed25519.PrivateKey(*edpriv)), nil
+}
+
+// unlockKey finds and decrypts the key of the given type in the keystore, as described by findAuthorityKey. It
+// returns the private key and its public key, or nil if there is no such key.
+func unlockKey(ctx *cli.Context, datadir string, keyType crypto.KeyType, unlock string, authorities [][]byte) (crypto.PrivateKey, string, error) {
+	keystorepath, err := keystoreDir(datadir)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not get keystore directory: %s", err)
+	}
+
+	keyfile, pub, err := findAuthorityKey(keystorepath, keyType, unlock, authorities)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if keyfile == "" {
+		if unlock != "" {
+			return nil, "", fmt.Errorf("could not find %s key %s in keystore", keyType, unlock)
+		}
+		return nil, "", nil
+	}
+
+	password, err := unlockPassword(ctx, pub)
+	if err != nil {
+		return nil, "", err
+	}
+
+	priv, err := keystore.ReadFromFileAndDecrypt(keyfile, password)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not unlock key %s: %s", pub, err)
+	}
+
+	log.Info("unlocked authority key", "type", keyType, "public key", pub)
+	return priv, pub, nil
+}
+
+// findAuthorityKey returns the file and public key of the key of the given type in the keystore with the public key unlock,
+// if set, or otherwise of the first key whose public key is one of the authorities
+func findAuthorityKey(keystorepath string, keyType crypto.KeyType, unlock string, authorities [][]byte) (string, string, error) {
+	files, err := ioutil.ReadDir(keystorepath)
+	if err != nil {
+		return "", "", fmt.Errorf("could not read keystore dir: %s", err)
+	}
+
+	for _, f := range files {
+		if filepath.Ext(f.Name()) != ".key" {
+			continue
+		}
+
+		keyfile := filepath.Join(keystorepath, f.Name())
+		data, err := ioutil.ReadFile(filepath.Clean(keyfile))
+		if err != nil {
+			return "", "", fmt.Errorf("could not read keystore file: %s", err)
+		}
+
+		ksjson := new(keystore.EncryptedKeystore)
+		err = json.Unmarshal(data, ksjson)
+		if err != nil || ksjson.Type != keyType {
+			continue
+		}
+
+		pub, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(ksjson.PublicKey), "0x"))
+		if err != nil {
+			continue
+		}
+
+		if unlock != "" {
+			if hex.EncodeToString(pub) != unlock {
+				continue
+			}
+			if !containsKey(authorities, pub) {
+				log.Warn("unlocked key is not a genesis authority", "public key", ksjson.PublicKey)
+			}
+			return keyfile, ksjson.PublicKey, nil
+		}
+
+		if containsKey(authorities, pub) {
+			return keyfile, ksjson.PublicKey, nil
+		}
+	}
+
+	return "", "", nil
+}
+
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, k := range keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// unlockPassword returns the password set with --password, or read from the file set with --password-file,
+// or otherwise prompts the user to enter the password of the key
+func unlockPassword(ctx *cli.Context, pub string) ([]byte, error) {
+	if pwd := ctx.GlobalString(utils.PasswordFlag.Name); pwd != "" {
+		return []byte(pwd), nil
+	}
+
+	if file := ctx.GlobalString(utils.PasswordFileFlag.Name); file != "" {
+		data, err := ioutil.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return nil, fmt.Errorf("could not read password file: %s", err)
+		}
+		return []byte(strings.TrimRight(string(data), "\r\n")), nil
+	}
+
+	return getPassword(fmt.Sprintf("Enter password to unlock key %s:", pub)), nil
+}
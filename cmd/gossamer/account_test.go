@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"io/ioutil"
 	"os"
@@ -251,3 +253,88 @@ func TestListKeys(t *testing.T) {
 		}
 	}
 }
+
+func TestUnlockAuthorityKey(t *testing.T) {
+	defer os.RemoveAll(testKeystoreDir)
+
+	// an ed25519 key and a sr25519 key that is not an authority are ignored
+	_, err := generateKeypair("ed25519", testKeystoreDir, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = generateKeypair("sr25519", testKeystoreDir, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyfile, err := generateKeypair("sr25519", testKeystoreDir, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := hex.DecodeString(strings.TrimSuffix(filepath.Base(keyfile), ".key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passwordFile := filepath.Join(testKeystoreDir, "password")
+	err = ioutil.WriteFile(passwordFile, append(testPassword, '\n'), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorities := [][]byte{make([]byte, 32), pub}
+	for _, c := range []struct {
+		name   string
+		flags  []string
+		values []interface{}
+	}{
+		{"password", []string{"password"}, []interface{}{string(testPassword)}},
+		{"password file", []string{"password-file"}, []interface{}{passwordFile}},
+		{"unlock", []string{"unlock", "password"}, []interface{}{"0x" + hex.EncodeToString(pub), string(testPassword)}},
+	} {
+		ctx, err := createCliContext(c.name, c.flags, c.values)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kp, err := unlockAuthorityKey(ctx, testKeystoreDir, authorities)
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if kp == nil || !bytes.Equal(kp.Public().Encode(), pub) {
+			t.Fatalf("%s: did not unlock authority key", c.name)
+		}
+	}
+
+	// no authority key in the keystore
+	ctx, err := createCliContext("no authority", []string{"password"}, []interface{}{string(testPassword)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kp, err := unlockAuthorityKey(ctx, testKeystoreDir, [][]byte{make([]byte, 32)})
+	if err != nil {
+		t.Fatal(err)
+	} else if kp != nil {
+		t.Fatal("Fail: unlocked key that is not an authority")
+	}
+
+	// wrong password
+	ctx, err = createCliContext("wrong password", []string{"password"}, []interface{}{"4321"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = unlockAuthorityKey(ctx, testKeystoreDir, authorities)
+	if err == nil {
+		t.Fatal("Fail: unlocked key with wrong password")
+	}
+
+	// the key to unlock is not in the keystore
+	ctx, err = createCliContext("unknown key", []string{"unlock"}, []interface{}{hex.EncodeToString(make([]byte, 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = unlockAuthorityKey(ctx, testKeystoreDir, authorities)
+	if err == nil {
+		t.Fatal("Fail: unlocked key that is not in the keystore")
+	}
+}
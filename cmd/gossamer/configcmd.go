@@ -21,15 +21,25 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/ChainSafe/gossamer/cmd/utils"
 	"github.com/ChainSafe/gossamer/common"
+	tx "github.com/ChainSafe/gossamer/common/transaction"
 	cfg "github.com/ChainSafe/gossamer/config"
 	"github.com/ChainSafe/gossamer/config/genesis"
+	"github.com/ChainSafe/gossamer/consensus"
+	"github.com/ChainSafe/gossamer/consensus/aura"
+	"github.com/ChainSafe/gossamer/consensus/babe"
+	"github.com/ChainSafe/gossamer/consensus/grandpa"
+	"github.com/ChainSafe/gossamer/consensus/manualseal"
 	"github.com/ChainSafe/gossamer/core"
+	"github.com/ChainSafe/gossamer/core/blocktree"
+	"github.com/ChainSafe/gossamer/core/types"
 	"github.com/ChainSafe/gossamer/dot"
 	"github.com/ChainSafe/gossamer/internal/api"
+	"github.com/ChainSafe/gossamer/internal/events"
 	"github.com/ChainSafe/gossamer/internal/services"
 	"github.com/ChainSafe/gossamer/p2p"
 	"github.com/ChainSafe/gossamer/polkadb"
@@ -77,27 +87,75 @@ func makeNode(ctx *cli.Context) (*dot.Dot, *cfg.Config, error) {
 		return nil, nil, err
 	}
 
-	log.Info("🕸\t Configuring node...", "datadir", fig.Global.DataDir, "protocolID", string(gendata.ProtocolId), "bootnodes", fig.P2p.BootstrapNodes)
+	weight, err := blockWeightFunc(fig.Consensus.Engine)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// BlockTree: rebuild the stored chain up to the block of the loaded state
+	bt, err := loadBlockTree(dbSrv.BlockDB, state, weight)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	genesisHash := bt.GenesisHash()
+	log.Info("🕸\t Configuring node...", "datadir", fig.Global.DataDir, "protocolID", string(gendata.ProtocolId), "bootnodes", fig.P2p.BootstrapNodes, "genesis", genesisHash.String())
+
+	// Event bus shared by the services
+	bus := events.NewBus()
+	bt.SetEventBus(bus)
 
-	// TODO: BABE
-	coreToP2p := make(chan []byte)
+	// Consensus: verifies imported blocks, and authors blocks if the node is an authority
+	engine, authoring, err := createConsensusEngine(ctx, fig, r, bt, dbSrv.StateDB.Db, bus)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// P2P
-	p2pSrvc, p2pToCore := createP2PService(fig, gendata)
+	p2pSrvc := createP2PService(fig, gendata, genesisHash, bus)
+	p2pSrvc.SetBlockSource(bt)
 	srvcs = append(srvcs, p2pSrvc)
 
 	// core.Service
-	coreSrvc := core.NewService(r, nil, p2pToCore, coreToP2p)
+	coreSrvc := core.NewService(r, engine, bus)
+	coreSrvc.SetBlockTree(bt)
+	if fig.TxPool.Journal {
+		journal := tx.NewJournal(filepath.Join(fig.Global.DataDir, tx.JournalFile), time.Duration(fig.TxPool.MaxAge)*time.Second)
+		coreSrvc.SetJournal(journal, time.Duration(fig.TxPool.JournalInterval)*time.Second)
+	}
+	coreSrvc.DependOn(dbSrv, p2pSrvc)
 	srvcs = append(srvcs, coreSrvc)
 
+	// block authoring publishes the blocks it authors to core and p2p
+	if authoring {
+		engine.DependOn(coreSrvc, p2pSrvc)
+		srvcs = append(srvcs, engine)
+	}
+
+	// GRANDPA: finalizes blocks, voting if the keystore holds the key of an authority
+	grandpaSrvc, err := createGrandpaService(ctx, fig, r, bt, bus)
+	if err != nil {
+		return nil, nil, err
+	}
+	if grandpaSrvc != nil {
+		grandpaSrvc.DependOn(coreSrvc, p2pSrvc)
+		srvcs = append(srvcs, grandpaSrvc)
+	}
+
 	// API
-	apiSrvc := api.NewApiService(p2pSrvc, nil)
+	apiSrvc := api.NewApiService(p2pSrvc, nil, bt)
+	if babeSession, ok := engine.(*babe.Session); ok {
+		apiSrvc.Api.BabeModule.Babe = babeSession
+	}
 	srvcs = append(srvcs, apiSrvc)
 
 	// RPC
 	rpcSrvr := startRpc(ctx, fig.Rpc, apiSrvc)
 
-	return dot.NewDot(string(gendata.Name), srvcs, rpcSrvr), fig, nil
+	node := dot.NewDot(string(gendata.Name), srvcs, rpcSrvr)
+	apiSrvc.Api.HealthModule.Health = node.Services
+
+	return node, fig, nil
 }
 
 func loadStateAndRuntime(t *trie.Trie) (*runtime.Runtime, error) {
@@ -111,7 +169,7 @@ func loadStateAndRuntime(t *trie.Trie) (*runtime.Runtime, error) {
 		return nil, fmt.Errorf("cannot load latest state: %s", err)
 	}
 
-	code, err := t.Get([]byte(":code"))
+	code, err := t.Get(runtime.CodeKey)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving :code from trie: %s", err)
 	}
@@ -119,6 +177,170 @@ func loadStateAndRuntime(t *trie.Trie) (*runtime.Runtime, error) {
 	return runtime.NewRuntime(code, t)
 }
 
+// loadBlockTree rebuilds the block tree from the chain stored in the block DB, up to the block whose state root is
+// the root of the loaded state trie. The blocks are weighted by the weight function of the consensus engine.
+func loadBlockTree(db *polkadb.BlockDB, state *trie.Trie, weight func(*types.BlockHeader) (uint64, error)) (*blocktree.BlockTree, error) {
+	root, err := state.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	bt, err := blocktree.LoadBlockTree(db, root, weight)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load block tree: %s", err)
+	}
+	return bt, nil
+}
+
+// consensusEngine is a consensus engine that runs as a node service once the services it publishes blocks to have
+// started
+type consensusEngine interface {
+	consensus.Engine
+	DependOn(srvcs ...services.Service)
+}
+
+// blockWeightFunc returns the function that weighs stored blocks like the configured consensus engine does
+func blockWeightFunc(engine string) (func(*types.BlockHeader) (uint64, error), error) {
+	switch engine {
+	case cfg.BabeEngine:
+		return babe.BlockWeight, nil
+	case cfg.AuraEngine, cfg.ManualSealEngine:
+		// the longest chain is the best one
+		return func(*types.BlockHeader) (uint64, error) { return 1, nil }, nil
+	default:
+		return nil, fmt.Errorf("unknown consensus engine %q, expected %s, %s or %s", engine, cfg.BabeEngine, cfg.AuraEngine, cfg.ManualSealEngine)
+	}
+}
+
+// createConsensusEngine creates the configured consensus engine, which builds on the block tree. It returns true if
+// the engine authors blocks, in which case it must run as a service.
+func createConsensusEngine(ctx *cli.Context, fig *cfg.Config, r *runtime.Runtime, bt *blocktree.BlockTree, db polkadb.Database, bus *events.Bus) (consensusEngine, bool, error) {
+	switch fig.Consensus.Engine {
+	case cfg.BabeEngine:
+		session, err := createBabeSession(ctx, fig, r, bt, db, bus)
+		if err != nil {
+			return nil, false, err
+		}
+		if session.IsAuthority() {
+			log.Info("🕸\t Running as a BABE authority")
+		}
+		return session, session.IsAuthority(), nil
+	case cfg.AuraEngine:
+		engine, err := createAuraEngine(ctx, fig, r, bt, bus)
+		if err != nil {
+			return nil, false, err
+		}
+		if engine.IsAuthority() {
+			log.Info("🕸\t Running as an Aura authority")
+		}
+		return engine, engine.IsAuthority(), nil
+	case cfg.ManualSealEngine:
+		engine, err := manualseal.NewEngine(r, bus)
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot create manual seal engine: %s", err)
+		}
+		engine.SetBlockTree(bt)
+		engine.SetInstantSeal(fig.Consensus.InstantSeal)
+		log.Info("🕸\t Running with manual seal", "instant", fig.Consensus.InstantSeal)
+		return engine, true, nil
+	default:
+		return nil, false, fmt.Errorf("unknown consensus engine %q", fig.Consensus.Engine)
+	}
+}
+
+// createAuraEngine creates an Aura engine that builds on the block tree. The engine authors blocks with the key of
+// an authority, if one is found in the keystore.
+func createAuraEngine(ctx *cli.Context, fig *cfg.Config, r *runtime.Runtime, bt *blocktree.BlockTree, bus *events.Bus) (*aura.Engine, error) {
+	engine, err := aura.NewEngine(nil, r, bus)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create Aura engine: %s", err)
+	}
+
+	engine.SetBlockTree(bt)
+	engine.SetGenesisTime(time.Unix(fig.Consensus.GenesisTime, 0))
+
+	var authorities [][]byte
+	for _, auth := range engine.Authorities() {
+		authorities = append(authorities, auth.Encode())
+	}
+
+	kp, err := unlockAuthorityKey(ctx, fig.Global.DataDir, authorities)
+	if err != nil {
+		return nil, err
+	}
+
+	if kp != nil {
+		engine.SetKeypair(kp)
+	}
+
+	return engine, nil
+}
+
+// createBabeSession creates a BABE session that builds on the block tree and persists its epoch state to the
+// database. The session authors blocks with the key of a genesis authority, if one is found in the keystore.
+func createBabeSession(ctx *cli.Context, fig *cfg.Config, r *runtime.Runtime, bt *blocktree.BlockTree, db polkadb.Database, bus *events.Bus) (*babe.Session, error) {
+	session, err := babe.NewSession(nil, r, bus)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create BABE session: %s", err)
+	}
+
+	session.SetBlockTree(bt)
+	session.SetGenesisTime(time.Unix(fig.Consensus.GenesisTime, 0))
+	err = session.SetEpochDB(db)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load BABE epoch state: %s", err)
+	}
+
+	var authorities [][]byte
+	for _, auth := range session.Epoch().Authorities {
+		authorities = append(authorities, append([]byte{}, auth.AuthorityId[:]...))
+	}
+
+	kp, err := unlockAuthorityKey(ctx, fig.Global.DataDir, authorities)
+	if err != nil {
+		return nil, err
+	}
+
+	if kp != nil {
+		session.SetKeypair(kp)
+	}
+
+	return session, nil
+}
+
+// createGrandpaService creates a GRANDPA service that finalizes blocks of the block tree, voting with the key of
+// an authority if one is found in the keystore. It returns nil if the runtime defines no GRANDPA authorities.
+func createGrandpaService(ctx *cli.Context, fig *cfg.Config, r *runtime.Runtime, bt *blocktree.BlockTree, bus *events.Bus) (*grandpa.Service, error) {
+	srvc, err := grandpa.NewService(&grandpa.Config{
+		BlockTree: bt,
+		Runtime:   r,
+		Bus:       bus,
+	})
+	if err == grandpa.ErrNoAuthorities {
+		log.Warn("runtime has no GRANDPA authorities, blocks will not be finalized")
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot create GRANDPA service: %s", err)
+	}
+
+	var authorities [][]byte
+	for _, auth := range srvc.Authorities() {
+		authorities = append(authorities, auth.Key.Encode())
+	}
+
+	kp, err := unlockGrandpaKey(ctx, fig.Global.DataDir, authorities)
+	if err != nil {
+		return nil, err
+	}
+
+	if kp != nil {
+		log.Info("🕸\t Running as a GRANDPA voter")
+		srvc.SetKeypair(kp)
+	}
+
+	return srvc, nil
+}
+
 // getConfig checks for config.toml if --config flag is specified and sets CLI flags
 func getConfig(ctx *cli.Context) (*cfg.Config, error) {
 	fig := cfg.DefaultConfig()
@@ -135,6 +357,7 @@ func getConfig(ctx *cli.Context) (*cfg.Config, error) {
 	setGlobalConfig(ctx, &fig.Global)
 	setP2pConfig(ctx, &fig.P2p)
 	setRpcConfig(ctx, &fig.Rpc)
+	setConsensusConfig(ctx, &fig.Consensus)
 	return fig, nil
 }
 
@@ -184,7 +407,7 @@ func setP2pConfig(ctx *cli.Context, fig *cfg.P2pCfg) {
 }
 
 // createP2PService starts a p2p network layer from provided config
-func createP2PService(fig *cfg.Config, gendata *genesis.GenesisData) (*p2p.Service, chan []byte) {
+func createP2PService(fig *cfg.Config, gendata *genesis.GenesisData, genesisHash common.Hash, bus *events.Bus) *p2p.Service {
 	config := p2p.Config{
 		BootstrapNodes: append(fig.P2p.BootstrapNodes, common.BytesToStringArray(gendata.Bootnodes)...),
 		Port:           fig.P2p.Port,
@@ -193,15 +416,28 @@ func createP2PService(fig *cfg.Config, gendata *genesis.GenesisData) (*p2p.Servi
 		NoMdns:         fig.P2p.NoMdns,
 		DataDir:        fig.Global.DataDir,
 		ProtocolId:     string(gendata.ProtocolId),
-	}
+		GenesisHash:    genesisHash,
 
-	msgChan := make(chan []byte)
+		TxGossipInterval:  time.Duration(fig.P2p.TxGossipInterval) * time.Millisecond,
+		TxGossipBatchSize: int(fig.P2p.TxGossipBatchSize),
+		TxReceiveLimit:    int(fig.P2p.TxReceiveLimit),
+	}
 
-	srvc, err := p2p.NewService(&config, msgChan, nil)
+	srvc, err := p2p.NewService(&config, bus)
 	if err != nil {
 		log.Error("error starting p2p", "err", err.Error())
 	}
-	return srvc, msgChan
+	return srvc
+}
+
+func setConsensusConfig(ctx *cli.Context, fig *cfg.ConsensusCfg) {
+	if engine := ctx.GlobalString(utils.ConsensusFlag.Name); engine != "" {
+		fig.Engine = engine
+	}
+
+	if ctx.GlobalBool(utils.InstantSealFlag.Name) {
+		fig.InstantSeal = true
+	}
 }
 
 func setRpcConfig(ctx *cli.Context, fig *cfg.RpcCfg) {
@@ -29,9 +29,11 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/ChainSafe/gossamer/common"
 	cfg "github.com/ChainSafe/gossamer/config"
 	"github.com/ChainSafe/gossamer/config/genesis"
 	"github.com/ChainSafe/gossamer/internal/api"
+	"github.com/ChainSafe/gossamer/internal/events"
 	"github.com/ChainSafe/gossamer/polkadb"
 	log "github.com/ChainSafe/log15"
 	"github.com/urfave/cli"
@@ -248,7 +250,7 @@ func TestCreateP2PService(t *testing.T) {
 		ProtocolId: "gossamer",
 	}
 
-	srv, _ := createP2PService(cfg.DefaultConfig(), gendata)
+	srv := createP2PService(cfg.DefaultConfig(), gendata, common.Hash{}, events.NewBus())
 
 	if srv == nil {
 		t.Fatalf("failed to create p2p service")
@@ -382,6 +384,48 @@ func TestSetRpcConfig(t *testing.T) {
 	}
 }
 
+func TestSetConsensusConfig(t *testing.T) {
+	tc := []struct {
+		description string
+		flags       []string
+		values      []interface{}
+		expected    cfg.ConsensusCfg
+	}{
+		{
+			"default",
+			[]string{},
+			[]interface{}{},
+			cfg.DefaultConsensusConfig,
+		},
+		{
+			"manual seal",
+			[]string{"consensus", "instant-seal"},
+			[]interface{}{"manual-seal", true},
+			cfg.ConsensusCfg{
+				Engine:      cfg.ManualSealEngine,
+				InstantSeal: true,
+			},
+		},
+	}
+
+	for _, c := range tc {
+		c := c // bypass scopelint false positive
+		t.Run(c.description, func(t *testing.T) {
+			context, err := createCliContext(c.description, c.flags, c.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			input := cfg.DefaultConfig()
+			setConsensusConfig(context, &input.Consensus)
+
+			if !reflect.DeepEqual(input.Consensus, c.expected) {
+				t.Fatalf("\ngot %+v\nexpected %+v", input.Consensus, c.expected)
+			}
+		})
+	}
+}
+
 func TestStrToMods(t *testing.T) {
 	strs := []string{"test1", "test2"}
 	mods := strToMods(strs)
@@ -410,6 +454,8 @@ func TestMakeNode(t *testing.T) {
 		{"node from config (norpc)", []string{"config", "genesis"}, []interface{}{tempFile.Name(), genesispath}, cfgClone},
 		{"default node (norpc)", []string{"genesis"}, []interface{}{genesispath}, cfgClone},
 		{"default node (rpc)", []string{"rpc", "genesis"}, []interface{}{true, genesispath}, cfgClone},
+		{"aura node", []string{"consensus", "genesis"}, []interface{}{"aura", genesispath}, cfgClone},
+		{"manual seal node", []string{"consensus", "genesis"}, []interface{}{"manual-seal", genesispath}, cfgClone},
 	}
 
 	for _, c := range tc {
@@ -2,11 +2,14 @@ package main
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/ChainSafe/gossamer/cmd/utils"
 	"github.com/ChainSafe/gossamer/common"
 	cfg "github.com/ChainSafe/gossamer/config"
 	"github.com/ChainSafe/gossamer/config/genesis"
+	"github.com/ChainSafe/gossamer/core/rawdb"
+	"github.com/ChainSafe/gossamer/core/types"
 	"github.com/ChainSafe/gossamer/polkadb"
 	"github.com/ChainSafe/gossamer/trie"
 	log "github.com/ChainSafe/log15"
@@ -71,10 +74,51 @@ func loadGenesis(ctx *cli.Context) error {
 		return fmt.Errorf("cannot store genesis hash in db: %s", err)
 	}
 
+	// create genesis block from the initial state and write it to the block DB
+	err = storeGenesisBlock(dbSrv.BlockDB, t)
+	if err != nil {
+		return fmt.Errorf("cannot store genesis block in db: %s", err)
+	}
+
 	// store node name, ID, p2p protocol, bootnodes in DB
 	return t.Db().StoreGenesisData(gen)
 }
 
+// storeGenesisBlock creates the genesis header using the genesis state root and an empty extrinsics root,
+// then stores it in the block DB along with the genesis hash
+func storeGenesisBlock(db *polkadb.BlockDB, t *trie.Trie) error {
+	stateRoot, err := t.Hash()
+	if err != nil {
+		return err
+	}
+
+	extrinsicsRoot, err := trie.NewEmptyTrie(nil).Hash()
+	if err != nil {
+		return err
+	}
+
+	header, err := types.NewHeader(common.Hash{}, big.NewInt(0), stateRoot, extrinsicsRoot, []byte{})
+	if err != nil {
+		return err
+	}
+
+	rawdb.SetHeader(db.Db, header)
+	rawdb.SetBlockData(db.Db, &types.BlockData{
+		Hash:   header.Hash,
+		Header: header,
+		Body:   &types.BlockBody{},
+	})
+
+	err = rawdb.SetBlockHash(db.Db, header.Number, header.Hash)
+	if err != nil {
+		return err
+	}
+
+	log.Info("🕸\t Created genesis block", "hash", header.Hash.String(), "stateRoot", stateRoot.String())
+
+	return rawdb.SetGenesisHash(db.Db, header.Hash)
+}
+
 // getGenesisPath gets the path to the genesis file
 func getGenesisPath(ctx *cli.Context) string {
 	if file := ctx.GlobalString(utils.GenesisFlag.Name); file != "" {
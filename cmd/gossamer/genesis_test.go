@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"flag"
+	"math/big"
 	"os"
 	"reflect"
 	"testing"
@@ -10,6 +11,7 @@ import (
 	"github.com/ChainSafe/gossamer/common"
 	"github.com/ChainSafe/gossamer/config/genesis"
 	"github.com/ChainSafe/gossamer/core"
+	"github.com/ChainSafe/gossamer/core/rawdb"
 	"github.com/ChainSafe/gossamer/dot"
 	"github.com/ChainSafe/gossamer/polkadb"
 	"github.com/ChainSafe/gossamer/trie"
@@ -99,6 +101,13 @@ func TestGenesisStateLoading(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	defer func() {
+		err = d.Services.Get(&polkadb.DbService{}).Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
 	if reflect.TypeOf(d) != reflect.TypeOf(&dot.Dot{}) {
 		t.Fatalf("failed to return correct type: got %v expected %v", reflect.TypeOf(d), reflect.TypeOf(&dot.Dot{}))
 	}
@@ -125,3 +134,82 @@ func TestGenesisStateLoading(t *testing.T) {
 		t.Fatalf("Fail: got %x expected %x", stateRoot, expectedRoot)
 	}
 }
+
+func TestStoreGenesisBlock(t *testing.T) {
+	tempFile, _ := createTempConfigFile()
+	defer teardown(tempFile)
+	defer removeTestDataDir()
+
+	genesispath := createTempGenesisFile(t)
+	defer os.Remove(genesispath)
+
+	set := flag.NewFlagSet("config", 0)
+	set.String("config", tempFile.Name(), "TOML configuration file")
+	set.String("genesis", genesispath, "genesis file")
+	ctx := cli.NewContext(nil, set, nil)
+
+	err := loadGenesis(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fig, err := getConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbSrv, err := polkadb.NewDbService(fig.Global.DataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dbSrv.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer dbSrv.Stop()
+
+	genesisHash, err := rawdb.GetGenesisHash(dbSrv.BlockDB.Db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := rawdb.GetBlockHash(dbSrv.BlockDB.Db, big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != genesisHash {
+		t.Fatalf("Fail: got %x expected %x", hash, genesisHash)
+	}
+
+	header := rawdb.GetHeader(dbSrv.BlockDB.Db, genesisHash)
+	if header.Number.Cmp(big.NewInt(0)) != 0 {
+		t.Fatalf("Fail: got genesis number %d expected 0", header.Number)
+	}
+
+	expected := &trie.Trie{}
+	err = expected.Load(tmpGenesis.Genesis.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedRoot, err := expected.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.StateRoot != expectedRoot {
+		t.Fatalf("Fail: got state root %x expected %x", header.StateRoot, expectedRoot)
+	}
+
+	computed, err := header.CalculateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if computed != genesisHash {
+		t.Fatalf("Fail: got header hash %x expected %x", computed, genesisHash)
+	}
+}
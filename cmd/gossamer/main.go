@@ -17,8 +17,11 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 
 	"github.com/ChainSafe/gossamer/cmd/utils"
 	log "github.com/ChainSafe/log15"
@@ -37,6 +40,10 @@ var (
 		utils.NoBootstrapFlag,
 		utils.NoMdnsFlag,
 	}
+	consensusFlags = []cli.Flag{
+		utils.ConsensusFlag,
+		utils.InstantSealFlag,
+	}
 	rpcFlags = []cli.Flag{
 		utils.RpcEnabledFlag,
 		utils.RpcHostFlag,
@@ -49,6 +56,11 @@ var (
 	cliFlags = []cli.Flag{
 		utils.VerbosityFlag,
 	}
+	authorityFlags = []cli.Flag{
+		utils.UnlockFlag,
+		utils.PasswordFlag,
+		utils.PasswordFileFlag,
+	}
 	accountFlags = []cli.Flag{
 		utils.GenerateFlag,
 		utils.Sr25519Flag,
@@ -112,9 +124,11 @@ func init() {
 	}
 	app.Flags = append(app.Flags, nodeFlags...)
 	app.Flags = append(app.Flags, p2pFlags...)
+	app.Flags = append(app.Flags, consensusFlags...)
 	app.Flags = append(app.Flags, rpcFlags...)
 	app.Flags = append(app.Flags, genesisFlags...)
 	app.Flags = append(app.Flags, cliFlags...)
+	app.Flags = append(app.Flags, authorityFlags...)
 }
 
 func main() {
@@ -169,7 +183,24 @@ func gossamer(ctx *cli.Context) error {
 	}
 
 	log.Info("🕸️\t Starting node...", "name", node.Name)
-	node.Start()
+	err = node.Start(context.Background())
+	if err != nil {
+		log.Error("error starting node", "err", err)
+		return err
+	}
+
+	go func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigc)
+		<-sigc
+		log.Info("Got interrupt, shutting down...")
+		err := node.Stop()
+		if err != nil {
+			log.Error("error stopping node", "err", err)
+		}
+	}()
 
+	node.Wait()
 	return nil
 }
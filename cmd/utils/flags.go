@@ -72,6 +72,18 @@ var (
 	}
 )
 
+// Consensus flags
+var (
+	ConsensusFlag = cli.StringFlag{
+		Name:  "consensus",
+		Usage: "Consensus engine used to author and verify blocks: babe, aura or manual-seal",
+	}
+	InstantSealFlag = cli.BoolFlag{
+		Name:  "instant-seal",
+		Usage: "Author a block for every imported transaction. Used with --consensus=manual-seal",
+	}
+)
+
 // RPC flags
 var (
 	RpcEnabledFlag = cli.BoolFlag{
@@ -118,5 +130,12 @@ var (
 		Name:  "sr25519",
 		Usage: "Specify account type as sr25519",
 	}
-	// TODO: account unlocking
+	UnlockFlag = cli.StringFlag{
+		Name:  "unlock",
+		Usage: "Public key of the keystore key used to author BABE blocks. Defaults to any key of a genesis authority",
+	}
+	PasswordFileFlag = cli.StringFlag{
+		Name:  "password-file",
+		Usage: "File containing the password used to unlock the keystore",
+	}
 )
@@ -261,6 +261,10 @@ func (sd *Decoder) DecodeByteArray() (o []byte, err error) {
 	}
 
 	b := make([]byte, length)
+	if length == 0 {
+		return b, nil
+	}
+
 	_, err = sd.Reader.Read(b)
 	if err != nil {
 		return nil, errors.New("could not decode invalid byte array: reached early EOF")
@@ -0,0 +1,217 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package transaction
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	scale "github.com/ChainSafe/gossamer/codec"
+	"github.com/ChainSafe/gossamer/core/types"
+	log "github.com/ChainSafe/log15"
+)
+
+// JournalFile is the name of the transaction journal in the data directory
+const JournalFile = "txpool.journal"
+
+// journalVersion is written at the start of the journal, so the format can be changed later
+const journalVersion = 0
+
+// Journal saves the transactions in a pool to a file, so they can be re-validated and re-imported after a restart
+type Journal struct {
+	path   string
+	maxAge time.Duration
+}
+
+// journalEntry is a transaction stored in the journal
+type journalEntry struct {
+	ext      types.Extrinsic
+	imported time.Time
+}
+
+// NewJournal creates a journal stored at the given path. Transactions first imported more than maxAge ago are
+// not restored, if maxAge is not 0.
+func NewJournal(path string, maxAge time.Duration) *Journal {
+	return &Journal{
+		path:   path,
+		maxAge: maxAge,
+	}
+}
+
+// Save writes the ready and future transactions of the pool to the journal, replacing its previous contents
+func (j *Journal) Save(p *Pool) error {
+	p.lock.RLock()
+	ptxs := p.all()
+	p.lock.RUnlock()
+	sortByInsertion(ptxs)
+
+	// write to a temporary file first, so the journal is never left half written
+	tmp, err := ioutil.TempFile(filepath.Dir(j.path), JournalFile)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	err = w.WriteByte(journalVersion)
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	for _, ptx := range ptxs {
+		err = writeJournalEntry(w, &journalEntry{ext: *ptx.tx.Extrinsic, imported: ptx.imported})
+		if err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), j.path)
+}
+
+// Restore re-validates the transactions in the journal and imports the valid ones into the pool, keeping the
+// time they were first imported at. It returns the number of transactions imported.
+func (j *Journal) Restore(p *Pool, validate ValidateFunc) (int, error) {
+	entries, err := j.load()
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	for _, entry := range entries {
+		if j.maxAge != 0 && p.now().Sub(entry.imported) > j.maxAge {
+			continue
+		}
+
+		validity, err := validate(entry.ext)
+		if err != nil {
+			log.Debug("dropping invalid journaled transaction", "error", err)
+			continue
+		}
+
+		ext := entry.ext
+		_, err = p.importAt(NewValidTransaction(&ext, validity), entry.imported)
+		if err != nil {
+			log.Debug("failed to import journaled transaction", "error", err)
+			continue
+		}
+		imported++
+	}
+
+	return imported, nil
+}
+
+// load reads the entries in the journal. A missing journal has no entries. If an entry is corrupt, the entries
+// before it are kept, and the journal is truncated there.
+func (j *Journal) load() ([]*journalEntry, error) {
+	data, err := ioutil.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if data[0] != journalVersion {
+		return nil, fmt.Errorf("unsupported transaction journal version %d", data[0])
+	}
+
+	r := bytes.NewReader(data[1:])
+	var entries []*journalEntry
+	for r.Len() > 0 {
+		offset := int64(len(data) - r.Len())
+		entry, err := readJournalEntry(r)
+		if err != nil {
+			log.Warn("[txpool] dropping corrupt transaction journal entries", "offset", offset, "restored", len(entries), "error", err)
+			err = os.Truncate(j.path, offset)
+			if err != nil {
+				log.Error("[txpool] cannot truncate transaction journal", "error", err)
+			}
+			break
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// writeJournalEntry writes the SCALE encoded extrinsic followed by its import time in unix nanoseconds
+func writeJournalEntry(w io.Writer, entry *journalEntry) error {
+	enc, err := scale.Encode([]byte(entry.ext))
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(entry.imported.UnixNano()))
+
+	_, err = w.Write(append(enc, buf...))
+	return err
+}
+
+// readJournalEntry reads an entry written by writeJournalEntry
+func readJournalEntry(r *bytes.Reader) (*journalEntry, error) {
+	sd := scale.Decoder{Reader: r}
+	length, err := sd.DecodeInteger()
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 || length > MaxTransactionSize {
+		return nil, fmt.Errorf("invalid extrinsic length %d in transaction journal", length)
+	}
+
+	// read the extrinsic and its import time
+	if int64(r.Len()) < length+8 {
+		return nil, errors.New("transaction journal is truncated")
+	}
+	buf := make([]byte, length+8)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := types.Extrinsic(buf[:length])
+	buf = buf[length:]
+
+	return &journalEntry{
+		ext:      ext,
+		imported: time.Unix(0, int64(binary.LittleEndian.Uint64(buf))),
+	}, nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package transaction
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/gossamer/core/types"
+)
+
+// newTestJournal creates a journal in a temporary directory, which should be removed by the caller
+func newTestJournal(t *testing.T, maxAge time.Duration) (*Journal, string) {
+	dir, err := ioutil.TempDir(os.TempDir(), "journal-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewJournal(filepath.Join(dir, JournalFile), maxAge), dir
+}
+
+func TestJournal_SaveRestore(t *testing.T) {
+	j, dir := newTestJournal(t, 0)
+	defer os.RemoveAll(dir)
+	p := NewPool(nil)
+
+	// a is waiting for b's tag, and c is long enough to need a multi-byte length prefix
+	a := newTestTransaction([]byte{1}, 1, [][]byte{{0xb}}, nil)
+	b := newTestTransaction([]byte{2}, 1, nil, [][]byte{{0xb}})
+	c := newTestTransaction(make([]byte, 300), 2, nil, nil)
+
+	for _, vt := range []*ValidTransaction{a, b, c} {
+		_, err := p.Import(vt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := j.Save(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validate := func(ext types.Extrinsic) (*Validity, error) {
+		switch ext[0] {
+		case 1:
+			return a.Validity, nil
+		case 2:
+			return b.Validity, nil
+		default:
+			return c.Validity, nil
+		}
+	}
+
+	restored := NewPool(nil)
+	n, err := j.Restore(restored, validate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("Fail: restored %d transactions expected 3", n)
+	}
+
+	if res, expected := restored.Ready(), p.Ready(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+}
+
+func TestJournal_RestoreMaxAge(t *testing.T) {
+	j, dir := newTestJournal(t, time.Hour)
+	defer os.RemoveAll(dir)
+	p := NewPool(nil)
+
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	a := newTestTransaction([]byte{1}, 1, nil, nil)
+	_, err := p.Import(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(30 * time.Minute)
+	b := newTestTransaction([]byte{2}, 1, nil, nil)
+	_, err = p.Import(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestTransaction([]byte{3}, 1, nil, nil)
+	_, err = p.Import(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.Save(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validate := func(ext types.Extrinsic) (*Validity, error) {
+		if ext[0] == 3 {
+			return nil, errors.New("invalid transaction")
+		}
+		return NewValidity(1, nil, nil, 64, true), nil
+	}
+
+	// a is too old to be restored, and c is no longer valid
+	restored := NewPool(nil)
+	restored.now = func() time.Time { return now.Add(45 * time.Minute) }
+
+	n, err := j.Restore(restored, validate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("Fail: restored %d transactions expected 1", n)
+	}
+
+	ready := restored.Ready()
+	if len(ready) != 1 || !reflect.DeepEqual(ready[0].Extrinsic, b.Extrinsic) {
+		t.Fatalf("Fail: got %v expected %v", ready, []*ValidTransaction{b})
+	}
+
+	// b keeps the time it was first imported at, so it expires at the same time after another restart
+	err = j.Save(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored = NewPool(nil)
+	restored.now = func() time.Time { return now.Add(2 * time.Hour) }
+
+	n, err = j.Restore(restored, validate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("Fail: restored %d transactions expected 0", n)
+	}
+}
+
+func TestJournal_RestoreMissing(t *testing.T) {
+	j, dir := newTestJournal(t, 0)
+	defer os.RemoveAll(dir)
+
+	n, err := j.Restore(NewPool(nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("Fail: restored %d transactions expected 0", n)
+	}
+}
+
+func TestJournal_RestoreCorrupt(t *testing.T) {
+	for _, corrupt := range [][]byte{
+		{0x13, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, // length prefix of 2^64-1 bytes
+		{0x10, 1, 2}, // entry cut short
+	} {
+		j, dir := newTestJournal(t, 0)
+		defer os.RemoveAll(dir)
+
+		p := NewPool(nil)
+		a := newTestTransaction([]byte{1}, 1, nil, nil)
+		_, err := p.Import(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = j.Save(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(j.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write(corrupt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the entry before the corrupt one is restored, and the journal is truncated at the corrupt entry
+		n, err := j.Restore(NewPool(nil), func(types.Extrinsic) (*Validity, error) { return a.Validity, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("Fail: restored %d transactions expected 1", n)
+		}
+
+		res, err := os.Stat(j.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Size() != info.Size() {
+			t.Fatalf("Fail: got journal size %d expected %d", res.Size(), info.Size())
+		}
+	}
+}
@@ -0,0 +1,731 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package transaction
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/core/types"
+)
+
+var (
+	// ErrAlreadyImported is returned when a transaction with the same extrinsic hash is already in the pool
+	ErrAlreadyImported = errors.New("transaction is already in the pool")
+	// ErrTooLowPriority is returned when a ready transaction providing the same tag has a higher or equal priority
+	ErrTooLowPriority = errors.New("transaction priority is too low to replace the transaction providing the same tag")
+	// ErrPoolFull is returned when the pool is full and the transaction has a lower priority than all others
+	ErrPoolFull = errors.New("transaction pool is full")
+	// ErrBanned is returned when a transaction has recently been found to be invalid
+	ErrBanned = errors.New("transaction is temporarily banned")
+	// ErrTooLarge is returned when a transaction's extrinsic is larger than MaxTransactionSize
+	ErrTooLarge = errors.New("transaction is too large")
+)
+
+// MaxTransactionSize is the size of the largest extrinsic the pool accepts, in bytes
+const MaxTransactionSize = 5 * 1024 * 1024
+
+// PoolConfig limits the size of a transaction pool
+type PoolConfig struct {
+	MaxReady       int           // maximum number of ready transactions
+	MaxReadyBytes  int           // maximum total size of the ready transactions' extrinsics
+	MaxFuture      int           // maximum number of future transactions
+	MaxFutureBytes int           // maximum total size of the future transactions' extrinsics
+	BanTime        time.Duration // time for which invalid transactions are rejected without being validated
+	MaxBanned      int           // maximum number of banned transactions, the oldest bans are lifted first
+}
+
+// DefaultPoolConfig is used when no pool config is provided
+var DefaultPoolConfig = PoolConfig{
+	MaxReady:       8192,
+	MaxReadyBytes:  20 * 1024 * 1024,
+	MaxFuture:      512,
+	MaxFutureBytes: 1024 * 1024,
+	BanTime:        30 * time.Minute,
+	MaxBanned:      16384,
+}
+
+// poolTx is a transaction stored in the pool
+type poolTx struct {
+	tx        *ValidTransaction
+	hash      common.Hash
+	insertion uint64    // insertion order, used to break ties between transactions with the same priority
+	validTill uint64    // last block number at which the transaction is valid
+	imported  time.Time // time the transaction was first imported, kept across restarts by the journal
+}
+
+// item returns the transaction as an item of a priority heap
+func (ptx *poolTx) item() *item {
+	return &item{
+		tx:    ptx.tx,
+		hash:  ptx.hash,
+		order: ptx.insertion,
+	}
+}
+
+func (ptx *poolTx) size() int {
+	return len(*ptx.tx.Extrinsic)
+}
+
+// ban is a banned transaction with the time its ban expires
+type ban struct {
+	hash  common.Hash
+	until time.Time
+}
+
+// ValidateFunc validates an extrinsic against the current state
+type ValidateFunc func(ext types.Extrinsic) (*Validity, error)
+
+// Pool is a transaction pool that resolves the dependencies between transactions using the tags in their Validity.
+// Transactions whose required tags are all provided by ready transactions (or by none, if they require nothing)
+// are ready to be included in a block; the rest wait in the future queue until their required tags are provided.
+type Pool struct {
+	lock      sync.RWMutex
+	config    PoolConfig
+	insertion uint64
+	number    uint64 // number of the latest block the pool has been pruned at
+
+	ready       map[common.Hash]*poolTx
+	readyBytes  int
+	future      map[common.Hash]*poolTx
+	futureBytes int
+
+	provided   map[string]common.Hash             // tags provided by ready transactions, mapped to the provider's hash
+	onChain    map[string]uint64                  // tags provided by transactions included in blocks, mapped to the block number
+	requiredBy map[string]map[common.Hash]*poolTx // ready and future transactions, indexed by their required tags
+
+	banned map[common.Hash]time.Time // banned transactions, mapped to the time their ban expires
+	bans   []ban                     // bans in the order they were made, which is the order they expire in
+	now    func() time.Time
+}
+
+// NewPool creates an empty transaction pool. If cfg is nil, DefaultPoolConfig is used.
+func NewPool(cfg *PoolConfig) *Pool {
+	if cfg == nil {
+		cfg = &DefaultPoolConfig
+	}
+
+	return &Pool{
+		config:     *cfg,
+		ready:      make(map[common.Hash]*poolTx),
+		future:     make(map[common.Hash]*poolTx),
+		provided:   make(map[string]common.Hash),
+		onChain:    make(map[string]uint64),
+		requiredBy: make(map[string]map[common.Hash]*poolTx),
+		banned:     make(map[common.Hash]time.Time),
+		now:        time.Now,
+	}
+}
+
+// Import adds a validated transaction to the pool and returns its hash. The transaction is added to the ready
+// queue if all of its required tags are provided, otherwise it is added to the future queue. Importing a
+// ready transaction promotes any future transactions that were waiting for its tags. If the pool is full, the
+// lowest priority transactions are evicted.
+func (p *Pool) Import(vt *ValidTransaction) (common.Hash, error) {
+	return p.importAt(vt, time.Time{})
+}
+
+// importAt imports a transaction that was first imported at the given time, or now if it is zero
+func (p *Pool) importAt(vt *ValidTransaction, imported time.Time) (common.Hash, error) {
+	if len(*vt.Extrinsic) > MaxTransactionSize {
+		return common.Hash{}, ErrTooLarge
+	}
+
+	hash, err := common.Blake2bHash(*vt.Extrinsic)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.isBanned(hash) {
+		return hash, ErrBanned
+	}
+
+	if p.ready[hash] != nil || p.future[hash] != nil {
+		return hash, ErrAlreadyImported
+	}
+
+	ptx := &poolTx{
+		tx:        vt,
+		hash:      hash,
+		insertion: p.insertion,
+		validTill: p.validTill(vt.Validity),
+		imported:  imported,
+	}
+	p.insertion++
+
+	if ptx.imported.IsZero() {
+		ptx.imported = p.now()
+	}
+
+	p.index(ptx)
+	if !p.satisfied(ptx) {
+		p.addFuture(ptx)
+	} else {
+		err = p.importReady(ptx)
+		if err != nil {
+			p.unindex(ptx)
+			return hash, err
+		}
+		p.promote(p.dependents(ptx.tx.Validity.Provides))
+	}
+
+	p.enforceLimits()
+	if p.ready[hash] == nil && p.future[hash] == nil {
+		return hash, ErrPoolFull
+	}
+
+	return hash, nil
+}
+
+// Remove removes the transaction with the given hash from the pool. Ready transactions that depended on tags
+// provided only by the removed transaction are moved back to the future queue.
+func (p *Pool) Remove(hash common.Hash) *ValidTransaction {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	ptx := p.get(hash)
+	if ptx == nil {
+		return nil
+	}
+
+	p.remove(ptx)
+	return ptx.tx
+}
+
+// Ban rejects the transactions with the given hashes without validating them until the ban time has passed,
+// and removes them from the pool
+func (p *Pool) Ban(hashes ...common.Hash) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.ban(hashes)
+	for _, hash := range hashes {
+		if ptx := p.get(hash); ptx != nil {
+			p.remove(ptx)
+		}
+	}
+}
+
+// IsBanned returns true if the transaction with the given hash is banned
+func (p *Pool) IsBanned(hash common.Hash) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.isBanned(hash)
+}
+
+// PruneBlock removes the transactions included in the block with the given number, and the transactions whose
+// longevity has expired at that block. The tags provided by the included transactions are treated as provided
+// until the pool is revalidated against a state that includes them. It returns the hashes of the removed transactions.
+func (p *Pool) PruneBlock(number uint64, exts []types.Extrinsic) ([]common.Hash, error) {
+	included := make([]common.Hash, len(exts))
+	for i, ext := range exts {
+		hash, err := common.Blake2bHash(ext)
+		if err != nil {
+			return nil, err
+		}
+		included[i] = hash
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if number > p.number {
+		p.number = number
+	}
+
+	p.pruneBans(p.now())
+
+	var removed []common.Hash
+	var onChain [][]byte
+	for _, hash := range included {
+		ptx := p.get(hash)
+		if ptx == nil {
+			continue
+		}
+
+		for _, tag := range ptx.tx.Validity.Provides {
+			p.onChain[string(tag)] = number
+		}
+		onChain = append(onChain, ptx.tx.Validity.Provides...)
+
+		p.remove(ptx)
+		removed = append(removed, hash)
+	}
+
+	var expired []*poolTx
+	for _, set := range []map[common.Hash]*poolTx{p.ready, p.future} {
+		for _, ptx := range set {
+			if ptx.validTill < number {
+				expired = append(expired, ptx)
+			}
+		}
+	}
+
+	for _, ptx := range expired {
+		// removing an expired transaction may have already removed another one
+		if p.get(ptx.hash) != nil {
+			p.remove(ptx)
+			removed = append(removed, ptx.hash)
+		}
+	}
+
+	// transactions depending on included transactions may now be ready
+	p.promote(p.dependents(onChain))
+	return removed, nil
+}
+
+// Revalidate re-runs validation for every transaction in the pool and re-imports them with their new validity,
+// dropping and banning those that are no longer valid. Validation is done without holding the pool's lock, so
+// transactions imported in the meantime are kept as they are. Tags provided by transactions included up to the
+// given block number are forgotten, since the new validity reflects them. It returns the hashes of the dropped
+// transactions.
+func (p *Pool) Revalidate(number uint64, validate ValidateFunc) []common.Hash {
+	p.lock.RLock()
+	snapshot := p.all()
+	p.lock.RUnlock()
+
+	validities := make(map[common.Hash]*Validity)
+	var invalid []common.Hash
+	for _, ptx := range snapshot {
+		validity, err := validate(*ptx.tx.Extrinsic)
+		if err != nil {
+			invalid = append(invalid, ptx.hash)
+			continue
+		}
+		validities[ptx.hash] = validity
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for tag, included := range p.onChain {
+		if included <= number {
+			delete(p.onChain, tag)
+		}
+	}
+
+	var dropped []common.Hash
+	for _, hash := range invalid {
+		if p.get(hash) != nil {
+			dropped = append(dropped, hash)
+		}
+	}
+	p.ban(invalid)
+
+	// rebuild the pool from scratch, in the original insertion order
+	all := p.all()
+	sortByInsertion(all)
+
+	p.ready = make(map[common.Hash]*poolTx)
+	p.readyBytes = 0
+	p.future = make(map[common.Hash]*poolTx)
+	p.futureBytes = 0
+	p.provided = make(map[string]common.Hash)
+	p.requiredBy = make(map[string]map[common.Hash]*poolTx)
+
+	for _, ptx := range all {
+		if p.isBanned(ptx.hash) {
+			continue
+		}
+
+		if validity, ok := validities[ptx.hash]; ok {
+			ptx.tx.Validity = validity
+			ptx.validTill = p.validTill(validity)
+		}
+
+		p.index(ptx)
+		p.addFuture(ptx)
+	}
+
+	p.promote(p.all())
+	p.enforceLimits()
+	return dropped
+}
+
+// Get returns the transaction with the given hash, if it is in the pool
+func (p *Pool) Get(hash common.Hash) *ValidTransaction {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if ptx := p.get(hash); ptx != nil {
+		return ptx.tx
+	}
+	return nil
+}
+
+// Ready returns the ready transactions in the order they should be included in a block: a transaction is only
+// returned after the transactions providing its required tags, and otherwise higher priority transactions come first.
+func (p *Pool) Ready() []*ValidTransaction {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	// number of each transaction's required tags that are provided by another ready transaction
+	waiting := make(map[common.Hash]int)
+
+	// ready transactions whose required tags have all been returned, ordered by priority
+	candidates := make(priorityHeap, 0, len(p.ready))
+	for _, ptx := range p.ready {
+		for _, tag := range ptx.tx.Validity.Requires {
+			if _, ok := p.provided[string(tag)]; ok {
+				waiting[ptx.hash]++
+			}
+		}
+		if waiting[ptx.hash] == 0 {
+			candidates = append(candidates, ptx.item())
+		}
+	}
+	heap.Init(&candidates)
+
+	txs := make([]*ValidTransaction, 0, len(p.ready))
+	for candidates.Len() > 0 {
+		next := heap.Pop(&candidates).(*item)
+		txs = append(txs, next.tx)
+
+		for _, tag := range next.tx.Validity.Provides {
+			for _, dep := range p.requiredBy[string(tag)] {
+				if p.ready[dep.hash] == nil {
+					continue
+				}
+				waiting[dep.hash]--
+				if waiting[dep.hash] == 0 {
+					heap.Push(&candidates, dep.item())
+				}
+			}
+		}
+	}
+
+	return txs
+}
+
+// Future returns the transactions waiting for their required tags, in insertion order
+func (p *Pool) Future() []*ValidTransaction {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	ptxs := make([]*poolTx, 0, len(p.future))
+	for _, ptx := range p.future {
+		ptxs = append(ptxs, ptx)
+	}
+	sortByInsertion(ptxs)
+
+	txs := make([]*ValidTransaction, len(ptxs))
+	for i, ptx := range ptxs {
+		txs[i] = ptx.tx
+	}
+	return txs
+}
+
+// Len returns the number of ready and future transactions in the pool
+func (p *Pool) Len() (ready int, future int) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return len(p.ready), len(p.future)
+}
+
+// Bytes returns the total size of the ready and future transactions' extrinsics
+func (p *Pool) Bytes() (ready int, future int) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.readyBytes, p.futureBytes
+}
+
+func (p *Pool) get(hash common.Hash) *poolTx {
+	if ptx, ok := p.ready[hash]; ok {
+		return ptx
+	}
+	return p.future[hash]
+}
+
+// all returns all of the transactions in the pool
+func (p *Pool) all() []*poolTx {
+	ptxs := make([]*poolTx, 0, len(p.ready)+len(p.future))
+	for _, set := range []map[common.Hash]*poolTx{p.ready, p.future} {
+		for _, ptx := range set {
+			ptxs = append(ptxs, ptx)
+		}
+	}
+	return ptxs
+}
+
+// index adds the transaction to the index of required tags
+func (p *Pool) index(ptx *poolTx) {
+	for _, tag := range ptx.tx.Validity.Requires {
+		if p.requiredBy[string(tag)] == nil {
+			p.requiredBy[string(tag)] = make(map[common.Hash]*poolTx)
+		}
+		p.requiredBy[string(tag)][ptx.hash] = ptx
+	}
+}
+
+// unindex removes the transaction from the index of required tags
+func (p *Pool) unindex(ptx *poolTx) {
+	for _, tag := range ptx.tx.Validity.Requires {
+		delete(p.requiredBy[string(tag)], ptx.hash)
+		if len(p.requiredBy[string(tag)]) == 0 {
+			delete(p.requiredBy, string(tag))
+		}
+	}
+}
+
+func (p *Pool) addReady(ptx *poolTx) {
+	p.ready[ptx.hash] = ptx
+	p.readyBytes += ptx.size()
+	for _, tag := range ptx.tx.Validity.Provides {
+		p.provided[string(tag)] = ptx.hash
+	}
+}
+
+// takeReady removes the transaction from the ready queue and returns the tags it no longer provides
+func (p *Pool) takeReady(ptx *poolTx) [][]byte {
+	delete(p.ready, ptx.hash)
+	p.readyBytes -= ptx.size()
+
+	var lost [][]byte
+	for _, tag := range ptx.tx.Validity.Provides {
+		if p.provided[string(tag)] == ptx.hash {
+			delete(p.provided, string(tag))
+			lost = append(lost, tag)
+		}
+	}
+	return lost
+}
+
+func (p *Pool) addFuture(ptx *poolTx) {
+	p.future[ptx.hash] = ptx
+	p.futureBytes += ptx.size()
+}
+
+func (p *Pool) takeFuture(ptx *poolTx) {
+	delete(p.future, ptx.hash)
+	p.futureBytes -= ptx.size()
+}
+
+// remove drops the transaction from the pool, moving ready transactions that depended on it to the future queue
+func (p *Pool) remove(ptx *poolTx) {
+	if p.ready[ptx.hash] != nil {
+		lost := p.takeReady(ptx)
+		p.unindex(ptx)
+		p.demote(lost)
+		return
+	}
+
+	if p.future[ptx.hash] != nil {
+		p.takeFuture(ptx)
+		p.unindex(ptx)
+	}
+}
+
+// provides returns true if the tag is provided by a ready transaction or by a transaction included in a block
+func (p *Pool) provides(tag []byte) bool {
+	if _, ok := p.provided[string(tag)]; ok {
+		return true
+	}
+	_, ok := p.onChain[string(tag)]
+	return ok
+}
+
+// satisfied returns true if all of the transaction's required tags are provided
+func (p *Pool) satisfied(ptx *poolTx) bool {
+	for _, tag := range ptx.tx.Validity.Requires {
+		if !p.provides(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// dependents returns the transactions requiring any of the given tags
+func (p *Pool) dependents(tags [][]byte) []*poolTx {
+	var deps []*poolTx
+	seen := make(map[common.Hash]bool)
+	for _, tag := range tags {
+		for hash, dep := range p.requiredBy[string(tag)] {
+			if !seen[hash] {
+				seen[hash] = true
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return deps
+}
+
+// validTill returns the last block number at which a transaction imported now is valid
+func (p *Pool) validTill(v *Validity) uint64 {
+	if v.Longevity > math.MaxUint64-p.number {
+		return math.MaxUint64
+	}
+	return p.number + v.Longevity
+}
+
+// importReady adds a transaction whose required tags are satisfied to the ready queue. If ready transactions
+// already provide any of its tags, they are replaced if the new transaction has a higher priority than all of them.
+func (p *Pool) importReady(ptx *poolTx) error {
+	replaced := make(map[common.Hash]*poolTx)
+	for _, tag := range ptx.tx.Validity.Provides {
+		if hash, ok := p.provided[string(tag)]; ok {
+			other := p.ready[hash]
+			if other.tx.Validity.Priority >= ptx.tx.Validity.Priority {
+				return ErrTooLowPriority
+			}
+			replaced[hash] = other
+		}
+	}
+
+	var lost [][]byte
+	for _, other := range replaced {
+		lost = append(lost, p.takeReady(other)...)
+		p.unindex(other)
+	}
+
+	p.addReady(ptx)
+
+	// transactions that depended on tags only the replaced transactions provided are no longer ready
+	p.demote(lost)
+	return nil
+}
+
+// demote moves ready transactions that required any of the given tags, and are no longer satisfied, to the
+// future queue, along with the transactions depending on them in turn
+func (p *Pool) demote(tags [][]byte) {
+	for len(tags) > 0 {
+		tag := tags[0]
+		tags = tags[1:]
+
+		if p.provides(tag) {
+			continue
+		}
+
+		for _, dep := range p.requiredBy[string(tag)] {
+			if p.ready[dep.hash] == nil {
+				continue
+			}
+
+			tags = append(tags, p.takeReady(dep)...)
+			p.addFuture(dep)
+		}
+	}
+}
+
+// promote moves the given future transactions to the ready queue if their required tags are provided, along
+// with the transactions depending on them in turn. Transactions that cannot replace the ready transaction
+// providing the same tag are dropped.
+func (p *Pool) promote(candidates []*poolTx) {
+	sortByInsertion(candidates)
+
+	for len(candidates) > 0 {
+		ptx := candidates[0]
+		candidates = candidates[1:]
+
+		if p.future[ptx.hash] == nil || !p.satisfied(ptx) {
+			continue
+		}
+
+		p.takeFuture(ptx)
+		err := p.importReady(ptx)
+		if err != nil {
+			// a better transaction already provides the same tag
+			p.unindex(ptx)
+			continue
+		}
+
+		deps := p.dependents(ptx.tx.Validity.Provides)
+		sortByInsertion(deps)
+		candidates = append(candidates, deps...)
+	}
+}
+
+// enforceLimits evicts the lowest priority transactions until the ready and future queues are within the
+// pool's limits. Between transactions with the same priority, the most recently imported one is evicted first.
+func (p *Pool) enforceLimits() {
+	for len(p.ready) > p.config.MaxReady || p.readyBytes > p.config.MaxReadyBytes {
+		p.remove(lowestPriority(p.ready))
+	}
+
+	for len(p.future) > p.config.MaxFuture || p.futureBytes > p.config.MaxFutureBytes {
+		p.remove(lowestPriority(p.future))
+	}
+}
+
+func (p *Pool) ban(hashes []common.Hash) {
+	now := p.now()
+	until := now.Add(p.config.BanTime)
+	for _, hash := range hashes {
+		p.banned[hash] = until
+		p.bans = append(p.bans, ban{hash: hash, until: until})
+	}
+
+	p.pruneBans(now)
+}
+
+// pruneBans forgets the bans that have expired, and lifts the oldest bans while there are more than MaxBanned
+func (p *Pool) pruneBans(now time.Time) {
+	i := 0
+	for ; i < len(p.bans); i++ {
+		b := p.bans[i]
+		if !now.After(b.until) && len(p.bans)-i <= p.config.MaxBanned {
+			break
+		}
+
+		// the transaction may have been banned again since
+		if until, ok := p.banned[b.hash]; ok && until.Equal(b.until) {
+			delete(p.banned, b.hash)
+		}
+	}
+	p.bans = p.bans[i:]
+}
+
+// isBanned returns true if the transaction is banned, and forgets bans that have expired
+func (p *Pool) isBanned(hash common.Hash) bool {
+	until, ok := p.banned[hash]
+	if !ok {
+		return false
+	}
+
+	if p.now().After(until) {
+		delete(p.banned, hash)
+		return false
+	}
+	return true
+}
+
+// lowestPriority returns the transaction that should be evicted first
+func lowestPriority(set map[common.Hash]*poolTx) *poolTx {
+	var lowest *poolTx
+	for _, ptx := range set {
+		if lowest == nil ||
+			ptx.tx.Validity.Priority < lowest.tx.Validity.Priority ||
+			(ptx.tx.Validity.Priority == lowest.tx.Validity.Priority && ptx.insertion > lowest.insertion) {
+			lowest = ptx
+		}
+	}
+	return lowest
+}
+
+// sortByInsertion sorts transactions by the order they were imported in
+func sortByInsertion(ptxs []*poolTx) {
+	sort.Slice(ptxs, func(i, j int) bool {
+		return ptxs[i].insertion < ptxs[j].insertion
+	})
+}
@@ -0,0 +1,435 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package transaction
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/core/types"
+)
+
+func newTestTransaction(ext []byte, priority uint64, requires, provides [][]byte) *ValidTransaction {
+	e := types.Extrinsic(ext)
+	return NewValidTransaction(&e, NewValidity(priority, requires, provides, 64, true))
+}
+
+func TestPool_ImportDependencies(t *testing.T) {
+	p := NewPool(nil)
+
+	// b depends on a, and has a higher priority
+	a := newTestTransaction([]byte{1}, 1, nil, [][]byte{{0xa}})
+	b := newTestTransaction([]byte{2}, 2, [][]byte{{0xa}}, [][]byte{{0xb}})
+	c := newTestTransaction([]byte{3}, 3, nil, [][]byte{{0xc}})
+
+	_, err := p.Import(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ready, future := p.Len(); ready != 0 || future != 1 {
+		t.Fatalf("Fail: got ready=%d future=%d expected ready=0 future=1", ready, future)
+	}
+
+	for _, vt := range []*ValidTransaction{a, c} {
+		_, err = p.Import(vt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ready, future := p.Len(); ready != 3 || future != 0 {
+		t.Fatalf("Fail: got ready=%d future=%d expected ready=3 future=0", ready, future)
+	}
+
+	expected := []*ValidTransaction{c, a, b}
+	if res := p.Ready(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+}
+
+func TestPool_ImportChain(t *testing.T) {
+	p := NewPool(nil)
+
+	// a chain of transactions imported in reverse order
+	txs := []*ValidTransaction{
+		newTestTransaction([]byte{1}, 1, nil, [][]byte{{1}}),
+		newTestTransaction([]byte{2}, 1, [][]byte{{1}}, [][]byte{{2}}),
+		newTestTransaction([]byte{3}, 1, [][]byte{{2}}, [][]byte{{3}}),
+		newTestTransaction([]byte{4}, 1, [][]byte{{3}}, [][]byte{{4}}),
+	}
+
+	for i := len(txs) - 1; i >= 0; i-- {
+		_, err := p.Import(txs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if res := p.Ready(); !reflect.DeepEqual(res, txs) {
+		t.Fatalf("Fail: got %v expected %v", res, txs)
+	}
+}
+
+func TestPool_ImportDuplicate(t *testing.T) {
+	p := NewPool(nil)
+
+	a := newTestTransaction([]byte{1}, 1, nil, [][]byte{{0xa}})
+	hash, err := p.Import(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dup := newTestTransaction([]byte{1}, 2, nil, [][]byte{{0xb}})
+	dupHash, err := p.Import(dup)
+	if err != ErrAlreadyImported {
+		t.Fatalf("Fail: got %v expected %v", err, ErrAlreadyImported)
+	}
+	if hash != dupHash {
+		t.Fatalf("Fail: got hash %x expected %x", dupHash, hash)
+	}
+
+	if p.Get(hash) != a {
+		t.Fatal("Fail: duplicate replaced the original transaction")
+	}
+}
+
+func TestPool_Replacement(t *testing.T) {
+	p := NewPool(nil)
+
+	a := newTestTransaction([]byte{1}, 5, nil, [][]byte{{0xa}, {0xf}})
+	b := newTestTransaction([]byte{2}, 1, [][]byte{{0xa}}, nil)
+	c := newTestTransaction([]byte{3}, 1, [][]byte{{0xf}}, nil)
+
+	for _, vt := range []*ValidTransaction{a, b, c} {
+		_, err := p.Import(vt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// lower or equal priority transactions cannot replace a
+	low := newTestTransaction([]byte{4}, 5, nil, [][]byte{{0xa}})
+	_, err := p.Import(low)
+	if err != ErrTooLowPriority {
+		t.Fatalf("Fail: got %v expected %v", err, ErrTooLowPriority)
+	}
+
+	// high replaces a, but doesn't provide the tag c requires
+	high := newTestTransaction([]byte{5}, 6, nil, [][]byte{{0xa}})
+	_, err = p.Import(high)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*ValidTransaction{high, b}
+	if res := p.Ready(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+
+	expected = []*ValidTransaction{c}
+	if res := p.Future(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+}
+
+func TestPool_Remove(t *testing.T) {
+	p := NewPool(nil)
+
+	a := newTestTransaction([]byte{1}, 1, nil, [][]byte{{0xa}})
+	b := newTestTransaction([]byte{2}, 1, [][]byte{{0xa}}, nil)
+
+	hash, err := p.Import(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Import(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Remove(hash) != a {
+		t.Fatal("Fail: did not remove transaction")
+	}
+	if p.Get(hash) != nil {
+		t.Fatal("Fail: removed transaction is still in the pool")
+	}
+
+	// b is waiting for a tag again
+	if ready, future := p.Len(); ready != 0 || future != 1 {
+		t.Fatalf("Fail: got ready=%d future=%d expected ready=0 future=1", ready, future)
+	}
+}
+
+func TestPool_PruneBlock(t *testing.T) {
+	p := NewPool(nil)
+
+	a := newTestTransaction([]byte{1}, 1, nil, [][]byte{{0xa}})
+	b := newTestTransaction([]byte{2}, 1, [][]byte{{0xa}}, nil)
+	short := newTestTransaction([]byte{3}, 1, nil, nil)
+	short.Validity.Longevity = 1
+
+	for _, vt := range []*ValidTransaction{a, b, short} {
+		_, err := p.Import(vt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a is included in block 1, b stays ready since the tag it requires is now on chain
+	removed, err := p.PruneBlock(1, []types.Extrinsic{*a.Extrinsic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 {
+		t.Fatalf("Fail: removed %d transactions expected 1", len(removed))
+	}
+
+	expected := []*ValidTransaction{b, short}
+	if res := p.Ready(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+
+	// short expires after block 1
+	removed, err = p.PruneBlock(2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 {
+		t.Fatalf("Fail: removed %d transactions expected 1", len(removed))
+	}
+
+	expected = []*ValidTransaction{b}
+	if res := p.Ready(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+}
+
+func TestPool_Revalidate(t *testing.T) {
+	p := NewPool(nil)
+
+	a := newTestTransaction([]byte{1}, 1, nil, [][]byte{{0xa}})
+	b := newTestTransaction([]byte{2}, 1, [][]byte{{0xa}}, [][]byte{{0xb}})
+	c := newTestTransaction([]byte{3}, 1, nil, nil)
+
+	for _, vt := range []*ValidTransaction{a, b, c} {
+		_, err := p.Import(vt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := p.PruneBlock(1, []types.Extrinsic{*a.Extrinsic})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// against the new state, b no longer requires a's tag and c is invalid
+	validate := func(ext types.Extrinsic) (*Validity, error) {
+		switch ext[0] {
+		case 2:
+			return NewValidity(7, nil, [][]byte{{0xb}}, 64, true), nil
+		default:
+			return nil, errors.New("invalid transaction")
+		}
+	}
+
+	dropped := p.Revalidate(1, validate)
+	if len(dropped) != 1 {
+		t.Fatalf("Fail: dropped %d transactions expected 1", len(dropped))
+	}
+
+	expected := []*ValidTransaction{b}
+	if res := p.Ready(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+	if b.Validity.Priority != 7 {
+		t.Fatalf("Fail: got priority %d expected 7", b.Validity.Priority)
+	}
+
+	// the invalid transaction is banned
+	_, err = p.Import(c)
+	if err != ErrBanned {
+		t.Fatalf("Fail: got %v expected %v", err, ErrBanned)
+	}
+}
+
+func TestPool_ReadyLimit(t *testing.T) {
+	p := NewPool(&PoolConfig{
+		MaxReady:       2,
+		MaxReadyBytes:  1024,
+		MaxFuture:      2,
+		MaxFutureBytes: 1024,
+	})
+
+	a := newTestTransaction([]byte{1}, 2, nil, [][]byte{{0xa}})
+	b := newTestTransaction([]byte{2}, 1, [][]byte{{0xa}}, [][]byte{{0xb}})
+	c := newTestTransaction([]byte{3}, 3, nil, [][]byte{{0xc}})
+
+	for _, vt := range []*ValidTransaction{a, b, c} {
+		_, err := p.Import(vt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// b has the lowest priority and is evicted
+	expected := []*ValidTransaction{c, a}
+	if res := p.Ready(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+
+	// a transaction with a lower priority than all others is rejected
+	d := newTestTransaction([]byte{4}, 1, nil, nil)
+	_, err := p.Import(d)
+	if err != ErrPoolFull {
+		t.Fatalf("Fail: got %v expected %v", err, ErrPoolFull)
+	}
+
+	// b still has the lowest priority
+	_, err = p.Import(b)
+	if err != ErrPoolFull {
+		t.Fatalf("Fail: got %v expected %v", err, ErrPoolFull)
+	}
+
+	e := newTestTransaction([]byte{5}, 4, nil, nil)
+	_, err = p.Import(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []*ValidTransaction{e, c}
+	if res := p.Ready(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+}
+
+func TestPool_FutureLimit(t *testing.T) {
+	p := NewPool(&PoolConfig{
+		MaxReady:       16,
+		MaxReadyBytes:  1024,
+		MaxFuture:      16,
+		MaxFutureBytes: 4,
+	})
+
+	// transactions with the same priority are evicted newest first
+	a := newTestTransaction([]byte{1, 1}, 1, [][]byte{{0xf}}, nil)
+	b := newTestTransaction([]byte{2, 2}, 1, [][]byte{{0xf}}, nil)
+	c := newTestTransaction([]byte{3, 3}, 2, [][]byte{{0xf}}, nil)
+
+	for _, vt := range []*ValidTransaction{a, b, c} {
+		_, err := p.Import(vt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []*ValidTransaction{a, c}
+	if res := p.Future(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+
+	if ready, future := p.Bytes(); ready != 0 || future != 4 {
+		t.Fatalf("Fail: got ready=%d future=%d bytes expected ready=0 future=4", ready, future)
+	}
+}
+
+func TestPool_Ban(t *testing.T) {
+	p := NewPool(&PoolConfig{
+		MaxReady:       16,
+		MaxReadyBytes:  1024,
+		MaxFuture:      16,
+		MaxFutureBytes: 1024,
+		BanTime:        time.Minute,
+		MaxBanned:      2,
+	})
+
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	a := newTestTransaction([]byte{1}, 1, nil, nil)
+	hash, err := p.Import(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// banning a transaction removes it from the pool
+	p.Ban(hash)
+	if !p.IsBanned(hash) {
+		t.Fatal("Fail: transaction is not banned")
+	}
+	if p.Get(hash) != nil {
+		t.Fatal("Fail: banned transaction is still in the pool")
+	}
+
+	_, err = p.Import(a)
+	if err != ErrBanned {
+		t.Fatalf("Fail: got %v expected %v", err, ErrBanned)
+	}
+
+	// the ban expires
+	now = now.Add(2 * time.Minute)
+	if p.IsBanned(hash) {
+		t.Fatal("Fail: transaction is still banned")
+	}
+
+	_, err = p.Import(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPool_PruneBans(t *testing.T) {
+	p := NewPool(&PoolConfig{
+		MaxReady:       16,
+		MaxReadyBytes:  1024,
+		MaxFuture:      16,
+		MaxFutureBytes: 1024,
+		BanTime:        time.Minute,
+		MaxBanned:      2,
+	})
+
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	// the oldest ban is lifted once there are more bans than the limit
+	p.Ban(common.Hash{1}, common.Hash{2})
+	now = now.Add(time.Second)
+	p.Ban(common.Hash{3})
+	if p.IsBanned(common.Hash{1}) || !p.IsBanned(common.Hash{2}) || !p.IsBanned(common.Hash{3}) {
+		t.Fatal("Fail: oldest ban was not lifted")
+	}
+
+	// a transaction banned again keeps its latest ban
+	p.Ban(common.Hash{2})
+	if !p.IsBanned(common.Hash{2}) {
+		t.Fatal("Fail: transaction banned again is not banned")
+	}
+
+	// expired bans are forgotten when a block is imported, without looking the transactions up
+	now = now.Add(2 * time.Minute)
+	_, err := p.PruneBlock(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.banned) != 0 || len(p.bans) != 0 {
+		t.Fatalf("Fail: got %d bans expected 0", len(p.banned))
+	}
+}
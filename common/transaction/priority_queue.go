@@ -16,87 +16,166 @@
 
 package transaction
 
-import "sync"
+import (
+	"container/heap"
+	"sort"
+	"sync"
 
-// PriorityQueue implements a priority queue using a double linked list
+	"github.com/ChainSafe/gossamer/common"
+)
+
+// PriorityQueue is a priority queue of transactions implemented as a binary heap. Transactions with a higher
+// priority are popped first, and transactions with the same priority are popped in the order they were inserted.
 type PriorityQueue struct {
-	head  *node
-	mutex sync.Mutex
+	lock  sync.Mutex
+	heap  priorityHeap
+	items map[common.Hash]*item
+	next  uint64
 }
 
-type node struct {
-	data   *ValidTransaction
-	parent *node
-	child  *node
+// item is a transaction in a priority heap
+type item struct {
+	tx    *ValidTransaction
+	hash  common.Hash
+	order uint64 // insertion order, used to break ties between transactions with the same priority
+	index int    // position in the heap, maintained by the heap.Interface methods
 }
 
+// NewPriorityQueue creates an empty priority queue
 func NewPriorityQueue() *PriorityQueue {
-	pq := PriorityQueue{
-		head:  nil,
-		mutex: sync.Mutex{},
+	return &PriorityQueue{
+		items: make(map[common.Hash]*item),
 	}
-
-	return &pq
 }
 
-// Pop removes the head of the queue and returns it
+// Pop removes the transaction with the highest priority from the queue and returns it
 func (q *PriorityQueue) Pop() *ValidTransaction {
-	q.mutex.Lock()
-	defer q.mutex.Unlock()
-	if q.head == nil {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.heap) == 0 {
 		return nil
 	}
-	head := q.head
-	q.head = head.child
-	return head.data
+
+	it := heap.Pop(&q.heap).(*item)
+	delete(q.items, it.hash)
+	return it.tx
 }
 
-// Peek returns the next item without removing it from the queue
+// Peek returns the transaction with the highest priority without removing it from the queue
 func (q *PriorityQueue) Peek() *ValidTransaction {
-	q.mutex.Lock()
-	defer q.mutex.Unlock()
-	if q.head == nil {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.heap) == 0 {
+		return nil
+	}
+	return q.heap[0].tx
+}
+
+// Insert adds a transaction to the queue and returns the hash of its extrinsic, which identifies it in the queue.
+// Transactions that are already in the queue are not inserted again.
+func (q *PriorityQueue) Insert(vt *ValidTransaction) (common.Hash, error) {
+	var ext []byte
+	if vt.Extrinsic != nil {
+		ext = *vt.Extrinsic
+	}
+
+	hash, err := common.Blake2bHash(ext)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, ok := q.items[hash]; ok {
+		return hash, ErrAlreadyImported
+	}
+
+	it := &item{
+		tx:    vt,
+		hash:  hash,
+		order: q.next,
+	}
+	q.next++
+
+	heap.Push(&q.heap, it)
+	q.items[hash] = it
+	return hash, nil
+}
+
+// Remove removes the transaction with the given hash from the queue and returns it, or nil if it is not in the queue
+func (q *PriorityQueue) Remove(hash common.Hash) *ValidTransaction {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	it, ok := q.items[hash]
+	if !ok {
 		return nil
 	}
-	return q.head.data
+
+	heap.Remove(&q.heap, it.index)
+	delete(q.items, hash)
+	return it.tx
+}
+
+// Len returns the number of transactions in the queue
+func (q *PriorityQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.heap)
 }
 
-// Insert traverses the list and places a valid transaction with priority p directly before the
-// first node with priority p-1. If there are other nodes with priority p, the new node is placed
-// behind them.
-func (q *PriorityQueue) Insert(vt *ValidTransaction) {
-	q.mutex.Lock()
-	defer q.mutex.Unlock()
-	curr := q.head
-	if curr == nil {
-		q.head = &node{data: vt}
-		return
+// Transactions returns the transactions in the queue in the order they would be popped in, without removing them
+func (q *PriorityQueue) Transactions() []*ValidTransaction {
+	q.lock.Lock()
+	items := make([]*item, len(q.heap))
+	copy(items, q.heap)
+	q.lock.Unlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].before(items[j])
+	})
+
+	txs := make([]*ValidTransaction, len(items))
+	for i, it := range items {
+		txs[i] = it.tx
 	}
+	return txs
+}
 
-	for ; curr != nil; curr = curr.child {
-		currPriority := curr.data.Validity.Priority
-		if vt.Validity.Priority > currPriority {
-			newNode := &node{
-				data:   vt,
-				parent: curr.parent,
-				child:  curr,
-			}
-
-			if curr.parent == nil {
-				q.head = newNode
-			} else {
-				curr.parent.child = newNode
-			}
-			curr.parent = newNode
-
-			return
-		} else if curr.child == nil {
-			newNode := &node{
-				data:   vt,
-				parent: curr,
-			}
-			curr.child = newNode
-			return
-		}
+// before returns true if the item should be popped before the other one
+func (it *item) before(other *item) bool {
+	if it.tx.Validity.Priority != other.tx.Validity.Priority {
+		return it.tx.Validity.Priority > other.tx.Validity.Priority
 	}
+	return it.order < other.order
+}
+
+// priorityHeap implements heap.Interface, with the highest priority item at the root
+type priorityHeap []*item
+
+func (h priorityHeap) Len() int { return len(h) }
+
+func (h priorityHeap) Less(i, j int) bool { return h[i].before(h[j]) }
+
+func (h priorityHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *priorityHeap) Push(x interface{}) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil // don't keep a reference to the popped item
+	it.index = -1
+	*h = old[:n-1]
+	return it
 }
@@ -17,27 +17,20 @@
 package transaction
 
 import (
+	"encoding/binary"
 	"reflect"
 	"testing"
+
+	"github.com/ChainSafe/gossamer/common"
 )
 
 func TestPriorityQueue(t *testing.T) {
 	tests := []*ValidTransaction{
-		{
-			Validity: &Validity{Priority: 1},
-		},
-		{
-			Validity: &Validity{Priority: 3},
-		},
-		{
-			Validity: &Validity{Priority: 2},
-		},
-		{
-			Validity: &Validity{Priority: 17},
-		},
-		{
-			Validity: &Validity{Priority: 2},
-		},
+		newTestTransaction([]byte{1}, 1, nil, nil),
+		newTestTransaction([]byte{2}, 3, nil, nil),
+		newTestTransaction([]byte{3}, 2, nil, nil),
+		newTestTransaction([]byte{4}, 17, nil, nil),
+		newTestTransaction([]byte{5}, 2, nil, nil),
 	}
 
 	pq := NewPriorityQueue()
@@ -57,21 +50,11 @@ func TestPriorityQueue(t *testing.T) {
 
 func TestPriorityQueueAgain(t *testing.T) {
 	tests := []*ValidTransaction{
-		{
-			Validity: &Validity{Priority: 2},
-		},
-		{
-			Validity: &Validity{Priority: 3},
-		},
-		{
-			Validity: &Validity{Priority: 2},
-		},
-		{
-			Validity: &Validity{Priority: 3},
-		},
-		{
-			Validity: &Validity{Priority: 1},
-		},
+		newTestTransaction([]byte{6}, 2, nil, nil),
+		newTestTransaction([]byte{7}, 3, nil, nil),
+		newTestTransaction([]byte{8}, 2, nil, nil),
+		newTestTransaction([]byte{9}, 3, nil, nil),
+		newTestTransaction([]byte{10}, 1, nil, nil),
 	}
 
 	pq := NewPriorityQueue()
@@ -132,21 +115,11 @@ func TestPriorityQueue_Pop(t *testing.T) {
 
 func TestPeek(t *testing.T) {
 	tests := []*ValidTransaction{
-		{
-			Validity: &Validity{Priority: 2},
-		},
-		{
-			Validity: &Validity{Priority: 3},
-		},
-		{
-			Validity: &Validity{Priority: 2},
-		},
-		{
-			Validity: &Validity{Priority: 3},
-		},
-		{
-			Validity: &Validity{Priority: 1},
-		},
+		newTestTransaction([]byte{11}, 2, nil, nil),
+		newTestTransaction([]byte{12}, 3, nil, nil),
+		newTestTransaction([]byte{13}, 2, nil, nil),
+		newTestTransaction([]byte{14}, 3, nil, nil),
+		newTestTransaction([]byte{15}, 1, nil, nil),
 	}
 
 	pq := NewPriorityQueue()
@@ -170,14 +143,189 @@ func TestPriorityQueueConcurrentCalls(t *testing.T) {
 	pq := NewPriorityQueue()
 
 	go func() {
-		pq.Insert(&ValidTransaction{Validity: &Validity{Priority: 1}})
+		pq.Insert(newTestTransaction([]byte{1}, 1, nil, nil))
 		pq.Peek()
 		pq.Pop()
 	}()
 	go func() {
-		pq.Insert(&ValidTransaction{Validity: &Validity{Priority: 1}})
+		pq.Insert(newTestTransaction([]byte{2}, 1, nil, nil))
 		pq.Peek()
 		pq.Pop()
 	}()
 
 }
+
+func TestPriorityQueue_Duplicate(t *testing.T) {
+	pq := NewPriorityQueue()
+	vt := newTestTransaction([]byte{1}, 1, nil, nil)
+
+	_, err := pq.Insert(vt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = pq.Insert(vt)
+	if err != ErrAlreadyImported {
+		t.Fatalf("Fail: got %v expected %v", err, ErrAlreadyImported)
+	}
+
+	if pq.Len() != 1 {
+		t.Fatalf("Fail: got length %d expected 1", pq.Len())
+	}
+}
+
+func TestPriorityQueue_Remove(t *testing.T) {
+	tests := []*ValidTransaction{
+		newTestTransaction([]byte{1}, 2, nil, nil),
+		newTestTransaction([]byte{2}, 3, nil, nil),
+		newTestTransaction([]byte{3}, 2, nil, nil),
+		newTestTransaction([]byte{4}, 1, nil, nil),
+	}
+
+	pq := NewPriorityQueue()
+	hashes := make([]common.Hash, len(tests))
+	for i, vt := range tests {
+		hash, err := pq.Insert(vt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[i] = hash
+	}
+
+	if res := pq.Remove(hashes[1]); res != tests[1] {
+		t.Fatalf("Fail: got %v expected %v", res, tests[1])
+	}
+	if res := pq.Remove(hashes[1]); res != nil {
+		t.Fatalf("Fail: got %v expected nil", res)
+	}
+
+	expected := []*ValidTransaction{tests[0], tests[2], tests[3]}
+	if res := pq.Transactions(); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Fail: got %v expected %v", res, expected)
+	}
+
+	for _, exp := range expected {
+		if res := pq.Pop(); res != exp {
+			t.Fatalf("Fail: got %v expected %v", res, exp)
+		}
+	}
+}
+
+func TestPriorityQueue_Transactions(t *testing.T) {
+	pq := NewPriorityQueue()
+
+	var txs []*ValidTransaction
+	for i := 0; i < 100; i++ {
+		vt := newTestTransaction([]byte{byte(i)}, uint64(i%7), nil, nil)
+		txs = append(txs, vt)
+		_, err := pq.Insert(vt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// iterating doesn't modify the queue, and returns the transactions in the order they are popped in
+	expected := pq.Transactions()
+	if !reflect.DeepEqual(pq.Transactions(), expected) {
+		t.Fatal("Fail: iteration order is not stable")
+	}
+
+	for i, exp := range expected {
+		if i > 0 && exp.Validity.Priority > expected[i-1].Validity.Priority {
+			t.Fatalf("Fail: transaction %d has a higher priority than the previous one", i)
+		}
+		if res := pq.Pop(); res != exp {
+			t.Fatalf("Fail: got %v expected %v", res, exp)
+		}
+	}
+}
+
+// newBenchmarkTransactions creates n transactions with distinct extrinsics and varying priorities
+func newBenchmarkTransactions(n int) []*ValidTransaction {
+	txs := make([]*ValidTransaction, n)
+	for i := range txs {
+		ext := make([]byte, 8)
+		binary.LittleEndian.PutUint64(ext, uint64(i))
+		txs[i] = newTestTransaction(ext, uint64(i*7919%1000), nil, nil)
+	}
+	return txs
+}
+
+// newBenchmarkQueue creates a priority queue holding the given transactions
+func newBenchmarkQueue(b *testing.B, txs []*ValidTransaction) (*PriorityQueue, []common.Hash) {
+	pq := NewPriorityQueue()
+	hashes := make([]common.Hash, len(txs))
+	for i, vt := range txs {
+		hash, err := pq.Insert(vt)
+		if err != nil {
+			b.Fatal(err)
+		}
+		hashes[i] = hash
+	}
+	return pq, hashes
+}
+
+const benchmarkPending = 100000
+
+func BenchmarkPriorityQueue_Insert(b *testing.B) {
+	txs := newBenchmarkTransactions(benchmarkPending + b.N)
+	pq, _ := newBenchmarkQueue(b, txs[:benchmarkPending])
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := pq.Insert(txs[benchmarkPending+i])
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPriorityQueue_Pop(b *testing.B) {
+	txs := newBenchmarkTransactions(benchmarkPending + b.N)
+	pq, _ := newBenchmarkQueue(b, txs)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq.Pop()
+	}
+}
+
+func BenchmarkPriorityQueue_Remove(b *testing.B) {
+	txs := newBenchmarkTransactions(benchmarkPending + b.N)
+	pq, hashes := newBenchmarkQueue(b, txs)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq.Remove(hashes[i])
+	}
+}
+
+func BenchmarkPriorityQueue_Transactions(b *testing.B) {
+	pq, _ := newBenchmarkQueue(b, newBenchmarkTransactions(benchmarkPending))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pq.Transactions()
+	}
+}
+
+func BenchmarkPool_Ready(b *testing.B) {
+	p := NewPool(&PoolConfig{
+		MaxReady:       benchmarkPending,
+		MaxReadyBytes:  benchmarkPending * 8,
+		MaxFuture:      0,
+		MaxFutureBytes: 0,
+	})
+
+	for _, vt := range newBenchmarkTransactions(benchmarkPending) {
+		_, err := p.Import(vt)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Ready()
+	}
+}
@@ -17,15 +17,17 @@
 package transaction
 
 import (
+	"errors"
+	"io"
+
+	scale "github.com/ChainSafe/gossamer/codec"
 	"github.com/ChainSafe/gossamer/common"
 	"github.com/ChainSafe/gossamer/core/types"
 )
 
-type Pool map[common.Hash]*ValidTransaction
-
 type Queue interface {
 	Pop() *ValidTransaction
-	Insert(vt *ValidTransaction)
+	Insert(vt *ValidTransaction) (common.Hash, error)
 }
 
 // see: https://github.com/paritytech/substrate/blob/5420de3face1349a97eb954ae71c5b0b940c31de/core/sr-primitives/src/transaction_validity.rs#L178
@@ -47,6 +49,60 @@ func NewValidity(priority uint64, requires, provides [][]byte, longevity uint64,
 	}
 }
 
+// Decode decodes a SCALE encoded Validity, as returned by TaggedTransactionQueue_validate_transaction
+func (v *Validity) Decode(r io.Reader) error {
+	sd := scale.Decoder{Reader: r}
+
+	priority, err := sd.DecodeFixedWidthInt(uint64(0))
+	if err != nil {
+		return err
+	}
+
+	v.Requires, err = decodeTags(sd)
+	if err != nil {
+		return err
+	}
+
+	v.Provides, err = decodeTags(sd)
+	if err != nil {
+		return err
+	}
+
+	longevity, err := sd.DecodeFixedWidthInt(uint64(0))
+	if err != nil {
+		return err
+	}
+
+	v.Propagate, err = sd.DecodeBool()
+	if err != nil {
+		return err
+	}
+
+	v.Priority = priority.(uint64)
+	v.Longevity = longevity.(uint64)
+	return nil
+}
+
+// decodeTags decodes a SCALE encoded list of tags
+func decodeTags(sd scale.Decoder) ([][]byte, error) {
+	length, err := sd.DecodeInteger()
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return nil, errors.New("invalid tag list length")
+	}
+
+	tags := make([][]byte, length)
+	for i := range tags {
+		tags[i], err = sd.DecodeByteArray()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
 type ValidTransaction struct {
 	Extrinsic *types.Extrinsic
 	Validity  *Validity
@@ -0,0 +1,39 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package transaction
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestValidity_Decode(t *testing.T) {
+	// priority=69, requires=[], provides=[[1, 2]], longevity=64, propagate=true
+	enc := []byte{69, 0, 0, 0, 0, 0, 0, 0, 0, 4, 8, 1, 2, 64, 0, 0, 0, 0, 0, 0, 0, 1}
+
+	v := new(Validity)
+	err := v.Decode(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := NewValidity(69, [][]byte{}, [][]byte{{1, 2}}, 64, true)
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Fail: got %v expected %v", v, expected)
+	}
+}
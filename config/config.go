@@ -27,9 +27,11 @@ import (
 
 // Config is a collection of configurations throughout the system
 type Config struct {
-	Global GlobalConfig `toml:"global"`
-	P2p    P2pCfg       `toml:"p2p"`
-	Rpc    RpcCfg       `toml:"rpc"`
+	Global    GlobalConfig `toml:"global"`
+	P2p       P2pCfg       `toml:"p2p"`
+	Rpc       RpcCfg       `toml:"rpc"`
+	TxPool    TxPoolCfg    `toml:"txpool"`
+	Consensus ConsensusCfg `toml:"consensus"`
 }
 
 type GlobalConfig struct {
@@ -41,6 +43,22 @@ type P2pCfg struct {
 	Port           uint32   `toml:"port"`
 	NoBootstrap    bool     `toml:"no-bootstrap"`
 	NoMdns         bool     `toml:"no-mdns"`
+	// Transaction gossip, the p2p package's defaults are used for zero values
+	TxGossipInterval  uint32 `toml:"tx-gossip-interval"` // milliseconds between transaction announcements
+	TxGossipBatchSize uint32 `toml:"tx-gossip-batch-size"`
+	TxReceiveLimit    uint32 `toml:"tx-receive-limit"`
+}
+
+type TxPoolCfg struct {
+	Journal         bool   `toml:"journal"`          // save pending transactions to the data dir and restore them on startup
+	JournalInterval uint32 `toml:"journal-interval"` // seconds between saves, 0 to only save on shutdown
+	MaxAge          uint32 `toml:"max-age"`          // seconds after which journaled transactions are not restored, 0 for no limit
+}
+
+type ConsensusCfg struct {
+	Engine      string `toml:"engine"`       // consensus engine: babe, aura or manual-seal
+	InstantSeal bool   `toml:"instant-seal"` // with manual-seal, author a block for every imported transaction
+	GenesisTime int64  `toml:"genesis-time"` // start of slot 0 in seconds since the unix epoch, which it is by default
 }
 
 type RpcCfg struct {
@@ -32,6 +32,15 @@ const (
 	// P2P
 	DefaultP2PPort = 7001
 
+	// Transaction pool
+	DefaultTxPoolJournalInterval = 60   // Default seconds between transaction journal saves
+	DefaultTxPoolMaxAge          = 3600 // Default seconds after which journaled transactions are dropped
+
+	// Consensus engines
+	BabeEngine       = "babe"
+	AuraEngine       = "aura"
+	ManualSealEngine = "manual-seal"
+
 	DefaultGenesisPath = "./genesis.json"
 )
 
@@ -61,14 +70,28 @@ var (
 		Port:    DefaultRpcHttpPort,
 		Modules: DefaultRpcModules,
 	}
+
+	// Transaction pool
+	DefaultTxPoolConfig = TxPoolCfg{
+		Journal:         true,
+		JournalInterval: DefaultTxPoolJournalInterval,
+		MaxAge:          DefaultTxPoolMaxAge,
+	}
+
+	// Consensus
+	DefaultConsensusConfig = ConsensusCfg{
+		Engine: BabeEngine,
+	}
 )
 
 // DefaultConfig is the default settings used when a config.toml file is not passed in during instantiation
 func DefaultConfig() *Config {
 	return &Config{
-		Global: DefaultGlobalConfig,
-		P2p:    DefaultP2PConfig,
-		Rpc:    DefaultRpcConfig,
+		Global:    DefaultGlobalConfig,
+		P2p:       DefaultP2PConfig,
+		Rpc:       DefaultRpcConfig,
+		TxPool:    DefaultTxPoolConfig,
+		Consensus: DefaultConsensusConfig,
 	}
 }
 
@@ -0,0 +1,365 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package aura
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/consensus"
+	"github.com/ChainSafe/gossamer/consensus/inherents"
+	"github.com/ChainSafe/gossamer/core/blocktree"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/crypto"
+	"github.com/ChainSafe/gossamer/internal/events"
+	"github.com/ChainSafe/gossamer/internal/services"
+	"github.com/ChainSafe/gossamer/runtime"
+	log "github.com/ChainSafe/log15"
+)
+
+var _ consensus.Engine = &Engine{}
+var _ services.DependentService = &Engine{}
+
+// DefaultMaxDrift is the default amount of time a block's slot may start in the future and still be accepted
+const DefaultMaxDrift = 5 * time.Second
+
+var (
+	ErrNoAuthorities = errors.New("there are no Aura authorities")
+	ErrNoPreDigest   = errors.New("block header has no Aura pre-digest")
+	ErrNoSeal        = errors.New("block header is not sealed")
+	ErrInvalidSeal   = errors.New("block header seal is not a valid signature by the slot's author")
+	ErrFutureBlock   = errors.New("block slot is too far in the future")
+)
+
+// Engine is the Aura consensus engine: the authorities take turns authoring a block, one slot each
+type Engine struct {
+	services.DependencyList // services the blocks authored by the engine are published to
+
+	keypair     *crypto.Sr25519Keypair
+	rt          *runtime.Runtime
+	authorities []*crypto.Sr25519PublicKey
+
+	slotDuration time.Duration
+	genesisTime  time.Time // start time of slot 0
+	maxDrift     time.Duration
+	now          func() time.Time
+
+	txPool    *tx.Pool
+	inherents *inherents.InherentDataProviders
+	builder   *consensus.BlockBuilder
+
+	lock      sync.Mutex // held while authoring a block
+	done      chan struct{}
+	authoring sync.WaitGroup // running block authoring loop
+
+	// Event bus on which a BlockProduced event is published every time a block is created
+	bus *events.Bus
+}
+
+// NewEngine returns an Aura engine that authors blocks with the keypair, which may be nil if the node is not an
+// authority. The slot duration and the authorities are read from the runtime.
+func NewEngine(keypair *crypto.Sr25519Keypair, rt *runtime.Runtime, bus *events.Bus) (*Engine, error) {
+	e := &Engine{
+		keypair:     keypair,
+		rt:          rt,
+		genesisTime: time.Unix(0, 0),
+		maxDrift:    DefaultMaxDrift,
+		now:         time.Now,
+		txPool:      tx.NewPool(nil),
+		done:        make(chan struct{}),
+		bus:         bus,
+	}
+
+	duration, err := e.rt.AuraAPI().SlotDuration()
+	if err != nil {
+		return nil, err
+	}
+	e.slotDuration = time.Duration(duration) * time.Millisecond
+
+	e.authorities, err = e.rt.AuraAPI().Authorities()
+	if err != nil {
+		return nil, err
+	}
+
+	e.inherents = inherents.NewInherentDataProviders()
+	err = e.inherents.Register(&inherents.TimestampProvider{Now: func() time.Time { return e.now() }})
+	if err != nil {
+		return nil, err
+	}
+	err = e.inherents.Register(&inherents.AuraSlotProvider{SlotDuration: duration})
+	if err != nil {
+		return nil, err
+	}
+
+	e.builder = consensus.NewBlockBuilder(rt, e.txPool, e.inherents, func() time.Time { return e.now() })
+	return e, nil
+}
+
+// SetKeypair sets the key the engine authors blocks with. It must be called before the engine is started.
+func (e *Engine) SetKeypair(keypair *crypto.Sr25519Keypair) {
+	e.keypair = keypair
+}
+
+// Authorities returns the keys of the authorities that take turns authoring blocks
+func (e *Engine) Authorities() []*crypto.Sr25519PublicKey {
+	return e.authorities
+}
+
+// IsAuthority returns true if the engine's key is one of the authorities
+func (e *Engine) IsAuthority() bool {
+	_, ok := e.authorityIndex()
+	return ok
+}
+
+// SetAuthorities replaces the authorities read from the runtime. It must be called before the engine is started.
+func (e *Engine) SetAuthorities(authorities []*crypto.Sr25519PublicKey) {
+	e.authorities = authorities
+}
+
+// SetGenesisTime sets the start time of slot 0. By default slots are counted from the unix epoch.
+func (e *Engine) SetGenesisTime(t time.Time) {
+	e.genesisTime = t
+}
+
+// SetBlockTree sets the block tree authored blocks are built on and imported into
+func (e *Engine) SetBlockTree(bt *blocktree.BlockTree) {
+	e.builder.SetBlockTree(bt)
+}
+
+// Start starts authoring blocks at the slots assigned to the engine's key, if it is one of the authorities
+func (e *Engine) Start() error {
+	if _, ok := e.authorityIndex(); !ok {
+		return nil
+	}
+
+	e.authoring.Add(1)
+	go e.invokeBlockAuthoring()
+	return nil
+}
+
+// Stop stops authoring blocks, and waits for the block being built, if any
+func (e *Engine) Stop() error {
+	close(e.done)
+	e.authoring.Wait()
+	return nil
+}
+
+// TxPool returns the engine's transaction pool
+func (e *Engine) TxPool() *tx.Pool {
+	return e.txPool
+}
+
+// InherentDataProviders returns the registry of providers of the inherent data blocks are built and checked with
+func (e *Engine) InherentDataProviders() *inherents.InherentDataProviders {
+	return e.inherents
+}
+
+// BlockWeight returns 1 for every block, so the longest chain is the best one
+func (e *Engine) BlockWeight(header *types.BlockHeader) (uint64, error) {
+	return 1, nil
+}
+
+// HandleHeader does nothing, as the authority set is fixed
+func (e *Engine) HandleHeader(header *types.BlockHeader) error {
+	return nil
+}
+
+// VerifyHeader checks that the header is sealed by the author of the slot in its pre-digest, and that the slot
+// is not in the future
+func (e *Engine) VerifyHeader(header *types.BlockHeader) error {
+	items, err := types.DecodeDigest(header.Digest)
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		return ErrNoPreDigest
+	}
+
+	// the seal must be the last digest item, and signs the header without it
+	seal := items[len(items)-1]
+	if seal.Type != types.SealDigestType || seal.ConsensusEngineID != types.AuraEngineID {
+		return ErrNoSeal
+	}
+
+	slot, err := preDigestSlot(items[:len(items)-1])
+	if err != nil {
+		return err
+	}
+
+	if e.slotStart(slot).After(e.now().Add(e.maxDrift)) {
+		return ErrFutureBlock
+	}
+
+	author, err := e.slotAuthor(slot)
+	if err != nil {
+		return err
+	}
+
+	hash, err := consensus.PreSealHash(header, items[:len(items)-1])
+	if err != nil {
+		return err
+	}
+
+	if !e.authorities[author].Verify(hash[:], seal.Data) {
+		return ErrInvalidSeal
+	}
+
+	return nil
+}
+
+// AuthorSlot builds, imports and announces a block for the slot. It returns consensus.ErrNotSlotAuthor if the
+// slot is assigned to another authority.
+func (e *Engine) AuthorSlot(slot uint64) (*types.Block, error) {
+	idx, ok := e.authorityIndex()
+	if !ok {
+		return nil, consensus.ErrNotSlotAuthor
+	}
+
+	author, err := e.slotAuthor(slot)
+	if err != nil {
+		return nil, err
+	}
+	if author != idx {
+		return nil, consensus.ErrNotSlotAuthor
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	pre := make([]byte, 8)
+	binary.LittleEndian.PutUint64(pre, slot)
+
+	deadline := e.slotStart(slot).Add(e.slotDuration * consensus.BuildTimeRatio / 100)
+	header, exts, err := e.builder.Build(e.builder.BestHeader(), []*types.DigestItem{types.NewPreRuntimeDigest(types.AuraEngineID, pre)}, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	err = consensus.SealHeader(header, types.AuraEngineID, e.keypair)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := types.NewBlockBody(exts)
+	if err != nil {
+		return nil, err
+	}
+
+	block := &types.Block{
+		Header: *header,
+		Body:   body,
+	}
+
+	err = e.builder.Import(block, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("[aura] built block", "slot", slot, "number", header.Number, "hash", header.Hash, "extrinsics", len(exts))
+
+	// Notify other services of the new block
+	if e.bus != nil {
+		e.bus.Publish(&events.BlockProduced{Block: block})
+	}
+
+	return block, nil
+}
+
+func (e *Engine) invokeBlockAuthoring() {
+	defer e.authoring.Done()
+	slot := e.currentSlot()
+
+	for {
+		if now := e.now(); now.Before(e.slotStart(slot)) {
+			select {
+			case <-e.done:
+				return
+			case <-time.After(e.slotStart(slot).Sub(now)):
+			}
+		}
+
+		select {
+		case <-e.done:
+			return
+		default:
+		}
+
+		_, err := e.AuthorSlot(slot)
+		if err != nil && err != consensus.ErrNotSlotAuthor {
+			log.Error("[aura] cannot build block", "slot", slot, "error", err)
+		}
+
+		// skip any slots that passed while producing the block
+		next := e.currentSlot()
+		if next <= slot {
+			next = slot + 1
+		}
+		slot = next
+	}
+}
+
+// slotStart returns the start time of the slot
+func (e *Engine) slotStart(slot uint64) time.Time {
+	return e.genesisTime.Add(time.Duration(slot) * e.slotDuration)
+}
+
+// currentSlot returns the slot the current time falls in
+func (e *Engine) currentSlot() uint64 {
+	since := e.now().Sub(e.genesisTime)
+	if since < 0 {
+		return 0
+	}
+	return uint64(since / e.slotDuration)
+}
+
+// slotAuthor returns the index of the authority assigned to the slot; the authorities take turns in order
+func (e *Engine) slotAuthor(slot uint64) (uint64, error) {
+	if len(e.authorities) == 0 {
+		return 0, ErrNoAuthorities
+	}
+	return slot % uint64(len(e.authorities)), nil
+}
+
+// authorityIndex returns the index of the engine's key in the authorities, and false if it is not an authority
+func (e *Engine) authorityIndex() (uint64, bool) {
+	if e.keypair == nil {
+		return 0, false
+	}
+
+	pub := e.keypair.Public().Encode()
+	for i, auth := range e.authorities {
+		if bytes.Equal(auth.Encode(), pub) {
+			return uint64(i), true
+		}
+	}
+	return 0, false
+}
+
+// preDigestSlot returns the slot of the Aura pre-runtime digest item
+func preDigestSlot(items []*types.DigestItem) (uint64, error) {
+	for _, item := range items {
+		if item.Type == types.PreRuntimeDigestType && item.ConsensusEngineID == types.AuraEngineID && len(item.Data) == 8 {
+			return binary.LittleEndian.Uint64(item.Data), nil
+		}
+	}
+	return 0, ErrNoPreDigest
+}
@@ -0,0 +1,279 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package aura
+
+import (
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/consensus"
+	"github.com/ChainSafe/gossamer/core/blocktree"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/crypto"
+	"github.com/ChainSafe/gossamer/internal/events"
+	db "github.com/ChainSafe/gossamer/polkadb"
+	"github.com/ChainSafe/gossamer/runtime"
+	"github.com/ChainSafe/gossamer/trie"
+)
+
+const POLKADOT_RUNTIME_FP string = "../../substrate_test_runtime.compact.wasm"
+const POLKADOT_RUNTIME_URL string = "https://github.com/noot/substrate/blob/add-blob/core/test-runtime/wasm/wasm32-unknown-unknown/release/wbuild/substrate-test-runtime/substrate_test_runtime.compact.wasm?raw=true"
+
+// getRuntimeBlob checks if the polkadot runtime wasm file exists and if not, it fetches it from github
+func getRuntimeBlob() (n int64, err error) {
+	if Exists(POLKADOT_RUNTIME_FP) {
+		return 0, nil
+	}
+
+	out, err := os.Create(POLKADOT_RUNTIME_FP)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	resp, err := http.Get(POLKADOT_RUNTIME_URL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err = io.Copy(out, resp.Body)
+	return n, err
+}
+
+// Exists reports whether the named file or directory exists.
+func Exists(name string) bool {
+	if _, err := os.Stat(name); err != nil {
+		if os.IsNotExist(err) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRuntime(t *testing.T) *runtime.Runtime {
+	_, err := getRuntimeBlob()
+	if err != nil {
+		t.Fatalf("Fail: could not get polkadot runtime")
+	}
+
+	fp, err := filepath.Abs(POLKADOT_RUNTIME_FP)
+	if err != nil {
+		t.Fatal("could not create filepath")
+	}
+
+	r, err := runtime.NewRuntimeFromFile(fp, &trie.Trie{})
+	if err != nil {
+		t.Fatal(err)
+	} else if r == nil {
+		t.Fatal("did not create new VM")
+	}
+
+	return r
+}
+
+// newTestEngines returns an engine for each of n authorities, in the order of the authorities. The engines share
+// a runtime, as only one runtime instance can be used at a time.
+func newTestEngines(t *testing.T, n int, bus *events.Bus) []*Engine {
+	rt := newRuntime(t)
+
+	keypairs := make([]*crypto.Sr25519Keypair, n)
+	authorities := make([]*crypto.Sr25519PublicKey, n)
+	for i := range keypairs {
+		kp, err := crypto.GenerateSr25519Keypair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keypairs[i] = kp
+		authorities[i] = kp.Public().(*crypto.Sr25519PublicKey)
+	}
+
+	engines := make([]*Engine, n)
+	for i, kp := range keypairs {
+		e, err := NewEngine(kp, rt, bus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.SetAuthorities(authorities)
+		e.SetGenesisTime(time.Now().Add(-10 * e.slotDuration))
+		engines[i] = e
+	}
+
+	return engines
+}
+
+func TestNewEngine(t *testing.T) {
+	e, err := NewEngine(nil, newRuntime(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.slotDuration != time.Second {
+		t.Fatalf("Fail: got slot duration %s expected %s", e.slotDuration, time.Second)
+	}
+
+	// the test runtime has no genesis authorities
+	if len(e.authorities) != 0 {
+		t.Fatalf("Fail: got %d authorities expected none", len(e.authorities))
+	}
+
+	_, err = e.AuthorSlot(1)
+	if err != consensus.ErrNotSlotAuthor {
+		t.Fatalf("Fail: got %v expected %v", err, consensus.ErrNotSlotAuthor)
+	}
+}
+
+func TestAuthorSlot_RoundRobin(t *testing.T) {
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.BlockProducedTopic)
+	defer sub.Unsubscribe()
+
+	engines := newTestEngines(t, 2, bus)
+
+	genesis := types.Block{
+		Header: types.BlockHeader{Number: big.NewInt(0), Hash: common.Hash{0x01}},
+		Body:   types.BlockBody{},
+	}
+	bt := blocktree.NewBlockTreeFromGenesis(genesis, &db.BlockDB{Db: db.NewMemDatabase()})
+	engines[0].SetBlockTree(bt)
+
+	// slot 3 belongs to the second authority
+	_, err := engines[0].AuthorSlot(3)
+	if err != consensus.ErrNotSlotAuthor {
+		t.Fatalf("Fail: got %v expected %v", err, consensus.ErrNotSlotAuthor)
+	}
+
+	block, err := engines[0].AuthorSlot(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if block.Header.Number.Cmp(big.NewInt(1)) != 0 || block.Header.ParentHash != genesis.Header.Hash {
+		t.Fatalf("Fail: got block %d with parent %x expected block 1 with parent %x", block.Header.Number, block.Header.ParentHash, genesis.Header.Hash)
+	}
+
+	if bt.BestBlock().Header.Hash != block.Header.Hash {
+		t.Fatalf("Fail: got best block %x expected %x", bt.BestBlock().Header.Hash, block.Header.Hash)
+	}
+
+	select {
+	case e := <-sub.Chan():
+		if e.(*events.BlockProduced).Block.Header.Hash != block.Header.Hash {
+			t.Fatal("Fail: produced block was not announced")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Fail: produced block was not announced")
+	}
+
+	// the other authority accepts the block
+	err = engines[1].VerifyHeader(&block.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyHeader(t *testing.T) {
+	engines := newTestEngines(t, 2, nil)
+
+	block, err := engines[1].AuthorSlot(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a header sealed by the author of the slot is valid
+	err = engines[0].VerifyHeader(&block.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := types.DecodeDigest(block.Header.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same header claiming a slot of the other authority is not
+	claim := make([]byte, 8)
+	claim[0] = 6
+	wrongSlot := block.Header
+	wrongSlot.Digest, err = types.EncodeDigest([]*types.DigestItem{types.NewPreRuntimeDigest(types.AuraEngineID, claim), items[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = engines[0].VerifyHeader(&wrongSlot)
+	if err != ErrInvalidSeal {
+		t.Fatalf("Fail: got %v expected %v", err, ErrInvalidSeal)
+	}
+
+	unsealed := block.Header
+	unsealed.Digest, err = types.EncodeDigest(items[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = engines[0].VerifyHeader(&unsealed)
+	if err != ErrNoSeal {
+		t.Fatalf("Fail: got %v expected %v", err, ErrNoSeal)
+	}
+
+	// a block for a slot far in the future is rejected
+	engines[1].SetGenesisTime(time.Now().Add(time.Hour))
+	future, err := engines[1].AuthorSlot(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engines[0].SetGenesisTime(time.Now().Add(time.Hour))
+	err = engines[0].VerifyHeader(&future.Header)
+	if err != ErrFutureBlock {
+		t.Fatalf("Fail: got %v expected %v", err, ErrFutureBlock)
+	}
+}
+
+func TestStart_AuthorsAssignedSlots(t *testing.T) {
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.BlockProducedTopic)
+	defer sub.Unsubscribe()
+
+	engines := newTestEngines(t, 1, bus)
+	err := engines[0].Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-sub.Chan():
+		block := e.(*events.BlockProduced).Block
+		err = engines[0].VerifyHeader(&block.Header)
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Fail: no block was produced")
+	}
+
+	err = engines[0].Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
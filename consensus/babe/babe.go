@@ -17,25 +17,42 @@
 package babe
 
 import (
-	"crypto/rand"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
 	"math/big"
+	"reflect"
+	"sync"
 	"time"
 
+	"github.com/ChainSafe/gossamer/common"
 	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/consensus"
+	"github.com/ChainSafe/gossamer/consensus/inherents"
+	"github.com/ChainSafe/gossamer/core/blocktree"
 	"github.com/ChainSafe/gossamer/core/types"
-	"github.com/ChainSafe/gossamer/p2p"
+	"github.com/ChainSafe/gossamer/crypto"
+	"github.com/ChainSafe/gossamer/internal/events"
+	"github.com/ChainSafe/gossamer/internal/services"
+	"github.com/ChainSafe/gossamer/polkadb"
 	"github.com/ChainSafe/gossamer/runtime"
+	log "github.com/ChainSafe/log15"
+	"github.com/gtank/merlin"
 )
 
+var _ consensus.Engine = &Session{}
+var _ services.DependentService = &Session{}
+
+// babeVrfPrefix is the context used to derive the slot lottery value from a VRF output
+var babeVrfPrefix = []byte("substrate-babe-vrf")
+
 // Session contains the VRF keys for the validator
 type Session struct {
-	vrfPublicKey  VrfPublicKey
-	vrfPrivateKey VrfPrivateKey
-	rt            *runtime.Runtime
+	services.DependencyList // services the blocks authored by the session are published to
+
+	keypair *crypto.Sr25519Keypair
+	rt      *runtime.Runtime
 
 	config *BabeConfiguration
 
@@ -45,98 +62,369 @@ type Session struct {
 	authorityWeights []uint64
 
 	epochThreshold *big.Int // validator threshold for this epoch
-	txQueue        *tx.PriorityQueue
-	isProducer     map[uint64]bool // whether we are a block producer at a slot
-
-	// Block announce channel used every time a block is created
-	blockAnnounce chan<- p2p.BlockAnnounceMessage
+	txPool         *tx.Pool
+	inherents      *inherents.InherentDataProviders
+	builder        *consensus.BlockBuilder
+	slotToClaim    map[uint64]*BabeHeader // pre-digest claiming each slot we are a block producer at
+	secondaryVrf   bool                   // whether secondary slot claims include a VRF output
+
+	lock        sync.Mutex
+	epoch       *EpochData                  // epoch of the latest slot authored for, which slots are claimed in
+	epochs      map[common.Hash]*EpochData  // data of the epochs, by hash of their first block
+	epochBlocks map[common.Hash]*epochBlock // BABE data of the blocks, by block hash
+	db          polkadb.Database            // database the epoch data is persisted to, may be nil
+	done        chan struct{}
+	authoring   sync.WaitGroup // running block authoring loop
+
+	seenHeaders    map[slotAuthor]*seenHeader // first verified header of each authority in recent slots
+	latestSeenSlot uint64                     // latest slot a header was verified for
+	equivocations  []*types.EquivocationProof // recently detected equivocations
+
+	clock       clock
+	genesisTime time.Time     // start time of slot 0
+	slotOffset  time.Duration // correction of the slot start times from the median of block arrival times
+	blockTree   *blocktree.BlockTree
+
+	// Event bus on which a BlockProduced event is published every time a block is created
+	bus *events.Bus
 }
 
-// NewSession returns a new Babe session using the provided VRF keys and runtime
-func NewSession(pubkey VrfPublicKey, privkey VrfPrivateKey, rt *runtime.Runtime, blockAnnounceChannel chan<- p2p.BlockAnnounceMessage) (*Session, error) {
+// NewSession returns a new Babe session using the provided sr25519 keypair and runtime
+func NewSession(keypair *crypto.Sr25519Keypair, rt *runtime.Runtime, bus *events.Bus) (*Session, error) {
 	babeSession := &Session{
-		vrfPublicKey:  pubkey,
-		vrfPrivateKey: privkey,
-		rt:            rt,
-		txQueue:       new(tx.PriorityQueue),
-		isProducer:    make(map[uint64]bool),
-		blockAnnounce: blockAnnounceChannel,
+		keypair:     keypair,
+		rt:          rt,
+		txPool:      tx.NewPool(nil),
+		slotToClaim: make(map[uint64]*BabeHeader),
+		epochs:      make(map[common.Hash]*EpochData),
+		epochBlocks: make(map[common.Hash]*epochBlock),
+		seenHeaders: make(map[slotAuthor]*seenHeader),
+		bus:         bus,
+		done:        make(chan struct{}),
+		clock:       systemClock{},
+		genesisTime: time.Unix(0, 0),
 	}
 	err := babeSession.configurationFromRuntime()
 	if err != nil {
 		return nil, err
 	}
 
+	babeSession.epoch = genesisEpoch(babeSession.config)
+
+	// the timestamp is read from the session's clock, and the slot is derived from it
+	babeSession.inherents = inherents.NewInherentDataProviders()
+	err = babeSession.inherents.Register(&inherents.TimestampProvider{Now: func() time.Time { return babeSession.clock.Now() }})
+	if err != nil {
+		return nil, err
+	}
+	err = babeSession.inherents.Register(&inherents.BabeSlotProvider{SlotDuration: babeSession.config.SlotDuration})
+	if err != nil {
+		return nil, err
+	}
+
+	babeSession.builder = consensus.NewBlockBuilder(rt, babeSession.txPool, babeSession.inherents, func() time.Time { return babeSession.clock.Now() })
+
 	return babeSession, nil
 }
 
-func (b *Session) Start() error {
-	var i uint64 = 0
-	var err error
-	for ; i < b.config.EpochLength; i++ {
-		b.isProducer[i], err = b.runLottery(i)
-		if err != nil {
-			return fmt.Errorf("BABE: error running slot lottery at slot %d: error %s", i, err)
-		}
+// SetKeypair sets the key the session authors blocks with. A session without a key only verifies blocks.
+// It must be called before the session is started.
+func (b *Session) SetKeypair(keypair *crypto.Sr25519Keypair) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.keypair = keypair
+	if idx, ok := b.authorityIndexOf(b.epoch.Authorities); ok {
+		b.authorityIndex = idx
 	}
+}
+
+// IsAuthority returns true if the session's key is one of the authorities of the current epoch
+func (b *Session) IsAuthority() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
 
+	_, ok := b.authorityIndexOf(b.epoch.Authorities)
+	return ok
+}
+
+// Start starts authoring blocks from the current slot. The epoch of each slot is resolved on the chain of the best
+// block, so the epochs follow the chain.
+func (b *Session) Start() error {
+	b.lock.Lock()
+	b.syncSlotTime()
+	b.lock.Unlock()
+
+	b.authoring.Add(1)
 	go b.invokeBlockAuthoring()
 
 	return nil
 }
 
-// PushToTxQueue adds a ValidTransaction to BABE's transaction queue
-func (b *Session) PushToTxQueue(vt *tx.ValidTransaction) {
-	b.txQueue.Insert(vt)
+// Stop stops authoring blocks, and waits for the block being built, if any
+func (b *Session) Stop() error {
+	close(b.done)
+	b.authoring.Wait()
+	return nil
+}
+
+// PushToTxQueue adds a ValidTransaction to BABE's transaction pool
+func (b *Session) PushToTxQueue(vt *tx.ValidTransaction) error {
+	_, err := b.txPool.Import(vt)
+	return err
 }
 
+// PeekFromTxQueue returns the next ready transaction to be included in a block, or nil if there are none
 func (b *Session) PeekFromTxQueue() *tx.ValidTransaction {
-	return b.txQueue.Peek()
+	ready := b.txPool.Ready()
+	if len(ready) == 0 {
+		return nil
+	}
+	return ready[0]
 }
 
-func (b *Session) invokeBlockAuthoring() {
-	// TODO: we might not actually be starting at slot 0, need to run median algorithm here
-	var currentSlot uint64 = 0
+// InherentDataProviders returns the registry of providers of the inherent data blocks are built and checked with.
+// Providers of custom inherent data can be registered with it.
+func (b *Session) InherentDataProviders() *inherents.InherentDataProviders {
+	return b.inherents
+}
 
-	for ; currentSlot < b.config.EpochLength; currentSlot++ {
-		if b.isProducer[currentSlot] {
-			// TODO: implement build block
-			block, err := b.buildBlock(big.NewInt(int64(currentSlot)))
-			if err != nil {
+// TxPool returns BABE's transaction pool
+func (b *Session) TxPool() *tx.Pool {
+	return b.txPool
+}
+
+func (b *Session) invokeBlockAuthoring() {
+	defer b.authoring.Done()
+	currentSlot := b.currentSlot()
+
+	for {
+		// wait for the start of the slot; start times are absolute, so time spent producing blocks does not
+		// delay the following slots
+		start := b.slotStart(currentSlot)
+		if now := b.clock.Now(); now.Before(start) {
+			select {
+			case <-b.done:
 				return
+			case <-b.clock.After(start.Sub(now)):
 			}
+		}
+
+		select {
+		case <-b.done:
+			return
+		default:
+		}
 
-			// Broadcast the block
-			blockAnnounceMsg := p2p.BlockAnnounceMessage{
-				Number: block.Header.Number,
+		b.lock.Lock()
+		claim, err := b.slotClaim(currentSlot)
+		b.lock.Unlock()
+		if err != nil {
+			log.Error("[babe] cannot claim slot", "slot", currentSlot, "error", err)
+		}
+
+		if claim != nil {
+			_, err := b.produceBlock(currentSlot, claim)
+			if err != nil {
+				log.Error("[babe] cannot build block", "slot", currentSlot, "error", err)
 			}
-			b.blockAnnounce <- blockAnnounceMsg
 		}
 
-		time.Sleep(time.Millisecond * time.Duration(b.config.SlotDuration))
+		// skip any slots that passed while producing the block
+		next := b.currentSlot()
+		if next <= currentSlot {
+			next = currentSlot + 1
+		} else if next > currentSlot+1 {
+			log.Debug("[babe] skipped slots", "from", currentSlot+1, "to", next)
+		}
+		currentSlot = next
 	}
 }
 
-// runs the slot lottery for a specific slot
-// returns true if validator is authorized to produce a block for that slot, false otherwise
-func (b *Session) runLottery(slot uint64) (bool, error) {
-	slotBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(slotBytes, slot)
-	vrfInput := append(slotBytes, b.config.Randomness)
-	output, err := b.vrfSign(vrfInput)
+// AuthorSlot builds, imports and announces a block for a slot the session has claimed in the slot's epoch on the
+// best chain. It returns consensus.ErrNotSlotAuthor if the session has no claim on the slot.
+func (b *Session) AuthorSlot(slot uint64) (*types.Block, error) {
+	b.lock.Lock()
+	claim, err := b.slotClaim(slot)
+	b.lock.Unlock()
+
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	if claim == nil {
+		return nil, consensus.ErrNotSlotAuthor
+	}
+
+	return b.produceBlock(slot, claim)
+}
+
+// BlockWeight returns the fork choice weight the block adds to its chain
+func (b *Session) BlockWeight(header *types.BlockHeader) (uint64, error) {
+	return BlockWeight(header)
+}
+
+// produceBlock builds a block for the claimed slot and announces it
+func (b *Session) produceBlock(slot uint64, claim *BabeHeader) (*types.Block, error) {
+	block, err := b.buildBlock(slot, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	b.lock.Lock()
+	err = b.addEpochBlock(&block.Header, claim, nil)
+	b.lock.Unlock()
+	if err != nil {
+		log.Error("[babe] cannot save epoch block", "error", err)
+	}
+
+	// Notify other services of the new block
+	if b.bus != nil {
+		b.bus.Publish(&events.BlockProduced{Block: block})
+	}
+
+	return block, nil
+}
+
+// SetSecondarySlotVrf sets whether claims of secondary slots include a VRF output, which then contributes
+// to the epoch randomness; otherwise plain secondary claims are made
+func (b *Session) SetSecondarySlotVrf(vrf bool) {
+	b.secondaryVrf = vrf
+}
+
+// slotClaim returns our claim on the slot in the slot's epoch on the chain of the best block, which the block for
+// the slot is built on, and nil if we are not a block producer at the slot. The session moves to that epoch if it
+// is not the current one, and corrects the slot times from the arrival times of recent blocks when it does.
+// The caller must hold the lock.
+func (b *Session) slotClaim(slot uint64) (*BabeHeader, error) {
+	parent := b.builder.BestHeader()
+	epoch, _, err := b.epochFor(parent.Hash, parent.Number.Uint64()+1, slot)
+	if err != nil {
+		return nil, err
 	}
 
-	output_int := new(big.Int).SetBytes(output)
+	if !reflect.DeepEqual(epoch, b.epoch) {
+		log.Debug("[babe] starting epoch", "epoch", epoch.Index, "start slot", epoch.StartSlot, "authorities", len(epoch.Authorities))
+		b.epoch = epoch
+		b.startEpoch()
+		b.syncSlotTime()
+	}
+
+	return b.claim(slot)
+}
+
+// claim returns our claim on a slot of the current epoch, and nil if we are not a block producer at the slot.
+// Claims are remembered until the next epoch starts. The caller must hold the lock.
+func (b *Session) claim(slot uint64) (*BabeHeader, error) {
+	if claim, ok := b.slotToClaim[slot]; ok {
+		return claim, nil
+	}
+
+	if _, ok := b.authorityIndexOf(b.epoch.Authorities); !ok {
+		return nil, nil
+	}
+
+	claim, err := b.claimSlot(slot)
+	if err != nil {
+		return nil, fmt.Errorf("BABE: error claiming slot %d: error %s", slot, err)
+	}
+
+	b.slotToClaim[slot] = claim
+	return claim, nil
+}
+
+// claimSlot returns the pre-digest claiming the slot, or nil if we are not a block producer at the slot.
+// We claim a primary slot if we win the slot lottery; otherwise, if secondary slots are enabled, we claim a
+// secondary slot if we are the slot's secondary author.
+func (b *Session) claimSlot(slot uint64) (*BabeHeader, error) {
+	vrf, err := b.runLottery(slot)
+	if err != nil {
+		return nil, err
+	}
+
+	if vrf != nil {
+		return &BabeHeader{
+			Type:               PrimaryPreDigestType,
+			VrfOutput:          vrf.Output,
+			VrfProof:           vrf.Proof,
+			BlockProducerIndex: b.authorityIndex,
+			SlotNumber:         slot,
+		}, nil
+	}
+
+	if !b.config.SecondarySlots {
+		return nil, nil
+	}
+
+	author, err := secondarySlotAuthor(b.epoch.Randomness, slot, len(b.authorityWeights))
+	if err != nil || author != b.authorityIndex {
+		return nil, err
+	}
+
+	claim := &BabeHeader{
+		Type:               SecondaryPlainPreDigestType,
+		BlockProducerIndex: b.authorityIndex,
+		SlotNumber:         slot,
+	}
+
+	if b.secondaryVrf {
+		vrf, err = b.vrfSign(makeTranscript(b.epoch.Randomness, slot, b.epoch.Index))
+		if err != nil {
+			return nil, err
+		}
+
+		claim.Type = SecondaryVrfPreDigestType
+		claim.VrfOutput = vrf.Output
+		claim.VrfProof = vrf.Proof
+	}
+
+	return claim, nil
+}
+
+// secondarySlotAuthor returns the index of the authority assigned to a secondary slot, which rotates through
+// the authorities pseudo-randomly based on the epoch randomness
+// equation: blake2b(randomness || slot) mod number of authorities
+func secondarySlotAuthor(randomness [RandomnessLength]byte, slot uint64, authorities int) (uint64, error) {
+	if authorities == 0 {
+		return 0, errors.New("cannot assign secondary slot: no authorities")
+	}
+
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, slot)
+	h, err := common.Blake2bHash(append(randomness[:], buf...))
+	if err != nil {
+		return 0, err
+	}
+
+	idx := new(big.Int).SetBytes(h[:])
+	return idx.Mod(idx, big.NewInt(int64(authorities))).Uint64(), nil
+}
+
+// runs the slot lottery for a specific slot
+// returns the VRF output and proof if validator is authorized to produce a block for that slot, nil otherwise
+func (b *Session) runLottery(slot uint64) (*VrfOutputAndProof, error) {
 	if b.epochThreshold == nil {
-		err = b.setEpochThreshold()
+		err := b.setEpochThreshold()
 		if err != nil {
-			return false, err
+			return nil, err
 		}
 	}
 
-	return output_int.Cmp(b.epochThreshold) > 0, nil
+	vrf, err := b.vrfSign(makeTranscript(b.epoch.Randomness, slot, b.epoch.Index))
+	if err != nil {
+		return nil, err
+	}
+
+	pub := b.keypair.Public().(*crypto.Sr25519PublicKey)
+	value, err := lotteryValue(pub, makeTranscript(b.epoch.Randomness, slot, b.epoch.Index), vrf.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	if value.Cmp(b.epochThreshold) < 0 {
+		return vrf, nil
+	}
+
+	return nil, nil
 }
 
 // sets the slot lottery threshold for the current epoch
@@ -193,18 +481,63 @@ func calculateThreshold(C1, C2, authorityIndex uint64, authorityWeights []uint64
 	return q.Mul(q, p_rat.Num()).Div(q, p_rat.Denom()), nil
 }
 
-func (b *Session) vrfSign(input []byte) ([]byte, error) {
-	// TOOD: return VRF output and proof
-	out := make([]byte, 32)
-	_, err := rand.Read(out)
-	return out, err
+// vrfSign creates a VRF output and proof for the transcript using the session's keypair
+func (b *Session) vrfSign(t *merlin.Transcript) (*VrfOutputAndProof, error) {
+	if b.keypair == nil {
+		return nil, errors.New("cannot sign VRF: no keypair")
+	}
+
+	out, proof, err := b.keypair.Private().(*crypto.Sr25519PrivateKey).VrfSign(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VrfOutputAndProof{Output: out, Proof: proof}, nil
 }
 
-// BuildBlock Builds the block
-func (s *Session) buildBlock(number *big.Int) (*types.Block, error) {
-	block := types.Block{
-		Header: types.BlockHeader{Number: number},
-		Body:   []byte{1, 2, 3, 4, 5},
+// VerifySlotWinner checks that the VRF output and proof were created by the authority with the given public key
+// for the slot, epoch and randomness, and that the output is below the authority's threshold
+func VerifySlotWinner(pub *crypto.Sr25519PublicKey, slot, epoch uint64, randomness [RandomnessLength]byte, vrf *VrfOutputAndProof, threshold *big.Int) (bool, error) {
+	ok, err := pub.VrfVerify(makeTranscript(randomness, slot, epoch), vrf.Output, vrf.Proof)
+	if err != nil || !ok {
+		return false, err
 	}
-	return &block, nil
+
+	value, err := lotteryValue(pub, makeTranscript(randomness, slot, epoch), vrf.Output)
+	if err != nil {
+		return false, err
+	}
+
+	return value.Cmp(threshold) < 0, nil
+}
+
+// makeTranscript creates the BABE VRF transcript for a slot
+// see: https://github.com/paritytech/substrate/blob/master/client/consensus/babe/src/authorship.rs
+func makeTranscript(randomness [RandomnessLength]byte, slot, epoch uint64) *merlin.Transcript {
+	t := merlin.NewTranscript("BABE")
+	appendUint64(t, []byte("slot number"), slot)
+	appendUint64(t, []byte("current epoch"), epoch)
+	t.AppendMessage([]byte("chain randomness"), randomness[:])
+	return t
+}
+
+func appendUint64(t *merlin.Transcript, label []byte, n uint64) {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, n)
+	t.AppendMessage(label, buf)
+}
+
+// lotteryValue returns the VRF output as a little-endian u128, which is compared against the slot lottery threshold
+func lotteryValue(pub *crypto.Sr25519PublicKey, t *merlin.Transcript, out [crypto.VrfOutputLength]byte) (*big.Int, error) {
+	b, err := pub.VrfOutputBytes(t, out, babeVrfPrefix, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	// reverse to big-endian for big.Int
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+
+	return new(big.Int).SetBytes(b), nil
 }
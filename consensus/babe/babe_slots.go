@@ -20,30 +20,102 @@ import (
 	"errors"
 	"math/big"
 	"sort"
+	"time"
 
 	"github.com/ChainSafe/gossamer/core/blocktree"
+	log "github.com/ChainSafe/log15"
 )
 
+// slotTail is the number of blocks before the deepest block whose arrival times are used to estimate slot times
+const slotTail = 20
+
+// clock is the source of time for slot timing; it is replaced in tests
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SetGenesisTime sets the start time of slot 0. By default slots are counted from the unix epoch.
+func (b *Session) SetGenesisTime(t time.Time) {
+	b.genesisTime = t
+}
+
+// SetBlockTree sets the block tree whose block arrival times are used to synchronise the slot times, and which
+// authored blocks are built on and imported into
+func (b *Session) SetBlockTree(bt *blocktree.BlockTree) {
+	b.blockTree = bt
+	b.builder.SetBlockTree(bt)
+}
+
+func (b *Session) slotDuration() time.Duration {
+	return time.Duration(b.config.SlotDuration) * time.Millisecond
+}
+
+// slotStart returns the start time of the slot
+func (b *Session) slotStart(slot uint64) time.Time {
+	return b.genesisTime.Add(b.slotOffset + time.Duration(slot)*b.slotDuration())
+}
+
+// currentSlot returns the slot the current time is in
+func (b *Session) currentSlot() uint64 {
+	since := b.clock.Now().Sub(b.genesisTime.Add(b.slotOffset))
+	if since < 0 {
+		return 0
+	}
+	return uint64(since / b.slotDuration())
+}
+
+// syncSlotTime corrects the slot start times by the median of the slot times implied by the arrival times
+// of recent blocks, if there are enough of them; otherwise the local clock is used as is.
+// The caller must hold the lock.
+func (b *Session) syncSlotTime() {
+	if b.blockTree == nil {
+		return
+	}
+
+	slot := b.currentSlot()
+	est, err := b.slotTime(slot, b.blockTree, slotTail)
+	if err != nil {
+		log.Debug("[babe] cannot estimate slot time, using local clock", "error", err)
+		return
+	}
+
+	expected := b.genesisTime.Add(time.Duration(slot) * b.slotDuration())
+	b.slotOffset = time.Unix(0, 0).Add(time.Duration(est) * time.Millisecond).Sub(expected)
+	log.Debug("[babe] synchronised slot time", "slot", slot, "offset", b.slotOffset)
+}
+
 // slotTime calculates the slot time in the form of miliseconds since the unix epoch
-// for a given slot in miliseconds, returns 0 and an error if it can't be calculated
+// for a given slot in miliseconds, returns 0 and an error if it can't be calculated.
+// The slots of the blocks are taken from their recorded BABE data; the caller must hold the lock.
 func (b *Session) slotTime(slot uint64, bt *blocktree.BlockTree, slotTail uint64) (uint64, error) {
 	var at []uint64
 	dl := bt.DeepestBlock()
 	bn := new(big.Int).SetUint64(slotTail)
-	nf := bn.Sub(dl.Header.Number, bn)
+	nf := new(big.Int).Sub(dl.Header.Number, bn)
 	// check to make sure we have enough blocks before the deepest block to accurately calculate slot time
 	if dl.Header.Number.Cmp(bn) <= 0 {
 		return 0, errors.New("Cannot calculate slot time, deepest leaf block number less than or equal to Slot Tail")
 	}
 	s := bt.GetBlockFromBlockNumber(nf)
-	err := b.configurationFromRuntime()
 	sd := b.config.SlotDuration
-	if err != nil {
-		return 0, err
-	}
 	for _, block := range bt.SubBlockchain(s.Header.Number, dl.Header.Number) {
-		so, offsetErr := slotOffset(bt.ComputeSlotForBlock(block, sd), slot)
-		if offsetErr != nil {
+		blk, err := b.getEpochBlock(block.Header.Hash)
+		if err != nil {
+			return 0, err
+		}
+		// blocks without BABE data or arrival time tell nothing about the slot times
+		if blk == nil || block.GetBlockArrivalTime() == 0 {
+			continue
+		}
+
+		so, err := slotOffset(blk.Slot, slot)
+		if err != nil {
 			return 0, err
 		}
 		st := block.GetBlockArrivalTime() + (so * sd)
@@ -68,7 +140,7 @@ func median(l []uint64) (uint64, error) {
 	if m == 0 {
 		return 0, errors.New("Arrival times list is empty!")
 	} else if m%2 == 0 {
-		med = (l[(m/2)-1] + l[(m/2)+1]) / 2
+		med = (l[(m/2)-1] + l[m/2]) / 2
 	} else {
 		med = l[m/2]
 	}
@@ -25,13 +25,16 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ChainSafe/gossamer/common"
+	tx "github.com/ChainSafe/gossamer/common/transaction"
 	"github.com/ChainSafe/gossamer/core/blocktree"
 	"github.com/ChainSafe/gossamer/core/types"
-	"github.com/ChainSafe/gossamer/p2p"
+	"github.com/ChainSafe/gossamer/crypto"
+	"github.com/ChainSafe/gossamer/internal/events"
 	db "github.com/ChainSafe/gossamer/polkadb"
 	"github.com/ChainSafe/gossamer/runtime"
 	"github.com/ChainSafe/gossamer/trie"
@@ -164,7 +167,12 @@ func TestCalculateThreshold_AuthorityWeights(t *testing.T) {
 
 func TestRunLottery(t *testing.T) {
 	rt := newRuntime(t)
-	babesession, err := NewSession([32]byte{}, [64]byte{}, rt, nil)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -176,7 +184,7 @@ func TestRunLottery(t *testing.T) {
 		C1:                 3,
 		C2:                 10,
 		GenesisAuthorities: []AuthorityData{},
-		Randomness:         0,
+		Randomness:         [RandomnessLength]byte{},
 		SecondarySlots:     false,
 	}
 	babesession.config = conf
@@ -201,7 +209,12 @@ func TestCalculateThreshold_Failing(t *testing.T) {
 
 func TestConfigurationFromRuntime(t *testing.T) {
 	rt := newRuntime(t)
-	babesession, err := NewSession([32]byte{}, [64]byte{}, rt, nil)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -217,11 +230,11 @@ func TestConfigurationFromRuntime(t *testing.T) {
 		C1:                 3,
 		C2:                 10,
 		GenesisAuthorities: []AuthorityData{},
-		Randomness:         0,
+		Randomness:         [RandomnessLength]byte{},
 		SecondarySlots:     false,
 	}
 
-	if babesession.config == expected {
+	if !reflect.DeepEqual(babesession.config, expected) {
 		t.Errorf("Fail: got %v expected %v\n", babesession.config, expected)
 	}
 }
@@ -334,10 +347,26 @@ func createFlatBlockTree(t *testing.T, depth int) *blocktree.BlockTree {
 
 }
 
+// recordSlots records the BABE data of the blocks of a flat block tree, block i being produced at slot i
+func recordSlots(t *testing.T, babesession *Session, depth int) {
+	for i := 1; i <= depth; i++ {
+		hash, err := common.HexToHash(fmt.Sprintf("0x%06x", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		babesession.epochBlocks[hash] = &epochBlock{Slot: uint64(i)}
+	}
+}
+
 func TestSlotTime(t *testing.T) {
 	rt := newRuntime(t)
 	bt := createFlatBlockTree(t, 100)
-	babesession, err := NewSession([32]byte{}, [64]byte{}, rt, nil)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -345,6 +374,7 @@ func TestSlotTime(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	recordSlots(t, babesession, 100)
 
 	res, err := babesession.slotTime(103, bt, 20)
 	if err != nil {
@@ -361,19 +391,22 @@ func TestSlotTime(t *testing.T) {
 
 func TestStart(t *testing.T) {
 	rt := newRuntime(t)
-	babesession, err := NewSession([32]byte{}, [64]byte{}, rt, nil)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	babesession.authorityIndex = 0
-	babesession.authorityWeights = []uint64{1}
 	conf := &BabeConfiguration{
 		SlotDuration:       1,
 		EpochLength:        6,
 		C1:                 1,
 		C2:                 10,
-		GenesisAuthorities: []AuthorityData{},
-		Randomness:         0,
+		GenesisAuthorities: []AuthorityData{newAuthorityData(kp, 1)},
+		Randomness:         [RandomnessLength]byte{},
 		SecondarySlots:     false,
 	}
 	babesession.config = conf
@@ -382,37 +415,1110 @@ func TestStart(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer babesession.Stop()
 	time.Sleep(time.Duration(conf.SlotDuration) * time.Duration(conf.EpochLength) * time.Millisecond)
 }
 
 func TestBabeAnnounceMessage(t *testing.T) {
 	rt := newRuntime(t)
 
-	// Block Announce Channel called when Build-Block Creates a block
-	blockAnnounceChan := make(chan p2p.BlockAnnounceMessage)
-	babesession, err := NewSession([32]byte{}, [64]byte{}, rt, blockAnnounceChan)
+	// BlockProduced is published when Build-Block creates a block
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.BlockProducedTopic)
+	defer sub.Unsubscribe()
+
+	kp, err := crypto.GenerateSr25519Keypair()
 	if err != nil {
 		t.Fatal(err)
 	}
-	babesession.authorityIndex = 0
-	babesession.authorityWeights = []uint64{1, 1, 1}
+
+	babesession, err := NewSession(kp, rt, bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setAuthorities(babesession, newAuthorityData(kp, 1))
+	// c = 1, so we win the lottery for every slot
+	babesession.config.C1 = babesession.config.C2
+	clk := newTestClock(time.Unix(1000, 0))
+	babesession.clock = clk
+	babesession.SetGenesisTime(clk.Now())
 
 	err = babesession.Start()
 	if err != nil {
 		t.Fatal(err)
 	}
-	time.Sleep(time.Duration(babesession.config.SlotDuration) * time.Duration(babesession.config.EpochLength) * time.Millisecond)
+	defer babesession.Stop()
 
 	for i := 0; i < int(babesession.config.EpochLength); i++ {
-		blk := <-blockAnnounceChan
+		e := <-sub.Chan()
+		blk := e.(*events.BlockProduced).Block
+
+		expectedNumber := big.NewInt(int64(i + 1))
+		if blk.Header.Number.Cmp(expectedNumber) != 0 {
+			t.Fatalf("Didn't receive the correct block: %+v\nExpected block number: %d", blk, expectedNumber)
+		}
+	}
+
+}
+
+func TestVerifySlotWinner(t *testing.T) {
+	rt := newRuntime(t)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	babesession.authorityIndex = 0
+	babesession.authorityWeights = []uint64{1}
+	babesession.config.C1 = babesession.config.C2
+
+	var slot uint64 = 3
+	vrf, err := babesession.runLottery(slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vrf == nil {
+		t.Fatal("Fail: did not win slot lottery with c = 1")
+	}
+
+	pub := kp.Public().(*crypto.Sr25519PublicKey)
+	ok, err := VerifySlotWinner(pub, slot, 0, babesession.epoch.Randomness, vrf, babesession.epochThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Fail: did not verify slot winner")
+	}
+
+	ok, err = VerifySlotWinner(pub, slot+1, 0, babesession.epoch.Randomness, vrf, babesession.epochThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("Fail: verified slot winner for the wrong slot")
+	}
+
+	other, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = VerifySlotWinner(other.Public().(*crypto.Sr25519PublicKey), slot, 0, babesession.epoch.Randomness, vrf, babesession.epochThreshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("Fail: verified slot winner for the wrong authority")
+	}
+}
+
+func newAuthorityData(kp *crypto.Sr25519Keypair, weight uint64) AuthorityData {
+	auth := AuthorityData{AuthorityWeight: weight}
+	copy(auth.AuthorityId[:], kp.Public().Encode())
+	return auth
+}
+
+// setAuthorities makes the authorities the genesis authorities, and starts the first epoch with them
+func setAuthorities(babesession *Session, authorities ...AuthorityData) {
+	babesession.config.GenesisAuthorities = authorities
+	babesession.epoch = genesisEpoch(babesession.config)
+	babesession.startEpoch()
+}
+
+// mustClaim returns the session's claim on a slot of the current epoch
+func mustClaim(t *testing.T, babesession *Session, slot uint64) *BabeHeader {
+	claim, err := babesession.claim(slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claim
+}
+
+func newPreDigest(t *testing.T, pre *BabeHeader) *types.DigestItem {
+	enc, err := pre.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.NewPreRuntimeDigest(types.BabeEngineID, enc)
+}
+
+func newTestHeader(t *testing.T, items ...*types.DigestItem) *types.BlockHeader {
+	digest, err := types.EncodeDigest(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &types.BlockHeader{Number: big.NewInt(1), Digest: digest}
+}
+
+// newChildHeader returns a header with the digest items built on the parent
+func newChildHeader(t *testing.T, parent *types.BlockHeader, items ...*types.DigestItem) *types.BlockHeader {
+	header := newTestHeader(t, items...)
+	header.ParentHash = hashOf(t, parent)
+	header.Number = new(big.Int).Add(parent.Number, big.NewInt(1))
+	return header
+}
+
+func hashOf(t *testing.T, header *types.BlockHeader) common.Hash {
+	hash, err := header.CalculateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// newGenesisTree returns a block tree whose genesis block is the parent of the test headers of block #1
+func newGenesisTree() *blocktree.BlockTree {
+	genesis := types.Block{
+		Header: types.BlockHeader{Number: big.NewInt(0)},
+		Body:   types.BlockBody{},
+	}
+	return blocktree.NewBlockTreeFromGenesis(genesis, &db.BlockDB{Db: db.NewMemDatabase()})
+}
+
+// addHeader adds a block with the header to the block tree
+func addHeader(t *testing.T, bt *blocktree.BlockTree, header *types.BlockHeader) {
+	block := types.Block{Header: *header, Body: types.BlockBody{}}
+	block.Header.Hash = hashOf(t, header)
+	bt.AddBlock(block)
+}
+
+func TestEpochFor(t *testing.T) {
+	rt := newRuntime(t)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setAuthorities(babesession, newAuthorityData(kp, 1))
+	length := babesession.config.EpochLength
+
+	// block #1 starts the first epoch at its slot, and announces a new authority set
+	pre := &BabeHeader{Type: PrimaryPreDigestType, VrfOutput: [32]byte{1, 2, 3}, SlotNumber: 5}
+	next := &NextEpochDescriptor{Authorities: []AuthorityData{newAuthorityData(other, 1), newAuthorityData(kp, 2)}}
+	enc, err := next.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := newTestHeader(t, newPreDigest(t, pre), types.NewConsensusDigest(types.BabeEngineID, enc))
+
+	// a block on another fork does not contribute to the epoch's randomness, nor is its authority set applied
+	forkPre := &BabeHeader{Type: PrimaryPreDigestType, VrfOutput: [32]byte{7, 8, 9}, SlotNumber: 6}
+	forkNext := &NextEpochDescriptor{Authorities: []AuthorityData{newAuthorityData(other, 1)}}
+	enc, err = forkNext.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork := newTestHeader(t, newPreDigest(t, forkPre), types.NewConsensusDigest(types.BabeEngineID, enc))
+
+	second := newChildHeader(t, first, newPreDigest(t, &BabeHeader{Type: SecondaryPlainPreDigestType, SlotNumber: 7}))
 
-		expectedBlockAnnounceMsg := p2p.BlockAnnounceMessage{
-			Number: big.NewInt(int64(i)),
+	// the first block past the end of the epoch starts the next one
+	thirdPre := &BabeHeader{Type: PrimaryPreDigestType, VrfOutput: [32]byte{4, 5, 6}, SlotNumber: 5 + length}
+	third := newChildHeader(t, second, newPreDigest(t, thirdPre))
+
+	for _, header := range []*types.BlockHeader{first, fork, second, third} {
+		err = babesession.HandleHeader(header)
+		if err != nil {
+			t.Fatal(err)
 		}
+	}
+
+	babesession.lock.Lock()
+	epoch, key, err := babesession.epochFor(hashOf(t, second), 3, 4+length)
+	babesession.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != hashOf(t, first) || epoch.Index != 0 || epoch.StartSlot != 5 {
+		t.Fatalf("Fail: got epoch %d starting at slot %d expected epoch 0 starting at slot 5", epoch.Index, epoch.StartSlot)
+	}
+
+	expectedRandomness, err := nextRandomness([RandomnessLength]byte{}, 0, [][32]byte{pre.VrfOutput})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &EpochData{
+		Index:       1,
+		StartSlot:   5 + length,
+		Duration:    length,
+		Authorities: next.Authorities,
+		Randomness:  expectedRandomness,
+	}
+
+	thirdHash := hashOf(t, third)
+	if blk := babesession.epochBlocks[thirdHash]; blk.Epoch != thirdHash {
+		t.Fatalf("Fail: got epoch %x for block %x expected the epoch it starts", blk.Epoch, thirdHash)
+	}
+	if !reflect.DeepEqual(babesession.epochs[thirdHash], expected) {
+		t.Fatalf("Fail: got %v expected %v", babesession.epochs[thirdHash], expected)
+	}
+
+	// the fork's epochs are resolved along the fork
+	forkRandomness, err := nextRandomness([RandomnessLength]byte{}, 0, [][32]byte{forkPre.VrfOutput})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession.lock.Lock()
+	epoch, _, err = babesession.epochFor(hashOf(t, fork), 2, 6+length)
+	babesession.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch.StartSlot != 6+length || epoch.Randomness != forkRandomness || !reflect.DeepEqual(epoch.Authorities, forkNext.Authorities) {
+		t.Fatalf("Fail: got fork epoch %v", epoch)
+	}
+
+	// epochs without blocks are skipped
+	babesession.lock.Lock()
+	epoch, key, err = babesession.epochFor(thirdHash, 4, 5+4*length+1)
+	babesession.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != (common.Hash{}) || epoch.Index != 4 || epoch.StartSlot != 5+4*length {
+		t.Fatalf("Fail: got epoch %d starting at slot %d expected epoch 4 starting at slot %d", epoch.Index, epoch.StartSlot, 5+4*length)
+	}
+
+	// the block of an unknown parent has no epoch
+	babesession.lock.Lock()
+	_, _, err = babesession.epochFor(common.Hash{1}, 2, 6)
+	babesession.lock.Unlock()
+	if err != ErrUnknownEpoch {
+		t.Fatalf("Fail: got %v expected %v", err, ErrUnknownEpoch)
+	}
+
+	// blocks authored on the third block are claimed in its epoch
+	bt := newGenesisTree()
+	for _, header := range []*types.BlockHeader{first, second, third} {
+		addHeader(t, bt, header)
+	}
+	babesession.SetBlockTree(bt)
+
+	babesession.lock.Lock()
+	_, err = babesession.slotClaim(6 + length)
+	babesession.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(babesession.Epoch(), expected) {
+		t.Fatalf("Fail: got %v expected %v", babesession.Epoch(), expected)
+	}
+
+	if babesession.authorityIndex != 1 {
+		t.Fatalf("Fail: got authority index %d expected 1", babesession.authorityIndex)
+	}
+
+	if !reflect.DeepEqual(babesession.authorityWeights, []uint64{1, 2}) {
+		t.Fatalf("Fail: got authority weights %v expected [1 2]", babesession.authorityWeights)
+	}
+}
+
+func TestEpochData_Persisted(t *testing.T) {
+	rt := newRuntime(t)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	database := db.NewMemDatabase()
 
-		if !reflect.DeepEqual(blk, expectedBlockAnnounceMsg) {
-			t.Fatalf("Didn't receive the correct block: %+v\nExpected block: %+v", blk, expectedBlockAnnounceMsg)
+	babesession, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = babesession.SetEpochDB(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	length := babesession.config.EpochLength
+	pre := &BabeHeader{Type: PrimaryPreDigestType, VrfOutput: [32]byte{1, 2, 3}, SlotNumber: 0}
+	first := newTestHeader(t, newPreDigest(t, pre))
+	second := newChildHeader(t, first, newPreDigest(t, &BabeHeader{Type: SecondaryPlainPreDigestType, SlotNumber: length}))
+	for _, header := range []*types.BlockHeader{first, second} {
+		err = babesession.HandleHeader(header)
+		if err != nil {
+			t.Fatal(err)
 		}
 	}
 
+	// restart
+	restarted, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = restarted.SetEpochDB(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted.lock.Lock()
+	defer restarted.lock.Unlock()
+
+	blk, err := restarted.getEpochBlock(hashOf(t, first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blk == nil || blk.VrfOutput == nil || *blk.VrfOutput != pre.VrfOutput {
+		t.Fatalf("Fail: got epoch block %v expected VRF output %x", blk, pre.VrfOutput)
+	}
+
+	secondHash := hashOf(t, second)
+	epoch, err := restarted.getEpoch(secondHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(epoch, babesession.epochs[secondHash]) {
+		t.Fatalf("Fail: got %v expected %v", epoch, babesession.epochs[secondHash])
+	}
+
+	// the epoch of a child of the second block is resolved from the restored data
+	_, key, err := restarted.epochFor(secondHash, 3, length+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != secondHash {
+		t.Fatalf("Fail: got epoch %x expected %x", key, secondHash)
+	}
+}
+
+// newSealedHeader returns a header of block #1 claiming the slot with a BABE pre-digest, sealed by the session's key
+func newSealedHeader(t *testing.T, babesession *Session, slot uint64) *types.BlockHeader {
+	return newSealedChildHeader(t, babesession, nil, slot)
+}
+
+// newSealedChildHeader returns a header built on the parent, or on the genesis block if the parent is nil, claiming
+// the slot with a BABE pre-digest, sealed by the session's key
+func newSealedChildHeader(t *testing.T, babesession *Session, parent *types.BlockHeader, slot uint64) *types.BlockHeader {
+	vrf, err := babesession.runLottery(slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vrf == nil {
+		t.Fatalf("Fail: did not win slot lottery for slot %d", slot)
+	}
+
+	pre := &BabeHeader{
+		Type:               PrimaryPreDigestType,
+		VrfOutput:          vrf.Output,
+		VrfProof:           vrf.Proof,
+		BlockProducerIndex: babesession.authorityIndex,
+		SlotNumber:         slot,
+	}
+	header := newTestHeader(t, newPreDigest(t, pre))
+	if parent != nil {
+		header = newChildHeader(t, parent, newPreDigest(t, pre))
+	}
+
+	err = babesession.sealHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestVerifyHeader(t *testing.T) {
+	rt := newRuntime(t)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// c = 1, so we win the lottery for every slot
+	babesession.config.C1 = babesession.config.C2
+	setAuthorities(babesession, newAuthorityData(other, 1), newAuthorityData(kp, 1))
+
+	err = babesession.VerifyHeader(newSealedHeader(t, babesession, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the header is changed after being sealed
+	header := newSealedHeader(t, babesession, 2)
+	header.StateRoot = common.Hash{1}
+	if err = babesession.VerifyHeader(header); err != ErrInvalidSeal {
+		t.Fatalf("Fail: got %v expected %v", err, ErrInvalidSeal)
+	}
+
+	// the header is not sealed
+	pre := &BabeHeader{Type: PrimaryPreDigestType, SlotNumber: 2, BlockProducerIndex: 1}
+	header = newTestHeader(t, newPreDigest(t, pre))
+	if err = babesession.VerifyHeader(header); err != ErrNoSeal {
+		t.Fatalf("Fail: got %v expected %v", err, ErrNoSeal)
+	}
+
+	// the header claims to be produced by another authority
+	babesession.authorityIndex = 0
+	header = newSealedHeader(t, babesession, 2)
+	if err = babesession.VerifyHeader(header); err != ErrInvalidSeal {
+		t.Fatalf("Fail: got %v expected %v", err, ErrInvalidSeal)
+	}
+
+	babesession.authorityIndex = 2
+	header = newSealedHeader(t, babesession, 2)
+	if err = babesession.VerifyHeader(header); err != ErrInvalidAuthorityIndex {
+		t.Fatalf("Fail: got %v expected %v", err, ErrInvalidAuthorityIndex)
+	}
+	babesession.authorityIndex = 1
+
+	// the slot is before the start of the parent's epoch
+	parent := newSealedHeader(t, babesession, 2)
+	err = babesession.HandleHeader(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header = newSealedChildHeader(t, babesession, parent, 1)
+	if err = babesession.VerifyHeader(header); err != ErrSlotNotInEpoch {
+		t.Fatalf("Fail: got %v expected %v", err, ErrSlotNotInEpoch)
+	}
+
+	// the VRF proof is for a different slot than claimed
+	vrf, err := babesession.runLottery(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pre = &BabeHeader{Type: PrimaryPreDigestType, VrfOutput: vrf.Output, VrfProof: vrf.Proof, BlockProducerIndex: 1, SlotNumber: 2}
+	header = newTestHeader(t, newPreDigest(t, pre))
+	err = babesession.sealHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = babesession.VerifyHeader(header); err != ErrInvalidVrf {
+		t.Fatalf("Fail: got %v expected %v", err, ErrInvalidVrf)
+	}
+
+	header = newSealedHeader(t, babesession, 5)
+
+	// the slot starts 5 seconds after the verifier's clock
+	v := NewVerifier(babesession.config, babesession.epoch)
+	v.now = func() time.Time { return time.Unix(0, 0) }
+	v.maxDrift = time.Second
+	if err = v.VerifyHeader(header); err != ErrFutureBlock {
+		t.Fatalf("Fail: got %v expected %v", err, ErrFutureBlock)
+	}
+
+	// the output is above the threshold of a nearly-always empty slot
+	conf := *babesession.config
+	conf.C1 = 1
+	conf.C2 = math.MaxUint64
+	v = NewVerifier(&conf, babesession.epoch)
+	if err = v.VerifyHeader(header); err != ErrVrfOverThreshold {
+		t.Fatalf("Fail: got %v expected %v", err, ErrVrfOverThreshold)
+	}
+}
+
+func TestVerifyHeader_EpochChange(t *testing.T) {
+	rt := newRuntime(t)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	author, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// c = 1, so we win the lottery for every slot
+	author.config.C1 = author.config.C2
+	setAuthorities(author, newAuthorityData(kp, 1))
+	bt := newGenesisTree()
+	author.SetBlockTree(bt)
+
+	// a node that is not an authority imports the chain
+	verifier, err := NewSession(nil, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier.config.C1 = verifier.config.C2
+	setAuthorities(verifier, newAuthorityData(kp, 1))
+
+	length := author.config.EpochLength
+	var parent *types.BlockHeader
+	var stale *BabeHeader
+	for slot := uint64(1); slot <= length+2; slot++ {
+		author.lock.Lock()
+		claim, err := author.slotClaim(slot)
+		if err == nil && slot == length {
+			// a claim on the first slot of the next epoch made with the data of the current one
+			stale, err = author.claimSlot(length + 1)
+		}
+		author.lock.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claim == nil {
+			t.Fatalf("Fail: did not claim slot %d", slot)
+		}
+
+		header := newTestHeader(t, newPreDigest(t, claim))
+		if parent != nil {
+			header = newChildHeader(t, parent, newPreDigest(t, claim))
+		}
+		err = author.sealHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = verifier.VerifyHeader(header)
+		if err != nil {
+			t.Fatalf("Fail: cannot verify block for slot %d: %s", slot, err)
+		}
+
+		for _, s := range []*Session{author, verifier} {
+			err = s.HandleHeader(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		addHeader(t, bt, header)
+		parent = header
+
+		if slot == length {
+			wrong := newChildHeader(t, header, newPreDigest(t, stale))
+			err = author.sealHeader(wrong)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = verifier.VerifyHeader(wrong); err != ErrInvalidVrf {
+				t.Fatalf("Fail: got %v expected %v", err, ErrInvalidVrf)
+			}
+		}
+	}
+
+	if epoch := author.Epoch(); epoch.Index != 1 || epoch.StartSlot != length+1 {
+		t.Fatalf("Fail: got epoch %d starting at slot %d expected epoch 1 starting at slot %d", epoch.Index, epoch.StartSlot, length+1)
+	}
+}
+
+// testClock is a clock whose time moves when it is waited on, and by step every time it is read
+type testClock struct {
+	lock sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func newTestClock(now time.Time) *testClock {
+	return &testClock{now: now}
+}
+
+func (c *testClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func (c *testClock) setStep(step time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.step = step
+}
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// slotOf returns the slot claimed by the BABE pre-digest of the header
+func slotOf(t *testing.T, header *types.BlockHeader) uint64 {
+	pre, _, err := babeDigests(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pre == nil {
+		t.Fatal("Fail: block has no BABE pre-digest")
+	}
+	return pre.SlotNumber
+}
+
+func TestCurrentSlot(t *testing.T) {
+	rt := newRuntime(t)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesis := time.Unix(1000, 0)
+	sd := babesession.slotDuration()
+	babesession.SetGenesisTime(genesis)
+	babesession.clock = newTestClock(genesis.Add(2*sd + sd/2))
+
+	if slot := babesession.currentSlot(); slot != 2 {
+		t.Fatalf("Fail: got slot %d expected 2", slot)
+	}
+
+	if start := babesession.slotStart(2); !start.Equal(genesis.Add(2 * sd)) {
+		t.Fatalf("Fail: got slot start %v expected %v", start, genesis.Add(2*sd))
+	}
+
+	babesession.clock = newTestClock(genesis.Add(-sd))
+	if slot := babesession.currentSlot(); slot != 0 {
+		t.Fatalf("Fail: got slot %d before genesis expected 0", slot)
+	}
+}
+
+func TestInvokeBlockAuthoring_WallClock(t *testing.T) {
+	rt := newRuntime(t)
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.BlockProducedTopic)
+	defer sub.Unsubscribe()
+
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setAuthorities(babesession, newAuthorityData(kp, 1))
+	babesession.config.C1 = babesession.config.C2
+
+	// start in the middle of slot 3
+	genesis := time.Unix(1000, 0)
+	sd := babesession.slotDuration()
+	clk := newTestClock(genesis.Add(3*sd + sd/2))
+	babesession.clock = clk
+	babesession.SetGenesisTime(genesis)
+
+	err = babesession.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer babesession.Stop()
+
+	// blocks are produced for consecutive slots across epochs, each once its slot has started; the first epoch
+	// starts at the slot of block #1
+	length := babesession.config.EpochLength
+	for i := uint64(0); i < 2*length; i++ {
+		blk := (<-sub.Chan()).(*events.BlockProduced).Block
+		if slot := slotOf(t, &blk.Header); slot != 3+i {
+			t.Fatalf("Fail: got block for slot %d expected %d", slot, 3+i)
+		}
+
+		babesession.lock.Lock()
+		epoch, err := babesession.getEpoch(babesession.epochBlocks[hashOf(t, &blk.Header)].Epoch)
+		babesession.lock.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index := i / length; epoch.Index != index || epoch.StartSlot != 3+index*length {
+			t.Fatalf("Fail: got block in epoch %d starting at slot %d expected epoch %d starting at slot %d", epoch.Index, epoch.StartSlot, index, 3+index*length)
+		}
+	}
+
+	// time spent in each slot does not accumulate, so no slots are skipped over long runs
+	clk.setStep(time.Millisecond)
+	prev := slotOf(t, &(<-sub.Chan()).(*events.BlockProduced).Block.Header)
+	for i := 0; i < 2000; i++ {
+		slot := slotOf(t, &(<-sub.Chan()).(*events.BlockProduced).Block.Header)
+		if slot != prev+1 {
+			t.Fatalf("Fail: got block for slot %d after slot %d", slot, prev)
+		}
+		prev = slot
+	}
+}
+
+func TestSetEpochDB_Resume(t *testing.T) {
+	rt := newRuntime(t)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	database := db.NewMemDatabase()
+	genesis := time.Unix(1000, 0)
+	first := newTestHeader(t, newPreDigest(t, &BabeHeader{Type: SecondaryPlainPreDigestType, SlotNumber: 0}))
+	bt := newGenesisTree()
+	addHeader(t, bt, first)
+
+	babesession, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	babesession.SetGenesisTime(genesis)
+	babesession.SetBlockTree(bt)
+	err = babesession.SetEpochDB(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = babesession.HandleHeader(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// restart two epochs and one slot later
+	restarted, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	length := restarted.config.EpochLength
+	restarted.SetGenesisTime(genesis)
+	restarted.clock = newTestClock(genesis.Add(time.Duration(2*length+1) * restarted.slotDuration()))
+	restarted.SetBlockTree(bt)
+	err = restarted.SetEpochDB(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the session resumes in the epoch of the best block
+	if !reflect.DeepEqual(restarted.Epoch(), babesession.epochs[hashOf(t, first)]) {
+		t.Fatalf("Fail: got %v expected %v", restarted.Epoch(), babesession.epochs[hashOf(t, first)])
+	}
+
+	// and catches up on the epochs that passed while it was down
+	restarted.lock.Lock()
+	_, err = restarted.slotClaim(restarted.currentSlot())
+	restarted.lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	epoch := restarted.Epoch()
+	if epoch.Index != 2 || epoch.StartSlot != 2*length {
+		t.Fatalf("Fail: got epoch %d starting at slot %d expected epoch 2 starting at slot %d", epoch.Index, epoch.StartSlot, 2*length)
+	}
+}
+
+func TestSyncSlotTime(t *testing.T) {
+	rt := newRuntime(t)
+	bt := createFlatBlockTree(t, 100)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	babesession.SetBlockTree(bt)
+	recordSlots(t, babesession, 100)
+
+	// the genesis block arrived at 1s, but our genesis time is 300ms later
+	genesis := time.Unix(1, 300*int64(time.Millisecond))
+	babesession.SetGenesisTime(genesis)
+	babesession.clock = newTestClock(genesis.Add(103*babesession.slotDuration() + time.Millisecond))
+
+	babesession.syncSlotTime()
+
+	if babesession.slotOffset != -300*time.Millisecond {
+		t.Fatalf("Fail: got slot offset %v expected -300ms", babesession.slotOffset)
+	}
+}
+
+func TestBabeHeader_EncodeAndDecode(t *testing.T) {
+	for _, typ := range []byte{PrimaryPreDigestType, SecondaryPlainPreDigestType, SecondaryVrfPreDigestType} {
+		bh := &BabeHeader{
+			Type:               typ,
+			BlockProducerIndex: 7,
+			SlotNumber:         1000,
+		}
+		if typ != SecondaryPlainPreDigestType {
+			bh.VrfOutput = [32]byte{1, 2, 3}
+			bh.VrfProof = [64]byte{4, 5, 6}
+		}
+
+		enc, err := bh.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := new(BabeHeader)
+		err = res.Decode(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(res, bh) {
+			t.Fatalf("Fail: got %v expected %v", res, bh)
+		}
+	}
+
+	err := new(BabeHeader).Decode([]byte{SecondaryPlainPreDigestType, 1, 2})
+	if err == nil {
+		t.Fatal("Fail: did not error for short header")
+	}
+}
+
+func TestClaimSlot_Secondary(t *testing.T) {
+	rt := newRuntime(t)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// primary slots are nearly always empty
+	babesession.config.C1 = 1
+	babesession.config.C2 = math.MaxUint64
+	babesession.config.SecondarySlots = true
+	setAuthorities(babesession, newAuthorityData(other, 1), newAuthorityData(kp, 1))
+
+	for _, vrf := range []bool{false, true} {
+		babesession.SetSecondarySlotVrf(vrf)
+		babesession.startEpoch()
+
+		var ours, theirs uint64
+		claimed := false
+		for slot := uint64(0); slot < 64; slot++ {
+			author, err := secondarySlotAuthor(babesession.epoch.Randomness, slot, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claim := mustClaim(t, babesession, slot)
+			if (claim != nil) != (author == babesession.authorityIndex) {
+				t.Fatalf("Fail: got claim %v for slot %d with secondary author %d", claim, slot, author)
+			}
+
+			if claim == nil {
+				theirs = slot
+				continue
+			}
+
+			ours = slot
+			claimed = true
+			if !claim.IsSecondary() || claim.HasVrf() != vrf {
+				t.Fatalf("Fail: got claim of type %d", claim.Type)
+			}
+		}
+
+		if !claimed {
+			t.Fatal("Fail: did not claim any secondary slot")
+		}
+
+		pre := mustClaim(t, babesession, ours)
+		header := newTestHeader(t, newPreDigest(t, pre))
+		err = babesession.sealHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = babesession.VerifyHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		weight, err := BlockWeight(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if weight != 0 {
+			t.Fatalf("Fail: got weight %d for secondary block expected 0", weight)
+		}
+
+		// claim a secondary slot assigned to the other authority
+		wrong := *pre
+		wrong.SlotNumber = theirs
+		header = newTestHeader(t, newPreDigest(t, &wrong))
+		err = babesession.sealHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = babesession.VerifyHeader(header); err != ErrNotSecondaryAuthor {
+			t.Fatalf("Fail: got %v expected %v", err, ErrNotSecondaryAuthor)
+		}
+	}
+
+	babesession.config.SecondarySlots = false
+	header := newTestHeader(t, newPreDigest(t, &BabeHeader{Type: SecondaryPlainPreDigestType, BlockProducerIndex: 1}))
+	err = babesession.sealHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = babesession.VerifyHeader(header); err != ErrSecondarySlotsOff {
+		t.Fatalf("Fail: got %v expected %v", err, ErrSecondarySlotsOff)
+	}
+
+	// primary blocks add weight to their chain
+	babesession.config.C1 = babesession.config.C2
+	babesession.startEpoch()
+	weight, err := BlockWeight(newSealedHeader(t, babesession, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weight != 1 {
+		t.Fatalf("Fail: got weight %d for primary block expected 1", weight)
+	}
+}
+
+func TestBuildBlock(t *testing.T) {
+	rt := newRuntime(t)
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	babesession.config.C1 = babesession.config.C2
+	setAuthorities(babesession, newAuthorityData(kp, 1))
+	babesession.SetGenesisTime(time.Now().Add(-2 * babesession.slotDuration()))
+
+	genesis := types.Block{
+		Header: types.BlockHeader{Number: big.NewInt(0), Hash: common.Hash{0x01}},
+		Body:   types.BlockBody{},
+	}
+	bt := blocktree.NewBlockTreeFromGenesis(genesis, &db.BlockDB{Db: db.NewMemDatabase()})
+	babesession.SetBlockTree(bt)
+
+	// a transaction the runtime cannot apply
+	ext := types.Extrinsic{1, 2, 3}
+	err = babesession.PushToTxQueue(tx.NewValidTransaction(&ext, tx.NewValidity(1, nil, [][]byte{{1}}, 10, true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := babesession.buildBlock(2, mustClaim(t, babesession, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if block.Header.Number.Cmp(big.NewInt(1)) != 0 || block.Header.ParentHash != genesis.Header.Hash {
+		t.Fatalf("Fail: got block %d with parent %x expected block 1 with parent %x", block.Header.Number, block.Header.ParentHash, genesis.Header.Hash)
+	}
+
+	if slot := slotOf(t, &block.Header); slot != 2 {
+		t.Fatalf("Fail: got block for slot %d expected 2", slot)
+	}
+
+	err = babesession.VerifyHeader(&block.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bt.BestBlockHash() != block.Header.Hash {
+		t.Fatalf("Fail: got best block %x expected %x", bt.BestBlockHash(), block.Header.Hash)
+	}
+
+	exts, err := block.Body.Extrinsics()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(exts) != 0 {
+		t.Fatalf("Fail: got %d extrinsics expected none", len(exts))
+	}
+
+	hash, err := common.Blake2bHash(ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the runtime fails to apply the transaction rather than reporting it invalid, so it is dropped without a ban
+	if babesession.TxPool().Get(hash) != nil {
+		t.Fatal("Fail: transaction the runtime failed to apply is still in the pool")
+	}
+	if babesession.TxPool().IsBanned(hash) {
+		t.Fatal("Fail: transaction the runtime failed to apply was banned")
+	}
+
+	// the next block is built on top of the imported block
+	next, err := babesession.buildBlock(3, mustClaim(t, babesession, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Header.Number.Cmp(big.NewInt(2)) != 0 || next.Header.ParentHash != block.Header.Hash {
+		t.Fatalf("Fail: got block %d with parent %x expected block 2 with parent %x", next.Header.Number, next.Header.ParentHash, block.Header.Hash)
+	}
+}
+
+func TestVerifyHeader_Equivocation(t *testing.T) {
+	rt := newRuntime(t)
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.EquivocationDetectedTopic)
+	defer sub.Unsubscribe()
+
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	babesession, err := NewSession(kp, rt, bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	babesession.config.C1 = babesession.config.C2
+	setAuthorities(babesession, newAuthorityData(kp, 1))
+
+	first := newSealedHeader(t, babesession, 2)
+	second := newSealedHeader(t, babesession, 2)
+	second.StateRoot = common.Hash{1}
+	err = babesession.sealHeader(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// verifying the same header twice is not an equivocation
+	for _, header := range []*types.BlockHeader{first, first, newSealedHeader(t, babesession, 3), second} {
+		err = babesession.VerifyHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case e := <-sub.Chan():
+		proof := e.(*events.EquivocationDetected).Proof
+		if proof.Slot != 2 || proof.FirstHeader.Hash != first.Hash || proof.SecondHeader.Hash != second.Hash {
+			t.Fatalf("Fail: got equivocation %+v", proof)
+		}
+		if proof.Offender != babesession.epoch.Authorities[0].AuthorityId {
+			t.Fatalf("Fail: got offender %x expected %x", proof.Offender, babesession.epoch.Authorities[0].AuthorityId)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Fail: did not receive EquivocationDetected event")
+	}
+
+	if equivocations := babesession.Equivocations(); len(equivocations) != 1 {
+		t.Fatalf("Fail: got %d equivocations expected 1", len(equivocations))
+	}
+
+	// headers of slots outside of the window are forgotten
+	babesession.checkEquivocation(first, [32]byte{}, 3+equivocationSlotWindow+1)
+	if len(babesession.seenHeaders) != 1 {
+		t.Fatalf("Fail: got %d remembered headers expected 1", len(babesession.seenHeaders))
+	}
 }
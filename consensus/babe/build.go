@@ -0,0 +1,67 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package babe
+
+import (
+	"github.com/ChainSafe/gossamer/consensus"
+	"github.com/ChainSafe/gossamer/core/types"
+	log "github.com/ChainSafe/log15"
+)
+
+// buildBlock builds a block for the slot on top of the best block. The block is executed by the runtime, which
+// applies the inherents and as many ready transactions as fit in the slot's time budget, then it is sealed and
+// imported into the block tree.
+func (b *Session) buildBlock(slot uint64, claim *BabeHeader) (*types.Block, error) {
+	pre, err := claim.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := b.slotStart(slot).Add(b.slotDuration() * consensus.BuildTimeRatio / 100)
+	header, exts, err := b.builder.Build(b.builder.BestHeader(), []*types.DigestItem{types.NewPreRuntimeDigest(types.BabeEngineID, pre)}, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.sealHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := types.NewBlockBody(exts)
+	if err != nil {
+		return nil, err
+	}
+
+	block := &types.Block{
+		Header: *header,
+		Body:   body,
+	}
+
+	weight, err := BlockWeight(header)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.builder.Import(block, weight)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("[babe] built block", "slot", slot, "number", header.Number, "hash", header.Hash, "extrinsics", len(exts))
+	return block, nil
+}
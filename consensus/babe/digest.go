@@ -0,0 +1,236 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package babe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	scale "github.com/ChainSafe/gossamer/codec"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/crypto"
+)
+
+// BABE pre-digest types
+const (
+	// PrimaryPreDigestType is the type of a pre-digest claiming a slot won in the VRF lottery
+	PrimaryPreDigestType = byte(1)
+	// SecondaryPlainPreDigestType is the type of a pre-digest claiming a secondary slot
+	SecondaryPlainPreDigestType = byte(2)
+	// SecondaryVrfPreDigestType is the type of a pre-digest claiming a secondary slot with a VRF output
+	SecondaryVrfPreDigestType = byte(3)
+)
+
+// NextEpochDataType is the type of a BABE consensus digest announcing the next epoch's authorities
+const NextEpochDataType = byte(1)
+
+const vrfLength = crypto.VrfOutputLength + crypto.VrfProofLength
+
+// BabeHeader is the BABE pre-runtime digest of a block, claiming the slot it was produced in.
+// Primary and secondary VRF claims include the VRF output and proof; secondary plain claims do not.
+type BabeHeader struct {
+	Type               byte
+	VrfOutput          [crypto.VrfOutputLength]byte
+	VrfProof           [crypto.VrfProofLength]byte
+	BlockProducerIndex uint64
+	SlotNumber         uint64
+}
+
+// IsSecondary returns true if the header claims a secondary slot
+func (bh *BabeHeader) IsSecondary() bool {
+	return bh.Type == SecondaryPlainPreDigestType || bh.Type == SecondaryVrfPreDigestType
+}
+
+// HasVrf returns true if the header contains a VRF output and proof
+func (bh *BabeHeader) HasVrf() bool {
+	return bh.Type == PrimaryPreDigestType || bh.Type == SecondaryVrfPreDigestType
+}
+
+// Encode returns the encoding of the BABE header: the type, then for primary claims the VRF output and proof,
+// producer index and slot number, and for secondary claims the producer index and slot number, followed by
+// the VRF output and proof for secondary VRF claims
+func (bh *BabeHeader) Encode() ([]byte, error) {
+	enc := []byte{bh.Type}
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf[:8], bh.BlockProducerIndex)
+	binary.LittleEndian.PutUint64(buf[8:], bh.SlotNumber)
+
+	switch bh.Type {
+	case PrimaryPreDigestType:
+		enc = append(enc, bh.VrfOutput[:]...)
+		enc = append(enc, bh.VrfProof[:]...)
+		return append(enc, buf...), nil
+	case SecondaryPlainPreDigestType:
+		return append(enc, buf...), nil
+	case SecondaryVrfPreDigestType:
+		enc = append(enc, buf...)
+		enc = append(enc, bh.VrfOutput[:]...)
+		return append(enc, bh.VrfProof[:]...), nil
+	default:
+		return nil, fmt.Errorf("unknown BABE pre-digest type %d", bh.Type)
+	}
+}
+
+// Decode decodes an encoded BABE header into the receiver
+func (bh *BabeHeader) Decode(in []byte) error {
+	if len(in) == 0 {
+		return errors.New("empty BABE header")
+	}
+
+	bh.Type = in[0]
+	in = in[1:]
+
+	var length int
+	switch bh.Type {
+	case PrimaryPreDigestType, SecondaryVrfPreDigestType:
+		length = vrfLength + 16
+	case SecondaryPlainPreDigestType:
+		length = 16
+	default:
+		return fmt.Errorf("unknown BABE pre-digest type %d", bh.Type)
+	}
+
+	if len(in) != length {
+		return fmt.Errorf("invalid BABE header length %d", len(in)+1)
+	}
+
+	if bh.Type == PrimaryPreDigestType {
+		copy(bh.VrfOutput[:], in[:crypto.VrfOutputLength])
+		copy(bh.VrfProof[:], in[crypto.VrfOutputLength:vrfLength])
+		in = in[vrfLength:]
+	}
+
+	bh.BlockProducerIndex = binary.LittleEndian.Uint64(in[:8])
+	bh.SlotNumber = binary.LittleEndian.Uint64(in[8:16])
+
+	if bh.Type == SecondaryVrfPreDigestType {
+		copy(bh.VrfOutput[:], in[16:16+crypto.VrfOutputLength])
+		copy(bh.VrfProof[:], in[16+crypto.VrfOutputLength:])
+	}
+
+	return nil
+}
+
+// BlockWeight returns the fork choice weight a block adds to its chain: 1 for blocks claiming a primary slot
+// and 0 for blocks claiming a secondary slot, so chains with more primary blocks are preferred
+func BlockWeight(header *types.BlockHeader) (uint64, error) {
+	pre, _, err := babeDigests(header)
+	if err != nil {
+		return 0, err
+	}
+
+	if pre == nil {
+		return 0, ErrNoBabeHeader
+	}
+
+	if pre.IsSecondary() {
+		return 0, nil
+	}
+
+	return 1, nil
+}
+
+// NextEpochDescriptor is the BABE consensus digest announcing the authority set of the next epoch
+type NextEpochDescriptor struct {
+	Authorities []AuthorityData
+}
+
+// Encode returns the SCALE encoding of the descriptor, prefixed by its type
+func (d *NextEpochDescriptor) Encode() ([]byte, error) {
+	enc, err := scale.Encode(big.NewInt(int64(len(d.Authorities))))
+	if err != nil {
+		return nil, err
+	}
+
+	enc = append([]byte{NextEpochDataType}, enc...)
+	buf := make([]byte, 8)
+	for _, auth := range d.Authorities {
+		enc = append(enc, auth.AuthorityId[:]...)
+		binary.LittleEndian.PutUint64(buf, auth.AuthorityWeight)
+		enc = append(enc, buf...)
+	}
+
+	return enc, nil
+}
+
+// Decode decodes a SCALE encoded descriptor into the receiver
+func (d *NextEpochDescriptor) Decode(in []byte) error {
+	if len(in) == 0 || in[0] != NextEpochDataType {
+		return errors.New("not a next epoch data digest")
+	}
+
+	r := bytes.NewReader(in[1:])
+	sd := scale.Decoder{Reader: r}
+	n, err := sd.DecodeInteger()
+	if err != nil {
+		return err
+	}
+
+	d.Authorities = []AuthorityData{}
+	buf := make([]byte, 8)
+	for i := int64(0); i < n; i++ {
+		auth := AuthorityData{}
+		_, err = io.ReadFull(r, auth.AuthorityId[:])
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return err
+		}
+		auth.AuthorityWeight = binary.LittleEndian.Uint64(buf)
+		d.Authorities = append(d.Authorities, auth)
+	}
+
+	return nil
+}
+
+// babeDigests returns the BABE pre-digest and next epoch descriptor contained in a header's digest;
+// either is nil if the header does not contain it
+func babeDigests(header *types.BlockHeader) (*BabeHeader, *NextEpochDescriptor, error) {
+	items, err := types.DecodeDigest(header.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pre *BabeHeader
+	var next *NextEpochDescriptor
+	for _, item := range items {
+		if item.ConsensusEngineID != types.BabeEngineID {
+			continue
+		}
+
+		switch item.Type {
+		case types.PreRuntimeDigestType:
+			pre = new(BabeHeader)
+			err = pre.Decode(item.Data)
+		case types.ConsensusDigestType:
+			next = new(NextEpochDescriptor)
+			err = next.Decode(item.Data)
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return pre, next, nil
+}
@@ -0,0 +1,430 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package babe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/polkadb"
+	log "github.com/ChainSafe/log15"
+)
+
+// epochPrefix prefixes the database keys under which the data of each epoch is stored, by the hash of the
+// epoch's first block
+var epochPrefix = []byte("babe_epoch_")
+
+// epochBlockPrefix prefixes the database keys under which the BABE data of each block is stored, by block hash
+var epochBlockPrefix = []byte("babe_block_")
+
+// ErrUnknownEpoch is returned when the epoch of a block cannot be resolved, as its parent was not handled
+var ErrUnknownEpoch = errors.New("block's parent has no BABE epoch data")
+
+// epochKey returns the database key of the data of the epoch starting with the block with the given hash
+func epochKey(hash common.Hash) []byte {
+	return append(append([]byte{}, epochPrefix...), hash.ToBytes()...)
+}
+
+// epochBlockKey returns the database key of the BABE data of the block with the given hash
+func epochBlockKey(hash common.Hash) []byte {
+	return append(append([]byte{}, epochBlockPrefix...), hash.ToBytes()...)
+}
+
+// EpochData is the data needed to produce and verify blocks in an epoch
+type EpochData struct {
+	Index       uint64
+	StartSlot   uint64
+	Duration    uint64 // duration of the epoch in slots
+	Authorities []AuthorityData
+	Randomness  [RandomnessLength]byte
+}
+
+// epochBlock is the BABE data of a block, from which the data of the epoch following the block's epoch is resolved
+// on the chains the block is on
+type epochBlock struct {
+	Parent          common.Hash
+	Slot            uint64
+	Epoch           common.Hash     // hash of the first block of the block's epoch
+	VrfOutput       *[32]byte       // nil if the block has no VRF output
+	NextAuthorities []AuthorityData // authorities announced for the next epoch, nil if none
+}
+
+// genesisEpoch returns the data of the first epoch, taken from the BABE configuration. Its start slot is the slot of
+// block #1, which is set once the block is known.
+func genesisEpoch(config *BabeConfiguration) *EpochData {
+	return &EpochData{
+		Index:       0,
+		StartSlot:   0,
+		Duration:    config.EpochLength,
+		Authorities: config.GenesisAuthorities,
+		Randomness:  config.Randomness,
+	}
+}
+
+// nextRandomness computes the randomness of the epoch following the epoch with the given index and randomness,
+// from the VRF outputs of the blocks in that epoch
+// equation: blake2b(randomness || epoch index || vrf outputs...)
+func nextRandomness(randomness [RandomnessLength]byte, epoch uint64, outputs [][32]byte) ([RandomnessLength]byte, error) {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, epoch)
+
+	s := append(randomness[:], buf...)
+	for _, out := range outputs {
+		s = append(s, out[:]...)
+	}
+
+	h, err := common.Blake2bHash(s)
+	return [RandomnessLength]byte(h), err
+}
+
+// SetEpochDB sets the database the data of epochs and the BABE data of blocks are persisted to. If a block tree is
+// set, the session resumes in the epoch of its best block, if it was recorded before a restart.
+func (b *Session) SetEpochDB(db polkadb.Database) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.db = db
+	if b.blockTree == nil {
+		return nil
+	}
+
+	blk, err := b.getEpochBlock(b.blockTree.BestBlockHash())
+	if err != nil || blk == nil {
+		return err
+	}
+
+	epoch, err := b.getEpoch(blk.Epoch)
+	if err != nil || epoch == nil {
+		return err
+	}
+
+	b.epoch = epoch
+	b.startEpoch()
+	log.Debug("[babe] restored epoch", "epoch", b.epoch.Index, "start slot", b.epoch.StartSlot)
+	return nil
+}
+
+// Epoch returns the data of the current epoch, which is the epoch of the latest slot the session authored for,
+// or of the best block when the session resumed
+func (b *Session) Epoch() *EpochData {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.epoch
+}
+
+// startEpoch sets the authority data for the current epoch, and forgets the slots claimed in the previous one;
+// the caller must hold the lock
+func (b *Session) startEpoch() {
+	b.slotToClaim = make(map[uint64]*BabeHeader)
+	b.epochThreshold = nil
+
+	idx, ok := b.authorityIndexOf(b.epoch.Authorities)
+	if !ok {
+		log.Debug("[babe] not an authority for epoch", "epoch", b.epoch.Index)
+		return
+	}
+
+	b.authorityIndex = idx
+	b.authorityWeights = make([]uint64, len(b.epoch.Authorities))
+	for i, auth := range b.epoch.Authorities {
+		b.authorityWeights[i] = auth.AuthorityWeight
+	}
+}
+
+// epochFor returns the data of the epoch of a block with the given number and slot built on the parent, and the
+// hash of the first block of that epoch on the parent's chain, which is zero if the block starts a new epoch.
+//
+// The first epoch starts at the slot of block #1. The randomness of each following epoch accumulates the VRF outputs
+// of the blocks in the previous epoch on the parent's chain, and the latest authority set they announced is applied.
+// If no block was produced for one or more epochs, the epoch following the last one with blocks is moved forward by
+// the skipped epochs, keeping its randomness and authorities.
+// The caller must hold the lock.
+func (b *Session) epochFor(parent common.Hash, number, slot uint64) (*EpochData, common.Hash, error) {
+	if number <= 1 {
+		epoch := genesisEpoch(b.config)
+		epoch.StartSlot = slot
+		return epoch, common.Hash{}, nil
+	}
+
+	parentBlk, err := b.getEpochBlock(parent)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	if parentBlk == nil {
+		return nil, common.Hash{}, ErrUnknownEpoch
+	}
+
+	cur, err := b.getEpoch(parentBlk.Epoch)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	if cur == nil {
+		return nil, common.Hash{}, ErrUnknownEpoch
+	}
+
+	if slot < cur.StartSlot+cur.Duration {
+		return cur, parentBlk.Epoch, nil
+	}
+
+	// walk the blocks of the parent's epoch on its chain back to the first one, newest first
+	var outputs [][32]byte
+	var authorities []AuthorityData
+	for hash := parent; ; {
+		blk, err := b.getEpochBlock(hash)
+		if err != nil {
+			return nil, common.Hash{}, err
+		}
+		if blk == nil {
+			return nil, common.Hash{}, ErrUnknownEpoch
+		}
+
+		if blk.VrfOutput != nil {
+			outputs = append([][32]byte{*blk.VrfOutput}, outputs...)
+		}
+		if authorities == nil && blk.NextAuthorities != nil {
+			authorities = blk.NextAuthorities
+		}
+
+		if hash == parentBlk.Epoch {
+			break
+		}
+		hash = blk.Parent
+	}
+
+	if authorities == nil {
+		authorities = cur.Authorities
+	}
+
+	randomness, err := nextRandomness(cur.Randomness, cur.Index, outputs)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+
+	skipped := (slot - cur.StartSlot) / cur.Duration
+	return &EpochData{
+		Index:       cur.Index + skipped,
+		StartSlot:   cur.StartSlot + skipped*cur.Duration,
+		Duration:    cur.Duration,
+		Authorities: authorities,
+		Randomness:  randomness,
+	}, common.Hash{}, nil
+}
+
+// getEpoch returns the data of the epoch starting with the block with the given hash, loading it from the database
+// if it was recorded before a restart, and nil if the epoch was not recorded; the caller must hold the lock
+func (b *Session) getEpoch(hash common.Hash) (*EpochData, error) {
+	if epoch, ok := b.epochs[hash]; ok {
+		return epoch, nil
+	}
+
+	epoch := new(EpochData)
+	ok, err := b.loadEpochData(epochKey(hash), epoch)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	b.epochs[hash] = epoch
+	return epoch, nil
+}
+
+// getEpochBlock returns the data of the block with the given hash, loading it from the database if it was recorded
+// before a restart, and nil if the block was not recorded; the caller must hold the lock
+func (b *Session) getEpochBlock(hash common.Hash) (*epochBlock, error) {
+	if blk, ok := b.epochBlocks[hash]; ok {
+		return blk, nil
+	}
+
+	blk := new(epochBlock)
+	ok, err := b.loadEpochData(epochBlockKey(hash), blk)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	b.epochBlocks[hash] = blk
+	return blk, nil
+}
+
+// loadEpochData decodes the value stored under the key in the epoch database into v, and returns false if there is
+// no such value or no epoch database is set; the caller must hold the lock
+func (b *Session) loadEpochData(key []byte, v interface{}) (bool, error) {
+	if b.db == nil {
+		return false, nil
+	}
+
+	has, err := b.db.Has(key)
+	if err != nil || !has {
+		return false, err
+	}
+
+	enc, err := b.db.Get(key)
+	if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(enc, v)
+}
+
+// saveEpochData stores v under the key if an epoch database is set; the caller must hold the lock
+func (b *Session) saveEpochData(key []byte, v interface{}) error {
+	if b.db == nil {
+		return nil
+	}
+
+	enc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.db.Put(key, enc)
+}
+
+// addEpochBlock records the BABE data of a block, and the data of its epoch if the block starts a new one,
+// persisting them if an epoch database is set; the caller must hold the lock
+func (b *Session) addEpochBlock(header *types.BlockHeader, pre *BabeHeader, next *NextEpochDescriptor) error {
+	if pre == nil {
+		return nil
+	}
+
+	hash, err := header.CalculateHash()
+	if err != nil {
+		return err
+	}
+
+	epoch, key, err := b.epochFor(header.ParentHash, header.Number.Uint64(), pre.SlotNumber)
+	if err != nil {
+		return err
+	}
+
+	if key == (common.Hash{}) {
+		log.Debug("[babe] block starts epoch", "epoch", epoch.Index, "start slot", epoch.StartSlot, "authorities", len(epoch.Authorities), "block", hash)
+
+		key = hash
+		b.epochs[key] = epoch
+		err = b.saveEpochData(epochKey(key), epoch)
+		if err != nil {
+			return err
+		}
+
+		err = b.pruneEpochs()
+		if err != nil {
+			return err
+		}
+	}
+
+	blk := &epochBlock{Parent: header.ParentHash, Slot: pre.SlotNumber, Epoch: key}
+	if pre.HasVrf() {
+		out := pre.VrfOutput
+		blk.VrfOutput = &out
+	}
+	if next != nil {
+		blk.NextAuthorities = next.Authorities
+	}
+	b.epochBlocks[hash] = blk
+
+	return b.saveEpochData(epochBlockKey(hash), blk)
+}
+
+// pruneEpochs removes the data of the epochs before the epoch of the finalized block, and of their blocks, as no
+// block can be built on them anymore. Data recorded before a restart and not loaded since stays in the database.
+// The caller must hold the lock.
+func (b *Session) pruneEpochs() error {
+	if b.blockTree == nil {
+		return nil
+	}
+
+	fin, err := b.getEpochBlock(b.blockTree.FinalizedHash())
+	if err != nil || fin == nil {
+		return err
+	}
+
+	finalized, err := b.getEpoch(fin.Epoch)
+	if err != nil || finalized == nil {
+		return err
+	}
+
+	for hash, blk := range b.epochBlocks {
+		epoch, err := b.getEpoch(blk.Epoch)
+		if err != nil {
+			return err
+		}
+		if epoch != nil && epoch.Index >= finalized.Index {
+			continue
+		}
+
+		delete(b.epochBlocks, hash)
+		err = b.deleteEpochData(epochBlockKey(hash))
+		if err != nil {
+			return err
+		}
+	}
+
+	for hash, epoch := range b.epochs {
+		if epoch.Index >= finalized.Index {
+			continue
+		}
+
+		delete(b.epochs, hash)
+		err = b.deleteEpochData(epochKey(hash))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteEpochData removes the value stored under the key if an epoch database is set; the caller must hold the lock
+func (b *Session) deleteEpochData(key []byte) error {
+	if b.db == nil {
+		return nil
+	}
+	return b.db.Del(key)
+}
+
+// authorityIndexOf returns the index of the session's key in the authority set, and false if it is not in it
+func (b *Session) authorityIndexOf(authorities []AuthorityData) (uint64, bool) {
+	if b.keypair == nil {
+		return 0, false
+	}
+
+	pub := b.keypair.Public().Encode()
+	for i, auth := range authorities {
+		if bytes.Equal(auth.AuthorityId[:], pub) {
+			return uint64(i), true
+		}
+	}
+
+	return 0, false
+}
+
+// HandleHeader processes the BABE digests of an imported block header. The VRF output of its pre-digest, if any,
+// and the authority set it announces for the next epoch, if any, are recorded by block, and applied to the next
+// epoch on the chains the block is on. If the block's slot is past the end of its parent's epoch, the block starts
+// the next epoch on its chain.
+func (b *Session) HandleHeader(header *types.BlockHeader) error {
+	pre, next, err := babeDigests(header)
+	if err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.addEpochBlock(header, pre, next)
+}
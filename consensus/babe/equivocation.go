@@ -0,0 +1,143 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package babe
+
+import (
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/events"
+	"github.com/ChainSafe/gossamer/runtime"
+	log "github.com/ChainSafe/log15"
+)
+
+// equivocationSlotWindow is the number of slots before the latest seen slot for which the headers of each
+// authority are remembered
+const equivocationSlotWindow = 1000
+
+// maxEquivocations is the number of detected equivocations kept for the RPC
+const maxEquivocations = 100
+
+// slotAuthor identifies the blocks an authority may produce for a slot
+type slotAuthor struct {
+	slot   uint64
+	author [32]byte
+}
+
+// seenHeader is the first header seen for a slot and author
+type seenHeader struct {
+	header   *types.BlockHeader
+	reported bool // set once an equivocation has been reported for the slot and author
+}
+
+// checkEquivocation remembers the header as produced by the author for the slot, and returns a proof of
+// equivocation if the author already produced a different header for the slot. Only one equivocation is
+// returned for each slot and author.
+func (b *Session) checkEquivocation(header *types.BlockHeader, author [32]byte, slot uint64) *types.EquivocationProof {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if slot > b.latestSeenSlot {
+		b.latestSeenSlot = slot
+		b.pruneSeenHeaders()
+	}
+	if slot+equivocationSlotWindow < b.latestSeenSlot {
+		return nil
+	}
+
+	key := slotAuthor{slot: slot, author: author}
+	seen := b.seenHeaders[key]
+	if seen == nil {
+		b.seenHeaders[key] = &seenHeader{header: header}
+		return nil
+	}
+
+	if seen.header.Hash == header.Hash || seen.reported {
+		return nil
+	}
+	seen.reported = true
+
+	proof := &types.EquivocationProof{
+		Offender:     author,
+		Slot:         slot,
+		FirstHeader:  seen.header,
+		SecondHeader: header,
+	}
+
+	b.equivocations = append(b.equivocations, proof)
+	if len(b.equivocations) > maxEquivocations {
+		b.equivocations = b.equivocations[1:]
+	}
+
+	return proof
+}
+
+// pruneSeenHeaders forgets the headers of slots that are outside of the window; the caller must hold the lock
+func (b *Session) pruneSeenHeaders() {
+	for key := range b.seenHeaders {
+		if key.slot+equivocationSlotWindow < b.latestSeenSlot {
+			delete(b.seenHeaders, key)
+		}
+	}
+}
+
+// Equivocations returns the most recently detected equivocations, oldest first
+func (b *Session) Equivocations() []*types.EquivocationProof {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return append([]*types.EquivocationProof{}, b.equivocations...)
+}
+
+// handleEquivocation publishes the equivocation and reports it to the runtime
+func (b *Session) handleEquivocation(proof *types.EquivocationProof) {
+	log.Warn("[babe] detected equivocation", "offender", proof.Offender, "slot", proof.Slot,
+		"first", proof.FirstHeader.Hash, "second", proof.SecondHeader.Hash)
+
+	if b.bus != nil {
+		b.bus.Publish(&events.EquivocationDetected{Proof: proof})
+	}
+
+	err := b.reportEquivocation(proof)
+	if err == runtime.ErrExportFunctionNotFound {
+		log.Debug("[babe] runtime does not support equivocation reports")
+	} else if err != nil {
+		log.Error("[babe] cannot report equivocation", "error", err)
+	}
+}
+
+// reportEquivocation submits an equivocation report extrinsic through the runtime. The runtime first creates a
+// proof that the offender's key was part of the authority set at the slot; if it cannot, nothing is reported.
+func (b *Session) reportEquivocation(proof *types.EquivocationProof) error {
+	ownership, err := b.rt.BabeAPI().GenerateKeyOwnershipProof(proof.Slot, proof.Offender)
+	if err != nil {
+		return err
+	}
+
+	if ownership == nil {
+		log.Debug("[babe] runtime cannot prove key ownership of offender", "offender", proof.Offender)
+		return nil
+	}
+
+	ok, err := b.rt.BabeAPI().SubmitReportEquivocation(proof, ownership)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		log.Debug("[babe] runtime did not submit equivocation report", "slot", proof.Slot)
+	}
+	return nil
+}
@@ -16,27 +16,28 @@
 
 package babe
 
-import (
-	scale "github.com/ChainSafe/gossamer/codec"
-)
-
 // gets the configuration data for Babe from the runtime
 func (b *Session) configurationFromRuntime() error {
-	ret, err := b.rt.Exec("BabeApi_configuration", 1, []byte{})
+	cfg, err := b.rt.BabeAPI().Configuration()
 	if err != nil {
 		return err
 	}
 
-	bc := new(BabeConfiguration)
-	bc.GenesisAuthorities = []AuthorityData{}
-	_, err = scale.Decode(ret, bc)
-
-	if err != nil {
-		return err
+	bc := &BabeConfiguration{
+		SlotDuration:       cfg.SlotDuration,
+		EpochLength:        cfg.EpochLength,
+		C1:                 cfg.C1,
+		C2:                 cfg.C2,
+		GenesisAuthorities: make([]AuthorityData, len(cfg.GenesisAuthorities)),
+		Randomness:         cfg.Randomness,
+		SecondarySlots:     cfg.SecondarySlots,
+	}
+	for i, auth := range cfg.GenesisAuthorities {
+		bc.GenesisAuthorities[i] = AuthorityData{AuthorityId: auth.Key, AuthorityWeight: auth.Weight}
 	}
 
 	// Directly set the babe session's config
 	b.config = bc
 
-	return err
+	return nil
 }
@@ -16,9 +16,12 @@
 
 package babe
 
-// TODO: change to Schnorrkel keys
-type VrfPublicKey [32]byte
-type VrfPrivateKey [64]byte
+import (
+	"github.com/ChainSafe/gossamer/crypto"
+)
+
+// RandomnessLength is the length in bytes of the epoch randomness
+const RandomnessLength = 32
 
 // BabeConfiguration contains the starting data needed for Babe
 // see: https://github.com/paritytech/substrate/blob/426c26b8bddfcdbaf8d29f45b128e0864b57de1c/core/consensus/babe/primitives/src/lib.rs#L132
@@ -28,7 +31,7 @@ type BabeConfiguration struct {
 	C1                 uint64 // (1-(c1/c2)) is the probability of a slot being empty
 	C2                 uint64
 	GenesisAuthorities []AuthorityData
-	Randomness         byte
+	Randomness         [RandomnessLength]byte
 	SecondarySlots     bool
 }
 
@@ -37,3 +40,10 @@ type AuthorityData struct {
 	AuthorityId     [32]byte
 	AuthorityWeight uint64
 }
+
+// VrfOutputAndProof is the VRF output and proof created by a block producer that won the slot lottery;
+// it is included in the block's pre-runtime digest so other nodes can verify the claim
+type VrfOutputAndProof struct {
+	Output [crypto.VrfOutputLength]byte
+	Proof  [crypto.VrfProofLength]byte
+}
@@ -0,0 +1,234 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package babe
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ChainSafe/gossamer/consensus"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/crypto"
+)
+
+// DefaultMaxDrift is the default amount of time a block's slot may start in the future and still be accepted
+const DefaultMaxDrift = 5 * time.Second
+
+var (
+	ErrNoBabeHeader          = errors.New("block header has no BABE pre-digest")
+	ErrNoSeal                = errors.New("block header is not sealed")
+	ErrInvalidSeal           = errors.New("block header seal is not a valid signature by its author")
+	ErrInvalidAuthorityIndex = errors.New("block producer index is not in the epoch's authority set")
+	ErrSlotNotInEpoch        = errors.New("block slot is not in the epoch of its chain")
+	ErrFutureBlock           = errors.New("block slot is too far in the future")
+	ErrInvalidVrf            = errors.New("block VRF proof is not valid")
+	ErrVrfOverThreshold      = errors.New("block VRF output is not below the producer's threshold")
+	ErrSecondarySlotsOff     = errors.New("block claims a secondary slot but secondary slots are disabled")
+	ErrNotSecondaryAuthor    = errors.New("block producer is not the secondary author of the slot")
+)
+
+// Verifier verifies the BABE claims of block headers for an epoch
+type Verifier struct {
+	config      *BabeConfiguration
+	epoch       *EpochData
+	genesisTime time.Time // start time of slot 0
+	maxDrift    time.Duration
+	now         func() time.Time
+}
+
+// NewVerifier returns a Verifier for headers in the given epoch
+func NewVerifier(config *BabeConfiguration, epoch *EpochData) *Verifier {
+	return &Verifier{
+		config:      config,
+		epoch:       epoch,
+		genesisTime: time.Unix(0, 0),
+		maxDrift:    DefaultMaxDrift,
+		now:         time.Now,
+	}
+}
+
+// VerifyHeader checks that the header was produced by an authority of the epoch that won the slot lottery
+// for its slot, and that it is sealed by that authority. Slots are counted in slot durations since the genesis
+// time, which is the unix epoch unless set otherwise.
+func (v *Verifier) VerifyHeader(header *types.BlockHeader) error {
+	items, err := types.DecodeDigest(header.Digest)
+	if err != nil {
+		return err
+	}
+
+	if len(items) == 0 {
+		return ErrNoBabeHeader
+	}
+
+	// the seal must be the last digest item, and signs the header without it
+	seal := items[len(items)-1]
+	if seal.Type != types.SealDigestType || seal.ConsensusEngineID != types.BabeEngineID {
+		return ErrNoSeal
+	}
+
+	var pre *BabeHeader
+	for _, item := range items[:len(items)-1] {
+		if item.Type == types.PreRuntimeDigestType && item.ConsensusEngineID == types.BabeEngineID {
+			pre = new(BabeHeader)
+			err = pre.Decode(item.Data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if pre == nil {
+		return ErrNoBabeHeader
+	}
+
+	if pre.BlockProducerIndex >= uint64(len(v.epoch.Authorities)) {
+		return ErrInvalidAuthorityIndex
+	}
+
+	if pre.SlotNumber < v.epoch.StartSlot || pre.SlotNumber >= v.epoch.StartSlot+v.epoch.Duration {
+		return ErrSlotNotInEpoch
+	}
+
+	slotStart := v.genesisTime.Add(time.Duration(pre.SlotNumber*v.config.SlotDuration) * time.Millisecond)
+	if slotStart.After(v.now().Add(v.maxDrift)) {
+		return ErrFutureBlock
+	}
+
+	pub := new(crypto.Sr25519PublicKey)
+	err = pub.Decode(v.epoch.Authorities[pre.BlockProducerIndex].AuthorityId[:])
+	if err != nil {
+		return err
+	}
+
+	hash, err := consensus.PreSealHash(header, items[:len(items)-1])
+	if err != nil {
+		return err
+	}
+
+	if !pub.Verify(hash[:], seal.Data) {
+		return ErrInvalidSeal
+	}
+
+	if pre.IsSecondary() {
+		return v.verifySecondary(pub, pre)
+	}
+
+	return v.verifyPrimary(pub, pre)
+}
+
+// verifyPrimary checks that the VRF output of a primary claim is valid and below the producer's threshold
+func (v *Verifier) verifyPrimary(pub *crypto.Sr25519PublicKey, pre *BabeHeader) error {
+	ok, err := pub.VrfVerify(makeTranscript(v.epoch.Randomness, pre.SlotNumber, v.epoch.Index), pre.VrfOutput, pre.VrfProof)
+	if err != nil || !ok {
+		return ErrInvalidVrf
+	}
+
+	weights := make([]uint64, len(v.epoch.Authorities))
+	for i, auth := range v.epoch.Authorities {
+		weights[i] = auth.AuthorityWeight
+	}
+
+	threshold, err := calculateThreshold(v.config.C1, v.config.C2, pre.BlockProducerIndex, weights)
+	if err != nil {
+		return err
+	}
+
+	value, err := lotteryValue(pub, makeTranscript(v.epoch.Randomness, pre.SlotNumber, v.epoch.Index), pre.VrfOutput)
+	if err != nil {
+		return err
+	}
+
+	if value.Cmp(threshold) >= 0 {
+		return ErrVrfOverThreshold
+	}
+
+	return nil
+}
+
+// verifySecondary checks that the producer of a secondary claim is the slot's secondary author,
+// and that its VRF output is valid if it has one
+func (v *Verifier) verifySecondary(pub *crypto.Sr25519PublicKey, pre *BabeHeader) error {
+	if !v.config.SecondarySlots {
+		return ErrSecondarySlotsOff
+	}
+
+	author, err := secondarySlotAuthor(v.epoch.Randomness, pre.SlotNumber, len(v.epoch.Authorities))
+	if err != nil {
+		return err
+	}
+
+	if author != pre.BlockProducerIndex {
+		return ErrNotSecondaryAuthor
+	}
+
+	if pre.HasVrf() {
+		ok, err := pub.VrfVerify(makeTranscript(v.epoch.Randomness, pre.SlotNumber, v.epoch.Index), pre.VrfOutput, pre.VrfProof)
+		if err != nil || !ok {
+			return ErrInvalidVrf
+		}
+	}
+
+	return nil
+}
+
+// sealHeader signs the header with the session's key and appends the seal to its digest
+func (b *Session) sealHeader(header *types.BlockHeader) error {
+	return consensus.SealHeader(header, types.BabeEngineID, b.keypair)
+}
+
+// VerifyHeader verifies the BABE claim of an imported header against the epoch of its slot, which is resolved along
+// the header's ancestry
+func (b *Session) VerifyHeader(header *types.BlockHeader) error {
+	pre, _, err := babeDigests(header)
+	if err != nil {
+		return err
+	}
+	if pre == nil {
+		return ErrNoBabeHeader
+	}
+
+	b.lock.Lock()
+	epoch, _, err := b.epochFor(header.ParentHash, header.Number.Uint64(), pre.SlotNumber)
+	b.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	v := NewVerifier(b.config, epoch)
+	v.genesisTime = b.genesisTime.Add(b.slotOffset)
+	v.now = b.clock.Now
+
+	err = v.VerifyHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// remember the verified header to detect authorities producing several blocks for a slot
+	hash, err := header.CalculateHash()
+	if err != nil {
+		return err
+	}
+
+	verified := *header
+	verified.Hash = hash
+	author := v.epoch.Authorities[pre.BlockProducerIndex].AuthorityId
+	if proof := b.checkEquivocation(&verified, author, pre.SlotNumber); proof != nil {
+		b.handleEquivocation(proof)
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package consensus
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/consensus/inherents"
+	"github.com/ChainSafe/gossamer/core/blocktree"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/runtime"
+	log "github.com/ChainSafe/log15"
+)
+
+// BuildTimeRatio is the fraction of the slot duration, in percent, that slot-based engines may spend applying
+// transactions to the blocks they author
+const BuildTimeRatio = 60
+
+var (
+	// ErrEmptyApplyResult is returned when the runtime does not return the result of applying an extrinsic
+	ErrEmptyApplyResult = runtime.ErrEmptyResult
+	// ErrInherentRejected is returned when the runtime rejects an inherent extrinsic it created itself
+	ErrInherentRejected = errors.New("runtime rejected inherent extrinsic")
+)
+
+// BlockBuilder builds blocks by executing them in the runtime, and imports them into the block tree. It is shared
+// by the consensus engines, which provide the pre-runtime digest and seal of the blocks they author.
+type BlockBuilder struct {
+	rt        *runtime.Runtime
+	txPool    *tx.Pool
+	inherents *inherents.InherentDataProviders
+	now       func() time.Time
+
+	blockTree *blocktree.BlockTree
+	head      *types.BlockHeader // last block imported by the builder, used as the best block if there is no block tree
+}
+
+// NewBlockBuilder returns a block builder that executes blocks in the runtime, including the transactions of the
+// pool and the inherents created from the providers' data. now is the clock the transaction deadline is checked
+// against.
+func NewBlockBuilder(rt *runtime.Runtime, txPool *tx.Pool, providers *inherents.InherentDataProviders, now func() time.Time) *BlockBuilder {
+	return &BlockBuilder{
+		rt:        rt,
+		txPool:    txPool,
+		inherents: providers,
+		now:       now,
+	}
+}
+
+// SetBlockTree sets the block tree blocks are built on and imported into
+func (bb *BlockBuilder) SetBlockTree(bt *blocktree.BlockTree) {
+	bb.blockTree = bt
+}
+
+// BestHeader returns the header of the block to build on: the best block of the block tree if it is set,
+// otherwise the last block imported by the builder
+func (bb *BlockBuilder) BestHeader() *types.BlockHeader {
+	if bb.blockTree != nil {
+		return &bb.blockTree.BestBlock().Header
+	}
+
+	if bb.head != nil {
+		return bb.head
+	}
+
+	return &types.BlockHeader{Number: big.NewInt(0)}
+}
+
+// Build executes a new block with the given pre-runtime digest items on top of the parent. The runtime applies
+// the inherents, then as many ready transactions as it can until the deadline. It returns the unsealed header
+// and the extrinsics of the block. The state is left unchanged if the block cannot be built.
+func (bb *BlockBuilder) Build(parent *types.BlockHeader, preDigest []*types.DigestItem, deadline time.Time) (*types.BlockHeader, []types.Extrinsic, error) {
+	digest, err := types.EncodeDigest(preDigest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := &types.BlockHeader{
+		ParentHash: parent.Hash,
+		Number:     new(big.Int).Add(parent.Number, big.NewInt(1)),
+		Digest:     digest,
+	}
+
+	// the block is built on an overlay of the state, which is only written to the trie once the block is done
+	build, err := bb.rt.BlockBuilder().BuildBlock(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer build.Discard()
+
+	data, err := bb.inherents.CreateInherentData()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inherentExts, err := build.InherentExtrinsics(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, ext := range inherentExts {
+		err = build.ApplyExtrinsic(ext)
+		if _, ok := err.(runtime.ApplyError); ok {
+			return nil, nil, ErrInherentRejected
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	exts := append(inherentExts, bb.applyTransactions(build, deadline)...)
+
+	header, err = build.FinalizeBlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = build.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// later blocks are built with the new runtime code if the block changed it; blocks are only built and executed
+	// on top of the current state, so the previous code is not needed anymore
+	switched, err := bb.rt.UpdateCode()
+	if err != nil {
+		return nil, nil, err
+	}
+	if switched {
+		bb.rt.PruneCodes(nil)
+	}
+
+	return header, exts, nil
+}
+
+// extrinsicApplier applies extrinsics to a block being built, implemented by runtime.BlockBuild
+type extrinsicApplier interface {
+	ApplyExtrinsic(ext types.Extrinsic) error
+}
+
+// applyTransactions applies the ready transactions of the pool to the block being built until the deadline or
+// until the runtime reports that the block is full, and returns the extrinsics that were applied. Transactions
+// the runtime reports as invalid are banned from the pool, and transactions the runtime fails to apply are
+// removed from it. Once the block is full the remaining transactions stay in the pool for a later block.
+// Transactions depending on ones that were not applied are skipped.
+func (bb *BlockBuilder) applyTransactions(build extrinsicApplier, deadline time.Time) []types.Extrinsic {
+	exts := []types.Extrinsic{}
+	skipped := make(map[string]bool) // tags provided by transactions that were not applied
+
+	for _, vt := range bb.txPool.Ready() {
+		if !bb.now().Before(deadline) {
+			break
+		}
+
+		if requiresAny(vt.Validity.Requires, skipped) {
+			markProvided(vt.Validity.Provides, skipped)
+			continue
+		}
+
+		err := build.ApplyExtrinsic(*vt.Extrinsic)
+		if err == nil {
+			exts = append(exts, *vt.Extrinsic)
+			continue
+		}
+
+		if err == runtime.ErrFullBlock {
+			log.Debug("[consensus] block is full, leaving remaining transactions in the pool")
+			break
+		}
+
+		markProvided(vt.Validity.Provides, skipped)
+		hash, herr := common.Blake2bHash(*vt.Extrinsic)
+		if herr != nil {
+			continue
+		}
+
+		if _, ok := err.(runtime.ApplyError); !ok {
+			log.Debug("[consensus] dropping transaction the runtime failed to apply", "error", err)
+			bb.txPool.Remove(hash)
+			continue
+		}
+
+		log.Debug("[consensus] banning transaction rejected by the runtime", "error", err)
+		bb.txPool.Ban(hash)
+	}
+
+	return exts
+}
+
+func requiresAny(tags [][]byte, set map[string]bool) bool {
+	for _, tag := range tags {
+		if set[string(tag)] {
+			return true
+		}
+	}
+	return false
+}
+
+func markProvided(tags [][]byte, set map[string]bool) {
+	for _, tag := range tags {
+		set[string(tag)] = true
+	}
+}
+
+// Import adds a sealed block to the block tree, if it is set, with the weight it adds to its chain, and removes
+// its extrinsics from the transaction pool
+func (bb *BlockBuilder) Import(block *types.Block, weight uint64) error {
+	block.SetBlockArrivalTime(uint64(bb.now().UnixNano() / int64(time.Millisecond)))
+
+	if bb.blockTree != nil {
+		bb.blockTree.AddBlockWithWeight(*block, weight)
+	}
+	bb.head = &block.Header
+
+	exts, err := block.Body.Extrinsics()
+	if err != nil {
+		return err
+	}
+
+	_, err = bb.txPool.PruneBlock(block.Header.Number.Uint64(), exts)
+	return err
+}
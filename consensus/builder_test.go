@@ -0,0 +1,97 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package consensus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/runtime"
+)
+
+// mockApplier returns the result the runtime gives for each extrinsic, by its first byte
+type mockApplier struct {
+	results map[byte]error
+	applied []types.Extrinsic
+}
+
+func (m *mockApplier) ApplyExtrinsic(ext types.Extrinsic) error {
+	m.applied = append(m.applied, ext)
+	return m.results[ext[0]]
+}
+
+func newTestTransaction(ext []byte, priority uint64) *tx.ValidTransaction {
+	e := types.Extrinsic(ext)
+	return tx.NewValidTransaction(&e, tx.NewValidity(priority, nil, [][]byte{ext}, 64, true))
+}
+
+func TestApplyTransactions_FullBlock(t *testing.T) {
+	pool := tx.NewPool(nil)
+	bb := NewBlockBuilder(nil, pool, nil, time.Now)
+
+	// transactions are applied in order of priority
+	valid := newTestTransaction([]byte{1}, 4)
+	invalid := newTestTransaction([]byte{2}, 3)
+	full := newTestTransaction([]byte{3}, 2)
+	rest := newTestTransaction([]byte{4}, 1)
+
+	for _, vt := range []*tx.ValidTransaction{valid, invalid, full, rest} {
+		_, err := pool.Import(vt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	build := &mockApplier{
+		results: map[byte]error{
+			2: runtime.ErrBadSignature,
+			3: runtime.ErrFullBlock,
+		},
+	}
+
+	exts := bb.applyTransactions(build, time.Now().Add(time.Minute))
+
+	expected := []types.Extrinsic{{1}}
+	if !reflect.DeepEqual(exts, expected) {
+		t.Fatalf("Fail: got %v expected %v", exts, expected)
+	}
+
+	// no transaction is applied once the block is full
+	expected = []types.Extrinsic{{1}, {2}, {3}}
+	if !reflect.DeepEqual(build.applied, expected) {
+		t.Fatalf("Fail: got %v expected %v", build.applied, expected)
+	}
+
+	for _, vt := range []*tx.ValidTransaction{invalid, full, rest} {
+		hash, err := common.Blake2bHash(*vt.Extrinsic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		banned := vt == invalid
+		if pool.IsBanned(hash) != banned {
+			t.Fatalf("Fail: transaction %v banned=%v expected %v", *vt.Extrinsic, pool.IsBanned(hash), banned)
+		}
+		if (pool.Get(hash) != nil) == banned {
+			t.Fatalf("Fail: transaction %v in pool=%v expected %v", *vt.Extrinsic, pool.Get(hash) != nil, !banned)
+		}
+	}
+}
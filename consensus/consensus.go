@@ -0,0 +1,51 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package consensus
+
+import (
+	"errors"
+
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/consensus/inherents"
+	"github.com/ChainSafe/gossamer/core/types"
+)
+
+// ErrNotSlotAuthor is returned when a block is requested for a slot the engine is not entitled to author
+var ErrNotSlotAuthor = errors.New("not the author of the slot")
+
+// Engine is a consensus engine, which authors blocks and verifies the blocks imported from other nodes
+type Engine interface {
+	// Start starts authoring blocks, if the engine is an authority
+	Start() error
+	// Stop stops authoring blocks
+	Stop() error
+
+	// VerifyHeader checks that the author of an imported header was entitled to produce it
+	VerifyHeader(header *types.BlockHeader) error
+	// HandleHeader updates the engine with an imported header once its block has been executed
+	HandleHeader(header *types.BlockHeader) error
+	// BlockWeight returns the weight a block adds to its chain; the best chain is the heaviest one
+	BlockWeight(header *types.BlockHeader) (uint64, error)
+	// AuthorSlot builds, imports and announces a block for the slot. It returns ErrNotSlotAuthor if the engine
+	// is not entitled to author a block at the slot.
+	AuthorSlot(slot uint64) (*types.Block, error)
+
+	// TxPool returns the pool of the transactions to include in the blocks the engine authors
+	TxPool() *tx.Pool
+	// InherentDataProviders returns the providers of the inherent data blocks are built and checked with
+	InherentDataProviders() *inherents.InherentDataProviders
+}
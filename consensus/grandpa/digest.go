@@ -0,0 +1,154 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package grandpa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+
+	scale "github.com/ChainSafe/gossamer/codec"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/crypto"
+)
+
+// ScheduledChangeType is the type of the GRANDPA consensus digest announcing a change of the authority set
+// see: https://github.com/paritytech/substrate/blob/master/primitives/finality-grandpa/src/lib.rs
+const ScheduledChangeType = byte(1)
+
+// ScheduledChange is the GRANDPA consensus digest announcing the next authority set. The change is enacted
+// once the block Delay blocks after the block containing the digest is finalized.
+type ScheduledChange struct {
+	Authorities []*Authority
+	Delay       uint32
+}
+
+// Encode returns the SCALE encoding of the change, prefixed by its type
+func (c *ScheduledChange) Encode() ([]byte, error) {
+	enc, err := encodeAuthorities(c.Authorities)
+	if err != nil {
+		return nil, err
+	}
+
+	enc = append([]byte{ScheduledChangeType}, enc...)
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, c.Delay)
+	return append(enc, buf...), nil
+}
+
+// Decode decodes a SCALE encoded change into the receiver
+func (c *ScheduledChange) Decode(in []byte) error {
+	if len(in) == 0 || in[0] != ScheduledChangeType {
+		return errors.New("not a scheduled change digest")
+	}
+
+	r := bytes.NewReader(in[1:])
+	var err error
+	c.Authorities, err = decodeAuthorities(r)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return err
+	}
+	c.Delay = binary.LittleEndian.Uint32(buf)
+
+	return nil
+}
+
+// scheduledChange returns the scheduled change contained in a header's digest, or nil if there is none. Other
+// GRANDPA consensus digests are ignored.
+func scheduledChange(header *types.BlockHeader) (*ScheduledChange, error) {
+	items, err := types.DecodeDigest(header.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if item.Type != types.ConsensusDigestType || item.ConsensusEngineID != types.GrandpaEngineID {
+			continue
+		}
+
+		if len(item.Data) == 0 || item.Data[0] != ScheduledChangeType {
+			continue
+		}
+
+		change := new(ScheduledChange)
+		err = change.Decode(item.Data)
+		if err != nil {
+			return nil, err
+		}
+		return change, nil
+	}
+
+	return nil, nil
+}
+
+// encodeAuthorities returns the SCALE encoding of a list of (public key, weight) pairs
+func encodeAuthorities(authorities []*Authority) ([]byte, error) {
+	enc, err := scale.Encode(big.NewInt(int64(len(authorities))))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 8)
+	for _, auth := range authorities {
+		enc = append(enc, auth.Key.Encode()...)
+		binary.LittleEndian.PutUint64(buf, auth.Weight)
+		enc = append(enc, buf...)
+	}
+
+	return enc, nil
+}
+
+// decodeAuthorities decodes a SCALE encoded list of (public key, weight) pairs
+func decodeAuthorities(r io.Reader) ([]*Authority, error) {
+	sd := scale.Decoder{Reader: r}
+	n, err := sd.DecodeInteger()
+	if err != nil {
+		return nil, err
+	}
+
+	authorities := []*Authority{}
+	buf := make([]byte, 8)
+	for i := int64(0); i < n; i++ {
+		id := make([]byte, 32)
+		_, err = io.ReadFull(r, id)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := crypto.NewEd25519PublicKey(id)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		authorities = append(authorities, &Authority{Key: key, Weight: binary.LittleEndian.Uint64(buf)})
+	}
+
+	return authorities, nil
+}
@@ -0,0 +1,956 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package grandpa
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/core/blocktree"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/crypto"
+	"github.com/ChainSafe/gossamer/internal/events"
+	"github.com/ChainSafe/gossamer/internal/services"
+	"github.com/ChainSafe/gossamer/runtime"
+	log "github.com/ChainSafe/log15"
+)
+
+var _ services.DependentService = &Service{}
+
+// DefaultGossipDuration is the default time a message takes to reach all voters; voters wait for it before
+// prevoting, unless the round can already be completed
+const DefaultGossipDuration = time.Second
+
+// maxFutureVotes is the number of votes for later rounds that are kept until the rounds start
+const maxFutureVotes = 1024
+
+var (
+	ErrNoAuthorities    = errors.New("there are no GRANDPA authorities")
+	ErrNoNetwork        = errors.New("GRANDPA needs a network or an event bus to gossip votes")
+	ErrUnknownAuthority = errors.New("vote is not signed by a GRANDPA authority")
+	ErrInvalidSignature = errors.New("vote signature is invalid")
+	ErrInvalidPrecommit = errors.New("justification precommit is not for the target block or one of its descendants")
+	ErrNotEnoughVotes   = errors.New("justification does not contain precommits by a supermajority of the authorities")
+	ErrWrongTarget      = errors.New("justification is not for the block")
+)
+
+// Config is the configuration of the GRANDPA service
+type Config struct {
+	BlockTree *blocktree.BlockTree
+	// Runtime the authority set is read from. Authorities is used if it is nil or does not export
+	// GrandpaApi_grandpa_authorities.
+	Runtime     *runtime.Runtime
+	Authorities []*Authority
+	// Keypair the node votes with; it may be nil if the node is not an authority and only follows finality
+	Keypair *crypto.Ed25519Keypair
+	// Network votes are gossiped over; if it is nil votes are gossiped over the p2p service through Bus
+	Network        Network
+	Bus            *events.Bus
+	GossipDuration time.Duration
+}
+
+// pendingChange is a change of the authority set announced in a block, enacted once the block at number is
+// finalized on the same chain
+type pendingChange struct {
+	hash        common.Hash
+	number      uint64
+	authorities []*Authority
+}
+
+// Service is the GRANDPA finality gadget. Voters agree on the blocks to finalize in rounds of two stages: in
+// the prevote stage each voter votes for its best chain containing the estimate of the previous round, and in
+// the precommit stage for the block a supermajority of the prevotes agreed on. Once a supermajority of the
+// precommits agree on a block, it is finalized and the precommits are kept as its justification. A round starts
+// once the previous one is completable, and the votes of the previous round are still counted to update its
+// estimate.
+type Service struct {
+	services.DependencyList // services publishing the blocks and votes the service handles, and gossiping its votes
+
+	bt             *blocktree.BlockTree
+	keypair        *crypto.Ed25519Keypair
+	network        Network
+	ownNetwork     *busNetwork // network created by the service, closed when it stops
+	bus            *events.Bus
+	gossipDuration time.Duration
+	now            func() time.Time
+
+	lock         sync.Mutex
+	authorities  []*Authority
+	setID        uint64
+	round        uint64 // 0 until the service is started
+	roundStart   time.Time
+	prevotes     map[[32]byte]*VoteMessage
+	precommits   map[[32]byte]*VoteMessage
+	prevoted     bool
+	precommitted bool
+	prev         *roundVotes    // votes of the previous round of the set, nil if they are unknown
+	future       []*VoteMessage // votes for later rounds of the current authority set
+	pending      []*pendingChange
+
+	// messages to gossip and blocks finalized while the lock was held, sent once it is released
+	outbox    [][]byte
+	finalized []*types.BlockHeader
+
+	sub  *events.Subscription
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// roundVotes are the votes of a round
+type roundVotes struct {
+	round      uint64
+	prevotes   map[[32]byte]*VoteMessage
+	precommits map[[32]byte]*VoteMessage
+}
+
+// NewService returns a GRANDPA service voting with the authority set read from the runtime
+func NewService(cfg *Config) (*Service, error) {
+	if cfg.Network == nil && cfg.Bus == nil {
+		return nil, ErrNoNetwork
+	}
+
+	s := &Service{
+		bt:             cfg.BlockTree,
+		keypair:        cfg.Keypair,
+		network:        cfg.Network,
+		bus:            cfg.Bus,
+		gossipDuration: cfg.GossipDuration,
+		now:            time.Now,
+		done:           make(chan struct{}),
+	}
+
+	if s.gossipDuration == 0 {
+		s.gossipDuration = DefaultGossipDuration
+	}
+
+	s.authorities = cfg.Authorities
+	if cfg.Runtime != nil {
+		authorities, err := authoritiesFromRuntime(cfg.Runtime)
+		if err == nil {
+			s.authorities = authorities
+		} else if err != runtime.ErrExportFunctionNotFound {
+			return nil, err
+		}
+	}
+
+	if len(s.authorities) == 0 {
+		return nil, ErrNoAuthorities
+	}
+
+	return s, nil
+}
+
+// Start starts voting, or following the votes if the node is not an authority
+func (s *Service) Start() error {
+	if s.network == nil {
+		s.ownNetwork = newBusNetwork(s.bus)
+		s.network = s.ownNetwork
+	}
+
+	if s.bus != nil {
+		s.sub = s.bus.Subscribe(events.BlockImportedTopic, events.BlockProducedTopic, events.JustificationReceivedTopic)
+	}
+
+	s.lock.Lock()
+	s.newRound(1)
+	s.progress()
+	out, finalized := s.takeOutbox()
+	s.lock.Unlock()
+	s.send(out, finalized)
+
+	s.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+// Stop stops voting
+func (s *Service) Stop() error {
+	close(s.done)
+	s.wg.Wait()
+
+	if s.sub != nil {
+		s.sub.Unsubscribe()
+	}
+
+	if s.ownNetwork != nil {
+		s.ownNetwork.close()
+	}
+
+	return nil
+}
+
+// SetKeypair sets the key the node votes with. It must be called before the service is started.
+func (s *Service) SetKeypair(kp *crypto.Ed25519Keypair) {
+	s.keypair = kp
+}
+
+// Authorities returns the current authority set
+func (s *Service) Authorities() []*Authority {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.authorities
+}
+
+// SetID returns the ID of the current authority set, which is incremented every time the set changes
+func (s *Service) SetID() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.setID
+}
+
+// Justification returns the justification of a finalized block, as stored in the block DB, or nil if the block
+// has none
+func (s *Service) Justification(hash common.Hash) (*Justification, error) {
+	s.lock.Lock()
+	enc, err := s.bt.GetJustification(hash)
+	s.lock.Unlock()
+	if err != nil || enc == nil {
+		return nil, err
+	}
+
+	j := new(Justification)
+	err = j.Decode(bytes.NewReader(enc))
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// ImportJustification finalizes the block with the SCALE encoded justification received from a peer, once it
+// is verified against the current authority set. This lets a node finalize blocks it syncs without voting.
+func (s *Service) ImportJustification(hash common.Hash, data []byte) error {
+	j := new(Justification)
+	err := j.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if j.Target.Hash != hash {
+		return ErrWrongTarget
+	}
+
+	s.lock.Lock()
+	if !s.aboveFinalized(j.Target) {
+		s.lock.Unlock()
+		return nil
+	}
+
+	err = VerifyJustification(s.bt, j, s.setID, s.authorities)
+	if err == nil && s.finalize(j.Target, j) && s.round != 0 {
+		s.newRound(1)
+	}
+	s.progress()
+	out, finalized := s.takeOutbox()
+	s.lock.Unlock()
+
+	s.send(out, finalized)
+	return err
+}
+
+// HandleHeader must be called with every imported block header; it records the changes of the authority set the
+// header announces, and counts the votes for the block that were received before it
+func (s *Service) HandleHeader(header *types.BlockHeader) error {
+	change, err := scheduledChange(header)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	if change != nil {
+		s.pending = append(s.pending, &pendingChange{
+			hash:        header.Hash,
+			number:      header.Number.Uint64() + uint64(change.Delay),
+			authorities: change.Authorities,
+		})
+	}
+	s.progress()
+	out, finalized := s.takeOutbox()
+	s.lock.Unlock()
+
+	s.send(out, finalized)
+	return nil
+}
+
+func (s *Service) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.gossipDuration / 4)
+	defer ticker.Stop()
+
+	var blocks <-chan events.Event
+	if s.sub != nil {
+		blocks = s.sub.Chan()
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.tick()
+		case msg := <-s.network.Messages():
+			s.handleMessage(msg)
+		case e := <-blocks:
+			s.handleEvent(e)
+		}
+	}
+}
+
+func (s *Service) handleEvent(e events.Event) {
+	switch ev := e.(type) {
+	case *events.BlockImported:
+		err := s.HandleHeader(&ev.Block.Header)
+		if err != nil {
+			log.Error("[grandpa] cannot handle block header", "hash", ev.Block.Header.Hash, "error", err)
+		}
+	case *events.BlockProduced:
+		err := s.HandleHeader(&ev.Block.Header)
+		if err != nil {
+			log.Error("[grandpa] cannot handle block header", "hash", ev.Block.Header.Hash, "error", err)
+		}
+	case *events.JustificationReceived:
+		err := s.ImportJustification(ev.Hash, ev.Justification)
+		if err != nil {
+			log.Debug("[grandpa] rejected justification", "hash", ev.Hash, "error", err)
+		}
+	}
+}
+
+// tick prevotes once the round has lasted a gossip duration
+func (s *Service) tick() {
+	s.lock.Lock()
+	s.progress()
+	out, finalized := s.takeOutbox()
+	s.lock.Unlock()
+
+	s.send(out, finalized)
+}
+
+func (s *Service) handleMessage(data []byte) {
+	msg, err := decodeMessage(data)
+	if err != nil {
+		log.Debug("[grandpa] cannot decode message", "error", err)
+		return
+	}
+
+	s.lock.Lock()
+	switch m := msg.(type) {
+	case *VoteMessage:
+		err = s.handleVote(m)
+	case *CommitMessage:
+		err = s.handleCommit(m)
+	}
+	out, finalized := s.takeOutbox()
+	s.lock.Unlock()
+
+	if err != nil {
+		log.Debug("[grandpa] rejected message", "error", err)
+	}
+	s.send(out, finalized)
+}
+
+// handleVote records a vote of the current or previous round of the set, or keeps it if it is for a later round
+func (s *Service) handleVote(m *VoteMessage) error {
+	if m.SetID != s.setID || m.Round+1 < s.round {
+		return nil
+	}
+
+	auth := s.authority(m.AuthorityID)
+	if auth == nil {
+		return ErrUnknownAuthority
+	}
+
+	if !auth.Key.Verify(signingPayload(m.Stage, m.Vote, m.Round, m.SetID), m.Signature[:]) {
+		return ErrInvalidSignature
+	}
+
+	if m.Round > s.round {
+		if len(s.future) < maxFutureVotes {
+			s.future = append(s.future, m)
+		}
+		return nil
+	}
+
+	s.addVote(m)
+	s.progress()
+	return nil
+}
+
+// handleCommit finalizes the block of a commit message once its justification is verified
+func (s *Service) handleCommit(m *CommitMessage) error {
+	j := m.Justification
+	if m.SetID != s.setID || !s.aboveFinalized(j.Target) {
+		return nil
+	}
+
+	err := VerifyJustification(s.bt, j, s.setID, s.authorities)
+	if err != nil {
+		return err
+	}
+
+	changed := s.finalize(j.Target, j)
+	if changed {
+		s.newRound(1)
+	} else if j.Round >= s.round {
+		s.newRound(j.Round + 1)
+	}
+
+	s.progress()
+	return nil
+}
+
+// addVote records a vote of the current or previous round; only the first vote of each voter in a stage is counted
+func (s *Service) addVote(m *VoteMessage) {
+	prevotes, precommits := s.prevotes, s.precommits
+	if m.Round != s.round {
+		if s.prev == nil || s.prev.round != m.Round {
+			return
+		}
+		prevotes, precommits = s.prev.prevotes, s.prev.precommits
+	}
+
+	votes := prevotes
+	if m.Stage == Precommit {
+		votes = precommits
+	}
+
+	if _, ok := votes[m.AuthorityID]; !ok {
+		votes[m.AuthorityID] = m
+	}
+}
+
+// newRound starts the round, counting the votes for it that were received early. The votes of the current round
+// are kept if the round follows it, otherwise the previous round is unknown.
+func (s *Service) newRound(round uint64) {
+	s.prev = nil
+	if s.round != 0 && round == s.round+1 {
+		s.prev = &roundVotes{round: s.round, prevotes: s.prevotes, precommits: s.precommits}
+	}
+
+	s.round = round
+	s.roundStart = s.now()
+	s.prevotes = make(map[[32]byte]*VoteMessage)
+	s.precommits = make(map[[32]byte]*VoteMessage)
+	s.prevoted = false
+	s.precommitted = false
+
+	future := s.future
+	s.future = nil
+	for _, m := range future {
+		if m.SetID != s.setID || m.Round < round {
+			continue
+		}
+
+		if m.Round == round {
+			s.addVote(m)
+		} else {
+			s.future = append(s.future, m)
+		}
+	}
+}
+
+// progress casts the votes of the current round that are due, finalizes the blocks a supermajority of the
+// precommits of the current or previous round agree on, and starts the next round once the current one is
+// completable
+func (s *Service) progress() {
+	if s.round == 0 {
+		return
+	}
+
+	for {
+		// late precommits of the previous round can still finalize a block
+		if s.prev != nil && s.finalizeRound(s.prev.round, s.prev.precommits) {
+			s.newRound(1)
+			continue
+		}
+
+		_, voter := s.voterID()
+		estimate, completable := s.previousEstimate()
+
+		// voters prevote once the previous round is completable, and after a gossip duration unless the round
+		// can already be completed
+		if voter && !s.prevoted && completable {
+			if _, done := s.roundEstimate(s.prevotes, s.precommits); done || s.now().Sub(s.roundStart) >= s.gossipDuration {
+				s.prevote(estimate)
+			}
+		}
+
+		// voters precommit for the prevote GHOST once its chain contains the estimate of the previous round
+		if voter && s.prevoted && !s.precommitted && estimate != nil {
+			if ghost := s.ghost(s.prevotes); ghost != nil {
+				if ok, err := s.bt.IsDescendantOf(estimate.Hash, ghost.Hash); err == nil && ok {
+					s.vote(Precommit, ghost)
+					s.precommitted = true
+				}
+			}
+		}
+
+		if s.finalizeRound(s.round, s.precommits) {
+			s.newRound(1)
+			continue
+		}
+
+		if _, done := s.roundEstimate(s.prevotes, s.precommits); !done {
+			return
+		}
+		s.newRound(s.round + 1)
+	}
+}
+
+// previousEstimate returns the estimate of the previous round, and true if the round is completable. The last
+// finalized block is the estimate of a previous round whose votes are unknown.
+func (s *Service) previousEstimate() (*Vote, bool) {
+	if s.prev != nil {
+		return s.roundEstimate(s.prev.prevotes, s.prev.precommits)
+	}
+
+	finalized, err := s.bt.GetHeader(s.bt.FinalizedHash())
+	if err != nil {
+		return nil, false
+	}
+	return &Vote{Hash: finalized.Hash, Number: finalized.Number.Uint64()}, true
+}
+
+// prevote votes for the best block if its chain contains the estimate of the previous round, otherwise for the
+// estimate itself
+func (s *Service) prevote(estimate *Vote) {
+	target := estimate
+	best := s.bt.BestBlock().Header
+	if ok, err := s.bt.IsDescendantOf(estimate.Hash, best.Hash); err == nil && ok {
+		target = &Vote{Hash: best.Hash, Number: best.Number.Uint64()}
+	}
+
+	s.vote(Prevote, target)
+	s.prevoted = true
+}
+
+// vote signs the vote for the current round, counts it and gossips it
+func (s *Service) vote(stage Subround, vote *Vote) {
+	id, _ := s.voterID()
+	sig, err := s.keypair.Sign(signingPayload(stage, vote, s.round, s.setID))
+	if err != nil {
+		log.Error("[grandpa] cannot sign vote", "error", err)
+		return
+	}
+
+	m := &VoteMessage{
+		Round:       s.round,
+		SetID:       s.setID,
+		Stage:       stage,
+		Vote:        vote,
+		AuthorityID: id,
+	}
+	copy(m.Signature[:], sig)
+
+	s.addVote(m)
+	s.outbox = append(s.outbox, m.Encode())
+}
+
+// ghost returns the highest block that a supermajority of the votes are for, counting a vote for a block as a
+// vote for each of its ancestors back to the last finalized block. It returns nil if there is no such block,
+// or only the last finalized block if the votes disagree on all of its descendants.
+func (s *Service) ghost(votes map[[32]byte]*VoteMessage) *Vote {
+	finalized, err := s.bt.GetHeader(s.bt.FinalizedHash())
+	if err != nil {
+		return nil
+	}
+
+	weights := make(map[common.Hash]uint64)
+	numbers := map[common.Hash]uint64{finalized.Hash: finalized.Number.Uint64()}
+
+	for id, m := range votes {
+		auth := s.authority(id)
+		chain := s.chainToFinalized(m.Vote, finalized)
+		for _, hash := range chain {
+			weights[hash] += auth.Weight
+		}
+		for i, hash := range chain {
+			numbers[hash] = m.Vote.Number - uint64(i)
+		}
+	}
+
+	var best *Vote
+	threshold := threshold(s.authorities)
+	for hash, weight := range weights {
+		if weight < threshold {
+			continue
+		}
+
+		if best == nil || numbers[hash] > best.Number {
+			best = &Vote{Hash: hash, Number: numbers[hash]}
+		}
+	}
+
+	return best
+}
+
+// roundEstimate returns the estimate of a round: the highest block on the chain of the prevote GHOST that a
+// supermajority of the precommits could still be for, counting the voters that have not precommitted yet. The
+// round is completable once its estimate cannot move up anymore, because it is below the prevote GHOST or no
+// child of the GHOST can get a supermajority of the precommits. It returns nil if there is no prevote GHOST.
+func (s *Service) roundEstimate(prevotes, precommits map[[32]byte]*VoteMessage) (*Vote, bool) {
+	ghost := s.ghost(prevotes)
+	if ghost == nil {
+		return nil, false
+	}
+
+	finalized, err := s.bt.GetHeader(s.bt.FinalizedHash())
+	if err != nil {
+		return nil, false
+	}
+
+	threshold := threshold(s.authorities)
+	estimate := &Vote{Hash: finalized.Hash, Number: finalized.Number.Uint64()}
+	for i, hash := range s.chainToFinalized(ghost, finalized) {
+		if s.possibleWeight(hash, precommits) >= threshold {
+			estimate = &Vote{Hash: hash, Number: ghost.Number - uint64(i)}
+			break
+		}
+	}
+
+	if estimate.Hash != ghost.Hash {
+		return estimate, true
+	}
+
+	// the voters that have not precommitted yet could all precommit for the same child of the GHOST
+	if s.unvotedWeight(precommits) >= threshold {
+		return estimate, false
+	}
+
+	for _, m := range precommits {
+		child, ok := s.childTowards(ghost, m.Vote)
+		if ok && s.possibleWeight(child, precommits) >= threshold {
+			return estimate, false
+		}
+	}
+
+	return estimate, true
+}
+
+// possibleWeight returns the weight of the precommits for the block or its descendants, and of the voters that
+// have not precommitted yet
+func (s *Service) possibleWeight(hash common.Hash, precommits map[[32]byte]*VoteMessage) uint64 {
+	weight := s.unvotedWeight(precommits)
+	for id, m := range precommits {
+		if ok, err := s.bt.IsDescendantOf(hash, m.Vote.Hash); err == nil && ok {
+			weight += s.authority(id).Weight
+		}
+	}
+	return weight
+}
+
+// unvotedWeight returns the weight of the authorities that have not precommitted yet
+func (s *Service) unvotedWeight(precommits map[[32]byte]*VoteMessage) uint64 {
+	var weight uint64
+	for _, auth := range s.authorities {
+		weight += auth.Weight
+	}
+
+	for id := range precommits {
+		weight -= s.authority(id).Weight
+	}
+	return weight
+}
+
+// childTowards returns the child of the ancestor block on the chain of the voted block, and false if the voted
+// block is not a descendant of the ancestor other than the ancestor itself
+func (s *Service) childTowards(ancestor *Vote, vote *Vote) (common.Hash, bool) {
+	header, err := s.bt.GetHeader(vote.Hash)
+	if err != nil {
+		return common.Hash{}, false
+	}
+
+	for header.Number.Uint64() > ancestor.Number+1 {
+		header, err = s.bt.GetHeader(header.ParentHash)
+		if err != nil {
+			return common.Hash{}, false
+		}
+	}
+
+	if header.Number.Uint64() != ancestor.Number+1 || header.ParentHash != ancestor.Hash {
+		return common.Hash{}, false
+	}
+	return header.Hash, true
+}
+
+// chainToFinalized returns the hashes of the voted block and its ancestors back to the last finalized block,
+// or nil if the block is unknown, its number is not the voted number, or it is not a descendant of the last
+// finalized block
+func (s *Service) chainToFinalized(vote *Vote, finalized *types.BlockHeader) []common.Hash {
+	header, err := s.bt.GetHeader(vote.Hash)
+	if err != nil || header.Number.Uint64() != vote.Number {
+		return nil
+	}
+
+	var chain []common.Hash
+	for header.Number.Cmp(finalized.Number) > 0 {
+		chain = append(chain, header.Hash)
+		header, err = s.bt.GetHeader(header.ParentHash)
+		if err != nil {
+			return nil
+		}
+	}
+
+	if header.Hash != finalized.Hash {
+		return nil
+	}
+
+	return append(chain, header.Hash)
+}
+
+// finalizeRound finalizes the block a supermajority of the precommits of the round agree on, if it is above the
+// last finalized block. It returns true if finalizing the block changed the authority set.
+func (s *Service) finalizeRound(round uint64, precommits map[[32]byte]*VoteMessage) bool {
+	target := s.ghost(precommits)
+	if target == nil || !s.aboveFinalized(target) {
+		return false
+	}
+
+	return s.finalize(target, s.roundJustification(round, precommits, target))
+}
+
+// roundJustification returns the precommits of the round for the target block or its descendants
+func (s *Service) roundJustification(round uint64, precommits map[[32]byte]*VoteMessage, target *Vote) *Justification {
+	j := &Justification{
+		Round:  round,
+		Target: target,
+	}
+
+	for _, m := range precommits {
+		if ok, err := s.bt.IsDescendantOf(target.Hash, m.Vote.Hash); err != nil || !ok {
+			continue
+		}
+
+		j.Precommits = append(j.Precommits, &SignedPrecommit{
+			Vote:        m.Vote,
+			Signature:   m.Signature,
+			AuthorityID: m.AuthorityID,
+		})
+	}
+
+	return j
+}
+
+// finalize finalizes the target block in the block tree, keeps its justification and announces it. It returns
+// true if finalizing the block enacted a change of the authority set.
+func (s *Service) finalize(target *Vote, j *Justification) bool {
+	err := s.bt.Finalize(target.Hash)
+	if err != nil {
+		log.Error("[grandpa] cannot finalize block", "hash", target.Hash, "error", err)
+		return false
+	}
+
+	header, err := s.bt.GetHeader(target.Hash)
+	if err != nil {
+		log.Error("[grandpa] cannot get header of finalized block", "hash", target.Hash, "error", err)
+		return false
+	}
+
+	log.Debug("[grandpa] finalized block", "number", target.Number, "hash", target.Hash, "round", j.Round, "set", s.setID)
+
+	enc, err := j.Encode()
+	if err == nil {
+		err = s.bt.SetJustification(target.Hash, enc)
+	}
+	if err != nil {
+		log.Error("[grandpa] cannot store justification", "hash", target.Hash, "error", err)
+	}
+
+	commit := &CommitMessage{SetID: s.setID, Justification: j}
+	enc, err = commit.Encode()
+	if err != nil {
+		log.Error("[grandpa] cannot encode commit message", "error", err)
+	} else {
+		s.outbox = append(s.outbox, enc)
+	}
+
+	s.finalized = append(s.finalized, header)
+	return s.enactChanges(target)
+}
+
+// enactChanges replaces the authority set with the last pending change enacted by finalizing the target block,
+// and drops the changes on chains that can no longer be finalized. It returns true if the set changed.
+func (s *Service) enactChanges(target *Vote) bool {
+	var enacted *pendingChange
+	pending := []*pendingChange{}
+	for _, change := range s.pending {
+		if ok, err := s.bt.IsDescendantOf(change.hash, target.Hash); err == nil && ok && change.number <= target.Number {
+			if enacted == nil || change.number > enacted.number {
+				enacted = change
+			}
+			continue
+		}
+
+		if ok, err := s.bt.IsDescendantOf(target.Hash, change.hash); err == nil && ok {
+			pending = append(pending, change)
+		}
+	}
+	s.pending = pending
+
+	if enacted == nil {
+		return false
+	}
+
+	s.authorities = enacted.authorities
+	s.setID++
+	s.future = nil
+	log.Info("[grandpa] authority set changed", "set", s.setID, "authorities", len(s.authorities))
+	return true
+}
+
+// aboveFinalized returns true if the block is a descendant of the last finalized block, other than that block
+func (s *Service) aboveFinalized(vote *Vote) bool {
+	finalized := s.bt.FinalizedHash()
+	if vote.Hash == finalized {
+		return false
+	}
+
+	ok, err := s.bt.IsDescendantOf(finalized, vote.Hash)
+	return err == nil && ok
+}
+
+// takeOutbox returns and clears the messages to gossip and the blocks finalized since it was last called
+func (s *Service) takeOutbox() ([][]byte, []*types.BlockHeader) {
+	out, finalized := s.outbox, s.finalized
+	s.outbox, s.finalized = nil, nil
+	return out, finalized
+}
+
+// send gossips the messages and announces the finalized blocks; it must be called without holding the lock
+func (s *Service) send(out [][]byte, finalized []*types.BlockHeader) {
+	for _, msg := range out {
+		err := s.network.Gossip(msg)
+		if err != nil {
+			log.Error("[grandpa] cannot gossip message", "error", err)
+		}
+	}
+
+	if s.bus == nil {
+		return
+	}
+
+	for _, header := range finalized {
+		s.bus.Publish(&events.BlockFinalized{Header: header})
+	}
+}
+
+// voterID returns the authority ID of the node's key, and false if it is not one of the authorities
+func (s *Service) voterID() ([32]byte, bool) {
+	id := [32]byte{}
+	if s.keypair == nil {
+		return id, false
+	}
+
+	copy(id[:], s.keypair.Public().Encode())
+	return id, s.authority(id) != nil
+}
+
+// authority returns the authority of the current set with the ID, or nil if there is none
+func (s *Service) authority(id [32]byte) *Authority {
+	return findAuthority(s.authorities, id)
+}
+
+func findAuthority(authorities []*Authority, id [32]byte) *Authority {
+	for _, auth := range authorities {
+		if bytes.Equal(auth.Key.Encode(), id[:]) {
+			return auth
+		}
+	}
+	return nil
+}
+
+// threshold returns the weight of a supermajority of the authorities, which is reached by the honest
+// authorities as long as less than a third of the weight is faulty
+func threshold(authorities []*Authority) uint64 {
+	var total uint64
+	for _, auth := range authorities {
+		total += auth.Weight
+	}
+
+	if total == 0 {
+		return 1
+	}
+	return total - (total-1)/3
+}
+
+// VerifyJustification checks that the justification contains valid precommits for its target block or its
+// descendants, signed by a supermajority of the authority set
+func VerifyJustification(bt *blocktree.BlockTree, j *Justification, setID uint64, authorities []*Authority) error {
+	header, err := bt.GetHeader(j.Target.Hash)
+	if err != nil {
+		return err
+	}
+
+	if header.Number.Uint64() != j.Target.Number {
+		return ErrInvalidPrecommit
+	}
+
+	var weight uint64
+	counted := make(map[[32]byte]bool)
+	for _, pc := range j.Precommits {
+		auth := findAuthority(authorities, pc.AuthorityID)
+		if auth == nil {
+			return ErrUnknownAuthority
+		}
+
+		if !auth.Key.Verify(signingPayload(Precommit, pc.Vote, j.Round, setID), pc.Signature[:]) {
+			return ErrInvalidSignature
+		}
+
+		ok, err := bt.IsDescendantOf(j.Target.Hash, pc.Vote.Hash)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidPrecommit
+		}
+
+		if counted[pc.AuthorityID] {
+			continue
+		}
+		counted[pc.AuthorityID] = true
+		weight += auth.Weight
+	}
+
+	if weight < threshold(authorities) {
+		return ErrNotEnoughVotes
+	}
+
+	return nil
+}
+
+// authoritiesFromRuntime returns the authority set by calling GrandpaApi_grandpa_authorities
+func authoritiesFromRuntime(rt *runtime.Runtime) ([]*Authority, error) {
+	auths, err := rt.GrandpaAPI().Authorities()
+	if err != nil {
+		return nil, err
+	}
+
+	authorities := make([]*Authority, len(auths))
+	for i, auth := range auths {
+		key, err := crypto.NewEd25519PublicKey(auth.Key[:])
+		if err != nil {
+			return nil, err
+		}
+		authorities[i] = &Authority{Key: key, Weight: auth.Weight}
+	}
+
+	return authorities, nil
+}
@@ -0,0 +1,557 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package grandpa
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/core/blocktree"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/crypto"
+	"github.com/ChainSafe/gossamer/internal/events"
+	db "github.com/ChainSafe/gossamer/polkadb"
+)
+
+// testNetwork is an in-process network delivering every gossiped message to all other peers of the hub
+type testNetwork struct {
+	hub *testHub
+	in  chan []byte
+}
+
+type testHub struct {
+	lock  sync.Mutex
+	peers []*testNetwork
+}
+
+func (h *testHub) newPeer() *testNetwork {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	n := &testNetwork{hub: h, in: make(chan []byte, 1024)}
+	h.peers = append(h.peers, n)
+	return n
+}
+
+func (n *testNetwork) Gossip(msg []byte) error {
+	n.hub.lock.Lock()
+	defer n.hub.lock.Unlock()
+
+	for _, p := range n.hub.peers {
+		if p != n {
+			go func(p *testNetwork) { p.in <- msg }(p)
+		}
+	}
+	return nil
+}
+
+func (n *testNetwork) Messages() <-chan []byte {
+	return n.in
+}
+
+// createTestBlocks returns a chain of blocks on top of the genesis block, and a block forking from block 1
+func createTestBlocks(t *testing.T, length int, digests map[int][]byte) (types.Block, []*types.Block, *types.Block) {
+	genesis := types.Block{
+		Header: types.BlockHeader{
+			Number: big.NewInt(0),
+			Hash:   common.Hash{0x00},
+		},
+		Body: types.BlockBody{},
+	}
+
+	blocks := []*types.Block{}
+	parent := genesis.Header.Hash
+	for i := 1; i <= length; i++ {
+		block := &types.Block{
+			Header: types.BlockHeader{
+				ParentHash: parent,
+				Number:     big.NewInt(int64(i)),
+				Digest:     digests[i],
+				Hash:       common.Hash{byte(i)},
+			},
+			Body: types.BlockBody{},
+		}
+		blocks = append(blocks, block)
+		parent = block.Header.Hash
+	}
+
+	fork := &types.Block{
+		Header: types.BlockHeader{
+			ParentHash: blocks[0].Header.Hash,
+			Number:     big.NewInt(2),
+			Hash:       common.Hash{0xf0},
+		},
+		Body: types.BlockBody{},
+	}
+
+	return genesis, blocks, fork
+}
+
+func newTestBlockTree(genesis types.Block, blocks []*types.Block, fork *types.Block) *blocktree.BlockTree {
+	bt := blocktree.NewBlockTreeFromGenesis(genesis, &db.BlockDB{Db: db.NewMemDatabase()})
+	for _, block := range blocks {
+		bt.AddBlock(*block)
+	}
+	bt.AddBlock(*fork)
+	return bt
+}
+
+func newTestAuthorities(t *testing.T, n int) ([]*crypto.Ed25519Keypair, []*Authority) {
+	keypairs := []*crypto.Ed25519Keypair{}
+	authorities := []*Authority{}
+	for i := 0; i < n; i++ {
+		kp, err := crypto.GenerateEd25519Keypair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keypairs = append(keypairs, kp)
+		authorities = append(authorities, &Authority{Key: kp.Public().(*crypto.Ed25519PublicKey), Weight: 1})
+	}
+	return keypairs, authorities
+}
+
+func signPrecommit(t *testing.T, kp *crypto.Ed25519Keypair, vote *Vote, round, setID uint64) *SignedPrecommit {
+	sig, err := kp.Sign(signingPayload(Precommit, vote, round, setID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc := &SignedPrecommit{Vote: vote}
+	copy(pc.Signature[:], sig)
+	copy(pc.AuthorityID[:], kp.Public().Encode())
+	return pc
+}
+
+// addTestVote records a vote of the authority in the round without signing it
+func addTestVote(s *Service, kp *crypto.Ed25519Keypair, round uint64, stage Subround, block *types.Block) {
+	m := &VoteMessage{
+		Round: round,
+		SetID: s.setID,
+		Stage: stage,
+		Vote:  &Vote{Hash: block.Header.Hash, Number: block.Header.Number.Uint64()},
+	}
+	copy(m.AuthorityID[:], kp.Public().Encode())
+	s.addVote(m)
+}
+
+// waitForFinality waits until the block with the hash is finalized, according to the BlockFinalized events
+func waitForFinality(t *testing.T, sub *events.Subscription, hash common.Hash) {
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e := <-sub.Chan():
+			if e.(*events.BlockFinalized).Header.Hash == hash {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("block %s was not finalized", hash)
+		}
+	}
+}
+
+func TestEncodeDecodeMessages(t *testing.T) {
+	vote := &VoteMessage{
+		Round: 7,
+		SetID: 2,
+		Stage: Precommit,
+		Vote:  &Vote{Hash: common.Hash{0x01, 0x02}, Number: 99},
+	}
+	vote.Signature[0] = 0xaa
+	vote.AuthorityID[31] = 0xbb
+
+	dec, err := decodeMessage(vote.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dec, vote) {
+		t.Fatalf("Fail: got %v expected %v", dec, vote)
+	}
+
+	commit := &CommitMessage{
+		SetID: 1,
+		Justification: &Justification{
+			Round:  3,
+			Target: &Vote{Hash: common.Hash{0x03}, Number: 3},
+			Precommits: []*SignedPrecommit{
+				{Vote: &Vote{Hash: common.Hash{0x04}, Number: 4}, Signature: [64]byte{0x05}, AuthorityID: [32]byte{0x06}},
+			},
+		},
+	}
+
+	enc, err := commit.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err = decodeMessage(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dec, commit) {
+		t.Fatalf("Fail: got %v expected %v", dec, commit)
+	}
+
+	_, err = decodeMessage([]byte{7})
+	if err != ErrUnknownMessageType {
+		t.Fatalf("Fail: got %v expected %v", err, ErrUnknownMessageType)
+	}
+}
+
+func TestScheduledChange_EncodeDecode(t *testing.T) {
+	_, authorities := newTestAuthorities(t, 2)
+	change := &ScheduledChange{Authorities: authorities, Delay: 5}
+
+	enc, err := change.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := new(ScheduledChange)
+	err = dec.Decode(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dec.Delay != 5 || len(dec.Authorities) != 2 || !bytes.Equal(dec.Authorities[1].Key.Encode(), authorities[1].Key.Encode()) {
+		t.Fatalf("Fail: got %v expected %v", dec, change)
+	}
+}
+
+func TestVerifyJustification(t *testing.T) {
+	genesis, blocks, fork := createTestBlocks(t, 4, nil)
+	bt := newTestBlockTree(genesis, blocks, fork)
+	keypairs, authorities := newTestAuthorities(t, 4)
+
+	target := &Vote{Hash: blocks[1].Header.Hash, Number: 2}
+	descendant := &Vote{Hash: blocks[3].Header.Hash, Number: 4}
+
+	j := &Justification{
+		Round:  1,
+		Target: target,
+		Precommits: []*SignedPrecommit{
+			signPrecommit(t, keypairs[0], target, 1, 0),
+			signPrecommit(t, keypairs[1], descendant, 1, 0),
+		},
+	}
+
+	err := VerifyJustification(bt, j, 0, authorities)
+	if err != ErrNotEnoughVotes {
+		t.Fatalf("Fail: got %v expected %v", err, ErrNotEnoughVotes)
+	}
+
+	// a duplicate precommit is only counted once
+	j.Precommits = append(j.Precommits, j.Precommits[1])
+	err = VerifyJustification(bt, j, 0, authorities)
+	if err != ErrNotEnoughVotes {
+		t.Fatalf("Fail: got %v expected %v", err, ErrNotEnoughVotes)
+	}
+
+	j.Precommits[2] = signPrecommit(t, keypairs[2], target, 1, 0)
+	err = VerifyJustification(bt, j, 0, authorities)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signed for another authority set
+	err = VerifyJustification(bt, j, 1, authorities)
+	if err != ErrInvalidSignature {
+		t.Fatalf("Fail: got %v expected %v", err, ErrInvalidSignature)
+	}
+
+	err = VerifyJustification(bt, j, 0, authorities[1:])
+	if err != ErrUnknownAuthority {
+		t.Fatalf("Fail: got %v expected %v", err, ErrUnknownAuthority)
+	}
+
+	j.Precommits[2] = signPrecommit(t, keypairs[2], &Vote{Hash: fork.Header.Hash, Number: 2}, 1, 0)
+	err = VerifyJustification(bt, j, 0, authorities)
+	if err != ErrInvalidPrecommit {
+		t.Fatalf("Fail: got %v expected %v", err, ErrInvalidPrecommit)
+	}
+}
+
+func TestGrandpa_Finality(t *testing.T) {
+	genesis, blocks, fork := createTestBlocks(t, 5, nil)
+	keypairs, authorities := newTestAuthorities(t, 4)
+	head := blocks[4].Header.Hash
+
+	// one of the authorities is offline; the others are a supermajority
+	hub := &testHub{}
+	voters := []*Service{}
+	subs := []*events.Subscription{}
+	for _, kp := range keypairs[:3] {
+		bus := events.NewBus()
+		s, err := NewService(&Config{
+			BlockTree:      newTestBlockTree(genesis, blocks, fork),
+			Authorities:    authorities,
+			Keypair:        kp,
+			Network:        hub.newPeer(),
+			Bus:            bus,
+			GossipDuration: 20 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		voters = append(voters, s)
+		subs = append(subs, bus.Subscribe(events.BlockFinalizedTopic))
+	}
+
+	for _, s := range voters {
+		err := s.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sub := range subs {
+		waitForFinality(t, sub, head)
+	}
+
+	for _, s := range voters {
+		err := s.Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if s.bt.FinalizedHash() != head {
+			t.Fatalf("Fail: got finalized block %s expected %s", s.bt.FinalizedHash(), head)
+		}
+
+		j, err := s.Justification(head)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j == nil {
+			t.Fatal("Fail: finalized block has no justification")
+		}
+
+		err = VerifyJustification(s.bt, j, 0, authorities)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGrandpa_ScheduledChange(t *testing.T) {
+	keypairs, authorities := newTestAuthorities(t, 2)
+
+	change := &ScheduledChange{Authorities: authorities[1:], Delay: 1}
+	enc, err := change.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := types.EncodeDigest([]*types.DigestItem{types.NewConsensusDigest(types.GrandpaEngineID, enc)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesis, blocks, fork := createTestBlocks(t, 3, map[int][]byte{1: digest})
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.BlockFinalizedTopic)
+
+	s, err := NewService(&Config{
+		BlockTree:      newTestBlockTree(genesis, blocks, fork),
+		Authorities:    authorities[:1],
+		Keypair:        keypairs[0],
+		Network:        (&testHub{}).newPeer(),
+		Bus:            bus,
+		GossipDuration: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, block := range blocks {
+		err = s.HandleHeader(&block.Header)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	waitForFinality(t, sub, blocks[2].Header.Hash)
+
+	if s.SetID() != 1 {
+		t.Fatalf("Fail: got set ID %d expected 1", s.SetID())
+	}
+
+	next := s.Authorities()
+	if len(next) != 1 || !bytes.Equal(next[0].Key.Encode(), authorities[1].Key.Encode()) {
+		t.Fatalf("Fail: authority set was not changed")
+	}
+}
+
+func TestGrandpa_ImportJustification(t *testing.T) {
+	genesis, blocks, fork := createTestBlocks(t, 4, nil)
+	keypairs, authorities := newTestAuthorities(t, 4)
+	bt := newTestBlockTree(genesis, blocks, fork)
+
+	// the node is not an authority, it finalizes blocks with the justifications it syncs
+	s, err := NewService(&Config{
+		BlockTree:   bt,
+		Authorities: authorities,
+		Network:     (&testHub{}).newPeer(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := &Vote{Hash: blocks[2].Header.Hash, Number: 3}
+	j := &Justification{Round: 5, Target: target}
+	for _, kp := range keypairs[:2] {
+		j.Precommits = append(j.Precommits, signPrecommit(t, kp, target, 5, 0))
+	}
+
+	enc, err := j.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.ImportJustification(target.Hash, enc)
+	if err != ErrNotEnoughVotes {
+		t.Fatalf("Fail: got %v expected %v", err, ErrNotEnoughVotes)
+	}
+
+	j.Precommits = append(j.Precommits, signPrecommit(t, keypairs[2], target, 5, 0))
+	enc, err = j.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.ImportJustification(blocks[1].Header.Hash, enc)
+	if err != ErrWrongTarget {
+		t.Fatalf("Fail: got %v expected %v", err, ErrWrongTarget)
+	}
+
+	err = s.ImportJustification(target.Hash, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bt.FinalizedHash() != target.Hash {
+		t.Fatalf("Fail: got finalized block %s expected %s", bt.FinalizedHash(), target.Hash)
+	}
+
+	stored, err := s.Justification(target.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored, j) {
+		t.Fatalf("Fail: got stored justification %v expected %v", stored, j)
+	}
+}
+
+func TestRoundEstimate(t *testing.T) {
+	genesis, blocks, fork := createTestBlocks(t, 5, nil)
+	keypairs, authorities := newTestAuthorities(t, 4)
+
+	s, err := NewService(&Config{
+		BlockTree:   newTestBlockTree(genesis, blocks, fork),
+		Authorities: authorities,
+		Network:     (&testHub{}).newPeer(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.newRound(1)
+
+	if estimate, _ := s.roundEstimate(s.prevotes, s.precommits); estimate != nil {
+		t.Fatalf("Fail: got estimate %v without prevotes expected none", estimate)
+	}
+
+	for _, kp := range keypairs[:3] {
+		addTestVote(s, kp, 1, Prevote, blocks[4])
+	}
+
+	// the precommits could still all be for the prevote GHOST or one of its children
+	estimate, completable := s.roundEstimate(s.prevotes, s.precommits)
+	if estimate.Hash != blocks[4].Header.Hash || completable {
+		t.Fatalf("Fail: got estimate %v completable=%v expected block 5 and not completable", estimate, completable)
+	}
+
+	// once two voters precommit on the fork, the chain of the GHOST can only be final up to block 1
+	for _, kp := range keypairs[:2] {
+		addTestVote(s, kp, 1, Precommit, fork)
+	}
+
+	estimate, completable = s.roundEstimate(s.prevotes, s.precommits)
+	if estimate.Hash != blocks[0].Header.Hash || !completable {
+		t.Fatalf("Fail: got estimate %v completable=%v expected block 1 and completable", estimate, completable)
+	}
+}
+
+func TestPrevote_PreviousEstimate(t *testing.T) {
+	genesis, blocks, fork := createTestBlocks(t, 5, nil)
+	keypairs, authorities := newTestAuthorities(t, 4)
+
+	s, err := NewService(&Config{
+		BlockTree:   newTestBlockTree(genesis, blocks, fork),
+		Authorities: authorities,
+		Keypair:     keypairs[0],
+		Network:     (&testHub{}).newPeer(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the previous round prevoted for the fork, which is not on the best chain
+	s.newRound(1)
+	for _, kp := range keypairs[1:] {
+		addTestVote(s, kp, 1, Prevote, fork)
+	}
+	s.newRound(2)
+	s.roundStart = time.Now().Add(-time.Minute)
+
+	id, _ := s.voterID()
+
+	// the voter waits until the previous round is completable
+	s.progress()
+	if s.prevoted {
+		t.Fatal("Fail: prevoted before the previous round is completable")
+	}
+
+	for _, kp := range keypairs[1:3] {
+		addTestVote(s, kp, 1, Precommit, fork)
+	}
+
+	s.progress()
+	if !s.prevoted {
+		t.Fatal("Fail: did not prevote once the previous round is completable")
+	}
+
+	if vote := s.prevotes[id].Vote; vote.Hash != fork.Header.Hash {
+		t.Fatalf("Fail: got prevote for %s expected the estimate %s", vote.Hash, fork.Header.Hash)
+	}
+}
+
+func TestNewService_NoAuthorities(t *testing.T) {
+	_, err := NewService(&Config{Bus: events.NewBus()})
+	if err != ErrNoAuthorities {
+		t.Fatalf("Fail: got %v expected %v", err, ErrNoAuthorities)
+	}
+}
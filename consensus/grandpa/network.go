@@ -0,0 +1,83 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package grandpa
+
+import (
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/events"
+)
+
+// Network gossips GRANDPA messages between voters
+type Network interface {
+	// Gossip sends the encoded message to our peers
+	Gossip(msg []byte) error
+	// Messages returns the channel on which the encoded messages gossiped by our peers are received
+	Messages() <-chan []byte
+}
+
+// busNetwork is the Network gossiping messages over the p2p service, through the consensus message events of
+// the event bus
+type busNetwork struct {
+	bus *events.Bus
+	sub *events.Subscription
+	out chan []byte
+}
+
+func newBusNetwork(bus *events.Bus) *busNetwork {
+	n := &busNetwork{
+		bus: bus,
+		sub: bus.Subscribe(events.ConsensusMessageReceivedTopic),
+		out: make(chan []byte, events.DefaultBufferSize),
+	}
+
+	go n.receive()
+	return n
+}
+
+func (n *busNetwork) Gossip(msg []byte) error {
+	n.bus.Publish(&events.ConsensusMessageProduced{EngineID: types.GrandpaEngineID, Data: msg})
+	return nil
+}
+
+func (n *busNetwork) Messages() <-chan []byte {
+	return n.out
+}
+
+// receive forwards the GRANDPA messages received from our peers, until the network is closed
+func (n *busNetwork) receive() {
+	for {
+		select {
+		case e := <-n.sub.Chan():
+			msg := e.(*events.ConsensusMessageReceived)
+			if msg.EngineID != types.GrandpaEngineID {
+				continue
+			}
+
+			select {
+			case n.out <- msg.Data:
+			case <-n.sub.Done():
+				return
+			}
+		case <-n.sub.Done():
+			return
+		}
+	}
+}
+
+func (n *busNetwork) close() {
+	n.sub.Unsubscribe()
+}
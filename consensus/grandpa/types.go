@@ -0,0 +1,295 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package grandpa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+
+	scale "github.com/ChainSafe/gossamer/codec"
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/crypto"
+)
+
+// Subround is a stage of a GRANDPA round
+type Subround byte
+
+const (
+	// Prevote is the first stage of a round, in which voters vote for their best chain
+	Prevote Subround = 0
+	// Precommit is the second stage of a round, in which voters vote for the block the prevotes agreed on
+	Precommit Subround = 1
+)
+
+// message types of the gossiped GRANDPA messages
+const (
+	voteMessageType   = byte(0)
+	commitMessageType = byte(1)
+)
+
+var (
+	// ErrUnknownMessageType is returned when decoding a GRANDPA message of an unknown type
+	ErrUnknownMessageType = errors.New("unknown GRANDPA message type")
+	// ErrUnknownSubround is returned when decoding a vote for an unknown stage of a round
+	ErrUnknownSubround = errors.New("unknown GRANDPA vote stage")
+)
+
+// Authority is a GRANDPA voter and the weight of its votes
+type Authority struct {
+	Key    *crypto.Ed25519PublicKey
+	Weight uint64
+}
+
+// Vote is a vote for a block, which also counts as a vote for all of the block's ancestors
+type Vote struct {
+	Hash   common.Hash
+	Number uint64
+}
+
+// signingPayload returns the message signed by a voter for the vote: the stage, the vote, the round and the
+// authority set ID
+func signingPayload(stage Subround, vote *Vote, round, setID uint64) []byte {
+	buf := make([]byte, 0, 1+32+8+8+8)
+	buf = append(buf, byte(stage))
+	buf = append(buf, vote.Hash[:]...)
+	buf = appendUint64(buf, vote.Number)
+	buf = appendUint64(buf, round)
+	return appendUint64(buf, setID)
+}
+
+func appendUint64(buf []byte, n uint64) []byte {
+	enc := make([]byte, 8)
+	binary.LittleEndian.PutUint64(enc, n)
+	return append(buf, enc...)
+}
+
+func readUint64(r io.Reader) (uint64, error) {
+	buf := make([]byte, 8)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+// encodeVote appends the SCALE encoding of the vote to buf
+func encodeVote(buf []byte, vote *Vote) []byte {
+	buf = append(buf, vote.Hash[:]...)
+	return appendUint64(buf, vote.Number)
+}
+
+func decodeVote(r io.Reader) (*Vote, error) {
+	vote := new(Vote)
+	_, err := io.ReadFull(r, vote.Hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	vote.Number, err = readUint64(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return vote, nil
+}
+
+// VoteMessage is a signed prevote or precommit gossiped by a voter
+type VoteMessage struct {
+	Round       uint64
+	SetID       uint64
+	Stage       Subround
+	Vote        *Vote
+	Signature   [64]byte
+	AuthorityID [32]byte
+}
+
+// Encode returns the encoding of the message, prefixed by its message type
+func (m *VoteMessage) Encode() []byte {
+	buf := []byte{voteMessageType}
+	buf = appendUint64(buf, m.Round)
+	buf = appendUint64(buf, m.SetID)
+	buf = append(buf, byte(m.Stage))
+	buf = encodeVote(buf, m.Vote)
+	buf = append(buf, m.Signature[:]...)
+	return append(buf, m.AuthorityID[:]...)
+}
+
+// Decode decodes the message, it assumes the message type has been removed
+func (m *VoteMessage) Decode(r io.Reader) error {
+	var err error
+	m.Round, err = readUint64(r)
+	if err != nil {
+		return err
+	}
+
+	m.SetID, err = readUint64(r)
+	if err != nil {
+		return err
+	}
+
+	stage := make([]byte, 1)
+	_, err = io.ReadFull(r, stage)
+	if err != nil {
+		return err
+	}
+	m.Stage = Subround(stage[0])
+	if m.Stage != Prevote && m.Stage != Precommit {
+		return ErrUnknownSubround
+	}
+
+	m.Vote, err = decodeVote(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.ReadFull(r, m.Signature[:])
+	if err != nil {
+		return err
+	}
+
+	_, err = io.ReadFull(r, m.AuthorityID[:])
+	return err
+}
+
+// SignedPrecommit is a precommit and the signature of its voter
+type SignedPrecommit struct {
+	Vote        *Vote
+	Signature   [64]byte
+	AuthorityID [32]byte
+}
+
+// Justification proves that a block is finalized: it contains the precommits of a round for the block or its
+// descendants, by voters holding a supermajority of the authority set's weight
+type Justification struct {
+	Round      uint64
+	Target     *Vote
+	Precommits []*SignedPrecommit
+}
+
+// Encode returns the SCALE encoding of the justification
+func (j *Justification) Encode() ([]byte, error) {
+	buf := appendUint64([]byte{}, j.Round)
+	buf = encodeVote(buf, j.Target)
+
+	n, err := scale.Encode(big.NewInt(int64(len(j.Precommits))))
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, n...)
+
+	for _, pc := range j.Precommits {
+		buf = encodeVote(buf, pc.Vote)
+		buf = append(buf, pc.Signature[:]...)
+		buf = append(buf, pc.AuthorityID[:]...)
+	}
+
+	return buf, nil
+}
+
+// Decode decodes the SCALE encoded justification
+func (j *Justification) Decode(r io.Reader) error {
+	var err error
+	j.Round, err = readUint64(r)
+	if err != nil {
+		return err
+	}
+
+	j.Target, err = decodeVote(r)
+	if err != nil {
+		return err
+	}
+
+	sd := scale.Decoder{Reader: r}
+	n, err := sd.DecodeInteger()
+	if err != nil {
+		return err
+	}
+
+	j.Precommits = make([]*SignedPrecommit, n)
+	for i := range j.Precommits {
+		pc := new(SignedPrecommit)
+		pc.Vote, err = decodeVote(r)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.ReadFull(r, pc.Signature[:])
+		if err != nil {
+			return err
+		}
+
+		_, err = io.ReadFull(r, pc.AuthorityID[:])
+		if err != nil {
+			return err
+		}
+
+		j.Precommits[i] = pc
+	}
+
+	return nil
+}
+
+// CommitMessage announces that a block has been finalized, with the justification of its finality
+type CommitMessage struct {
+	SetID         uint64
+	Justification *Justification
+}
+
+// Encode returns the encoding of the message, prefixed by its message type
+func (m *CommitMessage) Encode() ([]byte, error) {
+	enc, err := m.Justification.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := appendUint64([]byte{commitMessageType}, m.SetID)
+	return append(buf, enc...), nil
+}
+
+// Decode decodes the message, it assumes the message type has been removed
+func (m *CommitMessage) Decode(r io.Reader) error {
+	var err error
+	m.SetID, err = readUint64(r)
+	if err != nil {
+		return err
+	}
+
+	m.Justification = new(Justification)
+	return m.Justification.Decode(r)
+}
+
+// decodeMessage decodes a gossiped GRANDPA message, which is either a *VoteMessage or a *CommitMessage
+func decodeMessage(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, ErrUnknownMessageType
+	}
+
+	r := bytes.NewReader(data[1:])
+	switch data[0] {
+	case voteMessageType:
+		m := new(VoteMessage)
+		return m, m.Decode(r)
+	case commitMessageType:
+		m := new(CommitMessage)
+		return m, m.Decode(r)
+	default:
+		return nil, ErrUnknownMessageType
+	}
+}
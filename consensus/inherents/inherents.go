@@ -0,0 +1,181 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package inherents
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/gossamer/core/types"
+)
+
+var (
+	// ErrAlreadyRegistered is returned when registering a provider for inherent data that already has one
+	ErrAlreadyRegistered = errors.New("inherent data provider is already registered")
+	// ErrNoTimestamp is returned when the BABE slot is provided before the timestamp
+	ErrNoTimestamp = errors.New("no timestamp inherent data to derive the slot from")
+)
+
+// InherentDataProvider provides one type of inherent data when a block is built or checked
+type InherentDataProvider interface {
+	// Identifier returns the identifier of the data the provider puts into the inherent data
+	Identifier() types.InherentIdentifier
+	// ProvideInherentData puts the provider's data into the inherent data
+	ProvideInherentData(data *types.InherentData) error
+}
+
+// InherentDataProviders is a registry of inherent data providers, which create inherent data in the order
+// they were registered
+type InherentDataProviders struct {
+	lock      sync.RWMutex
+	providers []InherentDataProvider
+}
+
+// NewInherentDataProviders returns an empty registry of inherent data providers
+func NewInherentDataProviders() *InherentDataProviders {
+	return &InherentDataProviders{}
+}
+
+// Register adds a provider to the registry. Only one provider may be registered for each identifier.
+func (p *InherentDataProviders) Register(provider InherentDataProvider) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, registered := range p.providers {
+		if registered.Identifier() == provider.Identifier() {
+			return ErrAlreadyRegistered
+		}
+	}
+
+	p.providers = append(p.providers, provider)
+	return nil
+}
+
+// HasProvider returns true if a provider is registered for the identifier
+func (p *InherentDataProviders) HasProvider(id types.InherentIdentifier) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, registered := range p.providers {
+		if registered.Identifier() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateInherentData returns the inherent data of all registered providers
+func (p *InherentDataProviders) CreateInherentData() (*types.InherentData, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	data := types.NewInherentData()
+	for _, provider := range p.providers {
+		err := provider.ProvideInherentData(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot provide inherent data %s: %s", provider.Identifier(), err)
+		}
+	}
+
+	return data, nil
+}
+
+// TimestampProvider provides the current time, in milliseconds since the unix epoch, as timestamp inherent data
+type TimestampProvider struct {
+	Now func() time.Time
+}
+
+// NewTimestampProvider returns a timestamp provider using the system clock
+func NewTimestampProvider() *TimestampProvider {
+	return &TimestampProvider{Now: time.Now}
+}
+
+// Identifier returns the timestamp inherent identifier
+func (p *TimestampProvider) Identifier() types.InherentIdentifier {
+	return types.TimestampInherentIdentifier
+}
+
+// ProvideInherentData puts the current time into the inherent data
+func (p *TimestampProvider) ProvideInherentData(data *types.InherentData) error {
+	return data.Put(types.TimestampInherentIdentifier, uint64(p.Now().UnixNano()/int64(time.Millisecond)))
+}
+
+// BabeSlotProvider provides the BABE slot the timestamp inherent data falls in. It must be registered after
+// the timestamp provider.
+type BabeSlotProvider struct {
+	SlotDuration uint64 // slot duration in milliseconds
+}
+
+// Identifier returns the BABE slot inherent identifier
+func (p *BabeSlotProvider) Identifier() types.InherentIdentifier {
+	return types.BabeSlotInherentIdentifier
+}
+
+// ProvideInherentData puts the slot of the timestamp into the inherent data
+func (p *BabeSlotProvider) ProvideInherentData(data *types.InherentData) error {
+	return putSlot(data, types.BabeSlotInherentIdentifier, p.SlotDuration)
+}
+
+// AuraSlotProvider provides the Aura slot the timestamp inherent data falls in. It must be registered after
+// the timestamp provider.
+type AuraSlotProvider struct {
+	SlotDuration uint64 // slot duration in milliseconds
+}
+
+// Identifier returns the Aura slot inherent identifier
+func (p *AuraSlotProvider) Identifier() types.InherentIdentifier {
+	return types.AuraSlotInherentIdentifier
+}
+
+// ProvideInherentData puts the slot of the timestamp into the inherent data
+func (p *AuraSlotProvider) ProvideInherentData(data *types.InherentData) error {
+	return putSlot(data, types.AuraSlotInherentIdentifier, p.SlotDuration)
+}
+
+// putSlot puts the slot the timestamp inherent data falls in into the inherent data
+func putSlot(data *types.InherentData, id types.InherentIdentifier, slotDuration uint64) error {
+	enc := data.Get(types.TimestampInherentIdentifier)
+	if len(enc) != 8 {
+		return ErrNoTimestamp
+	}
+
+	return data.Put(id, binary.LittleEndian.Uint64(enc)/slotDuration)
+}
+
+// ProviderFunc is a provider of custom inherent data
+type ProviderFunc struct {
+	id      types.InherentIdentifier
+	provide func(data *types.InherentData) error
+}
+
+// NewProviderFunc returns a provider that calls provide to put the data for the identifier into the inherent data
+func NewProviderFunc(id types.InherentIdentifier, provide func(data *types.InherentData) error) *ProviderFunc {
+	return &ProviderFunc{id: id, provide: provide}
+}
+
+// Identifier returns the identifier of the provider's data
+func (p *ProviderFunc) Identifier() types.InherentIdentifier {
+	return p.id
+}
+
+// ProvideInherentData calls the provider's function
+func (p *ProviderFunc) ProvideInherentData(data *types.InherentData) error {
+	return p.provide(data)
+}
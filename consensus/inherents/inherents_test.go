@@ -0,0 +1,77 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package inherents
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/gossamer/core/types"
+)
+
+func TestInherentDataProviders(t *testing.T) {
+	now := time.Unix(0, 0).Add(12345 * time.Millisecond)
+	custom := types.InherentIdentifier{'c', 'u', 's', 't', 'o', 'm', '0', '0'}
+
+	providers := NewInherentDataProviders()
+	for _, p := range []InherentDataProvider{
+		&TimestampProvider{Now: func() time.Time { return now }},
+		&BabeSlotProvider{SlotDuration: 1000},
+		&AuraSlotProvider{SlotDuration: 2000},
+		NewProviderFunc(custom, func(data *types.InherentData) error { return data.Put(custom, []byte{1, 2}) }),
+	} {
+		err := providers.Register(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := providers.Register(NewTimestampProvider())
+	if err != ErrAlreadyRegistered {
+		t.Fatalf("Fail: got %v expected %v", err, ErrAlreadyRegistered)
+	}
+
+	data, err := providers.CreateInherentData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ts := data.Get(types.TimestampInherentIdentifier); !bytes.Equal(ts, []byte{0x39, 0x30, 0, 0, 0, 0, 0, 0}) {
+		t.Fatalf("Fail: got timestamp %x expected 12345", ts)
+	}
+	if slot := data.Get(types.BabeSlotInherentIdentifier); !bytes.Equal(slot, []byte{12, 0, 0, 0, 0, 0, 0, 0}) {
+		t.Fatalf("Fail: got slot %x expected 12", slot)
+	}
+	if slot := data.Get(types.AuraSlotInherentIdentifier); !bytes.Equal(slot, []byte{6, 0, 0, 0, 0, 0, 0, 0}) {
+		t.Fatalf("Fail: got Aura slot %x expected 6", slot)
+	}
+	if c := data.Get(custom); !bytes.Equal(c, []byte{8, 1, 2}) {
+		t.Fatalf("Fail: got custom data %x expected 080102", c)
+	}
+
+	// the slot is derived from the timestamp, which must be provided first
+	providers = NewInherentDataProviders()
+	err = providers.Register(&BabeSlotProvider{SlotDuration: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = providers.CreateInherentData()
+	if err == nil {
+		t.Fatal("Fail: provided slot without timestamp")
+	}
+}
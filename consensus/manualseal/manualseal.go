@@ -0,0 +1,195 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package manualseal
+
+import (
+	"sync"
+	"time"
+
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/consensus"
+	"github.com/ChainSafe/gossamer/consensus/inherents"
+	"github.com/ChainSafe/gossamer/core/blocktree"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/events"
+	"github.com/ChainSafe/gossamer/internal/services"
+	"github.com/ChainSafe/gossamer/runtime"
+	log "github.com/ChainSafe/log15"
+)
+
+var _ consensus.Engine = &Engine{}
+var _ services.DependentService = &Engine{}
+
+// buildTime is the time that may be spent applying transactions to a sealed block
+const buildTime = 2 * time.Second
+
+// Engine is a consensus engine for development chains that authors a block whenever it is asked to, and accepts
+// every imported block. With instant sealing, a block is also authored as soon as a transaction is imported.
+type Engine struct {
+	services.DependencyList // services the blocks authored by the engine are published to
+
+	txPool    *tx.Pool
+	inherents *inherents.InherentDataProviders
+	builder   *consensus.BlockBuilder
+	now       func() time.Time
+	instant   bool
+
+	lock    sync.Mutex // held while sealing a block
+	sub     *events.Subscription
+	sealing sync.WaitGroup // running instant sealing loop
+
+	// Event bus on which a BlockProduced event is published every time a block is created
+	bus *events.Bus
+}
+
+// NewEngine returns a manual seal engine that builds blocks with the runtime
+func NewEngine(rt *runtime.Runtime, bus *events.Bus) (*Engine, error) {
+	e := &Engine{
+		txPool: tx.NewPool(nil),
+		now:    time.Now,
+		bus:    bus,
+	}
+
+	e.inherents = inherents.NewInherentDataProviders()
+	err := e.inherents.Register(&inherents.TimestampProvider{Now: func() time.Time { return e.now() }})
+	if err != nil {
+		return nil, err
+	}
+
+	e.builder = consensus.NewBlockBuilder(rt, e.txPool, e.inherents, func() time.Time { return e.now() })
+	return e, nil
+}
+
+// SetInstantSeal sets whether a block is sealed every time a transaction is imported. It must be called before
+// the engine is started, and requires an event bus.
+func (e *Engine) SetInstantSeal(instant bool) {
+	e.instant = instant
+}
+
+// SetBlockTree sets the block tree sealed blocks are built on and imported into
+func (e *Engine) SetBlockTree(bt *blocktree.BlockTree) {
+	e.builder.SetBlockTree(bt)
+}
+
+// Start starts sealing a block for every imported transaction if instant sealing is enabled
+func (e *Engine) Start() error {
+	if !e.instant || e.bus == nil {
+		return nil
+	}
+
+	e.sub = e.bus.Subscribe(events.TransactionImportedTopic)
+	e.sealing.Add(1)
+	go e.instantSeal(e.sub)
+	return nil
+}
+
+// Stop stops instant sealing, and waits for the block being sealed, if any
+func (e *Engine) Stop() error {
+	if e.sub != nil {
+		e.sub.Unsubscribe()
+	}
+	e.sealing.Wait()
+	return nil
+}
+
+// TxPool returns the engine's transaction pool
+func (e *Engine) TxPool() *tx.Pool {
+	return e.txPool
+}
+
+// InherentDataProviders returns the registry of providers of the inherent data blocks are built and checked with
+func (e *Engine) InherentDataProviders() *inherents.InherentDataProviders {
+	return e.inherents
+}
+
+// BlockWeight returns 1 for every block, so the longest chain is the best one
+func (e *Engine) BlockWeight(header *types.BlockHeader) (uint64, error) {
+	return 1, nil
+}
+
+// VerifyHeader accepts every header; blocks of a development chain are trusted
+func (e *Engine) VerifyHeader(header *types.BlockHeader) error {
+	return nil
+}
+
+// HandleHeader does nothing, as the engine has no consensus state
+func (e *Engine) HandleHeader(header *types.BlockHeader) error {
+	return nil
+}
+
+// AuthorSlot seals a block; any slot may be authored
+func (e *Engine) AuthorSlot(slot uint64) (*types.Block, error) {
+	return e.SealBlock()
+}
+
+// SealBlock builds a block with the ready transactions of the pool on top of the best block, then imports and
+// announces it
+func (e *Engine) SealBlock() (*types.Block, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	header, exts, err := e.builder.Build(e.builder.BestHeader(), []*types.DigestItem{}, e.now().Add(buildTime))
+	if err != nil {
+		return nil, err
+	}
+
+	header.Hash, err = header.CalculateHash()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := types.NewBlockBody(exts)
+	if err != nil {
+		return nil, err
+	}
+
+	block := &types.Block{
+		Header: *header,
+		Body:   body,
+	}
+
+	err = e.builder.Import(block, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("[manualseal] sealed block", "number", header.Number, "hash", header.Hash, "extrinsics", len(exts))
+
+	// Notify other services of the new block
+	if e.bus != nil {
+		e.bus.Publish(&events.BlockProduced{Block: block})
+	}
+
+	return block, nil
+}
+
+// instantSeal seals a block for every imported transaction until the subscription is cancelled
+func (e *Engine) instantSeal(sub *events.Subscription) {
+	defer e.sealing.Done()
+
+	for {
+		select {
+		case <-sub.Chan():
+			_, err := e.SealBlock()
+			if err != nil {
+				log.Error("[manualseal] cannot seal block", "error", err)
+			}
+		case <-sub.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package manualseal
+
+import (
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/events"
+	"github.com/ChainSafe/gossamer/runtime"
+	"github.com/ChainSafe/gossamer/trie"
+)
+
+const POLKADOT_RUNTIME_FP string = "../../substrate_test_runtime.compact.wasm"
+const POLKADOT_RUNTIME_URL string = "https://github.com/noot/substrate/blob/add-blob/core/test-runtime/wasm/wasm32-unknown-unknown/release/wbuild/substrate-test-runtime/substrate_test_runtime.compact.wasm?raw=true"
+
+// getRuntimeBlob checks if the polkadot runtime wasm file exists and if not, it fetches it from github
+func getRuntimeBlob() (n int64, err error) {
+	if Exists(POLKADOT_RUNTIME_FP) {
+		return 0, nil
+	}
+
+	out, err := os.Create(POLKADOT_RUNTIME_FP)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	resp, err := http.Get(POLKADOT_RUNTIME_URL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err = io.Copy(out, resp.Body)
+	return n, err
+}
+
+// Exists reports whether the named file or directory exists.
+func Exists(name string) bool {
+	if _, err := os.Stat(name); err != nil {
+		if os.IsNotExist(err) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRuntime(t *testing.T) *runtime.Runtime {
+	_, err := getRuntimeBlob()
+	if err != nil {
+		t.Fatalf("Fail: could not get polkadot runtime")
+	}
+
+	fp, err := filepath.Abs(POLKADOT_RUNTIME_FP)
+	if err != nil {
+		t.Fatal("could not create filepath")
+	}
+
+	r, err := runtime.NewRuntimeFromFile(fp, &trie.Trie{})
+	if err != nil {
+		t.Fatal(err)
+	} else if r == nil {
+		t.Fatal("did not create new VM")
+	}
+
+	return r
+}
+
+func TestSealBlock(t *testing.T) {
+	e, err := NewEngine(newRuntime(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := e.SealBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Header.Number.Cmp(big.NewInt(1)) != 0 {
+		t.Fatalf("Fail: got block %d expected 1", first.Header.Number)
+	}
+
+	// blocks are sealed on top of each other
+	second, err := e.AuthorSlot(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Header.Number.Cmp(big.NewInt(2)) != 0 || second.Header.ParentHash != first.Header.Hash {
+		t.Fatalf("Fail: got block %d with parent %x expected block 2 with parent %x", second.Header.Number, second.Header.ParentHash, first.Header.Hash)
+	}
+
+	err = e.VerifyHeader(&second.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInstantSeal(t *testing.T) {
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.BlockProducedTopic)
+	defer sub.Unsubscribe()
+
+	e, err := NewEngine(newRuntime(t), bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetInstantSeal(true)
+
+	err = e.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ext := types.Extrinsic{1, 2, 3}
+	bus.Publish(&events.TransactionImported{Transaction: tx.NewValidTransaction(&ext, tx.NewValidity(1, nil, nil, 10, true))})
+
+	select {
+	case ev := <-sub.Chan():
+		if ev.(*events.BlockProduced).Block.Header.Number.Cmp(big.NewInt(1)) != 0 {
+			t.Fatal("Fail: expected block 1 to be sealed")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Fail: no block was sealed for the imported transaction")
+	}
+
+	err = e.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package consensus
+
+import (
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/crypto"
+)
+
+// PreSealHash returns the hash of the header with the given digest items, ie. without its seal
+func PreSealHash(header *types.BlockHeader, items []*types.DigestItem) (common.Hash, error) {
+	digest, err := types.EncodeDigest(items)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	unsealed := &types.BlockHeader{
+		ParentHash:     header.ParentHash,
+		Number:         header.Number,
+		StateRoot:      header.StateRoot,
+		ExtrinsicsRoot: header.ExtrinsicsRoot,
+		Digest:         digest,
+	}
+
+	return unsealed.CalculateHash()
+}
+
+// SealHeader signs the header with the key and appends the seal of the consensus engine to its digest, then sets
+// the hash of the sealed header
+func SealHeader(header *types.BlockHeader, id types.ConsensusEngineID, keypair *crypto.Sr25519Keypair) error {
+	items, err := types.DecodeDigest(header.Digest)
+	if err != nil {
+		return err
+	}
+
+	hash, err := PreSealHash(header, items)
+	if err != nil {
+		return err
+	}
+
+	sig, err := keypair.Sign(hash[:])
+	if err != nil {
+		return err
+	}
+
+	header.Digest, err = types.EncodeDigest(append(items, types.NewSealDigest(id, sig)))
+	if err != nil {
+		return err
+	}
+
+	header.Hash, err = header.CalculateHash()
+	return err
+}
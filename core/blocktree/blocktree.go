@@ -17,10 +17,14 @@
 package blocktree
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
+	"sync"
 
+	"github.com/ChainSafe/gossamer/core/rawdb"
 	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/events"
 
 	"github.com/ChainSafe/gossamer/polkadb"
 
@@ -31,12 +35,27 @@ import (
 
 type Hash = common.Hash
 
-// BlockTree represents the current state with all possible blocks
+var (
+	// ErrBlockNotFound is returned when a block is not in the block tree
+	ErrBlockNotFound = errors.New("cannot find block in block tree")
+	// ErrNotDescendantOfFinalized is returned when finalizing a block that is not a descendant of the last
+	// finalized block
+	ErrNotDescendantOfFinalized = errors.New("block is not a descendant of the last finalized block")
+	// ErrNoBlockDB is returned when storing data for a block tree without a block DB
+	ErrNoBlockDB = errors.New("block tree has no block DB")
+)
+
+// BlockTree represents the current state with all possible blocks. It is safe for concurrent use.
 type BlockTree struct {
+	lock            sync.RWMutex
 	head            *node
 	leaves          leafMap
+	best            []*node // the best chain, indexed by depth
 	finalizedBlocks []*node
 	Db              *polkadb.BlockDB
+
+	// Event bus on which changes of the best chain are published, may be nil
+	bus *events.Bus
 }
 
 // NewBlockTreeFromGenesis initializes a blocktree with a genesis block.
@@ -44,6 +63,7 @@ type BlockTree struct {
 func NewBlockTreeFromGenesis(genesis types.Block, db *polkadb.BlockDB) *BlockTree {
 	head := &node{
 		hash:        genesis.Header.Hash,
+		stateRoot:   genesis.Header.StateRoot,
 		number:      genesis.Header.Number,
 		parent:      nil,
 		children:    []*node{},
@@ -54,20 +74,122 @@ func NewBlockTreeFromGenesis(genesis types.Block, db *polkadb.BlockDB) *BlockTre
 		head:            head,
 		finalizedBlocks: []*node{},
 		leaves:          leafMap{head.hash: head},
+		best:            []*node{head},
 		Db:              db,
 	}
 }
 
-// AddBlock inserts the block as child of its parent node
+// LoadBlockTree rebuilds the block tree from the block DB. The tree holds the genesis block and the stored best
+// chain up to the block with the given state root, which is the state the node resumes from. The weight of each
+// block is given by the weight function, and the last finalized block is restored if it is part of the tree.
+func LoadBlockTree(db *polkadb.BlockDB, stateRoot Hash, weight func(*types.BlockHeader) (uint64, error)) (*BlockTree, error) {
+	genesisHash, err := rawdb.GetGenesisHash(db.Db)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load genesis hash, has the node been initialized?: %s", err)
+	}
+
+	genesis := types.Block{
+		Header: rawdb.GetHeader(db.Db, genesisHash),
+		Body:   types.BlockBody{},
+	}
+
+	best, err := rawdb.GetBestBlockHash(db.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	// walk back from the best block, keeping the blocks from the one whose state was stored
+	var chain []*types.BlockData
+	found := false
+	for hash := best; hash != (Hash{}) && hash != genesisHash; {
+		has, err := rawdb.HasBlockData(db.Db, hash)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			return nil, fmt.Errorf("cannot find block %s of the stored chain", hash)
+		}
+
+		bd := rawdb.GetBlockData(db.Db, hash)
+		if bd.Header == nil {
+			return nil, fmt.Errorf("block %s of the stored chain has no header", hash)
+		}
+
+		if bd.Header.StateRoot == stateRoot {
+			found = true
+		}
+		if found {
+			chain = append([]*types.BlockData{&bd}, chain...)
+		}
+		hash = bd.Header.ParentHash
+	}
+
+	if !found && genesis.Header.StateRoot != stateRoot {
+		return nil, fmt.Errorf("cannot find the block with state root %s in the stored chain", stateRoot)
+	}
+
+	bt := NewBlockTreeFromGenesis(genesis, db)
+	for _, bd := range chain {
+		w, err := weight(bd.Header)
+		if err != nil {
+			return nil, err
+		}
+
+		block := types.Block{Header: *bd.Header}
+		if bd.Body != nil {
+			block.Body = *bd.Body
+		}
+
+		at, err := rawdb.GetArrivalTime(db.Db, bd.Hash)
+		if err != nil {
+			return nil, err
+		}
+		block.SetBlockArrivalTime(at)
+
+		bt.AddBlockWithWeight(block, w)
+	}
+
+	finalized, err := rawdb.GetFinalizedHash(db.Db)
+	if err != nil {
+		return nil, err
+	}
+	if bt.GetNode(finalized) != nil && finalized != genesisHash {
+		err = bt.Finalize(finalized)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bt, nil
+}
+
+// SetEventBus sets the event bus on which a BestBlockChanged event is published every time the best block changes,
+// and a ChainReorganised event when it moves off the previous best chain
+func (bt *BlockTree) SetEventBus(bus *events.Bus) {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	bt.bus = bus
+}
+
+// AddBlock inserts the block as child of its parent node, adding a weight of 1 to its chain
 // Note: Assumes block has no children
 func (bt *BlockTree) AddBlock(block types.Block) {
-	parent := bt.GetNode(block.Header.ParentHash)
+	bt.AddBlockWithWeight(block, 1)
+}
+
+// AddBlockWithWeight inserts the block as child of its parent node. The weight is added to the weight of the
+// parent's chain, and the best block is the leaf of the heaviest chain.
+// Note: Assumes block has no children
+func (bt *BlockTree) AddBlockWithWeight(block types.Block, weight uint64) {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+
+	parent := bt.getNode(block.Header.ParentHash)
 	// Check if it already exists
 	// TODO: Can shortcut this by checking DB
-	// TODO: Write blockData to db
 	// TODO: Create getter functions to check if blockNum is greater than best block stored
 
-	n := bt.GetNode(block.Header.Hash)
+	n := bt.getNode(block.Header.Hash)
 	if n != nil {
 		log.Debug("Attempted to add block to tree that already exists", "Hash", n.hash)
 		return
@@ -78,19 +200,195 @@ func (bt *BlockTree) AddBlock(block types.Block) {
 
 	n = &node{
 		hash:        block.Header.Hash,
+		stateRoot:   block.Header.StateRoot,
 		number:      block.Header.Number,
 		parent:      parent,
 		children:    []*node{},
 		depth:       depth,
 		arrivalTime: block.GetBlockArrivalTime(),
+		weight:      parent.weight + weight,
 	}
 	parent.addChild(n)
 
 	bt.leaves.Replace(parent, n)
+
+	// the best chain only changes if the new block is heavier than its tip; ties keep the current best chain
+	tip := bt.bestBlock()
+	isBest := n.weight > tip.weight || (n.weight == tip.weight && n.depth.Cmp(tip.depth) > 0)
+	var retracted, enacted []*node
+	if isBest {
+		retracted, enacted = bt.setBest(n)
+	}
+
+	if bt.Db != nil {
+		bt.storeBlock(&block)
+
+		if isBest {
+			// the best block is where the chain is rebuilt from when the node restarts
+			err := rawdb.SetBestBlockHash(bt.Db.Db, n.hash)
+			if err != nil {
+				log.Error("[blocktree] cannot store best block hash", "error", err)
+			}
+		}
+	}
+
+	if isBest && bt.bus != nil {
+		header := block.Header
+		bt.bus.Publish(&events.BestBlockChanged{Header: &header})
+
+		// the best block moved off the previous best chain if that chain had blocks after the fork point
+		if len(retracted) > 0 {
+			bt.bus.Publish(&events.ChainReorganised{
+				Retracted: bt.blocksOf(retracted),
+				Enacted:   bt.blocksOf(enacted),
+			})
+		}
+	}
+}
+
+// bestBlock returns the tip of the best chain
+func (bt *BlockTree) bestBlock() *node {
+	return bt.best[len(bt.best)-1]
+}
+
+// setBest makes the chain ending at n the best chain, replacing the blocks of the previous best chain from the
+// fork point onwards. It returns the blocks that are no longer part of the best chain and the blocks that now are,
+// both in ascending order.
+func (bt *BlockTree) setBest(n *node) (retracted, enacted []*node) {
+	curr := n
+	for !bt.isBest(curr) {
+		enacted = append([]*node{curr}, enacted...)
+		curr = curr.parent
+	}
+
+	fork := curr.depth.Int64() + 1
+	retracted = append(retracted, bt.best[fork:]...)
+	bt.best = append(bt.best[:fork], enacted...)
+	return retracted, enacted
+}
+
+// blocksOf returns the blocks of the nodes, with their bodies if they are stored in the block DB
+func (bt *BlockTree) blocksOf(nodes []*node) []*types.Block {
+	blocks := make([]*types.Block, len(nodes))
+	for i, n := range nodes {
+		blocks[i] = n.getBlockFromNode()
+		if bt.Db == nil {
+			continue
+		}
+
+		has, err := rawdb.HasBlockData(bt.Db.Db, n.hash)
+		if err != nil || !has {
+			continue
+		}
+
+		bd := rawdb.GetBlockData(bt.Db.Db, n.hash)
+		if bd.Header != nil {
+			blocks[i].Header = *bd.Header
+		}
+		if bd.Body != nil {
+			blocks[i].Body = *bd.Body
+		}
+	}
+	return blocks
+}
+
+// isBest returns true if the node is part of the best chain
+func (bt *BlockTree) isBest(n *node) bool {
+	depth := n.depth.Int64()
+	return depth < int64(len(bt.best)) && bt.best[depth] == n
+}
+
+// storeBlock writes the header and body of the block to the block DB, so it can be served to peers, and its arrival
+// time, so the slot times can be estimated from it after a restart
+func (bt *BlockTree) storeBlock(block *types.Block) {
+	body := block.Body
+	rawdb.SetHeader(bt.Db.Db, &block.Header)
+	rawdb.SetBlockData(bt.Db.Db, &types.BlockData{
+		Hash:   block.Header.Hash,
+		Header: &block.Header,
+		Body:   &body,
+	})
+
+	err := rawdb.SetArrivalTime(bt.Db.Db, block.Header.Hash, block.GetBlockArrivalTime())
+	if err != nil {
+		log.Error("[blocktree] cannot store block arrival time", "error", err)
+	}
+}
+
+// GetBlockData returns the header, body and finality justification of the block with the given hash. Only the
+// fields known to the block tree are set for blocks that are not in the block DB.
+func (bt *BlockTree) GetBlockData(h Hash) (*types.BlockData, error) {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+
+	n := bt.getNode(h)
+	if n == nil {
+		return nil, ErrBlockNotFound
+	}
+
+	if bt.Db == nil {
+		header := n.getBlockFromNode().Header
+		return &types.BlockData{Hash: h, Header: &header}, nil
+	}
+
+	has, err := rawdb.HasBlockData(bt.Db.Db, h)
+	if err != nil {
+		return nil, err
+	}
+
+	bd := &types.BlockData{Hash: h}
+	if has {
+		*bd = rawdb.GetBlockData(bt.Db.Db, h)
+	} else {
+		header := n.getBlockFromNode().Header
+		bd.Header = &header
+	}
+
+	bd.Justification, err = rawdb.GetJustification(bt.Db.Db, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return bd, nil
+}
+
+// SetJustification stores the SCALE encoded finality justification of the block with the given hash in the
+// block DB
+func (bt *BlockTree) SetJustification(h Hash, justification []byte) error {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+
+	if bt.getNode(h) == nil {
+		return ErrBlockNotFound
+	}
+
+	if bt.Db == nil {
+		return ErrNoBlockDB
+	}
+
+	return rawdb.SetJustification(bt.Db.Db, h, justification)
+}
+
+// GetJustification returns the finality justification of the block with the given hash, or nil if it has none
+func (bt *BlockTree) GetJustification(h Hash) ([]byte, error) {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+
+	if bt.Db == nil {
+		return nil, nil
+	}
+
+	return rawdb.GetJustification(bt.Db.Db, h)
 }
 
 // GetNode finds and returns a node based on its Hash. Returns nil if not found.
 func (bt *BlockTree) GetNode(h Hash) *node {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	return bt.getNode(h)
+}
+
+func (bt *BlockTree) getNode(h Hash) *node {
 	if bt.head.hash == h {
 		return bt.head
 	}
@@ -104,9 +402,93 @@ func (bt *BlockTree) GetNode(h Hash) *node {
 	return nil
 }
 
+// GetHeader returns the header of the block with the given hash. Only its hash, number, parent hash and state root
+// are set.
+func (bt *BlockTree) GetHeader(h Hash) (*types.BlockHeader, error) {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+
+	n := bt.getNode(h)
+	if n == nil {
+		return nil, ErrBlockNotFound
+	}
+
+	header := n.getBlockFromNode().Header
+	return &header, nil
+}
+
+// IsDescendantOf returns true if the block with hash child is the block with hash parent or one of its descendants
+func (bt *BlockTree) IsDescendantOf(parent, child Hash) (bool, error) {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+
+	cn := bt.getNode(child)
+	if cn == nil || bt.getNode(parent) == nil {
+		return false, ErrBlockNotFound
+	}
+
+	for curr := cn; curr != nil; curr = curr.parent {
+		if curr.hash == parent {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Finalize marks the block with the given hash, and all its ancestors, as finalized. The block must be a
+// descendant of the last finalized block.
+func (bt *BlockTree) Finalize(h Hash) error {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+
+	n := bt.getNode(h)
+	if n == nil {
+		return ErrBlockNotFound
+	}
+
+	last := bt.head
+	if len(bt.finalizedBlocks) > 0 {
+		last = bt.finalizedBlocks[len(bt.finalizedBlocks)-1]
+	}
+
+	// the newly finalized blocks, from the child of the last finalized block to n
+	var path []*node
+	for curr := n; curr != last; curr = curr.parent {
+		if curr == nil {
+			return ErrNotDescendantOfFinalized
+		}
+		path = append([]*node{curr}, path...)
+	}
+
+	if len(bt.finalizedBlocks) == 0 {
+		bt.finalizedBlocks = append(bt.finalizedBlocks, last)
+	}
+	bt.finalizedBlocks = append(bt.finalizedBlocks, path...)
+
+	if bt.Db != nil {
+		return rawdb.SetFinalizedHash(bt.Db.Db, h)
+	}
+	return nil
+}
+
+// FinalizedHash returns the hash of the last finalized block, which is the genesis block if no block has been
+// finalized yet
+func (bt *BlockTree) FinalizedHash() Hash {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+
+	if len(bt.finalizedBlocks) == 0 {
+		return bt.head.hash
+	}
+	return bt.finalizedBlocks[len(bt.finalizedBlocks)-1].hash
+}
+
 // GetBlockFromBlockNumber finds and returns a block from its number
 // TODO: Grab block details from Db, this currently constructs and returns a block from node info
 func (bt *BlockTree) GetBlockFromBlockNumber(b *big.Int) *types.Block {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
 	return bt.getNodeFromBlockNumber(b).getBlockFromNode()
 
 }
@@ -129,6 +511,9 @@ func (bt *BlockTree) getNodeFromBlockNumber(b *big.Int) *node {
 
 // String utilizes github.com/disiqueira/gotree to create a printable tree
 func (bt *BlockTree) String() string {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+
 	// Construct tree
 	tree := gotree.New(bt.head.String())
 	for _, child := range bt.head.children {
@@ -149,9 +534,22 @@ func (bt *BlockTree) String() string {
 
 // LongestPath returns the path from the root to leftmost deepest leaf in BlockTree BT
 func (bt *BlockTree) LongestPath() []*node {
-	dl := bt.DeepestLeaf()
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	return pathTo(bt.leaves.DeepestLeaf())
+}
+
+// BestPath returns the path from the root to the leaf of the heaviest chain in BlockTree BT
+func (bt *BlockTree) BestPath() []*node {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	return append([]*node{}, bt.best...)
+}
+
+// pathTo returns the path from the root to the node
+func pathTo(n *node) []*node {
 	var path []*node
-	for curr := dl; ; curr = curr.parent {
+	for curr := n; ; curr = curr.parent {
 		path = append([]*node{curr}, path...)
 		if curr.parent == nil {
 			return path
@@ -161,16 +559,25 @@ func (bt *BlockTree) LongestPath() []*node {
 
 // SubChain returns the path from the node with Hash start to the node with Hash end
 func (bt *BlockTree) SubChain(start Hash, end Hash) []*node {
-	sn := bt.GetNode(start)
-	en := bt.GetNode(end)
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	return bt.subChain(start, end)
+}
+
+func (bt *BlockTree) subChain(start Hash, end Hash) []*node {
+	sn := bt.getNode(start)
+	en := bt.getNode(end)
 	return sn.subChain(en)
 }
 
 // SubChain returns the path from the node with Hash start to the node with Hash end
 func (bt *BlockTree) SubBlockchain(start *big.Int, end *big.Int) []*types.Block {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+
 	s := bt.getNodeFromBlockNumber(start)
 	e := bt.getNodeFromBlockNumber(end)
-	sc := bt.SubChain(s.hash, e.hash)
+	sc := bt.subChain(s.hash, e.hash)
 	var bc []*types.Block
 	for _, node := range sc {
 		bc = append(bc, node.getBlockFromNode())
@@ -181,26 +588,48 @@ func (bt *BlockTree) SubBlockchain(start *big.Int, end *big.Int) []*types.Block
 
 // DeepestLeaf returns leftmost deepest leaf in BlockTree BT
 func (bt *BlockTree) DeepestLeaf() *node {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
 	return bt.leaves.DeepestLeaf()
 }
 
 // DeepestLeaf returns leftmost deepest block in BlockTree BT
 func (bt *BlockTree) DeepestBlock() *types.Block {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
 	b := bt.leaves.DeepestLeaf().getBlockFromNode()
 	return b
 }
 
-// computes the slot for a block from genesis
-// helper for now, there's a better way to do this
-func (bt *BlockTree) ComputeSlotForBlock(b *types.Block, sd uint64) uint64 {
-	gt := bt.head.arrivalTime
-	nt := b.GetBlockArrivalTime()
+// GenesisHash returns the hash of the genesis block, which is the root of the BlockTree
+func (bt *BlockTree) GenesisHash() Hash {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	return bt.head.hash
+}
 
-	sp := uint64(0)
-	for gt < nt {
-		gt += sd
-		sp += 1
-	}
+// BestBlockHash returns the hash of the leaf of the heaviest chain in the BlockTree
+func (bt *BlockTree) BestBlockHash() Hash {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	return bt.bestBlock().hash
+}
 
-	return sp
+// BestBlock returns the leaf block of the heaviest chain in the BlockTree
+func (bt *BlockTree) BestBlock() *types.Block {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+	return bt.bestBlock().getBlockFromNode()
+}
+
+// GetBlockHash returns the hash of the block with the given number on the best chain
+func (bt *BlockTree) GetBlockHash(number *big.Int) (Hash, error) {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+
+	depth := new(big.Int).Sub(number, bt.head.number)
+	if depth.Sign() < 0 || depth.Cmp(big.NewInt(int64(len(bt.best)))) >= 0 {
+		return Hash{}, errors.New("cannot find block with given number in best chain")
+	}
+	return bt.best[depth.Int64()].hash, nil
 }
@@ -17,11 +17,14 @@
 package blocktree
 
 import (
+	"bytes"
 	"math/big"
 	"strconv"
 	"testing"
 
+	"github.com/ChainSafe/gossamer/core/rawdb"
 	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/events"
 
 	"github.com/ChainSafe/gossamer/common"
 	db "github.com/ChainSafe/gossamer/polkadb"
@@ -116,12 +119,21 @@ func TestBlockTree_AddBlock(t *testing.T) {
 			ParentHash: common.Hash{0x01},
 			Number:     nil,
 			Hash:       common.Hash{0x02},
+			StateRoot:  common.Hash{0x03},
 		},
 		Body: types.BlockBody{},
 	}
 
 	bt.AddBlock(block)
 
+	header, err := bt.GetHeader(common.Hash{0x02})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.StateRoot != block.Header.StateRoot {
+		t.Fatalf("Fail: got state root %s expected %s", header.StateRoot, block.Header.StateRoot)
+	}
+
 	n := bt.GetNode(common.Hash{0x02})
 
 	if bt.leaves[n.hash] == nil {
@@ -219,18 +231,6 @@ func TestBlockTree_Subchain(t *testing.T) {
 	}
 }
 
-func TestBlockTree_ComputeSlotForBlock(t *testing.T) {
-	bt := createFlatTree(t, 9)
-
-	expectedSlotNumber := uint64(9)
-	slotNumber := bt.ComputeSlotForBlock(bt.GetNode(common.Hash{0x09}).getBlockFromNode(), 1000)
-
-	if slotNumber != expectedSlotNumber {
-		t.Errorf("expected Slot Number: %d got: %d", expectedSlotNumber, slotNumber)
-	}
-
-}
-
 // TODO: Need to define leftmost (see BlockTree.LongestPath)
 //func TestBlockTree_LongestPath_LeftMost(t *testing.T) {
 //	bt := createFlatTree(t, 1)
@@ -258,3 +258,460 @@ func TestBlockTree_ComputeSlotForBlock(t *testing.T) {
 //		}
 //	}
 //}
+
+func TestBlockTree_GetBlockHash(t *testing.T) {
+	bt := createFlatTree(t, 5)
+
+	if bt.GenesisHash() != bt.head.hash {
+		t.Errorf("Fail: got genesis hash %x expected %x", bt.GenesisHash(), bt.head.hash)
+	}
+
+	hash, err := bt.GetBlockHash(big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != bt.head.hash {
+		t.Errorf("Fail: got %x expected %x", hash, bt.head.hash)
+	}
+
+	expected, err := common.HexToHash(intToHashable(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err = bt.GetBlockHash(big.NewInt(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != expected {
+		t.Errorf("Fail: got %x expected %x", hash, expected)
+	}
+
+	if bt.BestBlockHash() != bt.DeepestLeaf().hash {
+		t.Errorf("Fail: got best hash %x expected %x", bt.BestBlockHash(), bt.DeepestLeaf().hash)
+	}
+
+	_, err = bt.GetBlockHash(big.NewInt(6))
+	if err == nil {
+		t.Error("Fail: expected error for block not in tree")
+	}
+}
+
+func TestBlockTree_BestBlockHash_Weight(t *testing.T) {
+	bt := createFlatTree(t, 3)
+
+	// a longer fork from block 1 made of blocks that add no weight
+	previousHash, err := common.HexToHash(intToHashable(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 2; i <= 4; i++ {
+		hash := common.Hash{0xff, byte(i)}
+		block := types.Block{
+			Header: types.BlockHeader{
+				ParentHash: previousHash,
+				Hash:       hash,
+				Number:     big.NewInt(int64(i)),
+			},
+			Body: types.BlockBody{},
+		}
+		bt.AddBlockWithWeight(block, 0)
+		previousHash = hash
+	}
+
+	expected, err := common.HexToHash(intToHashable(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bt.BestBlockHash() != expected {
+		t.Errorf("Fail: got best hash %x expected %x", bt.BestBlockHash(), expected)
+	}
+
+	if bt.DeepestLeaf().hash != previousHash {
+		t.Errorf("Fail: got deepest hash %x expected %x", bt.DeepestLeaf().hash, previousHash)
+	}
+
+	hash, err := bt.GetBlockHash(big.NewInt(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err = common.HexToHash(intToHashable(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != expected {
+		t.Errorf("Fail: got %x expected %x", hash, expected)
+	}
+}
+
+func TestBlockTree_GetBlockHash_Reorg(t *testing.T) {
+	bt := createFlatTree(t, 3)
+
+	// a fork from block 1 that becomes the best chain once it is longer
+	previousHash, err := common.HexToHash(intToHashable(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 2; i <= 4; i++ {
+		hash := common.Hash{0xff, byte(i)}
+		block := types.Block{
+			Header: types.BlockHeader{
+				ParentHash: previousHash,
+				Hash:       hash,
+				Number:     big.NewInt(int64(i)),
+			},
+			Body: types.BlockBody{},
+		}
+		bt.AddBlock(block)
+		previousHash = hash
+
+		// the fork ties with the best chain at block 3, which keeps the current best chain
+		expected := common.Hash{0xff, byte(i)}
+		if i < 4 {
+			expected, err = common.HexToHash(intToHashable(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := bt.GetBlockHash(big.NewInt(int64(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("Fail: got block %x at number %d expected %x", got, i, expected)
+		}
+	}
+
+	if bt.BestBlockHash() != previousHash {
+		t.Fatalf("Fail: got best hash %x expected %x", bt.BestBlockHash(), previousHash)
+	}
+
+	for i := 2; i <= 4; i++ {
+		hash, err := bt.GetBlockHash(big.NewInt(int64(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != (common.Hash{0xff, byte(i)}) {
+			t.Errorf("Fail: got block %x at number %d expected the fork's block", hash, i)
+		}
+	}
+
+	if len(bt.BestPath()) != 5 {
+		t.Fatalf("Fail: got best path of length %d expected 5", len(bt.BestPath()))
+	}
+}
+
+func TestBlockTree_Finalize(t *testing.T) {
+	bt := createFlatTree(t, 3)
+
+	// a fork from block 1
+	fork := types.Block{
+		Header: types.BlockHeader{
+			ParentHash: common.Hash{0x01},
+			Hash:       common.Hash{0xff},
+			Number:     big.NewInt(2),
+		},
+		Body: types.BlockBody{},
+	}
+	bt.AddBlock(fork)
+
+	if bt.FinalizedHash() != bt.GenesisHash() {
+		t.Fatalf("Fail: got finalized hash %x expected genesis %x", bt.FinalizedHash(), bt.GenesisHash())
+	}
+
+	two := common.Hash{0x02}
+	ok, err := bt.IsDescendantOf(common.Hash{0x01}, two)
+	if err != nil || !ok {
+		t.Fatalf("Fail: expected block 2 to descend from block 1, got %v %v", ok, err)
+	}
+	ok, err = bt.IsDescendantOf(fork.Header.Hash, two)
+	if err != nil || ok {
+		t.Fatalf("Fail: expected block 2 not to descend from the fork, got %v %v", ok, err)
+	}
+
+	err = bt.Finalize(two)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bt.FinalizedHash() != two {
+		t.Fatalf("Fail: got finalized hash %x expected %x", bt.FinalizedHash(), two)
+	}
+
+	if len(bt.finalizedBlocks) != 3 {
+		t.Fatalf("Fail: got %d finalized blocks expected 3", len(bt.finalizedBlocks))
+	}
+
+	// blocks on other forks can no longer be finalized
+	err = bt.Finalize(fork.Header.Hash)
+	if err != ErrNotDescendantOfFinalized {
+		t.Fatalf("Fail: got %v expected %v", err, ErrNotDescendantOfFinalized)
+	}
+
+	err = bt.Finalize(common.Hash{0x03})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := bt.GetHeader(bt.FinalizedHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Number.Cmp(big.NewInt(3)) != 0 || header.ParentHash != two {
+		t.Fatalf("Fail: got finalized block %d with parent %x expected block 3 with parent %x", header.Number, header.ParentHash, two)
+	}
+}
+
+func TestBlockTree_GetBlockData(t *testing.T) {
+	bt := createFlatTree(t, 2)
+	hash, err := common.HexToHash(intToHashable(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bd, err := bt.GetBlockData(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bd.Hash != hash || bd.Header == nil || bd.Header.Number.Cmp(big.NewInt(2)) != 0 || bd.Body == nil {
+		t.Fatalf("Fail: got block data %v for block 2", bd)
+	}
+	if bd.Justification != nil {
+		t.Fatal("Fail: got justification for block without one")
+	}
+
+	err = bt.SetJustification(hash, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bd, err = bt.GetBlockData(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bd.Justification, []byte{1, 2, 3}) {
+		t.Fatalf("Fail: got justification %x expected %x", bd.Justification, []byte{1, 2, 3})
+	}
+
+	// the genesis block is not in the block DB
+	bd, err = bt.GetBlockData(bt.GenesisHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bd.Header == nil || bd.Header.Number.Sign() != 0 {
+		t.Fatalf("Fail: got block data %v for genesis block", bd)
+	}
+
+	_, err = bt.GetBlockData(common.Hash{0xff})
+	if err != ErrBlockNotFound {
+		t.Fatalf("Fail: got %v expected %v", err, ErrBlockNotFound)
+	}
+
+	err = bt.SetJustification(common.Hash{0xff}, []byte{1})
+	if err != ErrBlockNotFound {
+		t.Fatalf("Fail: got %v expected %v", err, ErrBlockNotFound)
+	}
+}
+
+func TestBlockTree_Concurrent(t *testing.T) {
+	bt := createFlatTree(t, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		parent := common.Hash{0x01}
+		for i := 2; i < 100; i++ {
+			hash := common.Hash{byte(i), 0xff}
+			bt.AddBlock(types.Block{
+				Header: types.BlockHeader{
+					ParentHash: parent,
+					Hash:       hash,
+					Number:     big.NewInt(int64(i)),
+				},
+			})
+			parent = hash
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		best := bt.BestBlockHash()
+		if bt.GetNode(best) == nil {
+			t.Fatalf("Fail: best block %x is not in the tree", best)
+		}
+		_, err := bt.GetBlockHash(big.NewInt(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	<-done
+	err := bt.Finalize(common.Hash{50, 0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadBlockTree(t *testing.T) {
+	d := &db.BlockDB{
+		Db: db.NewMemDatabase(),
+	}
+
+	genesis := createGenesisBlock()
+	genesis.Header.StateRoot = common.Hash{0xa0}
+	rawdb.SetHeader(d.Db, &genesis.Header)
+	err := rawdb.SetGenesisHash(d.Db, genesis.Header.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bt := NewBlockTreeFromGenesis(genesis, d)
+	previousHash := genesis.Header.Hash
+	for i := 1; i <= 3; i++ {
+		block := types.Block{
+			Header: types.BlockHeader{
+				ParentHash: previousHash,
+				Hash:       common.Hash{byte(i)},
+				Number:     big.NewInt(int64(i)),
+				StateRoot:  common.Hash{0xa0 + byte(i)},
+			},
+			Body: types.BlockBody{},
+		}
+		block.SetBlockArrivalTime(uint64(1000 * i))
+		bt.AddBlock(block)
+		previousHash = block.Header.Hash
+	}
+
+	err = bt.Finalize(common.Hash{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weight := func(*types.BlockHeader) (uint64, error) { return 1, nil }
+
+	// the stored state is the state of block 2, so block 3 must be imported again
+	loaded, err := LoadBlockTree(d, common.Hash{0xa2}, weight)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.BestBlockHash() != (common.Hash{2}) {
+		t.Fatalf("Fail: got best block %x expected %x", loaded.BestBlockHash(), common.Hash{2})
+	}
+	if loaded.FinalizedHash() != (common.Hash{1}) {
+		t.Fatalf("Fail: got finalized block %x expected %x", loaded.FinalizedHash(), common.Hash{1})
+	}
+	if loaded.GetNode(common.Hash{3}) != nil {
+		t.Fatal("Fail: block past the stored state is in the block tree")
+	}
+	if at := loaded.GetNode(common.Hash{2}).arrivalTime; at != 2000 {
+		t.Fatalf("Fail: got arrival time %d expected 2000", at)
+	}
+
+	loaded, err = LoadBlockTree(d, genesis.Header.StateRoot, weight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.BestBlockHash() != genesis.Header.Hash {
+		t.Fatalf("Fail: got best block %x expected genesis", loaded.BestBlockHash())
+	}
+
+	_, err = LoadBlockTree(d, common.Hash{0xff}, weight)
+	if err == nil {
+		t.Fatal("Fail: loaded block tree for unknown state root")
+	}
+}
+
+func TestBlockTree_BestBlockChanged(t *testing.T) {
+	bt := createFlatTree(t, 1)
+	bus := events.NewBus()
+	bt.SetEventBus(bus)
+	sub := bus.Subscribe(events.BestBlockChangedTopic)
+	defer sub.Unsubscribe()
+
+	parent, err := common.HexToHash(intToHashable(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := types.Block{
+		Header: types.BlockHeader{ParentHash: parent, Hash: common.Hash{0xaa}, Number: big.NewInt(2)},
+		Body:   types.BlockBody{},
+	}
+	bt.AddBlock(block)
+
+	select {
+	case e := <-sub.Chan():
+		if e.(*events.BestBlockChanged).Header.Hash != block.Header.Hash {
+			t.Fatalf("Fail: got best block %s expected %s", e.(*events.BestBlockChanged).Header.Hash, block.Header.Hash)
+		}
+	default:
+		t.Fatal("Fail: did not publish best block change")
+	}
+
+	// a block that ties with the best block does not change it
+	block.Header.Hash = common.Hash{0xbb}
+	bt.AddBlock(block)
+
+	select {
+	case e := <-sub.Chan():
+		t.Fatalf("Fail: published best block change to %s", e.(*events.BestBlockChanged).Header.Hash)
+	default:
+	}
+}
+
+func TestBlockTree_ChainReorganised(t *testing.T) {
+	bt := createFlatTree(t, 2)
+	bus := events.NewBus()
+	bt.SetEventBus(bus)
+	sub := bus.Subscribe(events.ChainReorganisedTopic)
+	defer sub.Unsubscribe()
+
+	// a heavier fork from block 1 retracts block 2
+	parent, err := common.HexToHash(intToHashable(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	retracted, err := common.HexToHash(intToHashable(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := types.Block{
+		Header: types.BlockHeader{ParentHash: parent, Hash: common.Hash{0xaa}, Number: big.NewInt(2)},
+		Body:   types.BlockBody{},
+	}
+	bt.AddBlockWithWeight(block, 2)
+
+	select {
+	case e := <-sub.Chan():
+		ev := e.(*events.ChainReorganised)
+		if len(ev.Retracted) != 1 || ev.Retracted[0].Header.Hash != retracted {
+			t.Fatalf("Fail: got retracted blocks %v expected %s", ev.Retracted, retracted)
+		}
+		if len(ev.Enacted) != 1 || ev.Enacted[0].Header.Hash != block.Header.Hash {
+			t.Fatalf("Fail: got enacted blocks %v expected %s", ev.Enacted, block.Header.Hash)
+		}
+	default:
+		t.Fatal("Fail: did not publish chain reorganisation")
+	}
+
+	// extending the best chain is not a reorganisation
+	bt.AddBlock(types.Block{
+		Header: types.BlockHeader{ParentHash: block.Header.Hash, Hash: common.Hash{0xbb}, Number: big.NewInt(3)},
+		Body:   types.BlockBody{},
+	})
+
+	select {
+	case <-sub.Chan():
+		t.Fatal("Fail: published chain reorganisation when extending the best chain")
+	default:
+	}
+}
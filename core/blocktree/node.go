@@ -28,11 +28,13 @@ import (
 // node is an element in the BlockTree
 type node struct {
 	hash        common.Hash // Block hash
+	stateRoot   common.Hash // Root of the state after the block
 	parent      *node       // Parent node
 	number      *big.Int    // Block Number
 	children    []*node     // Nodes of children blocks
 	depth       *big.Int    // Depth within the tree
 	arrivalTime uint64      // Arrival time of the block
+	weight      uint64      // Fork choice weight of the chain ending at this block
 }
 
 // addChild appends node to n's list of children
@@ -88,9 +90,13 @@ func (n *node) getNodeFromBlockNumber(b *big.Int) *node {
 
 func (n *node) getBlockFromNode() *types.Block {
 	bh := types.BlockHeader{
-		ParentHash: n.parent.hash,
-		Number:     n.number,
-		Hash:       n.hash,
+		Number:    n.number,
+		Hash:      n.hash,
+		StateRoot: n.stateRoot,
+	}
+
+	if n.parent != nil {
+		bh.ParentHash = n.parent.hash
 	}
 
 	b := &types.Block{
@@ -1,7 +1,10 @@
 package rawdb
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"math/big"
 
 	"github.com/ChainSafe/gossamer/common"
 	"github.com/ChainSafe/gossamer/core/types"
@@ -53,6 +56,11 @@ func GetBlockData(db polkadb.Reader, hash common.Hash) types.BlockData {
 	return result
 }
 
+// HasBlockData returns true if the KV-store holds the blockData of the block with the given hash
+func HasBlockData(db polkadb.Reader, hash common.Hash) (bool, error) {
+	return db.Has(blockDataKey(hash))
+}
+
 // get is a helper function for retrieving a value from KV-store and unmarshaling
 // into the provided type out
 func get(db polkadb.Reader, hash []byte, out interface{}) {
@@ -62,3 +70,103 @@ func get(db polkadb.Reader, hash []byte, out interface{}) {
 	err = json.Unmarshal(data, &out)
 	check(err)
 }
+
+// SetBlockHash stores the hash of the block with the given number
+func SetBlockHash(db polkadb.Writer, number *big.Int, hash common.Hash) error {
+	return db.Put(blockHashKey(number), hash.ToBytes())
+}
+
+// GetBlockHash returns the hash of the block with the given number
+func GetBlockHash(db polkadb.Reader, number *big.Int) (common.Hash, error) {
+	data, err := db.Get(blockHashKey(number))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.NewHash(data), nil
+}
+
+// SetJustification stores the SCALE encoded finality justification of the block with the given hash
+func SetJustification(db polkadb.Writer, hash common.Hash, justification []byte) error {
+	return db.Put(justificationKey(hash), justification)
+}
+
+// GetJustification returns the finality justification of the block with the given hash, or nil if it has none
+func GetJustification(db polkadb.Reader, hash common.Hash) ([]byte, error) {
+	has, err := db.Has(justificationKey(hash))
+	if err != nil || !has {
+		return nil, err
+	}
+	return db.Get(justificationKey(hash))
+}
+
+// SetArrivalTime stores the time the block with the given hash arrived at, in milliseconds since the unix epoch
+func SetArrivalTime(db polkadb.Writer, hash common.Hash, t uint64) error {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, t)
+	return db.Put(arrivalTimeKey(hash), enc)
+}
+
+// GetArrivalTime returns the time the block with the given hash arrived at, or 0 if none is stored
+func GetArrivalTime(db polkadb.Reader, hash common.Hash) (uint64, error) {
+	has, err := db.Has(arrivalTimeKey(hash))
+	if err != nil || !has {
+		return 0, err
+	}
+
+	enc, err := db.Get(arrivalTimeKey(hash))
+	if err != nil {
+		return 0, err
+	}
+	if len(enc) != 8 {
+		return 0, fmt.Errorf("invalid arrival time of block %s", hash)
+	}
+	return binary.BigEndian.Uint64(enc), nil
+}
+
+// SetGenesisHash stores the hash of the genesis block
+func SetGenesisHash(db polkadb.Writer, hash common.Hash) error {
+	return db.Put(genesisHashKey, hash.ToBytes())
+}
+
+// GetGenesisHash returns the hash of the genesis block
+func GetGenesisHash(db polkadb.Reader) (common.Hash, error) {
+	data, err := db.Get(genesisHashKey)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.NewHash(data), nil
+}
+
+// SetBestBlockHash stores the hash of the best block
+func SetBestBlockHash(db polkadb.Writer, hash common.Hash) error {
+	return db.Put(bestBlockHashKey, hash.ToBytes())
+}
+
+// GetBestBlockHash returns the hash of the best block, or the zero hash if none is stored
+func GetBestBlockHash(db polkadb.Reader) (common.Hash, error) {
+	return getHash(db, bestBlockHashKey)
+}
+
+// SetFinalizedHash stores the hash of the last finalized block
+func SetFinalizedHash(db polkadb.Writer, hash common.Hash) error {
+	return db.Put(finalizedHashKey, hash.ToBytes())
+}
+
+// GetFinalizedHash returns the hash of the last finalized block, or the zero hash if none is stored
+func GetFinalizedHash(db polkadb.Reader) (common.Hash, error) {
+	return getHash(db, finalizedHashKey)
+}
+
+// getHash returns the hash stored under the key, or the zero hash if the key is not in the KV-store
+func getHash(db polkadb.Reader, key []byte) (common.Hash, error) {
+	has, err := db.Has(key)
+	if err != nil || !has {
+		return common.Hash{}, err
+	}
+
+	data, err := db.Get(key)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.NewHash(data), nil
+}
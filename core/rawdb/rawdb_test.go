@@ -1,6 +1,7 @@
 package rawdb
 
 import (
+	"bytes"
 	"math/big"
 	"reflect"
 	"testing"
@@ -54,3 +55,123 @@ func TestSetBlockData(t *testing.T) {
 		t.Fatalf("Retrieved blockData mismatch: have %v, want %v", entry, bd)
 	}
 }
+
+func TestSetBlockHash(t *testing.T) {
+	memDB, h := setup()
+
+	err := SetBlockHash(memDB, h.Number, h.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := GetBlockHash(memDB, h.Number)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != h.Hash {
+		t.Fatalf("Retrieved block hash mismatch: have %x, want %x", hash, h.Hash)
+	}
+
+	_, err = GetBlockHash(memDB, big.NewInt(3))
+	if err == nil {
+		t.Fatal("expected error for unknown block number")
+	}
+}
+
+func TestSetJustification(t *testing.T) {
+	memDB, h := setup()
+
+	j, err := GetJustification(memDB, h.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j != nil {
+		t.Fatalf("Fail: got justification %x for block without one", j)
+	}
+
+	err = SetJustification(memDB, h.Hash, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = GetJustification(memDB, h.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(j, []byte{1, 2, 3}) {
+		t.Fatalf("Retrieved justification mismatch: have %x, want %x", j, []byte{1, 2, 3})
+	}
+}
+
+func TestSetArrivalTime(t *testing.T) {
+	memDB, h := setup()
+
+	at, err := GetArrivalTime(memDB, h.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at != 0 {
+		t.Fatalf("Fail: got arrival time %d for block without one", at)
+	}
+
+	err = SetArrivalTime(memDB, h.Hash, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at, err = GetArrivalTime(memDB, h.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if at != 1000 {
+		t.Fatalf("Retrieved arrival time mismatch: have %d, want 1000", at)
+	}
+}
+
+func TestSetGenesisHash(t *testing.T) {
+	memDB, h := setup()
+
+	err := SetGenesisHash(memDB, h.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := GetGenesisHash(memDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != h.Hash {
+		t.Fatalf("Retrieved genesis hash mismatch: have %x, want %x", hash, h.Hash)
+	}
+}
+
+func TestSetBestBlockHash(t *testing.T) {
+	memDB, h := setup()
+
+	hash, err := GetBestBlockHash(memDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != (common.Hash{}) {
+		t.Fatalf("Expected zero hash before the best block is stored, got %x", hash)
+	}
+
+	err = SetBestBlockHash(memDB, h.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err = GetBestBlockHash(memDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != h.Hash {
+		t.Fatalf("Retrieved best block hash mismatch: have %x, want %x", hash, h.Hash)
+	}
+}
@@ -1,11 +1,24 @@
 package rawdb
 
-import "github.com/ChainSafe/gossamer/common"
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/ChainSafe/gossamer/common"
+)
 
 var (
 	// Data prefixes
-	headerPrefix    = []byte("hdr") // headerPrefix + hash -> header
-	blockDataPrefix = []byte("hsh") // blockDataPrefix + hash -> blockData
+	headerPrefix        = []byte("hdr") // headerPrefix + hash -> header
+	blockDataPrefix     = []byte("hsh") // blockDataPrefix + hash -> blockData
+	blockHashPrefix     = []byte("hnm") // blockHashPrefix + num (uint64 big endian) -> hash
+	justificationPrefix = []byte("jst") // justificationPrefix + hash -> justification
+	arrivalTimePrefix   = []byte("arr") // arrivalTimePrefix + hash -> arrival time (uint64 big endian)
+
+	// Data keys
+	genesisHashKey   = []byte("genesis_hash")   // genesisHashKey -> genesis block hash
+	bestBlockHashKey = []byte("best_block")     // bestBlockHashKey -> best block hash
+	finalizedHashKey = []byte("finalized_hash") // finalizedHashKey -> last finalized block hash
 )
 
 // headerKey = headerPrefix + hash
@@ -17,3 +30,19 @@ func headerKey(hash common.Hash) []byte {
 func blockDataKey(hash common.Hash) []byte {
 	return append(blockDataPrefix, hash.ToBytes()...)
 }
+
+// justificationKey = justificationPrefix + hash
+func justificationKey(hash common.Hash) []byte {
+	return append(justificationPrefix, hash.ToBytes()...)
+}
+
+// arrivalTimeKey = arrivalTimePrefix + hash
+func arrivalTimeKey(hash common.Hash) []byte {
+	return append(arrivalTimePrefix, hash.ToBytes()...)
+}
+
+func blockHashKey(number *big.Int) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number.Uint64())
+	return append(blockHashPrefix, enc...)
+}
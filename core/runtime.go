@@ -19,40 +19,79 @@ package core
 import (
 	"errors"
 
-	scale "github.com/ChainSafe/gossamer/codec"
 	tx "github.com/ChainSafe/gossamer/common/transaction"
 	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/runtime"
+	log "github.com/ChainSafe/log15"
 )
 
-// runs the extrinsic through runtime function TaggedTransactionQueue_validate_transaction
-// and returns *Validity
+// ErrInvalidTransaction is returned when the runtime reports that a transaction is invalid
+var ErrInvalidTransaction = runtime.ErrInvalidTransaction
+
+// ErrParentNotStateHead is returned when importing a block whose parent is not the block of the current state
+var ErrParentNotStateHead = errors.New("parent of block is not the block of the current state")
+
+// ErrInvalidInherents is returned when the runtime reports that the inherent extrinsics of a block are invalid
+var ErrInvalidInherents = errors.New("block has invalid inherent extrinsics")
+
+// validateTransaction returns the validity of the extrinsic reported by the runtime
 func (s *Service) validateTransaction(e types.Extrinsic) (*tx.Validity, error) {
-	var loc int32 = 1000
+	return s.rt.TaggedTransactionQueue().Validate(e)
+}
 
-	ret, err := s.rt.Exec("TaggedTransactionQueue_validate_transaction", loc, e)
-	if err != nil {
-		return nil, err
-	}
+// validateBlock executes the block in the runtime, and returns an error if the runtime rejects it. Only the
+// latest state is kept, so the block's parent must be the block of the current state, whose runtime code the
+// block is executed with. Without a block tree the block's parent is unknown, and the block is executed on the
+// current state.
+func (s *Service) validateBlock(block *types.Block) error {
+	if s.blockTree != nil {
+		parent, err := s.blockTree.GetHeader(block.Header.ParentHash)
+		if err != nil {
+			return ErrUnknownParent
+		}
+
+		root, err := s.rt.StorageRoot()
+		if err != nil {
+			return err
+		}
 
-	if ret[0] != 0 {
-		return nil, errors.New("could not validate transaction")
+		if parent.StateRoot != root {
+			return ErrParentNotStateHead
+		}
 	}
 
-	v := tx.NewValidity(0, [][]byte{{}}, [][]byte{{}}, 0, false)
-	_, err = scale.Decode(ret[1:], v)
+	err := s.updateCode()
+	if err != nil {
+		return err
+	}
 
-	return v, err
+	return s.rt.Core().ExecuteBlock(block)
 }
 
-// runs the block through runtime function Core_execute_block
-// doesn't return data, but will error if the call isn't successful
-func (s *Service) validateBlock(b []byte) error {
-	var loc int32 = 1000
+// updateCode switches the runtime to the code in the current state if a block changed it, and prunes the previous
+// code, as blocks are only executed on top of the current state
+func (s *Service) updateCode() error {
+	switched, err := s.rt.UpdateCode()
+	if err != nil || !switched {
+		return err
+	}
+
+	s.rt.PruneCodes(nil)
+	return nil
+}
 
-	_, err := s.rt.Exec("Core_execute_block", loc, b)
+// checkInherents returns an error if the runtime reports that the block's inherent extrinsics are invalid for the
+// inherent data
+func (s *Service) checkInherents(block *types.Block, data *types.InherentData) error {
+	res, err := s.rt.BlockBuilder().CheckInherents(block, data)
 	if err != nil {
 		return err
 	}
 
+	if !res.Okay {
+		log.Debug("invalid inherents", "fatal", res.FatalError, "errors", res.Errors.Identifiers())
+		return ErrInvalidInherents
+	}
+
 	return nil
 }
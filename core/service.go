@@ -17,92 +17,195 @@
 package core
 
 import (
-	"github.com/ChainSafe/gossamer/internal/services"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
 	log "github.com/ChainSafe/log15"
 
 	"github.com/ChainSafe/gossamer/common"
 	tx "github.com/ChainSafe/gossamer/common/transaction"
-	"github.com/ChainSafe/gossamer/consensus/babe"
+	"github.com/ChainSafe/gossamer/consensus"
+	"github.com/ChainSafe/gossamer/core/blocktree"
 	"github.com/ChainSafe/gossamer/core/types"
-	"github.com/ChainSafe/gossamer/p2p"
+	"github.com/ChainSafe/gossamer/internal/events"
+	"github.com/ChainSafe/gossamer/internal/services"
 	"github.com/ChainSafe/gossamer/runtime"
 )
 
-var _ services.Service = &Service{}
+var _ services.ContextService = &Service{}
+var _ services.HealthReporter = &Service{}
+var _ services.DependentService = &Service{}
+
+// ErrUnknownParent is returned when importing a block whose parent is not in the block tree
+var ErrUnknownParent = errors.New("parent of block is not in the block tree")
 
-// Service is a overhead layer that allows for communication between the runtime, BABE, and the p2p layer.
+// maxRequestedBlocks is the maximum number of blocks requested from the peer that announced a block
+const maxRequestedBlocks = 128
+
+// ErrNoTxPool is returned when importing a transaction into a service without a consensus engine, whose pool holds
+// the transactions
+var ErrNoTxPool = errors.New("service has no consensus engine to pool transactions")
+
+// Service is a overhead layer that allows for communication between the runtime, the consensus engine, and the
+// p2p layer.
 // It deals with the validation of transactions and blocks by calling their respective validation functions
 // in the runtime.
 type Service struct {
-	rt *runtime.Runtime
-	b  *babe.Session
+	services.DependencyList // services core publishes imported blocks and transactions to
+
+	rt        *runtime.Runtime
+	engine    consensus.Engine
+	blockTree *blocktree.BlockTree // imported blocks are added to it, if set
+
+	bus *events.Bus
+	sub *events.Subscription
 
-	recChan  <-chan []byte
-	sendChan chan<- []byte
+	statusLock sync.RWMutex
+	crashed    bool  // set if the event loop exits unexpectedly
+	lastErr    error // last error returned while handling an event
+
+	revalidateLock    sync.Mutex
+	revalidateWg      sync.WaitGroup
+	revalidating      bool    // set while the transaction pool is being revalidated
+	revalidatePending *uint64 // block number to revalidate at once the current revalidation is done
+
+	journal         *tx.Journal
+	journalInterval time.Duration
+	journalStop     chan struct{}
+	journalWg       sync.WaitGroup
 }
 
-// NewService returns a Service that connects the runtime, BABE, and the p2p messages.
-func NewService(rt *runtime.Runtime, b *babe.Session, recChan <-chan []byte, sendChan chan<- []byte) *Service {
+// NewService returns a Service that connects the runtime, the consensus engine, and the p2p messages. The engine
+// may be nil, in which case imported blocks are only executed by the runtime.
+func NewService(rt *runtime.Runtime, engine consensus.Engine, bus *events.Bus) *Service {
 	return &Service{
-		rt:       rt,
-		b:        b,
-		recChan:  recChan,
-		sendChan: sendChan,
+		rt:     rt,
+		engine: engine,
+		bus:    bus,
 	}
 }
 
-// Start begins the service. This begins watching the message channel for new block or transaction messages.
+// SetBlockTree sets the block tree imported blocks are added to
+func (s *Service) SetBlockTree(bt *blocktree.BlockTree) {
+	s.blockTree = bt
+}
+
+// Start begins the service. This subscribes to the event bus and begins watching for new blocks or transactions
+// received from the network.
 func (s *Service) Start() error {
-	e := make(chan error)
-	go s.start(e)
-	return <-e
+	return s.StartWithContext(context.Background())
 }
 
-func (s *Service) start(e chan error) {
-	e <- nil
+// StartWithContext begins the service. Events are handled until the service is stopped or the context is done.
+func (s *Service) StartWithContext(ctx context.Context) error {
+	s.startJournal(ctx)
 
-	for {
-		msg, ok := <-s.recChan
-		if !ok {
-			log.Warn("core service message watcher", "error", "channel closed")
-			break
+	if s.bus == nil {
+		return nil
+	}
+
+	s.sub = s.bus.Subscribe(
+		events.TransactionsReceivedTopic,
+		events.BlockAnnounceReceivedTopic,
+		events.BlockResponseReceivedTopic,
+		events.ChainReorganisedTopic,
+	)
+
+	go s.handleEvents(ctx, s.sub)
+	return nil
+}
+
+func (s *Service) handleEvents(ctx context.Context, sub *events.Subscription) {
+	defer sub.Unsubscribe()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("core service event loop crashed", "error", r)
+			s.statusLock.Lock()
+			s.crashed = true
+			s.lastErr = fmt.Errorf("event loop crashed: %v", r)
+			s.statusLock.Unlock()
 		}
+	}()
 
-		msgType := msg[0]
-		switch msgType {
-		case p2p.TransactionMsgType:
-			// process tx
-			err := s.ProcessTransaction(msg[1:])
+	for {
+		select {
+		case e := <-sub.Chan():
+			err := s.handleEvent(e)
 			if err != nil {
 				log.Error("core service", "error", err)
-				e <- err
+				s.statusLock.Lock()
+				s.lastErr = err
+				s.statusLock.Unlock()
 			}
-			e <- nil
-		case p2p.BlockAnnounceMsgType:
-			// get extrinsics by sending BlockRequest message
-			// process block
-		case p2p.BlockResponseMsgType:
-			// process response
-			err := s.ProcessBlock(msg[1:])
+		case <-sub.Done():
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Service) handleEvent(e events.Event) error {
+	switch ev := e.(type) {
+	case *events.TransactionsReceived:
+		// a peer's batch may contain invalid or banned transactions, which must not stop the others from being imported
+		for _, ext := range ev.Extrinsics {
+			err := s.ProcessTransaction(ext)
 			if err != nil {
-				log.Error("core service", "error", err)
-				e <- err
+				log.Debug("[core] dropping received transaction", "error", err)
 			}
-			e <- nil
-		default:
-			log.Error("core service", "error", "got unsupported message type")
 		}
+	case *events.BlockAnnounceReceived:
+		s.requestAnnouncedBlock(ev)
+	case *events.BlockResponseReceived:
+		return s.processBlockResponse(ev.Data)
+	case *events.ChainReorganised:
+		s.reinjectRetracted(ev.Retracted)
+	default:
+		log.Error("core service", "error", "got unsupported event", "topic", e.Topic())
 	}
+
+	return nil
 }
 
+// Stop stops the service and unsubscribes it from the event bus. The state is stored, so the node resumes from it
+// when it restarts.
 func (s *Service) Stop() error {
-	if s.rt != nil {
-		s.rt.Stop()
+	if s.sub != nil {
+		s.sub.Unsubscribe()
 	}
-	if s.sendChan != nil {
-		close(s.sendChan)
+	// the runtime is needed until the transaction pool has been revalidated
+	s.revalidateWg.Wait()
+	s.stopJournal()
+	if s.rt == nil {
+		return nil
 	}
-	return nil
+
+	// the block tree is rebuilt up to this state when the node restarts
+	err := s.rt.StoreState()
+	s.rt.Stop()
+	return err
+}
+
+// Health reports the service as failed if its event loop has crashed, along with the last error it encountered
+func (s *Service) Health() services.ServiceStatus {
+	s.statusLock.RLock()
+	defer s.statusLock.RUnlock()
+
+	status := services.ServiceStatus{State: services.Running}
+	if s.crashed {
+		status.State = services.Failed
+	}
+	if s.lastErr != nil {
+		status.LastError = s.lastErr.Error()
+	}
+	return status
 }
 
 func (s *Service) StorageRoot() (common.Hash, error) {
@@ -110,23 +213,210 @@ func (s *Service) StorageRoot() (common.Hash, error) {
 }
 
 // ProcessTransaction attempts to validates the transaction
-// if it is validated, it is added to the transaction pool of the BABE session
+// if it is validated, it is added to the transaction pool of the consensus engine
+// transactions found to be invalid are banned from the pool for a while, so they are not validated again
+// ErrNoTxPool is returned if the service has no consensus engine
 func (s *Service) ProcessTransaction(e types.Extrinsic) error {
+	if s.engine == nil {
+		return ErrNoTxPool
+	}
+
+	hash, err := common.Blake2bHash(e)
+	if err != nil {
+		return err
+	}
+
+	pool := s.engine.TxPool()
+	if pool.IsBanned(hash) {
+		return tx.ErrBanned
+	}
+
 	validity, err := s.validateTransaction(e)
+	if err == ErrInvalidTransaction {
+		pool.Ban(hash)
+	}
 	if err != nil {
 		log.Error("ProcessTransaction", "error", err)
 		return err
 	}
 
 	vtx := tx.NewValidTransaction(&e, validity)
-	s.b.PushToTxQueue(vtx)
+	_, err = pool.Import(vtx)
+	if err != nil {
+		return err
+	}
+
+	if s.bus != nil {
+		s.bus.Publish(&events.TransactionImported{Transaction: vtx})
+	}
 
 	return nil
 }
 
-// ProcessBlock attempts to add a block to the chain by calling `core_execute_block`
+// ProcessBlock attempts to add a block to the chain by verifying its header and inherents and calling `core_execute_block`
 // if the block is validated, it is stored in the block DB and becomes part of the canonical chain
 func (s *Service) ProcessBlock(b []byte) error {
-	err := s.validateBlock(b)
-	return err
+	// the block arrived now; the slot times are estimated from the arrival times of imported blocks
+	arrival := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	// the encoded block is the header followed by the body
+	buf := bytes.NewBuffer(b)
+	header := new(types.BlockHeader)
+	err := header.Decode(buf)
+	if err != nil {
+		return err
+	}
+
+	block := &types.Block{
+		Header: *header,
+		Body:   types.BlockBody(buf.Bytes()),
+	}
+	block.SetBlockArrivalTime(arrival)
+
+	if s.blockTree != nil {
+		// the block must not change the state before it is known to extend the block tree
+		_, err = s.blockTree.GetHeader(header.ParentHash)
+		if err != nil {
+			return ErrUnknownParent
+		}
+	}
+
+	if s.engine != nil {
+		// check the block's author was entitled to produce it before executing it
+		err = s.engine.VerifyHeader(header)
+		if err != nil {
+			return err
+		}
+
+		data, err := s.engine.InherentDataProviders().CreateInherentData()
+		if err != nil {
+			return err
+		}
+
+		err = s.checkInherents(block, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.validateBlock(block)
+	if err != nil {
+		return err
+	}
+
+	// later blocks are executed with the new runtime code if the block changed it
+	err = s.updateCode()
+	if err != nil {
+		return err
+	}
+
+	if s.engine != nil {
+		// let the engine track consensus state changes of imported blocks, eg. BABE epoch randomness
+		err = s.engine.HandleHeader(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.blockTree != nil {
+		err = s.importBlock(block)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.pruneTransactions(block)
+	if err != nil {
+		return err
+	}
+
+	if s.bus != nil {
+		s.bus.Publish(&events.BlockImported{Block: block})
+	}
+
+	return nil
+}
+
+// importBlock adds a validated block to the block tree, with the weight given to it by the consensus engine
+func (s *Service) importBlock(block *types.Block) error {
+	weight := uint64(1)
+	if s.engine != nil {
+		var err error
+		weight, err = s.engine.BlockWeight(&block.Header)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.blockTree.AddBlockWithWeight(*block, weight)
+	return nil
+}
+
+// requestAnnouncedBlock asks the peer that announced a block for it, along with the ancestors of the block that may
+// be missing from the block tree
+func (s *Service) requestAnnouncedBlock(ev *events.BlockAnnounceReceived) {
+	if s.blockTree == nil || s.bus == nil {
+		return
+	}
+
+	_, err := s.blockTree.GetHeader(ev.Header.Hash)
+	if err == nil {
+		return
+	}
+
+	// the blocks from our best block to the announced one are requested
+	max := uint32(1)
+	best := s.blockTree.BestBlock()
+	if diff := new(big.Int).Sub(ev.Header.Number, best.Header.Number); diff.Cmp(big.NewInt(1)) > 0 {
+		max = uint32(maxRequestedBlocks)
+		if diff.IsUint64() && diff.Uint64() < maxRequestedBlocks {
+			max = uint32(diff.Uint64())
+		}
+	}
+
+	s.bus.Publish(&events.BlockRequestProduced{PeerID: ev.PeerID, Hash: ev.Header.Hash, Max: max})
+}
+
+// processBlockResponse imports the blocks of a block response, which is a SCALE encoded list of block data, from
+// the lowest block number to the highest. Blocks that are already in the block tree are skipped. The finality
+// justifications the response contains are published, so the finality gadget can finalize the blocks.
+func (s *Service) processBlockResponse(data []byte) error {
+	bds, err := types.DecodeBlockDataArray(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	// blocks are requested in descending order, but parents must be imported first
+	sort.SliceStable(bds, func(i, j int) bool {
+		if bds[i].Header == nil || bds[j].Header == nil {
+			return false
+		}
+		return bds[i].Header.Number.Cmp(bds[j].Header.Number) < 0
+	})
+
+	for _, bd := range bds {
+		known := false
+		if s.blockTree != nil {
+			_, err = s.blockTree.GetHeader(bd.Hash)
+			known = err == nil
+		}
+
+		if !known && bd.Header != nil && bd.Body != nil {
+			enc, err := bd.Header.Encode()
+			if err != nil {
+				return err
+			}
+
+			err = s.ProcessBlock(append(enc, *bd.Body...))
+			if err != nil {
+				return err
+			}
+		}
+
+		if bd.Justification != nil && s.bus != nil {
+			s.bus.Publish(&events.JustificationReceived{Hash: bd.Hash, Justification: bd.Justification})
+		}
+	}
+
+	return nil
 }
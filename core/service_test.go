@@ -19,6 +19,8 @@ package core
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
+	"math/big"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -26,9 +28,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ChainSafe/gossamer/common"
 	tx "github.com/ChainSafe/gossamer/common/transaction"
 	"github.com/ChainSafe/gossamer/consensus/babe"
-	"github.com/ChainSafe/gossamer/p2p"
+	"github.com/ChainSafe/gossamer/core/blocktree"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/crypto"
+	"github.com/ChainSafe/gossamer/internal/events"
 	"github.com/ChainSafe/gossamer/runtime"
 	"github.com/ChainSafe/gossamer/trie"
 )
@@ -91,15 +97,35 @@ func newRuntime(t *testing.T) *runtime.Runtime {
 	return r
 }
 
+func decodeBlock(t *testing.T, enc []byte) *types.Block {
+	buf := bytes.NewBuffer(enc)
+	header := new(types.BlockHeader)
+	err := header.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &types.Block{
+		Header: *header,
+		Body:   types.BlockBody(buf.Bytes()),
+	}
+}
+
+func newTestKeypair(t *testing.T) *crypto.Sr25519Keypair {
+	kp, err := crypto.GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp
+}
+
 func TestNewService_Start(t *testing.T) {
 	rt := newRuntime(t)
-	b, err := babe.NewSession([32]byte{}, [64]byte{}, rt, nil)
+	b, err := babe.NewSession(newTestKeypair(t), rt, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	msgChan := make(chan []byte)
-
-	mgr := NewService(rt, b, msgChan, nil)
+	mgr := NewService(rt, b, events.NewBus())
 
 	err = mgr.Start()
 	if err != nil {
@@ -109,7 +135,7 @@ func TestNewService_Start(t *testing.T) {
 
 func TestValidateTransaction(t *testing.T) {
 	rt := newRuntime(t)
-	mgr := NewService(rt, nil, make(chan []byte), nil)
+	mgr := NewService(rt, nil, nil)
 	// from https://github.com/paritytech/substrate/blob/5420de3face1349a97eb954ae71c5b0b940c31de/core/transaction-pool/src/tests.rs#L95
 	// added:
 	// let utx = Transfer {
@@ -129,7 +155,7 @@ func TestValidateTransaction(t *testing.T) {
 	// see: https://github.com/paritytech/substrate/blob/ea2644a235f4b189c8029b9c9eac9d4df64ee91e/core/test-runtime/src/system.rs#L190
 	expected := &tx.Validity{
 		Priority: 69,
-		Requires: [][]byte{{}},
+		Requires: [][]byte{},
 		// Provides is the twox128 hash of nonce and from: see https://github.com/paritytech/substrate/blob/ea2644a235f4b189c8029b9c9eac9d4df64ee91e/core/test-runtime/src/system.rs#L173
 		Provides:  [][]byte{{146, 157, 61, 99, 63, 98, 30, 242, 128, 49, 150, 90, 140, 165, 187, 249}},
 		Longevity: 64,
@@ -143,11 +169,11 @@ func TestValidateTransaction(t *testing.T) {
 
 func TestProcessTransaction(t *testing.T) {
 	rt := newRuntime(t)
-	b, err := babe.NewSession([32]byte{}, [64]byte{}, rt, nil)
+	b, err := babe.NewSession(newTestKeypair(t), rt, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	mgr := NewService(rt, b, make(chan []byte), nil)
+	mgr := NewService(rt, b, nil)
 	ext := []byte{1, 212, 53, 147, 199, 21, 253, 211, 28, 97, 20, 26, 189, 4, 169, 159, 214, 130, 44, 133, 88, 133, 76, 205, 227, 154, 86, 132, 231, 165, 109, 162, 125, 142, 175, 4, 21, 22, 135, 115, 99, 38, 201, 254, 161, 126, 37, 252, 82, 135, 97, 54, 147, 201, 18, 144, 156, 178, 38, 170, 71, 148, 242, 106, 72, 69, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 216, 5, 113, 87, 87, 40, 221, 120, 247, 252, 137, 201, 74, 231, 222, 101, 85, 108, 102, 39, 31, 190, 210, 14, 215, 124, 19, 160, 180, 203, 54, 110, 167, 163, 149, 45, 12, 108, 80, 221, 65, 238, 57, 237, 199, 16, 10, 33, 185, 8, 244, 184, 243, 139, 5, 87, 252, 245, 24, 225, 37, 154, 163, 142}
 	err = mgr.ProcessTransaction(ext)
 	if err != nil {
@@ -160,12 +186,29 @@ func TestProcessTransaction(t *testing.T) {
 	}
 }
 
+func TestProcessTransaction_NoEngine(t *testing.T) {
+	rt := newRuntime(t)
+	mgr := NewService(rt, nil, nil)
+
+	err := mgr.ProcessTransaction([]byte{1, 2, 3})
+	if err != ErrNoTxPool {
+		t.Fatalf("Fail: got %v expected %v", err, ErrNoTxPool)
+	}
+
+	// retracted blocks are not re-injected without a pool
+	body, err := types.NewBlockBody([]types.Extrinsic{{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.reinjectRetracted([]*types.Block{{Body: body}})
+}
+
 func TestValidateBlock(t *testing.T) {
 	rt := newRuntime(t)
-	mgr := NewService(rt, nil, make(chan []byte), nil)
+	mgr := NewService(rt, nil, nil)
 	// from https://github.com/paritytech/substrate/blob/426c26b8bddfcdbaf8d29f45b128e0864b57de1c/core/test-runtime/src/system.rs#L371
 	data := []byte{69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 4, 179, 38, 109, 225, 55, 210, 10, 93, 15, 243, 166, 64, 30, 181, 113, 39, 82, 95, 217, 178, 105, 55, 1, 240, 191, 90, 138, 133, 63, 163, 235, 224, 3, 23, 10, 46, 117, 151, 183, 183, 227, 216, 76, 5, 57, 29, 19, 154, 98, 177, 87, 231, 135, 134, 216, 192, 130, 242, 157, 207, 76, 17, 19, 20, 0, 0}
-	err := mgr.validateBlock(data)
+	err := mgr.validateBlock(decodeBlock(t, data))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -173,25 +216,35 @@ func TestValidateBlock(t *testing.T) {
 
 func TestHandleMsg_Transaction(t *testing.T) {
 	rt := newRuntime(t)
-	b, err := babe.NewSession([32]byte{}, [64]byte{}, rt, nil)
+	b, err := babe.NewSession(newTestKeypair(t), rt, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	msgChan := make(chan []byte)
-	mgr := NewService(rt, b, msgChan, nil)
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.TransactionImportedTopic)
+	defer sub.Unsubscribe()
+
+	mgr := NewService(rt, b, bus)
 	err = mgr.Start()
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// wait for mgr to start
-	time.Sleep(time.Second)
+	defer mgr.Stop()
 
 	ext := []byte{1, 212, 53, 147, 199, 21, 253, 211, 28, 97, 20, 26, 189, 4, 169, 159, 214, 130, 44, 133, 88, 133, 76, 205, 227, 154, 86, 132, 231, 165, 109, 162, 125, 142, 175, 4, 21, 22, 135, 115, 99, 38, 201, 254, 161, 126, 37, 252, 82, 135, 97, 54, 147, 201, 18, 144, 156, 178, 38, 170, 71, 148, 242, 106, 72, 69, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 216, 5, 113, 87, 87, 40, 221, 120, 247, 252, 137, 201, 74, 231, 222, 101, 85, 108, 102, 39, 31, 190, 210, 14, 215, 124, 19, 160, 180, 203, 54, 110, 167, 163, 149, 45, 12, 108, 80, 221, 65, 238, 57, 237, 199, 16, 10, 33, 185, 8, 244, 184, 243, 139, 5, 87, 252, 245, 24, 225, 37, 154, 163, 142}
-	msgChan <- append([]byte{p2p.TransactionMsgType}, ext...)
+	// an invalid transaction in the batch does not stop the valid one from being imported
+	bus.Publish(&events.TransactionsReceived{Extrinsics: []types.Extrinsic{{1, 2, 3}, ext}})
 
-	// wait for message to be handled
-	time.Sleep(time.Second)
+	// wait for transaction to be imported
+	select {
+	case e := <-sub.Chan():
+		imported := e.(*events.TransactionImported).Transaction
+		if !bytes.Equal([]byte(*imported.Extrinsic), ext) {
+			t.Fatalf("Fail: got %x expected %x", imported.Extrinsic, ext)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("did not receive TransactionImported event")
+	}
 
 	// check if in babe tx queue
 	tx := b.PeekFromTxQueue()
@@ -204,27 +257,260 @@ func TestHandleMsg_Transaction(t *testing.T) {
 
 func TestHandleMsg_BlockResponse(t *testing.T) {
 	rt := newRuntime(t)
-	b, err := babe.NewSession([32]byte{}, [64]byte{}, rt, nil)
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.BlockImportedTopic, events.JustificationReceivedTopic)
+	defer sub.Unsubscribe()
+
+	// the test block has no BABE header, so it is imported without a BABE session
+	mgr := NewService(rt, nil, bus)
+	err := mgr.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Stop()
+
+	block := []byte{69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 4, 179, 38, 109, 225, 55, 210, 10, 93, 15, 243, 166, 64, 30, 181, 113, 39, 82, 95, 217, 178, 105, 55, 1, 240, 191, 90, 138, 133, 63, 163, 235, 224, 3, 23, 10, 46, 117, 151, 183, 183, 227, 216, 76, 5, 57, 29, 19, 154, 98, 177, 87, 231, 135, 134, 216, 192, 130, 242, 157, 207, 76, 17, 19, 20, 0, 0}
+
+	// the response holds the block data of the block: its header, body and justification
+	buf := bytes.NewBuffer(block)
+	header := new(types.BlockHeader)
+	err = header.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := types.BlockBody(buf.Bytes())
+
+	data, err := types.EncodeBlockDataArray([]*types.BlockData{
+		{Hash: header.Hash, Header: header, Body: &body, Justification: []byte{1, 2, 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Publish(&events.BlockResponseReceived{ID: 1, Data: data})
+
+	// wait for block to be imported
+	select {
+	case e := <-sub.Chan():
+		imported := e.(*events.BlockImported).Block
+		if imported.Header.Number.Cmp(big.NewInt(1)) != 0 {
+			t.Fatalf("Fail: got block number %d expected 1", imported.Header.Number)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("did not receive BlockImported event")
+	}
+
+	// the justification is published once the block is imported
+	select {
+	case e := <-sub.Chan():
+		received := e.(*events.JustificationReceived)
+		if received.Hash != header.Hash || !bytes.Equal(received.Justification, []byte{1, 2, 3}) {
+			t.Fatalf("Fail: got justification %x for block %s", received.Justification, received.Hash)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("did not receive JustificationReceived event")
+	}
+}
+
+func TestHandleMsg_BlockAnnounce(t *testing.T) {
+	rt := newRuntime(t)
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.BlockRequestProducedTopic)
+	defer sub.Unsubscribe()
+
+	mgr := NewService(rt, nil, bus)
+	genesis := types.Block{
+		Header: types.BlockHeader{Number: big.NewInt(0), Hash: common.Hash{0x01}},
+		Body:   types.BlockBody{},
+	}
+	mgr.SetBlockTree(blocktree.NewBlockTreeFromGenesis(genesis, nil))
+
+	err := mgr.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Stop()
+
+	// the genesis block is known, so it is not requested
+	bus.Publish(&events.BlockAnnounceReceived{PeerID: "peer", Header: &genesis.Header})
+
+	header := &types.BlockHeader{Number: big.NewInt(5), Hash: common.Hash{0x05}}
+	bus.Publish(&events.BlockAnnounceReceived{PeerID: "peer", Header: header})
+
+	select {
+	case e := <-sub.Chan():
+		req := e.(*events.BlockRequestProduced)
+		if req.PeerID != "peer" || req.Hash != header.Hash || req.Max != 5 {
+			t.Fatalf("Fail: got block request %+v", req)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("did not receive BlockRequestProduced event")
+	}
+
+	select {
+	case e := <-sub.Chan():
+		t.Fatalf("Fail: got unexpected block request %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestProcessBlock_BlockTree(t *testing.T) {
+	rt := newRuntime(t)
+	mgr := NewService(rt, nil, nil)
+
+	block := []byte{69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 4, 179, 38, 109, 225, 55, 210, 10, 93, 15, 243, 166, 64, 30, 181, 113, 39, 82, 95, 217, 178, 105, 55, 1, 240, 191, 90, 138, 133, 63, 163, 235, 224, 3, 23, 10, 46, 117, 151, 183, 183, 227, 216, 76, 5, 57, 29, 19, 154, 98, 177, 87, 231, 135, 134, 216, 192, 130, 242, 157, 207, 76, 17, 19, 20, 0, 0}
+	header := new(types.BlockHeader)
+	err := header.Decode(bytes.NewReader(block))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the parent of the block is not in the block tree
+	genesis := types.Block{
+		Header: types.BlockHeader{Number: big.NewInt(0), Hash: common.Hash{0x01}},
+		Body:   types.BlockBody{},
+	}
+	mgr.SetBlockTree(blocktree.NewBlockTreeFromGenesis(genesis, nil))
+	root, err := rt.StorageRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mgr.ProcessBlock(block)
+	if err != ErrUnknownParent {
+		t.Fatalf("Fail: got %v expected %v", err, ErrUnknownParent)
+	}
+
+	// the block is rejected before it is executed
+	after, err := rt.StorageRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != root {
+		t.Fatalf("Fail: block with unknown parent changed the state root from %s to %s", root, after)
+	}
+
+	// the parent of the block is in the block tree, but the state is not the parent's state
+	genesis.Header.Hash = header.ParentHash
+	mgr.SetBlockTree(blocktree.NewBlockTreeFromGenesis(genesis, nil))
+
+	err = mgr.ProcessBlock(block)
+	if err != ErrParentNotStateHead {
+		t.Fatalf("Fail: got %v expected %v", err, ErrParentNotStateHead)
+	}
+
+	genesis.Header.StateRoot = root
+	bt := blocktree.NewBlockTreeFromGenesis(genesis, nil)
+	mgr.SetBlockTree(bt)
+
+	err = mgr.ProcessBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bt.BestBlockHash() != header.Hash {
+		t.Fatalf("Fail: got best block %s expected imported block %s", bt.BestBlockHash(), header.Hash)
+	}
+
+	if bt.BestBlock().GetBlockArrivalTime() == 0 {
+		t.Fatal("Fail: imported block has no arrival time")
+	}
+}
+
+func TestProcessBlock_NoBabeHeader(t *testing.T) {
+	rt := newRuntime(t)
+	b, err := babe.NewSession(newTestKeypair(t), rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewService(rt, b, nil)
+
+	block := []byte{69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 4, 179, 38, 109, 225, 55, 210, 10, 93, 15, 243, 166, 64, 30, 181, 113, 39, 82, 95, 217, 178, 105, 55, 1, 240, 191, 90, 138, 133, 63, 163, 235, 224, 3, 23, 10, 46, 117, 151, 183, 183, 227, 216, 76, 5, 57, 29, 19, 154, 98, 177, 87, 231, 135, 134, 216, 192, 130, 242, 157, 207, 76, 17, 19, 20, 0, 0}
+	err = mgr.ProcessBlock(block)
+	if err != babe.ErrNoBabeHeader {
+		t.Fatalf("Fail: got %v expected %v", err, babe.ErrNoBabeHeader)
+	}
+}
+
+func TestCheckInherents(t *testing.T) {
+	rt := newRuntime(t)
+	b, err := babe.NewSession(newTestKeypair(t), rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewService(rt, b, nil)
+
+	data, err := b.InherentDataProviders().CreateInherentData()
 	if err != nil {
 		t.Fatal(err)
 	}
-	msgChan := make(chan []byte)
-	mgr := NewService(rt, b, msgChan, nil)
-	e := make(chan error)
-	go mgr.start(e)
-	if err := <-e; err != nil {
+
+	block := []byte{69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 4, 179, 38, 109, 225, 55, 210, 10, 93, 15, 243, 166, 64, 30, 181, 113, 39, 82, 95, 217, 178, 105, 55, 1, 240, 191, 90, 138, 133, 63, 163, 235, 224, 3, 23, 10, 46, 117, 151, 183, 183, 227, 216, 76, 5, 57, 29, 19, 154, 98, 177, 87, 231, 135, 134, 216, 192, 130, 242, 157, 207, 76, 17, 19, 20, 0, 0}
+	err = mgr.checkInherents(decodeBlock(t, block), data)
+	if err != nil {
 		t.Fatal(err)
 	}
+}
 
-	// wait for mgr to start
-	time.Sleep(time.Second)
+func TestProcessBlock_UpdateCode(t *testing.T) {
+	_, err := getRuntimeBlob()
+	if err != nil {
+		t.Fatalf("Fail: could not get polkadot runtime")
+	}
+
+	code, err := ioutil.ReadFile(POLKADOT_RUNTIME_FP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := &trie.Trie{}
+	rt, err := runtime.NewRuntime(code, tt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := NewService(rt, nil, nil)
+	oldHash := rt.CodeHash()
+
+	// the new code is the old code with a custom section appended, as if the parent of the block had set it; the
+	// block is executed with the code in its parent's state
+	newCode := append(append([]byte{}, code...), 0, 5, 4, 't', 'e', 's', 't')
+	err = tt.Put(runtime.CodeKey, newCode)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	block := []byte{69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 69, 4, 179, 38, 109, 225, 55, 210, 10, 93, 15, 243, 166, 64, 30, 181, 113, 39, 82, 95, 217, 178, 105, 55, 1, 240, 191, 90, 138, 133, 63, 163, 235, 224, 3, 23, 10, 46, 117, 151, 183, 183, 227, 216, 76, 5, 57, 29, 19, 154, 98, 177, 87, 231, 135, 134, 216, 192, 130, 242, 157, 207, 76, 17, 19, 20, 0, 0}
-	msgChan <- append([]byte{p2p.BlockResponseMsgType}, block...)
+	header := new(types.BlockHeader)
+	err = header.Decode(bytes.NewReader(block))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := rt.StorageRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// wait for message to be handled
-	time.Sleep(time.Second)
-	if err := <-e; err != nil {
+	genesis := types.Block{
+		Header: types.BlockHeader{Number: big.NewInt(0), Hash: header.ParentHash, StateRoot: root},
+		Body:   types.BlockBody{},
+	}
+	mgr.SetBlockTree(blocktree.NewBlockTreeFromGenesis(genesis, nil))
+
+	err = mgr.ProcessBlock(block)
+	if err != nil {
 		t.Fatal(err)
 	}
+
+	if rt.CodeHash() == oldHash {
+		t.Fatal("Fail: runtime did not switch to the new code")
+	}
+
+	// blocks are only executed on top of the current state, so the old code is pruned
+	_, err = rt.ExecWithCode(oldHash, "Core_version", []byte{})
+	if err != runtime.ErrUnknownCode {
+		t.Fatalf("Fail: got %v expected %v", err, runtime.ErrUnknownCode)
+	}
 }
@@ -0,0 +1,174 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"time"
+
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/core/types"
+	log "github.com/ChainSafe/log15"
+)
+
+// pruneTransactions removes the transactions included in an imported block, and the expired transactions, from
+// the engine's transaction pool. The remaining transactions are then revalidated against the new state in the background.
+func (s *Service) pruneTransactions(block *types.Block) error {
+	if s.engine == nil {
+		return nil
+	}
+
+	exts, err := block.Body.Extrinsics()
+	if err != nil {
+		return err
+	}
+
+	number := block.Header.Number.Uint64()
+	removed, err := s.engine.TxPool().PruneBlock(number, exts)
+	if err != nil {
+		return err
+	}
+
+	log.Debug("pruned transaction pool", "block", number, "removed", len(removed))
+
+	s.scheduleRevalidation(number)
+	return nil
+}
+
+// scheduleRevalidation revalidates the transaction pool at the given block number in the background. If a
+// revalidation is already running, another one is run once it is done, at the latest scheduled block number.
+func (s *Service) scheduleRevalidation(number uint64) {
+	s.revalidateLock.Lock()
+	defer s.revalidateLock.Unlock()
+
+	if s.revalidating {
+		s.revalidatePending = &number
+		return
+	}
+
+	s.revalidating = true
+	s.revalidateWg.Add(1)
+	go s.revalidate(number)
+}
+
+func (s *Service) revalidate(number uint64) {
+	defer s.revalidateWg.Done()
+
+	for {
+		dropped := s.engine.TxPool().Revalidate(number, s.validateTransaction)
+		log.Debug("revalidated transaction pool", "block", number, "dropped", len(dropped))
+
+		s.revalidateLock.Lock()
+		if s.revalidatePending == nil {
+			s.revalidating = false
+			s.revalidateLock.Unlock()
+			return
+		}
+		number = *s.revalidatePending
+		s.revalidatePending = nil
+		s.revalidateLock.Unlock()
+	}
+}
+
+// reinjectRetracted revalidates the extrinsics of blocks that are no longer part of the best chain and
+// re-imports the valid ones into the transaction pool, so that they can be included in the new best chain
+func (s *Service) reinjectRetracted(retracted []*types.Block) {
+	if s.engine == nil {
+		return
+	}
+
+	for _, block := range retracted {
+		exts, err := block.Body.Extrinsics()
+		if err != nil {
+			log.Error("failed to decode retracted block body", "block", block.Header.Hash, "error", err)
+			continue
+		}
+
+		for _, ext := range exts {
+			err = s.ProcessTransaction(ext)
+			if err != nil {
+				log.Debug("failed to re-inject retracted transaction", "error", err)
+			}
+		}
+	}
+}
+
+// SetJournal makes the service restore the engine's transaction pool from the journal when it starts, and save the
+// pool to the journal every interval and when it stops. A zero interval only saves the pool when stopping.
+func (s *Service) SetJournal(journal *tx.Journal, interval time.Duration) {
+	s.journal = journal
+	s.journalInterval = interval
+}
+
+// startJournal restores the transaction pool from the journal, and starts saving it periodically
+func (s *Service) startJournal(ctx context.Context) {
+	if s.journal == nil || s.engine == nil {
+		return
+	}
+
+	restored, err := s.journal.Restore(s.engine.TxPool(), s.validateTransaction)
+	if err != nil {
+		log.Error("failed to restore transaction pool from journal", "error", err)
+	} else {
+		log.Info("restored transaction pool from journal", "transactions", restored)
+	}
+
+	if s.journalInterval == 0 {
+		return
+	}
+
+	s.journalStop = make(chan struct{})
+	s.journalWg.Add(1)
+	go func() {
+		defer s.journalWg.Done()
+
+		ticker := time.NewTicker(s.journalInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				err := s.journal.Save(s.engine.TxPool())
+				if err != nil {
+					log.Error("failed to save transaction pool to journal", "error", err)
+				}
+			case <-s.journalStop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stopJournal stops saving the transaction pool periodically, and saves it one last time
+func (s *Service) stopJournal() {
+	if s.journal == nil || s.engine == nil {
+		return
+	}
+
+	if s.journalStop != nil {
+		close(s.journalStop)
+		s.journalWg.Wait()
+		s.journalStop = nil
+	}
+
+	err := s.journal.Save(s.engine.TxPool())
+	if err != nil {
+		log.Error("failed to save transaction pool to journal", "error", err)
+	}
+}
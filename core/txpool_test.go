@@ -0,0 +1,198 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/consensus/babe"
+	"github.com/ChainSafe/gossamer/core/blocktree"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/events"
+	"github.com/ChainSafe/gossamer/polkadb"
+)
+
+func TestPruneTransactions(t *testing.T) {
+	rt := newRuntime(t)
+	b, err := babe.NewSession(newTestKeypair(t), rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := NewService(rt, b, nil)
+	ext := []byte{1, 212, 53, 147, 199, 21, 253, 211, 28, 97, 20, 26, 189, 4, 169, 159, 214, 130, 44, 133, 88, 133, 76, 205, 227, 154, 86, 132, 231, 165, 109, 162, 125, 142, 175, 4, 21, 22, 135, 115, 99, 38, 201, 254, 161, 126, 37, 252, 82, 135, 97, 54, 147, 201, 18, 144, 156, 178, 38, 170, 71, 148, 242, 106, 72, 69, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 216, 5, 113, 87, 87, 40, 221, 120, 247, 252, 137, 201, 74, 231, 222, 101, 85, 108, 102, 39, 31, 190, 210, 14, 215, 124, 19, 160, 180, 203, 54, 110, 167, 163, 149, 45, 12, 108, 80, 221, 65, 238, 57, 237, 199, 16, 10, 33, 185, 8, 244, 184, 243, 139, 5, 87, 252, 245, 24, 225, 37, 154, 163, 142}
+	err = mgr.ProcessTransaction(ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := types.NewBlockBody([]types.Extrinsic{ext})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := &types.Block{
+		Header: types.BlockHeader{Number: big.NewInt(1)},
+		Body:   body,
+	}
+
+	err = mgr.pruneTransactions(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for revalidation to finish
+	mgr.revalidateWg.Wait()
+
+	if ready, future := b.TxPool().Len(); ready != 0 || future != 0 {
+		t.Fatalf("Fail: got ready=%d future=%d expected empty pool", ready, future)
+	}
+}
+
+func TestHandleMsg_ChainReorganised(t *testing.T) {
+	rt := newRuntime(t)
+	b, err := babe.NewSession(newTestKeypair(t), rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.TransactionImportedTopic)
+	defer sub.Unsubscribe()
+
+	mgr := NewService(rt, b, bus)
+	err = mgr.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Stop()
+	ext := []byte{1, 212, 53, 147, 199, 21, 253, 211, 28, 97, 20, 26, 189, 4, 169, 159, 214, 130, 44, 133, 88, 133, 76, 205, 227, 154, 86, 132, 231, 165, 109, 162, 125, 142, 175, 4, 21, 22, 135, 115, 99, 38, 201, 254, 161, 126, 37, 252, 82, 135, 97, 54, 147, 201, 18, 144, 156, 178, 38, 170, 71, 148, 242, 106, 72, 69, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 216, 5, 113, 87, 87, 40, 221, 120, 247, 252, 137, 201, 74, 231, 222, 101, 85, 108, 102, 39, 31, 190, 210, 14, 215, 124, 19, 160, 180, 203, 54, 110, 167, 163, 149, 45, 12, 108, 80, 221, 65, 238, 57, 237, 199, 16, 10, 33, 185, 8, 244, 184, 243, 139, 5, 87, 252, 245, 24, 225, 37, 154, 163, 142}
+	body, err := types.NewBlockBody([]types.Extrinsic{ext})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesis := types.Block{
+		Header: types.BlockHeader{Number: big.NewInt(0), Hash: common.Hash{0x01}},
+		Body:   types.BlockBody{},
+	}
+	bt := blocktree.NewBlockTreeFromGenesis(genesis, &polkadb.BlockDB{Db: polkadb.NewMemDatabase()})
+	bt.SetEventBus(bus)
+
+	// a heavier block on another fork retracts the block with the extrinsic from the best chain
+	bt.AddBlockWithWeight(types.Block{
+		Header: types.BlockHeader{ParentHash: genesis.Header.Hash, Number: big.NewInt(1), Hash: common.Hash{0x02}},
+		Body:   body,
+	}, 1)
+	bt.AddBlockWithWeight(types.Block{
+		Header: types.BlockHeader{ParentHash: genesis.Header.Hash, Number: big.NewInt(1), Hash: common.Hash{0x03}},
+		Body:   types.BlockBody{},
+	}, 2)
+
+	// the retracted block's extrinsic is imported back into the pool
+	select {
+	case <-sub.Chan():
+	case <-time.After(10 * time.Second):
+		t.Fatal("did not receive TransactionImported event")
+	}
+
+	if ready, _ := b.TxPool().Len(); ready != 1 {
+		t.Fatalf("Fail: got %d ready transactions expected 1", ready)
+	}
+}
+
+func TestProcessTransaction_Banned(t *testing.T) {
+	rt := newRuntime(t)
+	b, err := babe.NewSession(newTestKeypair(t), rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := NewService(rt, b, nil)
+	ext := []byte{1, 212, 53, 147, 199, 21, 253, 211, 28, 97, 20, 26, 189, 4, 169, 159, 214, 130, 44, 133, 88, 133, 76, 205, 227, 154, 86, 132, 231, 165, 109, 162, 125, 142, 175, 4, 21, 22, 135, 115, 99, 38, 201, 254, 161, 126, 37, 252, 82, 135, 97, 54, 147, 201, 18, 144, 156, 178, 38, 170, 71, 148, 242, 106, 72, 69, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 216, 5, 113, 87, 87, 40, 221, 120, 247, 252, 137, 201, 74, 231, 222, 101, 85, 108, 102, 39, 31, 190, 210, 14, 215, 124, 19, 160, 180, 203, 54, 110, 167, 163, 149, 45, 12, 108, 80, 221, 65, 238, 57, 237, 199, 16, 10, 33, 185, 8, 244, 184, 243, 139, 5, 87, 252, 245, 24, 225, 37, 154, 163, 142}
+
+	hash, err := common.Blake2bHash(ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.TxPool().Ban(hash)
+
+	err = mgr.ProcessTransaction(ext)
+	if err != tx.ErrBanned {
+		t.Fatalf("Fail: got %v expected %v", err, tx.ErrBanned)
+	}
+}
+
+func TestJournal_RestartService(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "core-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journal := tx.NewJournal(filepath.Join(dir, tx.JournalFile), time.Hour)
+
+	rt := newRuntime(t)
+	b, err := babe.NewSession(newTestKeypair(t), rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := NewService(rt, b, nil)
+	mgr.SetJournal(journal, 0)
+
+	err = mgr.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ext := []byte{1, 212, 53, 147, 199, 21, 253, 211, 28, 97, 20, 26, 189, 4, 169, 159, 214, 130, 44, 133, 88, 133, 76, 205, 227, 154, 86, 132, 231, 165, 109, 162, 125, 142, 175, 4, 21, 22, 135, 115, 99, 38, 201, 254, 161, 126, 37, 252, 82, 135, 97, 54, 147, 201, 18, 144, 156, 178, 38, 170, 71, 148, 242, 106, 72, 69, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 216, 5, 113, 87, 87, 40, 221, 120, 247, 252, 137, 201, 74, 231, 222, 101, 85, 108, 102, 39, 31, 190, 210, 14, 215, 124, 19, 160, 180, 203, 54, 110, 167, 163, 149, 45, 12, 108, 80, 221, 65, 238, 57, 237, 199, 16, 10, 33, 185, 8, 244, 184, 243, 139, 5, 87, 252, 245, 24, 225, 37, 154, 163, 142}
+	err = mgr.ProcessTransaction(ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pool is saved to the journal when the service stops
+	err = mgr.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt = newRuntime(t)
+	b, err = babe.NewSession(newTestKeypair(t), rt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr = NewService(rt, b, nil)
+	mgr.SetJournal(journal, 0)
+
+	// and restored when it starts again
+	err = mgr.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Stop()
+
+	res := b.PeekFromTxQueue()
+	if res == nil || !reflect.DeepEqual([]byte(*res.Extrinsic), ext) {
+		t.Fatalf("Fail: got %v expected %x", res, ext)
+	}
+}
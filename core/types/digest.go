@@ -0,0 +1,166 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	scale "github.com/ChainSafe/gossamer/codec"
+)
+
+// Digest item types
+// see: https://github.com/paritytech/substrate/blob/master/primitives/runtime/src/generic/digest.rs
+const (
+	ChangesTrieRootDigestType = byte(2)
+	ConsensusDigestType       = byte(4)
+	SealDigestType            = byte(5)
+	PreRuntimeDigestType      = byte(6)
+)
+
+// ConsensusEngineID identifies the consensus engine a digest item is intended for
+type ConsensusEngineID [4]byte
+
+// BabeEngineID is the consensus engine ID of BABE
+var BabeEngineID = ConsensusEngineID{'B', 'A', 'B', 'E'}
+
+// AuraEngineID is the consensus engine ID of Aura
+var AuraEngineID = ConsensusEngineID{'a', 'u', 'r', 'a'}
+
+// GrandpaEngineID is the consensus engine ID of GRANDPA
+var GrandpaEngineID = ConsensusEngineID{'F', 'R', 'N', 'K'}
+
+// DigestItem is a single item of a block header digest
+// ChangesTrieRoot items have no ConsensusEngineID and their Data is the 32-byte root
+type DigestItem struct {
+	Type              byte
+	ConsensusEngineID ConsensusEngineID
+	Data              []byte
+}
+
+// NewPreRuntimeDigest returns a pre-runtime digest item for the consensus engine
+func NewPreRuntimeDigest(id ConsensusEngineID, data []byte) *DigestItem {
+	return &DigestItem{Type: PreRuntimeDigestType, ConsensusEngineID: id, Data: data}
+}
+
+// NewConsensusDigest returns a consensus digest item for the consensus engine
+func NewConsensusDigest(id ConsensusEngineID, data []byte) *DigestItem {
+	return &DigestItem{Type: ConsensusDigestType, ConsensusEngineID: id, Data: data}
+}
+
+// NewSealDigest returns a seal digest item for the consensus engine
+func NewSealDigest(id ConsensusEngineID, data []byte) *DigestItem {
+	return &DigestItem{Type: SealDigestType, ConsensusEngineID: id, Data: data}
+}
+
+// Encode returns the SCALE encoding of the digest item
+func (d *DigestItem) Encode() ([]byte, error) {
+	enc := []byte{d.Type}
+	switch d.Type {
+	case ChangesTrieRootDigestType:
+		if len(d.Data) != 32 {
+			return nil, errors.New("changes trie root digest data is not 32 bytes")
+		}
+		return append(enc, d.Data...), nil
+	case ConsensusDigestType, SealDigestType, PreRuntimeDigestType:
+		enc = append(enc, d.ConsensusEngineID[:]...)
+		data, err := scale.Encode(d.Data)
+		if err != nil {
+			return nil, err
+		}
+		return append(enc, data...), nil
+	default:
+		return nil, fmt.Errorf("unknown digest item type %d", d.Type)
+	}
+}
+
+// Decode decodes a SCALE encoded digest item from the reader into the receiver
+func (d *DigestItem) Decode(r io.Reader) error {
+	sd := scale.Decoder{Reader: r}
+	typ, err := sd.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	d.Type = typ
+	switch typ {
+	case ChangesTrieRootDigestType:
+		d.Data = make([]byte, 32)
+		_, err = io.ReadFull(r, d.Data)
+		return err
+	case ConsensusDigestType, SealDigestType, PreRuntimeDigestType:
+		_, err = io.ReadFull(r, d.ConsensusEngineID[:])
+		if err != nil {
+			return err
+		}
+		d.Data, err = sd.DecodeByteArray()
+		return err
+	default:
+		return fmt.Errorf("unknown digest item type %d", typ)
+	}
+}
+
+// EncodeDigest returns the SCALE encoding of a list of digest items, to be used as a header's Digest
+func EncodeDigest(items []*DigestItem) ([]byte, error) {
+	enc, err := scale.Encode(big.NewInt(int64(len(items))))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		b, err := item.Encode()
+		if err != nil {
+			return nil, err
+		}
+		enc = append(enc, b...)
+	}
+
+	return enc, nil
+}
+
+// DecodeDigest decodes a header's Digest into its digest items; an empty digest has no items
+func DecodeDigest(in []byte) ([]*DigestItem, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+
+	return readDigest(bytes.NewReader(in))
+}
+
+// readDigest decodes a SCALE encoded list of digest items from the reader
+func readDigest(r io.Reader) ([]*DigestItem, error) {
+	sd := scale.Decoder{Reader: r}
+	n, err := sd.DecodeInteger()
+	if err != nil {
+		return nil, err
+	}
+
+	items := []*DigestItem{}
+	for i := int64(0); i < n; i++ {
+		item := new(DigestItem)
+		err = item.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
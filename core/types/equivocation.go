@@ -0,0 +1,47 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/binary"
+)
+
+// EquivocationProof proves that an authority produced two different blocks for the same slot
+// see: https://github.com/paritytech/substrate/blob/master/primitives/consensus/slots/src/lib.rs
+type EquivocationProof struct {
+	Offender     [32]byte     `json:"offender"` // public key of the authority
+	Slot         uint64       `json:"slot"`
+	FirstHeader  *BlockHeader `json:"firstHeader"`
+	SecondHeader *BlockHeader `json:"secondHeader"`
+}
+
+// Encode returns the SCALE encoding of the equivocation proof
+func (p *EquivocationProof) Encode() ([]byte, error) {
+	enc := make([]byte, 40)
+	copy(enc, p.Offender[:])
+	binary.LittleEndian.PutUint64(enc[32:], p.Slot)
+
+	for _, header := range []*BlockHeader{p.FirstHeader, p.SecondHeader} {
+		b, err := header.Encode()
+		if err != nil {
+			return nil, err
+		}
+		enc = append(enc, b...)
+	}
+
+	return enc, nil
+}
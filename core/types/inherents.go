@@ -0,0 +1,155 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"sort"
+
+	scale "github.com/ChainSafe/gossamer/codec"
+)
+
+// InherentIdentifier identifies a type of inherent data
+type InherentIdentifier [8]byte
+
+var (
+	// TimestampInherentIdentifier identifies the timestamp inherent data
+	TimestampInherentIdentifier = InherentIdentifier{'t', 'i', 'm', 's', 't', 'a', 'p', '0'}
+	// BabeSlotInherentIdentifier identifies the BABE slot inherent data
+	BabeSlotInherentIdentifier = InherentIdentifier{'b', 'a', 'b', 'e', 's', 'l', 'o', 't'}
+	// AuraSlotInherentIdentifier identifies the Aura slot inherent data
+	AuraSlotInherentIdentifier = InherentIdentifier{'a', 'u', 'r', 'a', 's', 'l', 'o', 't'}
+)
+
+// String returns the identifier as a string
+func (id InherentIdentifier) String() string {
+	return string(id[:])
+}
+
+// InherentData is the data the runtime creates the inherent extrinsics of a block from, and checks the inherent
+// extrinsics of imported blocks against. Each value is the SCALE encoding of the data for its identifier.
+type InherentData struct {
+	data map[InherentIdentifier][]byte
+}
+
+// NewInherentData returns empty inherent data
+func NewInherentData() *InherentData {
+	return &InherentData{
+		data: make(map[InherentIdentifier][]byte),
+	}
+}
+
+// Put sets the data for the identifier to the SCALE encoding of the value
+func (d *InherentData) Put(id InherentIdentifier, value interface{}) error {
+	enc, err := scale.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	d.data[id] = enc
+	return nil
+}
+
+// Get returns the SCALE encoded data for the identifier, or nil if there is none
+func (d *InherentData) Get(id InherentIdentifier) []byte {
+	return d.data[id]
+}
+
+// Identifiers returns the identifiers there is data for, in ascending order
+func (d *InherentData) Identifiers() []InherentIdentifier {
+	ids := make([]InherentIdentifier, 0, len(d.data))
+	for id := range d.data {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 })
+	return ids
+}
+
+// Encode returns the SCALE encoding of the inherent data as a map of identifiers to byte arrays, in ascending
+// order of identifiers
+func (d *InherentData) Encode() ([]byte, error) {
+	enc, err := scale.Encode(big.NewInt(int64(len(d.data))))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range d.Identifiers() {
+		b, err := scale.Encode(d.data[id])
+		if err != nil {
+			return nil, err
+		}
+
+		enc = append(enc, id[:]...)
+		enc = append(enc, b...)
+	}
+
+	return enc, nil
+}
+
+// Decode decodes SCALE encoded inherent data from the reader into the receiver
+func (d *InherentData) Decode(r io.Reader) error {
+	sd := scale.Decoder{Reader: r}
+	n, err := sd.DecodeInteger()
+	if err != nil {
+		return err
+	}
+
+	d.data = make(map[InherentIdentifier][]byte)
+	for i := int64(0); i < n; i++ {
+		var id InherentIdentifier
+		_, err = io.ReadFull(r, id[:])
+		if err != nil {
+			return err
+		}
+
+		d.data[id], err = sd.DecodeByteArray()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckInherentsResult is the result of checking the inherent extrinsics of a block against inherent data
+type CheckInherentsResult struct {
+	Okay       bool          // true if all inherent extrinsics are valid
+	FatalError bool          // true if an error means the block must be rejected
+	Errors     *InherentData // the errors found for each type of inherent data
+}
+
+// Decode decodes a SCALE encoded CheckInherentsResult from the reader into the receiver
+func (c *CheckInherentsResult) Decode(r io.Reader) error {
+	sd := scale.Decoder{Reader: r}
+
+	var err error
+	c.Okay, err = sd.DecodeBool()
+	if err != nil {
+		return err
+	}
+
+	c.FatalError, err = sd.DecodeBool()
+	if err != nil {
+		return err
+	}
+
+	c.Errors = NewInherentData()
+	return c.Errors.Decode(r)
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestInherentData_EncodeAndDecode(t *testing.T) {
+	data := NewInherentData()
+	err := data.Put(TimestampInherentIdentifier, uint64(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = data.Put(BabeSlotInherentIdentifier, uint64(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := data.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// identifiers are in ascending order, and the data of each is a byte array
+	expected := []byte{8}
+	expected = append(expected, []byte("babeslot")...)
+	expected = append(expected, 32, 1, 0, 0, 0, 0, 0, 0, 0)
+	expected = append(expected, []byte("timstap0")...)
+	expected = append(expected, 32, 7, 0, 0, 0, 0, 0, 0, 0)
+	if !bytes.Equal(enc, expected) {
+		t.Fatalf("Fail: got %x expected %x", enc, expected)
+	}
+
+	dec := new(InherentData)
+	err = dec.Decode(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(dec, data) {
+		t.Fatalf("Fail: got %v expected %v", dec, data)
+	}
+}
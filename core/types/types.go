@@ -17,8 +17,11 @@
 package types
 
 import (
+	"bytes"
+	"io"
 	"math/big"
 
+	scale "github.com/ChainSafe/gossamer/codec"
 	"github.com/ChainSafe/gossamer/common"
 )
 
@@ -42,6 +45,19 @@ func (b *Block) SetBlockArrivalTime(t uint64) {
 	b.arrivalTime = t
 }
 
+// Encode returns the SCALE encoding of the block, which is the encoded header followed by the body
+func (b *Block) Encode() ([]byte, error) {
+	enc, err := b.Header.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b.Body) == 0 {
+		return append(enc, 0), nil
+	}
+	return append(enc, b.Body...), nil
+}
+
 // BlockHeader is a state block header
 type BlockHeader struct {
 	ParentHash     common.Hash `json:"parentHash"`
@@ -53,9 +69,138 @@ type BlockHeader struct {
 	Hash common.Hash `json:"hash"`
 }
 
+// NewHeader creates a new block header and sets its hash field
+func NewHeader(parentHash common.Hash, number *big.Int, stateRoot common.Hash, extrinsicsRoot common.Hash, digest []byte) (*BlockHeader, error) {
+	bh := &BlockHeader{
+		ParentHash:     parentHash,
+		Number:         number,
+		StateRoot:      stateRoot,
+		ExtrinsicsRoot: extrinsicsRoot,
+		Digest:         digest,
+	}
+
+	hash, err := bh.CalculateHash()
+	if err != nil {
+		return nil, err
+	}
+
+	bh.Hash = hash
+	return bh, nil
+}
+
+// Encode returns the SCALE encoding of the header, not including the hash field.
+// The Digest is already a SCALE encoded list of digest items and is appended as is;
+// an empty Digest is encoded as an empty list.
+func (bh *BlockHeader) Encode() ([]byte, error) {
+	enc, err := scale.Encode(bh.ParentHash)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range []interface{}{bh.Number, bh.StateRoot, bh.ExtrinsicsRoot} {
+		b, err := scale.Encode(field)
+		if err != nil {
+			return nil, err
+		}
+		enc = append(enc, b...)
+	}
+
+	if len(bh.Digest) == 0 {
+		return append(enc, 0), nil
+	}
+	return append(enc, bh.Digest...), nil
+}
+
+// Decode decodes a SCALE encoded header from the reader into the receiver and sets its hash
+func (bh *BlockHeader) Decode(r io.Reader) error {
+	sd := scale.Decoder{Reader: r}
+
+	_, err := io.ReadFull(r, bh.ParentHash[:])
+	if err != nil {
+		return err
+	}
+
+	bh.Number, err = sd.DecodeBigInt()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.ReadFull(r, bh.StateRoot[:])
+	if err != nil {
+		return err
+	}
+
+	_, err = io.ReadFull(r, bh.ExtrinsicsRoot[:])
+	if err != nil {
+		return err
+	}
+
+	items, err := readDigest(r)
+	if err != nil {
+		return err
+	}
+
+	bh.Digest = []byte{}
+	if len(items) > 0 {
+		bh.Digest, err = EncodeDigest(items)
+		if err != nil {
+			return err
+		}
+	}
+
+	bh.Hash, err = bh.CalculateHash()
+	return err
+}
+
+// CalculateHash returns the blake2b hash of the encoded header
+func (bh *BlockHeader) CalculateHash() (common.Hash, error) {
+	enc, err := bh.Encode()
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return common.Blake2bHash(enc)
+}
+
 // BlockBody is the extrinsics inside a state block
 type BlockBody []byte
 
+// NewBlockBody returns the SCALE encoding of the list of extrinsics as a block body
+func NewBlockBody(exts []Extrinsic) (BlockBody, error) {
+	enc := make([][]byte, len(exts))
+	for i, ext := range exts {
+		enc[i] = ext
+	}
+
+	body, err := scale.Encode(enc)
+	if err != nil {
+		return nil, err
+	}
+	return BlockBody(body), nil
+}
+
+// Extrinsics decodes the SCALE encoded list of extrinsics in the block body
+func (bb BlockBody) Extrinsics() ([]Extrinsic, error) {
+	if len(bb) == 0 {
+		return nil, nil
+	}
+
+	sd := scale.Decoder{Reader: bytes.NewReader(bb)}
+	length, err := sd.DecodeInteger()
+	if err != nil {
+		return nil, err
+	}
+
+	exts := make([]Extrinsic, length)
+	for i := range exts {
+		exts[i], err = sd.DecodeByteArray()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return exts, nil
+}
+
 /// BlockData is stored within the BlockDB
 type BlockData struct {
 	Hash   common.Hash
@@ -63,5 +208,156 @@ type BlockData struct {
 	Body   *BlockBody
 	// Receipt
 	// MessageQueue
-	// Justification
+	Justification []byte // SCALE encoded finality justification; nil if the block has none
+}
+
+// Encode returns the SCALE encoding of the block data; the fields that are not set are encoded as None
+// see: https://github.com/paritytech/substrate/blob/master/client/network/src/protocol/message.rs
+func (bd *BlockData) Encode() ([]byte, error) {
+	enc := bd.Hash.ToBytes()
+
+	if bd.Header == nil {
+		enc = append(enc, 0)
+	} else {
+		header, err := bd.Header.Encode()
+		if err != nil {
+			return nil, err
+		}
+		enc = append(append(enc, 1), header...)
+	}
+
+	if bd.Body == nil {
+		enc = append(enc, 0)
+	} else if len(*bd.Body) == 0 {
+		// an empty body is an empty list of extrinsics
+		enc = append(enc, 1, 0)
+	} else {
+		enc = append(append(enc, 1), *bd.Body...)
+	}
+
+	// receipt and message queue are not supported
+	enc = append(enc, 0, 0)
+
+	if bd.Justification == nil {
+		return append(enc, 0), nil
+	}
+
+	j, err := scale.Encode(bd.Justification)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(enc, 1), j...), nil
+}
+
+// Decode decodes SCALE encoded block data from the reader into the receiver. Receipts and message queues are
+// skipped.
+func (bd *BlockData) Decode(r io.Reader) error {
+	sd := scale.Decoder{Reader: r}
+
+	_, err := io.ReadFull(r, bd.Hash[:])
+	if err != nil {
+		return err
+	}
+
+	exists, err := sd.ReadByte()
+	if err != nil {
+		return err
+	}
+	if exists == 1 {
+		bd.Header = new(BlockHeader)
+		err = bd.Header.Decode(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	exists, err = sd.ReadByte()
+	if err != nil {
+		return err
+	}
+	if exists == 1 {
+		n, err := sd.DecodeInteger()
+		if err != nil {
+			return err
+		}
+
+		exts := make([]Extrinsic, n)
+		for i := range exts {
+			exts[i], err = sd.DecodeByteArray()
+			if err != nil {
+				return err
+			}
+		}
+
+		body, err := NewBlockBody(exts)
+		if err != nil {
+			return err
+		}
+		bd.Body = &body
+	}
+
+	for i := 0; i < 2; i++ {
+		exists, err = sd.ReadByte()
+		if err != nil {
+			return err
+		}
+		if exists == 1 {
+			_, err = sd.DecodeByteArray()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	exists, err = sd.ReadByte()
+	if err != nil {
+		return err
+	}
+	if exists == 1 {
+		bd.Justification, err = sd.DecodeByteArray()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EncodeBlockDataArray returns the SCALE encoding of a list of block data
+func EncodeBlockDataArray(bds []*BlockData) ([]byte, error) {
+	enc, err := scale.Encode(big.NewInt(int64(len(bds))))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bd := range bds {
+		b, err := bd.Encode()
+		if err != nil {
+			return nil, err
+		}
+		enc = append(enc, b...)
+	}
+
+	return enc, nil
+}
+
+// DecodeBlockDataArray decodes a SCALE encoded list of block data
+func DecodeBlockDataArray(r io.Reader) ([]*BlockData, error) {
+	sd := scale.Decoder{Reader: r}
+	n, err := sd.DecodeInteger()
+	if err != nil {
+		return nil, err
+	}
+
+	bds := []*BlockData{}
+	for i := int64(0); i < n; i++ {
+		bd := new(BlockData)
+		err = bd.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		bds = append(bds, bd)
+	}
+
+	return bds, nil
 }
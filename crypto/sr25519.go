@@ -5,11 +5,19 @@ import (
 	"errors"
 
 	sr25519 "github.com/ChainSafe/go-schnorrkel"
+	"github.com/gtank/merlin"
 )
 
 // SigningContext is the context for signatures used or created with substrate
 var SigningContext = []byte("substrate")
 
+const (
+	// VrfOutputLength is the length in bytes of an encoded VRF output
+	VrfOutputLength = 32
+	// VrfProofLength is the length in bytes of an encoded VRF proof
+	VrfProofLength = 64
+)
+
 // Sr25519Keypair is a sr25519 public-private keypair
 type Sr25519Keypair struct {
 	public  *Sr25519PublicKey
@@ -37,6 +45,11 @@ func NewSr25519Keypair(priv *sr25519.SecretKey) (*Sr25519Keypair, error) {
 	}, nil
 }
 
+// NewSr25519KeypairFromPrivate returns the Sr25519Keypair of a private key
+func NewSr25519KeypairFromPrivate(priv *Sr25519PrivateKey) (*Sr25519Keypair, error) {
+	return NewSr25519Keypair(priv.key)
+}
+
 // NewSr25519PrivateKey creates a new private key using the input bytes
 func NewSr25519PrivateKey(in []byte) (*Sr25519PrivateKey, error) {
 	if len(in) != 32 {
@@ -89,6 +102,22 @@ func (k *Sr25519PrivateKey) Sign(msg []byte) ([]byte, error) {
 	return enc[:], nil
 }
 
+// VrfSign creates a VRF output and proof for the transcript using the private key
+func (k *Sr25519PrivateKey) VrfSign(t *merlin.Transcript) ([VrfOutputLength]byte, [VrfProofLength]byte, error) {
+	out := [VrfOutputLength]byte{}
+	proof := [VrfProofLength]byte{}
+	if k.key == nil {
+		return out, proof, errors.New("key is nil")
+	}
+
+	inout, p, err := k.key.VrfSign(t)
+	if err != nil {
+		return out, proof, err
+	}
+
+	return inout.Output().Encode(), p.Encode(), nil
+}
+
 // Public returns the public key corresponding to this private key
 func (k *Sr25519PrivateKey) Public() (PublicKey, error) {
 	if k.key == nil {
@@ -140,7 +169,52 @@ func (k *Sr25519PublicKey) Verify(msg, sig []byte) bool {
 	}
 
 	t := sr25519.NewSigningContext(SigningContext, msg)
-	return k.key.Verify(s, t)
+	ok, err := k.key.Verify(s, t)
+	if err != nil {
+		return false
+	}
+	return ok
+}
+
+// VrfVerify verifies that the VRF output and proof were created for the transcript by the private key
+// corresponding to this public key
+func (k *Sr25519PublicKey) VrfVerify(t *merlin.Transcript, out [VrfOutputLength]byte, proof [VrfProofLength]byte) (bool, error) {
+	if k.key == nil {
+		return false, errors.New("key is nil")
+	}
+
+	o, err := sr25519.NewOutput(out)
+	if err != nil {
+		return false, err
+	}
+
+	p := new(sr25519.VrfProof)
+	err = p.Decode(proof)
+	if err != nil {
+		return false, err
+	}
+
+	return k.key.VrfVerify(t, o, p)
+}
+
+// VrfOutputBytes derives size bytes from a VRF output created by this public key's private key for the
+// transcript, using context to separate uses of the same output
+func (k *Sr25519PublicKey) VrfOutputBytes(t *merlin.Transcript, out [VrfOutputLength]byte, context []byte, size int) ([]byte, error) {
+	if k.key == nil {
+		return nil, errors.New("key is nil")
+	}
+
+	o, err := sr25519.NewOutput(out)
+	if err != nil {
+		return nil, err
+	}
+
+	inout, err := o.AttachInput(k.key, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return inout.MakeBytes(size, context)
 }
 
 // Encode returns the 32-byte encoding of the public key
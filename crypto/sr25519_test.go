@@ -3,6 +3,8 @@ package crypto
 import (
 	"reflect"
 	"testing"
+
+	"github.com/gtank/merlin"
 )
 
 func TestSr25519SignAndVerify(t *testing.T) {
@@ -77,3 +79,51 @@ func TestSr25519EncodeAndDecodePublicKey(t *testing.T) {
 		t.Fatalf("Fail: got %v expected %v", res.key, exp)
 	}
 }
+
+func TestSr25519VrfSignAndVerify(t *testing.T) {
+	kp, err := GenerateSr25519Keypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transcript := func() *merlin.Transcript {
+		tr := merlin.NewTranscript("test")
+		tr.AppendMessage([]byte("msg"), []byte("helloworld"))
+		return tr
+	}
+
+	out, proof, err := kp.private.VrfSign(transcript())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := kp.public.VrfVerify(transcript(), out, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Fail: did not verify VRF output")
+	}
+
+	other := merlin.NewTranscript("test")
+	other.AppendMessage([]byte("msg"), []byte("noot"))
+	ok, err = kp.public.VrfVerify(other, out, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("Fail: verified VRF output for a different transcript")
+	}
+
+	a, err := kp.public.VrfOutputBytes(transcript(), out, []byte("context"), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := kp.public.VrfOutputBytes(transcript(), out, []byte("context"), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 16 || !reflect.DeepEqual(a, b) {
+		t.Fatalf("Fail: VRF output bytes are not deterministic: got %x and %x", a, b)
+	}
+}
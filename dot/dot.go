@@ -17,9 +17,8 @@
 package dot
 
 import (
-	"os"
-	"os/signal"
-	"syscall"
+	"context"
+	"sync"
 
 	"github.com/ChainSafe/gossamer/internal/services"
 	"github.com/ChainSafe/gossamer/rpc"
@@ -33,6 +32,7 @@ type Dot struct {
 	Rpc       *rpc.HttpServer           // HTTP instance for RPC server
 	IsStarted chan struct{}             // Signals node startup complete
 	stop      chan struct{}             // Used to signal node shutdown
+	stopOnce  sync.Once
 }
 
 // NewDot initializes a Dot with provided components.
@@ -42,7 +42,7 @@ func NewDot(name string, srvcs []services.Service, rpc *rpc.HttpServer) *Dot {
 		Services:  services.NewServiceRegistry(),
 		Rpc:       rpc,
 		IsStarted: make(chan struct{}),
-		stop:      nil,
+		stop:      make(chan struct{}),
 	}
 
 	for _, srvc := range srvcs {
@@ -52,39 +52,48 @@ func NewDot(name string, srvcs []services.Service, rpc *rpc.HttpServer) *Dot {
 	return d
 }
 
-// Start starts all services. API service is started last.
-func (d *Dot) Start() {
+// Start starts all services in dependency order, then the RPC server. It returns once the node has started;
+// use Wait to block until the node is stopped. If any service fails to start, the services already started
+// are stopped and the error is returned.
+func (d *Dot) Start(ctx context.Context) error {
 	log.Debug("Starting core services.")
-	d.Services.StartAll()
-	if d.Rpc != nil {
-		d.Rpc.Start()
+	err := d.Services.StartAll(ctx)
+	if err != nil {
+		return err
 	}
 
-	d.stop = make(chan struct{})
-	go func() {
-		sigc := make(chan os.Signal, 1)
-		signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
-		defer signal.Stop(sigc)
-		<-sigc
-		log.Info("Got interrupt, shutting down...")
-		d.Stop()
-		os.Exit(130)
-	}()
+	if d.Rpc != nil {
+		err = d.Rpc.Start()
+		if err != nil {
+			log.Error("Error starting RPC server", "err", err)
+			if stopErr := d.Services.StopAll(); stopErr != nil {
+				log.Error("Error stopping services", "err", stopErr)
+			}
+			return err
+		}
+	}
 
-	//Move on when routine catches SIGINT or SIGTERM calls
 	close(d.IsStarted)
-	d.Wait()
+	return nil
 }
 
-// Wait is used to force the node to stay alive until a signal is passed into `Dot.stop`
+// Wait blocks until the node has been stopped
 func (d *Dot) Wait() {
 	<-d.stop
 }
 
-//Stop all services first, then send stop signal for test
-func (d *Dot) Stop() {
-	d.Services.StopAll()
-	if d.stop != nil {
+// Stop stops the RPC server, then all services in the reverse of their start order, and unblocks Wait.
+// It is safe to call multiple times.
+func (d *Dot) Stop() error {
+	var err error
+	d.stopOnce.Do(func() {
+		if d.Rpc != nil {
+			if rpcErr := d.Rpc.Stop(); rpcErr != nil {
+				log.Error("Error stopping RPC server", "err", rpcErr)
+			}
+		}
+		err = d.Services.StopAll()
 		close(d.stop)
-	}
+	})
+	return err
 }
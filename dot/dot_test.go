@@ -17,6 +17,8 @@
 package dot
 
 import (
+	"context"
+	"errors"
 	"os"
 	"testing"
 
@@ -38,7 +40,7 @@ func createTestDot(t *testing.T) *Dot {
 		NoMdns:         false,
 		DataDir:        "",
 	}
-	p2pSrvc, err := p2p.NewService(p2pCfg, nil, nil)
+	p2pSrvc, err := p2p.NewService(p2pCfg, nil)
 	services = append(services, p2pSrvc)
 	if err != nil {
 		t.Fatal(err)
@@ -53,7 +55,7 @@ func createTestDot(t *testing.T) *Dot {
 	services = append(services, dbSrv)
 
 	// API
-	apiSrvc := api.NewApiService(p2pSrvc, nil)
+	apiSrvc := api.NewApiService(p2pSrvc, nil, nil)
 	services = append(services, apiSrvc)
 
 	return NewDot("gossamer", services, nil)
@@ -68,10 +70,17 @@ func TestDot_Start(t *testing.T) {
 
 	dot := createTestDot(t)
 
-	go dot.Start()
+	err := dot.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// Wait until dot.Start() is finished
-	<-dot.IsStarted
+	// Start closes IsStarted once it has finished
+	select {
+	case <-dot.IsStarted:
+	default:
+		t.Fatal("IsStarted was not closed after starting")
+	}
 
 	for _, srvc := range availableServices {
 		s := dot.Services.Get(srvc)
@@ -80,9 +89,12 @@ func TestDot_Start(t *testing.T) {
 		}
 	}
 
-	dot.Stop()
-	// Wait for everything to finish
-	<-dot.stop
+	err = dot.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait returns once the node has stopped
+	dot.Wait()
 
 	defer func() {
 		if err := os.RemoveAll("../test_data"); err != nil {
@@ -90,3 +102,33 @@ func TestDot_Start(t *testing.T) {
 		}
 	}()
 }
+
+type failingService struct{}
+
+func (s *failingService) Start() error { return errors.New("failed to start") }
+func (s *failingService) Stop() error  { return nil }
+
+func TestDot_Start_Failure(t *testing.T) {
+	dot := NewDot("gossamer", []services.Service{&failingService{}}, nil)
+
+	err := dot.Start(context.Background())
+	if err == nil {
+		t.Fatal("expected error starting node")
+	}
+
+	select {
+	case <-dot.IsStarted:
+		t.Fatal("IsStarted should not be closed after a failed start")
+	default:
+	}
+
+	// Stop can be called more than once
+	err = dot.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dot.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
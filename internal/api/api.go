@@ -17,11 +17,13 @@
 package api
 
 import (
+	"github.com/ChainSafe/gossamer/core/blocktree"
 	apiModule "github.com/ChainSafe/gossamer/internal/api/modules"
 	"github.com/ChainSafe/gossamer/internal/services"
 )
 
-var _ services.Service = &Service{}
+var _ services.DependentService = &Service{}
+var _ apiModule.BlockApi = &blocktree.BlockTree{}
 
 // Service couples all components required for the API.
 type Service struct {
@@ -32,13 +34,16 @@ type Service struct {
 type Api struct {
 	P2pModule     *apiModule.P2pModule
 	RuntimeModule *apiModule.RuntimeModule
+	BlockModule   *apiModule.BlockModule
+	HealthModule  *apiModule.HealthModule
+	BabeModule    *apiModule.BabeModule
 }
 
 // Module represents a collection of API endpoints.
 type Module string
 
 // NewApiService creates a new API instance.
-func NewApiService(p2p apiModule.P2pApi, rt apiModule.RuntimeApi) *Service {
+func NewApiService(p2p apiModule.P2pApi, rt apiModule.RuntimeApi, block apiModule.BlockApi) *Service {
 	return &Service{
 		&Api{
 			P2pModule: &apiModule.P2pModule{
@@ -47,6 +52,13 @@ func NewApiService(p2p apiModule.P2pApi, rt apiModule.RuntimeApi) *Service {
 			RuntimeModule: &apiModule.RuntimeModule{
 				Rt: rt,
 			},
+			BlockModule: &apiModule.BlockModule{
+				Block: block,
+			},
+			// Health is set once the service registry has been created
+			HealthModule: &apiModule.HealthModule{},
+			// Babe is set once a BABE session has been created
+			BabeModule: &apiModule.BabeModule{},
 		},
 	}
 }
@@ -55,6 +67,17 @@ func (s *Service) Start() error {
 	return nil
 }
 
+// Dependencies returns the modules' backends that are themselves services, so they are started before the API
+func (s *Service) Dependencies() []services.Service {
+	var deps []services.Service
+	for _, backend := range []interface{}{s.Api.P2pModule.P2p, s.Api.RuntimeModule.Rt, s.Api.BlockModule.Block} {
+		if srvc, ok := backend.(services.Service); ok {
+			deps = append(deps, srvc)
+		}
+	}
+	return deps
+}
+
 func (s *Service) Stop() error {
 	return nil
 }
@@ -17,7 +17,11 @@
 package api
 
 import (
+	"errors"
+	"math/big"
 	"testing"
+
+	"github.com/ChainSafe/gossamer/common"
 )
 
 // -------------- Mock Apis ------------------
@@ -28,6 +32,8 @@ var (
 	peerID          = "Qmc85Ephxa3sR7xaTzTq2UpCJ4a4HWAfxxaV6TarXHWVVh"
 	noBootstrapping = false
 	peers           = []string{"QmeQeqpf3fz3CG2ckQq3CUWwUnyT2cqxJepHpjji7ehVtX"}
+	genesisHash     = common.Hash{0x01}
+	bestHash        = common.Hash{0x02}
 )
 
 // Creating a mock peer
@@ -61,6 +67,28 @@ func (a *MockRuntimeApi) Version() string {
 	return testVersion
 }
 
+// Creating a mock block API
+type MockBlockApi struct{}
+
+func (a *MockBlockApi) GenesisHash() common.Hash {
+	return genesisHash
+}
+
+func (a *MockBlockApi) BestBlockHash() common.Hash {
+	return bestHash
+}
+
+func (a *MockBlockApi) FinalizedHash() common.Hash {
+	return genesisHash
+}
+
+func (a *MockBlockApi) GetBlockHash(number *big.Int) (common.Hash, error) {
+	if number.Cmp(big.NewInt(0)) == 0 {
+		return genesisHash, nil
+	}
+	return common.Hash{}, errors.New("block not found")
+}
+
 // func (a *MockRuntimeApi) Chain() string {
 // 	return Chain
 // }
@@ -73,7 +101,7 @@ func (a *MockRuntimeApi) Version() string {
 // -------------------------------------------
 
 func TestSystemModule(t *testing.T) {
-	srvc := NewApiService(&MockP2pApi{}, &MockRuntimeApi{})
+	srvc := NewApiService(&MockP2pApi{}, &MockRuntimeApi{}, &MockBlockApi{})
 
 	// System.Name
 	n := srvc.Api.RuntimeModule.Name()
@@ -105,3 +133,36 @@ func TestSystemModule(t *testing.T) {
 		t.Fatalf("System.Version - expected: %s got: %s\n", testVersion, v)
 	}
 }
+
+func TestBlockModule(t *testing.T) {
+	srvc := NewApiService(&MockP2pApi{}, &MockRuntimeApi{}, &MockBlockApi{})
+
+	// Chain.GenesisHash
+	g := srvc.Api.BlockModule.GenesisHash()
+	if g != genesisHash {
+		t.Fatalf("Chain.GenesisHash - expected: %x got: %x\n", genesisHash, g)
+	}
+
+	// Chain.GetBlockHash
+	h, err := srvc.Api.BlockModule.GetBlockHash(big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != genesisHash {
+		t.Fatalf("Chain.GetBlockHash - expected: %x got: %x\n", genesisHash, h)
+	}
+
+	// Chain.GetBlockHash with no block number returns the best block hash
+	h, err = srvc.Api.BlockModule.GetBlockHash(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != bestHash {
+		t.Fatalf("Chain.GetBlockHash - expected: %x got: %x\n", bestHash, h)
+	}
+
+	_, err = srvc.Api.BlockModule.GetBlockHash(big.NewInt(1))
+	if err == nil {
+		t.Fatal("Chain.GetBlockHash - expected error for unknown block")
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package module
+
+import (
+	"github.com/ChainSafe/gossamer/core/types"
+	log "github.com/ChainSafe/log15"
+)
+
+type BabeModule struct {
+	Babe BabeApi
+}
+
+type BabeApi interface {
+	Equivocations() []*types.EquivocationProof
+}
+
+func NewBabeModule(babeapi BabeApi) *BabeModule {
+	return &BabeModule{babeapi}
+}
+
+func (b *BabeModule) Equivocations() []*types.EquivocationProof {
+	log.Debug("[rpc] Executing Babe.Equivocations", "params", nil)
+	if b.Babe == nil {
+		return []*types.EquivocationProof{}
+	}
+	return b.Babe.Equivocations()
+}
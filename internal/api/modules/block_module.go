@@ -0,0 +1,61 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package module
+
+import (
+	"math/big"
+
+	"github.com/ChainSafe/gossamer/common"
+	log "github.com/ChainSafe/log15"
+)
+
+type BlockModule struct {
+	Block BlockApi
+}
+
+// BlockApi is the interface expected to implemented by `blocktree` package
+type BlockApi interface {
+	GenesisHash() common.Hash
+	BestBlockHash() common.Hash
+	FinalizedHash() common.Hash
+	GetBlockHash(number *big.Int) (common.Hash, error)
+}
+
+func NewBlockModule(blockapi BlockApi) *BlockModule {
+	return &BlockModule{blockapi}
+}
+
+// GenesisHash returns the hash of the genesis block
+func (b *BlockModule) GenesisHash() common.Hash {
+	log.Debug("[rpc] Executing Chain.GenesisHash", "params", nil)
+	return b.Block.GenesisHash()
+}
+
+// GetBlockHash returns the hash of the block with the given number, or the best block hash if number is nil
+func (b *BlockModule) GetBlockHash(number *big.Int) (common.Hash, error) {
+	log.Debug("[rpc] Executing Chain.GetBlockHash", "params", number)
+	if number == nil {
+		return b.Block.BestBlockHash(), nil
+	}
+	return b.Block.GetBlockHash(number)
+}
+
+// FinalizedHash returns the hash of the last finalized block
+func (b *BlockModule) FinalizedHash() common.Hash {
+	log.Debug("[rpc] Executing Chain.FinalizedHash", "params", nil)
+	return b.Block.FinalizedHash()
+}
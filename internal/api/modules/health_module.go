@@ -0,0 +1,53 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package module
+
+import (
+	"github.com/ChainSafe/gossamer/internal/services"
+	log "github.com/ChainSafe/log15"
+)
+
+type HealthModule struct {
+	Health HealthApi
+}
+
+// HealthApi is the interface expected to implemented by `services.ServiceRegistry`
+type HealthApi interface {
+	Health() map[string]services.ServiceStatus
+	Healthy() bool
+}
+
+func NewHealthModule(healthapi HealthApi) *HealthModule {
+	return &HealthModule{healthapi}
+}
+
+// Services returns the status of each of the node's services
+func (h *HealthModule) Services() map[string]services.ServiceStatus {
+	log.Debug("[rpc] Executing System.Health", "params", nil)
+	if h.Health == nil {
+		return map[string]services.ServiceStatus{}
+	}
+	return h.Health.Health()
+}
+
+// Healthy returns true if all of the node's services are healthy
+func (h *HealthModule) Healthy() bool {
+	if h.Health == nil {
+		return true
+	}
+	return h.Health.Healthy()
+}
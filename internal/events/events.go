@@ -0,0 +1,200 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+
+	log "github.com/ChainSafe/log15"
+)
+
+// DefaultBufferSize is the number of events a subscription can hold before events published to it are dropped
+const DefaultBufferSize = 256
+
+// criticalTopics are the topics of the events sync and consensus cannot recover from losing. Instead of being
+// dropped, they are queued without bound for a subscriber whose buffer is full, and delivered in order.
+var criticalTopics = map[Topic]bool{
+	BlockResponseReceivedTopic: true,
+	BlockImportedTopic:         true,
+	JustificationReceivedTopic: true,
+	BlockFinalizedTopic:        true,
+}
+
+// Bus is a typed publish/subscribe event bus used by services to communicate with each other
+type Bus struct {
+	lock sync.RWMutex
+	subs map[Topic]map[*Subscription]struct{}
+}
+
+// NewBus creates an event bus with no subscriptions
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[Topic]map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe returns a subscription that receives every event published to any of the given topics
+func (b *Bus) Subscribe(topics ...Topic) *Subscription {
+	s := &Subscription{
+		bus:    b,
+		topics: topics,
+		ch:     make(chan Event, DefaultBufferSize),
+		quit:   make(chan struct{}),
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, topic := range topics {
+		if b.subs[topic] == nil {
+			b.subs[topic] = make(map[*Subscription]struct{})
+		}
+		b.subs[topic][s] = struct{}{}
+	}
+
+	return s
+}
+
+// Publish sends the event to all subscribers of its topic. It never blocks, so a slow subscriber cannot stall the
+// services publishing events: a subscriber whose buffer is full does not receive the event, unless its topic is
+// critical, in which case it is queued for the subscriber.
+func (b *Bus) Publish(e Event) {
+	b.lock.RLock()
+	subs := make([]*Subscription, 0, len(b.subs[e.Topic()]))
+	for s := range b.subs[e.Topic()] {
+		subs = append(subs, s)
+	}
+	b.lock.RUnlock()
+
+	for _, s := range subs {
+		if criticalTopics[e.Topic()] {
+			s.enqueue(e)
+			continue
+		}
+
+		select {
+		case s.ch <- e:
+		case <-s.quit:
+		default:
+			dropped := atomic.AddUint64(&s.dropped, 1)
+			log.Warn("[events] subscriber buffer is full, dropping event", "topic", e.Topic(), "dropped", dropped)
+		}
+	}
+}
+
+// Subscribers returns the number of subscriptions for the given topic
+func (b *Bus) Subscribers(topic Topic) int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return len(b.subs[topic])
+}
+
+func (b *Bus) unsubscribe(s *Subscription) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, topic := range s.topics {
+		delete(b.subs[topic], s)
+		if len(b.subs[topic]) == 0 {
+			delete(b.subs, topic)
+		}
+	}
+}
+
+// Subscription receives events published on a Bus for a set of topics
+type Subscription struct {
+	bus    *Bus
+	topics []Topic
+	ch     chan Event
+	quit   chan struct{}
+	once   sync.Once
+
+	dropped uint64 // number of events dropped because the buffer was full, accessed atomically
+
+	queueLock  sync.Mutex
+	queue      []Event // critical events waiting for space in the buffer
+	forwarding bool    // set while a goroutine moves the queued events into the buffer
+}
+
+// enqueue delivers a critical event. If the buffer is full, or earlier events are still queued, the event is
+// queued and a goroutine moves the queue into the buffer as the subscriber takes events from it.
+func (s *Subscription) enqueue(e Event) {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+
+	if !s.forwarding {
+		select {
+		case s.ch <- e:
+			return
+		case <-s.quit:
+			return
+		default:
+		}
+
+		s.forwarding = true
+		go s.forward()
+	}
+
+	s.queue = append(s.queue, e)
+	log.Debug("[events] subscriber buffer is full, queueing event", "topic", e.Topic(), "queued", len(s.queue))
+}
+
+// forward moves the queued events into the buffer until the queue is empty or the subscription is cancelled
+func (s *Subscription) forward() {
+	for {
+		s.queueLock.Lock()
+		if len(s.queue) == 0 {
+			s.forwarding = false
+			s.queueLock.Unlock()
+			return
+		}
+		e := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.queueLock.Unlock()
+
+		select {
+		case s.ch <- e:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// Chan returns the channel on which events are delivered
+func (s *Subscription) Chan() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns the number of events the subscription did not receive because its buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Done returns a channel that is closed once the subscription has been cancelled
+func (s *Subscription) Done() <-chan struct{} {
+	return s.quit
+}
+
+// Unsubscribe removes the subscription from the bus; it is safe to call multiple times
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.unsubscribe(s)
+		close(s.quit)
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/gossamer/core/types"
+)
+
+func TestBus_PublishSubscribe(t *testing.T) {
+	bus := NewBus()
+
+	peers := bus.Subscribe(PeerConnectedTopic, PeerDisconnectedTopic)
+	defer peers.Unsubscribe()
+	connected := bus.Subscribe(PeerConnectedTopic)
+	defer connected.Unsubscribe()
+
+	bus.Publish(&PeerConnected{PeerID: "a"})
+	bus.Publish(&PeerDisconnected{PeerID: "a"})
+	bus.Publish(&BlockFinalized{})
+
+	expected := []Event{&PeerConnected{PeerID: "a"}, &PeerDisconnected{PeerID: "a"}}
+	for _, exp := range expected {
+		select {
+		case e := <-peers.Chan():
+			if e.Topic() != exp.Topic() {
+				t.Fatalf("Fail: got topic %d expected %d", e.Topic(), exp.Topic())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Fail: did not receive event for topic %d", exp.Topic())
+		}
+	}
+
+	select {
+	case e := <-connected.Chan():
+		if e.(*PeerConnected).PeerID != "a" {
+			t.Fatalf("Fail: got peer %s expected a", e.(*PeerConnected).PeerID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Fail: did not receive PeerConnected event")
+	}
+
+	select {
+	case e := <-connected.Chan():
+		t.Fatalf("Fail: received unexpected event %v", e)
+	default:
+	}
+}
+
+func TestBus_Unsubscribe(t *testing.T) {
+	bus := NewBus()
+
+	sub := bus.Subscribe(BlockImportedTopic)
+	if bus.Subscribers(BlockImportedTopic) != 1 {
+		t.Fatalf("Fail: got %d subscribers expected 1", bus.Subscribers(BlockImportedTopic))
+	}
+
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+
+	select {
+	case <-sub.Done():
+	default:
+		t.Fatal("Fail: subscription is not done after unsubscribing")
+	}
+
+	if bus.Subscribers(BlockImportedTopic) != 0 {
+		t.Fatalf("Fail: got %d subscribers expected 0", bus.Subscribers(BlockImportedTopic))
+	}
+}
+
+func TestBus_PublishFullBuffer(t *testing.T) {
+	bus := NewBus()
+
+	slow := bus.Subscribe(TransactionImportedTopic)
+	defer slow.Unsubscribe()
+	fast := bus.Subscribe(TransactionImportedTopic)
+	defer fast.Unsubscribe()
+
+	// fill the slow subscription's buffer, while the fast one keeps up
+	for i := 0; i < DefaultBufferSize; i++ {
+		bus.Publish(&TransactionImported{})
+		<-fast.Chan()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		bus.Publish(&TransactionImported{})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Fail: publish blocked on a full subscriber")
+	}
+
+	if slow.Dropped() != 1 {
+		t.Fatalf("Fail: got %d dropped events expected 1", slow.Dropped())
+	}
+
+	select {
+	case <-fast.Chan():
+	case <-time.After(time.Second):
+		t.Fatal("Fail: fast subscriber did not receive the event")
+	}
+}
+
+func TestBus_PublishFullBuffer_Critical(t *testing.T) {
+	bus := NewBus()
+
+	slow := bus.Subscribe(BlockImportedTopic)
+	defer slow.Unsubscribe()
+
+	// the events that do not fit into the buffer are queued, and publishing does not block
+	n := DefaultBufferSize + 10
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			bus.Publish(&BlockImported{Block: &types.Block{Header: types.BlockHeader{Number: big.NewInt(int64(i))}}})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Fail: publish blocked on a full subscriber")
+	}
+
+	for i := 0; i < n; i++ {
+		select {
+		case e := <-slow.Chan():
+			num := e.(*BlockImported).Block.Header.Number.Int64()
+			if num != int64(i) {
+				t.Fatalf("Fail: got event %d expected %d", num, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Fail: did not receive event %d", i)
+		}
+	}
+
+	if slow.Dropped() != 0 {
+		t.Fatalf("Fail: got %d dropped events expected 0", slow.Dropped())
+	}
+}
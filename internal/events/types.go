@@ -0,0 +1,172 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"github.com/ChainSafe/gossamer/common"
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/core/types"
+)
+
+// Topic identifies a kind of event
+type Topic int
+
+const (
+	BlockImportedTopic Topic = iota
+	BestBlockChangedTopic
+	BlockFinalizedTopic
+	ChainReorganisedTopic
+	BlockProducedTopic
+	TransactionImportedTopic
+	PeerConnectedTopic
+	PeerDisconnectedTopic
+	TransactionsReceivedTopic
+	BlockAnnounceReceivedTopic
+	BlockResponseReceivedTopic
+	EquivocationDetectedTopic
+	ConsensusMessageProducedTopic
+	ConsensusMessageReceivedTopic
+	JustificationReceivedTopic
+	BlockRequestProducedTopic
+)
+
+// Event is implemented by all events published on a Bus
+type Event interface {
+	Topic() Topic
+}
+
+// BlockImported is published when a block has been validated and added to the chain
+type BlockImported struct {
+	Block *types.Block
+}
+
+func (e *BlockImported) Topic() Topic { return BlockImportedTopic }
+
+// BestBlockChanged is published when the head of the best chain changes
+type BestBlockChanged struct {
+	Header *types.BlockHeader
+}
+
+func (e *BestBlockChanged) Topic() Topic { return BestBlockChangedTopic }
+
+// BlockFinalized is published when a block has been finalized
+type BlockFinalized struct {
+	Header *types.BlockHeader
+}
+
+func (e *BlockFinalized) Topic() Topic { return BlockFinalizedTopic }
+
+// ChainReorganised is published when the best chain switches to a different fork. Retracted contains the
+// blocks that are no longer part of the best chain, and Enacted the blocks that now are.
+type ChainReorganised struct {
+	Retracted []*types.Block
+	Enacted   []*types.Block
+}
+
+func (e *ChainReorganised) Topic() Topic { return ChainReorganisedTopic }
+
+// BlockProduced is published when this node has authored a block
+type BlockProduced struct {
+	Block *types.Block
+}
+
+func (e *BlockProduced) Topic() Topic { return BlockProducedTopic }
+
+// TransactionImported is published when a transaction has been validated and added to the transaction queue
+type TransactionImported struct {
+	Transaction *tx.ValidTransaction
+}
+
+func (e *TransactionImported) Topic() Topic { return TransactionImportedTopic }
+
+// PeerConnected is published when a connection to a peer is opened
+type PeerConnected struct {
+	PeerID string
+}
+
+func (e *PeerConnected) Topic() Topic { return PeerConnectedTopic }
+
+// PeerDisconnected is published when the connection to a peer is closed
+type PeerDisconnected struct {
+	PeerID string
+}
+
+func (e *PeerDisconnected) Topic() Topic { return PeerDisconnectedTopic }
+
+// TransactionsReceived is published when a peer sends us transactions
+type TransactionsReceived struct {
+	Extrinsics []types.Extrinsic
+}
+
+func (e *TransactionsReceived) Topic() Topic { return TransactionsReceivedTopic }
+
+// BlockAnnounceReceived is published when a peer announces a new block
+type BlockAnnounceReceived struct {
+	PeerID string
+	Header *types.BlockHeader
+}
+
+func (e *BlockAnnounceReceived) Topic() Topic { return BlockAnnounceReceivedTopic }
+
+// BlockResponseReceived is published when a peer responds to a block request we sent it
+type BlockResponseReceived struct {
+	ID   uint64
+	Data []byte
+}
+
+func (e *BlockResponseReceived) Topic() Topic { return BlockResponseReceivedTopic }
+
+// EquivocationDetected is published when an authority is found to have produced two blocks for the same slot
+type EquivocationDetected struct {
+	Proof *types.EquivocationProof
+}
+
+func (e *EquivocationDetected) Topic() Topic { return EquivocationDetectedTopic }
+
+// ConsensusMessageProduced is published when a consensus engine has a message to gossip to its peers
+type ConsensusMessageProduced struct {
+	EngineID types.ConsensusEngineID
+	Data     []byte
+}
+
+func (e *ConsensusMessageProduced) Topic() Topic { return ConsensusMessageProducedTopic }
+
+// ConsensusMessageReceived is published when a peer gossips a consensus engine message to us
+type ConsensusMessageReceived struct {
+	EngineID types.ConsensusEngineID
+	Data     []byte
+}
+
+func (e *ConsensusMessageReceived) Topic() Topic { return ConsensusMessageReceivedTopic }
+
+// JustificationReceived is published when a peer sends us the finality justification of a block
+type JustificationReceived struct {
+	Hash          common.Hash
+	Justification []byte
+}
+
+func (e *JustificationReceived) Topic() Topic { return JustificationReceivedTopic }
+
+// BlockRequestProduced is published when blocks are needed from a peer: up to Max blocks of the peer's chain, from
+// the block with the given hash back towards the genesis block
+type BlockRequestProduced struct {
+	PeerID string
+	Hash   common.Hash
+	Max    uint32
+}
+
+func (e *BlockRequestProduced) Topic() Topic { return BlockRequestProducedTopic }
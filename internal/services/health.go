@@ -0,0 +1,87 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package services
+
+import (
+	"strings"
+)
+
+// State describes the lifecycle state of a service
+type State string
+
+const (
+	// Stopped services have not been started, or have been stopped
+	Stopped State = "stopped"
+	// Running services have started and are working normally
+	Running State = "running"
+	// Degraded services are running but are not fully functional, eg. p2p with no peers
+	Degraded State = "degraded"
+	// Failed services have failed to start or stop, or have stopped working
+	Failed State = "failed"
+)
+
+// ServiceStatus reports the health of a service
+type ServiceStatus struct {
+	State     State                  `json:"state"`
+	LastError string                 `json:"lastError,omitempty"`
+	Metrics   map[string]interface{} `json:"metrics,omitempty"`
+}
+
+// Healthy returns true if the service is running, even if degraded
+func (s ServiceStatus) Healthy() bool {
+	return s.State == Running || s.State == Degraded
+}
+
+// HealthReporter is implemented by services that report their own health while running
+type HealthReporter interface {
+	Health() ServiceStatus
+}
+
+// Health returns the status of every registered service, keyed by service name.
+// Running services that implement HealthReporter report their own status.
+func (s *ServiceRegistry) Health() map[string]ServiceStatus {
+	s.statusLock.RLock()
+	defer s.statusLock.RUnlock()
+
+	health := make(map[string]ServiceStatus)
+	for _, typ := range s.serviceTypes {
+		status := s.status[typ]
+		if hr, ok := s.services[typ].(HealthReporter); ok && status.State == Running {
+			status = hr.Health()
+			if status.State == "" {
+				status.State = Running
+			}
+		}
+		health[serviceName(typ.String())] = status
+	}
+	return health
+}
+
+// Healthy returns true if all registered services are healthy
+func (s *ServiceRegistry) Healthy() bool {
+	for _, status := range s.Health() {
+		if !status.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+// serviceName returns the name of a service from its type, eg. "p2p.Service" for *p2p.Service
+func serviceName(typ string) string {
+	return strings.TrimPrefix(typ, "*")
+}
@@ -17,28 +17,73 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"time"
 
 	log "github.com/ChainSafe/log15"
 )
 
+// DefaultStopTimeout is the time a service is given to stop before it is abandoned
+const DefaultStopTimeout = 10 * time.Second
+
 // Service must be implemented by all services
 type Service interface {
 	Start() error
 	Stop() error
 }
 
+// DependentService is implemented by services that must be started after other services. Dependencies are
+// identified by type, e.g. returning `&p2p.Service{}` means the registered p2p service must be started first.
+type DependentService interface {
+	Service
+	Dependencies() []Service
+}
+
+// DependencyList implements DependentService for services whose dependencies are set when the node is assembled,
+// eg. because the packages of the services they depend on import their own package. It is embedded in the service.
+type DependencyList struct {
+	deps []Service
+}
+
+// DependOn adds services that must be started before the service
+func (l *DependencyList) DependOn(srvcs ...Service) {
+	l.deps = append(l.deps, srvcs...)
+}
+
+// Dependencies returns the services added with DependOn
+func (l *DependencyList) Dependencies() []Service {
+	return l.deps
+}
+
+// ContextService is implemented by services that accept a context when starting. The context is cancelled once
+// all services have been stopped, or if startup is aborted.
+type ContextService interface {
+	Service
+	StartWithContext(ctx context.Context) error
+}
+
 // ServiceRegistry is a structure to manage core system services
 type ServiceRegistry struct {
 	services     map[reflect.Type]Service // map of types to service instances
 	serviceTypes []reflect.Type           // all known service types, used to iterate through services
+	started      []reflect.Type           // services that have been started, in start order
+	cancel       context.CancelFunc       // cancels the context passed to started services
+	stopTimeout  time.Duration            // time each service is given to stop
+
+	statusLock sync.RWMutex
+	status     map[reflect.Type]ServiceStatus // lifecycle status of each service, as seen by the registry
 }
 
 // NewServiceRegistry creates an empty registry
 func NewServiceRegistry() *ServiceRegistry {
 	return &ServiceRegistry{
-		services: make(map[reflect.Type]Service),
+		services:    make(map[reflect.Type]Service),
+		stopTimeout: DefaultStopTimeout,
+		status:      make(map[reflect.Type]ServiceStatus),
 	}
 }
 
@@ -51,32 +96,169 @@ func (s *ServiceRegistry) RegisterService(service Service) {
 	}
 	s.services[kind] = service
 	s.serviceTypes = append(s.serviceTypes, kind)
+	s.setStatus(kind, Stopped, nil)
 }
 
-// StartAll calls `Service.Start()` for all registered services
-func (s *ServiceRegistry) StartAll() {
-	log.Info(fmt.Sprintf("Starting services: %v", s.serviceTypes))
-	for _, typ := range s.serviceTypes {
+// SetStopTimeout sets the time each service is given to stop before StopAll moves on to the next one
+func (s *ServiceRegistry) SetStopTimeout(timeout time.Duration) {
+	s.stopTimeout = timeout
+}
+
+// StartAll calls `Service.Start()` for all registered services, starting each service after its dependencies.
+// If a service fails to start, the services that were already started are stopped and the error is returned.
+func (s *ServiceRegistry) StartAll(ctx context.Context) error {
+	order, err := s.startOrder()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	log.Info(fmt.Sprintf("Starting services: %v", order))
+	for _, typ := range order {
+		if err = ctx.Err(); err != nil {
+			log.Error("Startup cancelled", "err", err)
+			s.abortStart()
+			return err
+		}
+
 		log.Debug(fmt.Sprintf("Starting service %v", typ))
-		err := s.services[typ].Start()
+		if cs, ok := s.services[typ].(ContextService); ok {
+			err = cs.StartWithContext(ctx)
+		} else {
+			err = s.services[typ].Start()
+		}
 		if err != nil {
 			log.Error("Error starting service", "srvc", typ, "err", err)
+			s.setStatus(typ, Failed, err)
+			s.abortStart()
+			return fmt.Errorf("failed to start service %v: %s", typ, err)
 		}
+
+		s.setStatus(typ, Running, nil)
+		s.started = append(s.started, typ)
 	}
 	log.Debug("All services started.")
+	return nil
 }
 
-// StopAll calls `Service.Stop()` for all registered services
-func (s *ServiceRegistry) StopAll() {
-	log.Info(fmt.Sprintf("Stopping services: %v", s.serviceTypes))
-	for _, typ := range s.serviceTypes {
+// abortStart stops the services that have already been started
+func (s *ServiceRegistry) abortStart() {
+	err := s.StopAll()
+	if err != nil {
+		log.Error("Error stopping services after failed startup", "err", err)
+	}
+}
+
+// StopAll calls `Service.Stop()` for all started services, in the reverse of the order they were started in.
+// Each service is given the registry's stop timeout to stop before it is abandoned.
+func (s *ServiceRegistry) StopAll() error {
+	log.Info(fmt.Sprintf("Stopping services: %v", s.started))
+
+	var failed []reflect.Type
+	for i := len(s.started) - 1; i >= 0; i-- {
+		typ := s.started[i]
 		log.Debug(fmt.Sprintf("Stopping service %v", typ))
-		err := s.services[typ].Stop()
+		err := s.stopService(s.services[typ])
 		if err != nil {
 			log.Error("Error stopping service", "srvc", typ, "err", err)
+			s.setStatus(typ, Failed, err)
+			failed = append(failed, typ)
+			continue
 		}
+		s.setStatus(typ, Stopped, nil)
+	}
+
+	s.started = nil
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
 	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("failed to stop services: %v", failed)
+	}
+
 	log.Debug("All services stopped.")
+	return nil
+}
+
+func (s *ServiceRegistry) setStatus(typ reflect.Type, state State, err error) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	status := ServiceStatus{State: state}
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	s.status[typ] = status
+}
+
+// stopService stops the service, returning an error if it does not stop within the stop timeout
+func (s *ServiceRegistry) stopService(srvc Service) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- srvc.Stop()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(s.stopTimeout):
+		return errors.New("timed out stopping service")
+	}
+}
+
+// startOrder returns the registered service types sorted so that every service comes after its dependencies.
+// Services without dependencies between them keep their registration order.
+func (s *ServiceRegistry) startOrder() ([]reflect.Type, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[reflect.Type]int)
+	order := []reflect.Type{}
+
+	var visit func(typ reflect.Type) error
+	visit = func(typ reflect.Type) error {
+		switch state[typ] {
+		case visiting:
+			return fmt.Errorf("dependency cycle detected at service %v", typ)
+		case visited:
+			return nil
+		}
+
+		state[typ] = visiting
+		if ds, ok := s.services[typ].(DependentService); ok {
+			for _, dep := range ds.Dependencies() {
+				depType := reflect.TypeOf(dep)
+				if _, exists := s.services[depType]; !exists {
+					return fmt.Errorf("service %v depends on unregistered service %v", typ, depType)
+				}
+
+				err := visit(depType)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		state[typ] = visited
+
+		order = append(order, typ)
+		return nil
+	}
+
+	for _, typ := range s.serviceTypes {
+		err := visit(typ)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
 }
 
 // Get retrieves a service and stores a reference to it in the passed in `srvc`
@@ -17,7 +17,11 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"reflect"
 	"testing"
+	"time"
 )
 
 // ------------------- Mock Services --------------------
@@ -52,6 +56,74 @@ type FakeService struct{}
 func (s *FakeService) Start() error { return nil }
 func (s *FakeService) Stop()        {}
 
+// MockSrvcC depends on MockSrvcD, and records the order in which services are started and stopped
+type MockSrvcC struct {
+	log *[]string
+}
+
+func (s *MockSrvcC) Start() error {
+	*s.log = append(*s.log, "start C")
+	return nil
+}
+func (s *MockSrvcC) Stop() error {
+	*s.log = append(*s.log, "stop C")
+	return nil
+}
+func (s *MockSrvcC) Dependencies() []Service {
+	return []Service{&MockSrvcD{}}
+}
+
+type MockSrvcD struct {
+	log *[]string
+	ctx context.Context
+}
+
+func (s *MockSrvcD) Start() error {
+	return errors.New("should be started with context")
+}
+func (s *MockSrvcD) StartWithContext(ctx context.Context) error {
+	s.ctx = ctx
+	*s.log = append(*s.log, "start D")
+	return nil
+}
+func (s *MockSrvcD) Stop() error {
+	*s.log = append(*s.log, "stop D")
+	return nil
+}
+
+type FailingService struct {
+	dep Service
+}
+
+func (s *FailingService) Start() error { return errors.New("failed to start") }
+func (s *FailingService) Stop() error  { return nil }
+func (s *FailingService) Dependencies() []Service {
+	if s.dep == nil {
+		return nil
+	}
+	return []Service{s.dep}
+}
+
+// MockSrvcE records when it is started, after the services it was set to depend on
+type MockSrvcE struct {
+	DependencyList
+	log *[]string
+}
+
+func (s *MockSrvcE) Start() error {
+	*s.log = append(*s.log, "start E")
+	return nil
+}
+func (s *MockSrvcE) Stop() error { return nil }
+
+type SlowService struct{}
+
+func (s *SlowService) Start() error { return nil }
+func (s *SlowService) Stop() error {
+	time.Sleep(time.Second)
+	return nil
+}
+
 // --------------------------------------------------------
 
 func TestServiceRegistry_RegisterService(t *testing.T) {
@@ -77,13 +149,19 @@ func TestServiceRegistry_StartStopAll(t *testing.T) {
 	r.RegisterService(a)
 	r.RegisterService(b)
 
-	r.StartAll()
+	err := r.StartAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if a.running != true || b.running != true {
 		t.Fatal("failed to start service")
 	}
 
-	r.StopAll()
+	err = r.StopAll()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if a.running != false || b.running != false {
 		t.Fatal("failed to stop service")
@@ -91,6 +169,141 @@ func TestServiceRegistry_StartStopAll(t *testing.T) {
 
 }
 
+func TestServiceRegistry_StartOrder(t *testing.T) {
+	r := NewServiceRegistry()
+
+	log := []string{}
+	c := &MockSrvcC{log: &log}
+	d := &MockSrvcD{log: &log}
+
+	// C is registered first but depends on D
+	r.RegisterService(c)
+	r.RegisterService(d)
+
+	err := r.StartAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.ctx == nil {
+		t.Fatal("context service was not started with a context")
+	}
+
+	err = r.StopAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"start D", "start C", "stop C", "stop D"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Fatalf("Fail: got %v expected %v", log, expected)
+	}
+
+	if d.ctx.Err() == nil {
+		t.Fatal("context was not cancelled after stopping services")
+	}
+}
+
+func TestServiceRegistry_DependencyList(t *testing.T) {
+	r := NewServiceRegistry()
+
+	log := []string{}
+	e := &MockSrvcE{log: &log}
+	d := &MockSrvcD{log: &log}
+	e.DependOn(d)
+
+	r.RegisterService(e)
+	r.RegisterService(d)
+
+	err := r.StartAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"start D", "start E"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Fatalf("Fail: got %v expected %v", log, expected)
+	}
+}
+
+func TestServiceRegistry_StartAll_MissingDependency(t *testing.T) {
+	r := NewServiceRegistry()
+
+	log := []string{}
+	r.RegisterService(&MockSrvcC{log: &log})
+
+	err := r.StartAll(context.Background())
+	if err == nil {
+		t.Fatal("expected error for unregistered dependency")
+	}
+	if len(log) != 0 {
+		t.Fatalf("no services should have been started, got %v", log)
+	}
+}
+
+func TestServiceRegistry_StartAll_Failure(t *testing.T) {
+	r := NewServiceRegistry()
+
+	a := &MockSrvcA{}
+	b := &MockSrvcB{}
+
+	r.RegisterService(a)
+	r.RegisterService(&FailingService{dep: a})
+	r.RegisterService(b)
+
+	err := r.StartAll(context.Background())
+	if err == nil {
+		t.Fatal("expected error starting services")
+	}
+
+	if a.running {
+		t.Fatal("service started before the failure was not stopped")
+	}
+	if b.running {
+		t.Fatal("service after the failure should not have been started")
+	}
+}
+
+func TestServiceRegistry_StartAll_Cancelled(t *testing.T) {
+	r := NewServiceRegistry()
+
+	a := &MockSrvcA{}
+	r.RegisterService(a)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := r.StartAll(ctx)
+	if err == nil {
+		t.Fatal("expected error starting services with a cancelled context")
+	}
+	if a.running {
+		t.Fatal("service should not have been started")
+	}
+}
+
+func TestServiceRegistry_StopAll_Timeout(t *testing.T) {
+	r := NewServiceRegistry()
+	r.SetStopTimeout(10 * time.Millisecond)
+
+	a := &MockSrvcA{}
+	r.RegisterService(a)
+	r.RegisterService(&SlowService{})
+
+	err := r.StartAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.StopAll()
+	if err == nil {
+		t.Fatal("expected error for service that timed out")
+	}
+	if a.running {
+		t.Fatal("services after the timed out service were not stopped")
+	}
+}
+
 func TestServiceRegistry_Get_Err(t *testing.T) {
 	r := NewServiceRegistry()
 
@@ -119,3 +332,63 @@ func TestServiceRegistry_Get_Err(t *testing.T) {
 		t.Fatalf("Expected nil. Fetched service: %T", s)
 	}
 }
+
+type ReportingService struct {
+	status ServiceStatus
+}
+
+func (s *ReportingService) Start() error          { return nil }
+func (s *ReportingService) Stop() error           { return nil }
+func (s *ReportingService) Health() ServiceStatus { return s.status }
+
+func TestServiceRegistry_Health(t *testing.T) {
+	r := NewServiceRegistry()
+
+	a := &MockSrvcA{}
+	rep := &ReportingService{status: ServiceStatus{State: Degraded, Metrics: map[string]interface{}{"peers": 0}}}
+
+	r.RegisterService(a)
+	r.RegisterService(rep)
+
+	health := r.Health()
+	if health["services.MockSrvcA"].State != Stopped || health["services.ReportingService"].State != Stopped {
+		t.Fatalf("registered services should be stopped, got %v", health)
+	}
+	if r.Healthy() {
+		t.Fatal("registry with stopped services should not be healthy")
+	}
+
+	err := r.StartAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	health = r.Health()
+	if health["services.MockSrvcA"].State != Running {
+		t.Fatalf("got state %s expected %s", health["services.MockSrvcA"].State, Running)
+	}
+	if !reflect.DeepEqual(health["services.ReportingService"], rep.status) {
+		t.Fatalf("got status %v expected %v", health["services.ReportingService"], rep.status)
+	}
+	if !r.Healthy() {
+		t.Fatal("registry with running and degraded services should be healthy")
+	}
+
+	err = r.StopAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r = NewServiceRegistry()
+	r.RegisterService(&FailingService{})
+
+	err = r.StartAll(context.Background())
+	if err == nil {
+		t.Fatal("expected error starting services")
+	}
+
+	status := r.Health()["services.FailingService"]
+	if status.State != Failed || status.LastError != "failed to start" {
+		t.Fatalf("got status %v expected failed with error", status)
+	}
+}
@@ -26,7 +26,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 
+	"github.com/ChainSafe/gossamer/common"
 	log "github.com/ChainSafe/log15"
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p-core/crypto"
@@ -52,6 +54,14 @@ type Config struct {
 	NoMdns bool
 	// Global data directory
 	DataDir string
+	// Hash of the genesis block
+	GenesisHash common.Hash
+	// Interval at which transactions are announced to peers, DefaultTxGossipInterval if 0
+	TxGossipInterval time.Duration
+	// Maximum number of transactions sent to a peer in each interval, DefaultTxGossipBatchSize if 0
+	TxGossipBatchSize int
+	// Maximum number of transactions accepted from a peer in each interval, DefaultTxReceiveLimit if 0
+	TxReceiveLimit int
 	// Identity key for node
 	privateKey crypto.PrivKey
 }
@@ -78,7 +88,9 @@ func (c *Config) buildOpts() ([]libp2p.Option, error) {
 		return nil, err
 	}
 
-	connMgr := ConnManager{}
+	connMgr := ConnManager{
+		genesisHash: c.GenesisHash,
+	}
 
 	return []libp2p.Option{
 		libp2p.ListenAddrs(addr),
@@ -29,12 +29,14 @@ import (
 
 // ConnManager implement connmgr.ConnManager
 // https://godoc.org/github.com/libp2p/go-libp2p-core/connmgr#ConnManager
-type ConnManager struct{}
+type ConnManager struct {
+	genesisHash common.Hash
+}
 
 // Notifee is used to monitor changes to a connection
 func (cm ConnManager) Notifee() net.Notifiee {
 	nb := new(net.NotifyBundle)
-	nb.ConnectedF = Connected
+	nb.ConnectedF = cm.Connected
 	nb.OpenedStreamF = OpenedStream
 	nb.ClosedStreamF = ClosedStream
 	nb.DisconnectedF = Disconnected
@@ -50,15 +52,15 @@ func (_ ConnManager) Protect(peer.ID, string)                  {}
 func (_ ConnManager) Unprotect(peer.ID, string) bool           { return false }
 func (_ ConnManager) Close() error                             { return nil }
 
-func Connected(n net.Network, c net.Conn) {
-	// TODO: replace dummy status message with current state
+func (cm ConnManager) Connected(n net.Network, c net.Conn) {
+	// TODO: replace dummy best block with current state
 	status := &StatusMessage{
 		ProtocolVersion:     0,
 		MinSupportedVersion: 0,
 		Roles:               0,
 		BestBlockNumber:     0,
 		BestBlockHash:       common.Hash{0x00},
-		GenesisHash:         common.Hash{0x00},
+		GenesisHash:         cm.genesisHash,
 		ChainStatus:         []byte{0},
 	}
 	log.Info("connected", "status", status)
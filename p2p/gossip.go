@@ -0,0 +1,216 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/core/types"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// DefaultTxGossipInterval is the default interval at which transactions are announced to peers
+	DefaultTxGossipInterval = time.Second
+	// DefaultTxGossipBatchSize is the default maximum number of transactions sent to a peer in each interval
+	DefaultTxGossipBatchSize = 256
+	// DefaultTxReceiveLimit is the default maximum number of transactions accepted from a peer in each interval
+	DefaultTxReceiveLimit = 1024
+
+	// maxPendingTxs is the maximum number of transactions waiting to be announced
+	maxPendingTxs = 8192
+	// maxKnownTxs is the maximum number of transactions remembered as known by each peer
+	maxKnownTxs = 4096
+)
+
+// knownSet is a set of hashes with a maximum size, which forgets the oldest hashes when it is full
+type knownSet struct {
+	hashes map[common.Hash]struct{}
+	order  []common.Hash
+	next   int
+}
+
+func newKnownSet(size int) *knownSet {
+	return &knownSet{
+		hashes: make(map[common.Hash]struct{}),
+		order:  make([]common.Hash, 0, size),
+	}
+}
+
+func (k *knownSet) add(hash common.Hash) {
+	if k.has(hash) {
+		return
+	}
+
+	if len(k.order) < cap(k.order) {
+		k.order = append(k.order, hash)
+	} else {
+		delete(k.hashes, k.order[k.next])
+		k.order[k.next] = hash
+		k.next = (k.next + 1) % len(k.order)
+	}
+	k.hashes[hash] = struct{}{}
+}
+
+func (k *knownSet) has(hash common.Hash) bool {
+	_, ok := k.hashes[hash]
+	return ok
+}
+
+// pendingTx is a transaction waiting to be announced to peers
+type pendingTx struct {
+	hash common.Hash
+	ext  types.Extrinsic
+}
+
+// txGossip keeps track of the transactions to announce to each peer. Transactions are announced in batches,
+// and only to peers that are not already known to have them, either because we have sent them the transaction
+// or because we have received it from them. The number of transactions accepted from each peer is limited.
+type txGossip struct {
+	lock         sync.Mutex
+	batchSize    int
+	receiveLimit int
+	pending      []*pendingTx
+	pendingSet   map[common.Hash]struct{}
+	known        map[peer.ID]*knownSet
+	received     map[peer.ID]int // number of transactions received from each peer in the current interval
+}
+
+func newTxGossip(batchSize, receiveLimit int) *txGossip {
+	return &txGossip{
+		batchSize:    batchSize,
+		receiveLimit: receiveLimit,
+		pendingSet:   make(map[common.Hash]struct{}),
+		known:        make(map[peer.ID]*knownSet),
+		received:     make(map[peer.ID]int),
+	}
+}
+
+// add queues a transaction to be announced to peers
+func (g *txGossip) add(ext types.Extrinsic) error {
+	hash, err := common.Blake2bHash(ext)
+	if err != nil {
+		return err
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if _, ok := g.pendingSet[hash]; ok {
+		return nil
+	}
+
+	if len(g.pending) == maxPendingTxs {
+		delete(g.pendingSet, g.pending[0].hash)
+		g.pending = g.pending[1:]
+	}
+
+	g.pending = append(g.pending, &pendingTx{hash: hash, ext: ext})
+	g.pendingSet[hash] = struct{}{}
+	return nil
+}
+
+// receive records the transactions received from a peer as known by it, and returns the transactions that are
+// within the peer's limit for the current interval
+func (g *txGossip) receive(p peer.ID, exts []types.Extrinsic) ([]types.Extrinsic, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	allowed := g.receiveLimit - g.received[p]
+	if allowed <= 0 {
+		return nil, nil
+	}
+	if len(exts) > allowed {
+		exts = exts[:allowed]
+	}
+	g.received[p] += len(exts)
+
+	known := g.knownBy(p)
+	for _, ext := range exts {
+		hash, err := common.Blake2bHash(ext)
+		if err != nil {
+			return nil, err
+		}
+		known.add(hash)
+	}
+
+	return exts, nil
+}
+
+// batches returns the transactions to announce to each of the given peers, and resets the peers' receive limits.
+// Transactions stay pending until every peer knows them.
+func (g *txGossip) batches(peers []peer.ID) map[peer.ID][]types.Extrinsic {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.received = make(map[peer.ID]int)
+
+	batches := make(map[peer.ID][]types.Extrinsic)
+	if len(peers) == 0 {
+		return batches
+	}
+
+	for _, p := range peers {
+		known := g.knownBy(p)
+		for _, ptx := range g.pending {
+			if len(batches[p]) == g.batchSize {
+				break
+			}
+			if !known.has(ptx.hash) {
+				known.add(ptx.hash)
+				batches[p] = append(batches[p], ptx.ext)
+			}
+		}
+	}
+
+	var pending []*pendingTx
+	for _, ptx := range g.pending {
+		for _, p := range peers {
+			if !g.known[p].has(ptx.hash) {
+				pending = append(pending, ptx)
+				break
+			}
+		}
+	}
+
+	g.pending = pending
+	g.pendingSet = make(map[common.Hash]struct{})
+	for _, ptx := range g.pending {
+		g.pendingSet[ptx.hash] = struct{}{}
+	}
+
+	return batches
+}
+
+// removePeer forgets the transactions known by a disconnected peer
+func (g *txGossip) removePeer(p peer.ID) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	delete(g.known, p)
+	delete(g.received, p)
+}
+
+func (g *txGossip) knownBy(p peer.ID) *knownSet {
+	known, ok := g.known[p]
+	if !ok {
+		known = newKnownSet(maxKnownTxs)
+		g.known[p] = known
+	}
+	return known
+}
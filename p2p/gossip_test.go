@@ -0,0 +1,132 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/core/types"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestKnownSet(t *testing.T) {
+	known := newKnownSet(2)
+	hashes := []common.Hash{{1}, {2}, {3}}
+
+	for _, hash := range hashes {
+		known.add(hash)
+	}
+
+	// the oldest hash is forgotten
+	if known.has(hashes[0]) {
+		t.Fatalf("Fail: expected %s to be forgotten", hashes[0])
+	}
+	for _, hash := range hashes[1:] {
+		if !known.has(hash) {
+			t.Fatalf("Fail: expected %s to be known", hash)
+		}
+	}
+}
+
+func TestTxGossip_Batches(t *testing.T) {
+	g := newTxGossip(2, 16)
+	peerA, peerB := peer.ID("a"), peer.ID("b")
+	exts := []types.Extrinsic{{1}, {2}, {3}}
+
+	for _, ext := range exts {
+		err := g.add(ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// peer B has already sent us the first transaction
+	_, err := g.receive(peerB, exts[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batches := g.batches([]peer.ID{peerA, peerB})
+	expected := map[peer.ID][]types.Extrinsic{
+		peerA: exts[:2],
+		peerB: exts[1:],
+	}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Fatalf("Fail: got %v expected %v", batches, expected)
+	}
+
+	// the transaction that didn't fit in peer A's batch is sent in the next one
+	batches = g.batches([]peer.ID{peerA, peerB})
+	expected = map[peer.ID][]types.Extrinsic{
+		peerA: exts[2:],
+	}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Fatalf("Fail: got %v expected %v", batches, expected)
+	}
+
+	if len(g.pending) != 0 {
+		t.Fatalf("Fail: got %d pending transactions expected 0", len(g.pending))
+	}
+}
+
+func TestTxGossip_ReceiveLimit(t *testing.T) {
+	g := newTxGossip(2, 2)
+	p := peer.ID("a")
+	exts := []types.Extrinsic{{1}, {2}, {3}}
+
+	res, err := g.receive(p, exts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, exts[:2]) {
+		t.Fatalf("Fail: got %v expected %v", res, exts[:2])
+	}
+
+	res, err = g.receive(p, exts[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Fatalf("Fail: got %v expected no transactions", res)
+	}
+
+	// the limit is reset every interval
+	g.batches([]peer.ID{p})
+
+	res, err = g.receive(p, exts[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, exts[2:]) {
+		t.Fatalf("Fail: got %v expected %v", res, exts[2:])
+	}
+}
+
+func TestReadLEB128(t *testing.T) {
+	for _, length := range []uint64{0, 1, 127, 128, 300, maxMessageSize} {
+		res, err := readLEB128(bytes.NewReader(Uint64ToLEB128(length)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != length {
+			t.Fatalf("Fail: got %d expected %d", res, length)
+		}
+	}
+}
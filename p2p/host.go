@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/ChainSafe/gossamer/common"
 	"github.com/ethereum/go-ethereum/log"
 	ds "github.com/ipfs/go-datastore"
 	dsync "github.com/ipfs/go-datastore/sync"
@@ -163,7 +162,7 @@ func (h *host) send(peer core.PeerAddrInfo, msg []byte) (err error) {
 	}
 
 	// Write length of message, and then message
-	_, err = stream.Write(common.Uint16ToBytes(uint16(len(msg)))[0:1])
+	_, err = stream.Write(Uint64ToLEB128(uint64(len(msg))))
 	if err != nil {
 		log.Error("fail to send message", "error", err)
 		return err
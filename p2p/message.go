@@ -17,6 +17,7 @@
 package p2p
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -47,6 +48,9 @@ const (
 	ChainSpecificMsgType = 255
 )
 
+// maxMessageSize is the maximum length of a message received from a peer
+const maxMessageSize = 16 * 1024 * 1024
+
 type Message interface {
 	Encode() ([]byte, error)
 	Decode(io.Reader) error
@@ -79,6 +83,9 @@ func DecodeMessage(r io.Reader) (m Message, err error) {
 	case TransactionMsgType:
 		m = new(TransactionMessage)
 		err = m.Decode(r)
+	case ConsensusMsgType:
+		m = new(ConsensusMessage)
+		err = m.Decode(r)
 	default:
 		return nil, errors.New("unsupported message type")
 	}
@@ -332,7 +339,7 @@ func (bm *BlockAnnounceMessage) Id() string {
 
 type BlockResponseMessage struct {
 	ID   uint64
-	Data []byte // TODO: change this to BlockData type
+	Data []byte // SCALE encoded list of the block data of the requested blocks, see types.DecodeBlockDataArray
 }
 
 func (bm *BlockResponseMessage) GetType() int {
@@ -417,16 +424,15 @@ func (tm *TransactionMessage) Decode(r io.Reader) error {
 	if err != nil {
 		return err
 	}
-	messageSize := len(decodedMessage.([]byte))
-	bytesProcessed := 0
 	// loop through the message decoding extrinsics until they have all been decoded
-	for bytesProcessed < messageSize {
-		decodedExtrinsic, err := scale.Decode(decodedMessage.([]byte)[bytesProcessed:], []byte{})
+	buf := bytes.NewReader(decodedMessage.([]byte))
+	extDecoder := scale.Decoder{Reader: buf}
+	for buf.Len() > 0 {
+		decodedExtrinsic, err := extDecoder.DecodeByteArray()
 		if err != nil {
 			return err
 		}
-		bytesProcessed = bytesProcessed + len(decodedExtrinsic.([]byte)) + 1 // add 1 to processed since the first decode byte is consumed during decoding
-		tm.Extrinsics = append(tm.Extrinsics, decodedExtrinsic.([]byte))
+		tm.Extrinsics = append(tm.Extrinsics, decodedExtrinsic)
 	}
 
 	return nil
@@ -446,6 +452,56 @@ func (tm *TransactionMessage) Id() string {
 	return hash.String()
 }
 
+// ConsensusMessage is a message of a consensus engine, such as a GRANDPA vote, gossiped between peers
+type ConsensusMessage struct {
+	ConsensusEngineID types.ConsensusEngineID
+	Data              []byte
+}
+
+func (cm *ConsensusMessage) GetType() int {
+	return ConsensusMsgType
+}
+
+func (cm *ConsensusMessage) String() string {
+	return fmt.Sprintf("ConsensusMessage ConsensusEngineID=%s Data=0x%x", cm.ConsensusEngineID[:], cm.Data)
+}
+
+// Encode encodes the message type, the consensus engine ID and the SCALE encoded data
+func (cm *ConsensusMessage) Encode() ([]byte, error) {
+	encData, err := scale.Encode(cm.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := append([]byte{ConsensusMsgType}, cm.ConsensusEngineID[:]...)
+	return append(enc, encData...), nil
+}
+
+// Decode decodes the message into a ConsensusMessage, it assumes the type byte has been removed
+func (cm *ConsensusMessage) Decode(r io.Reader) error {
+	_, err := io.ReadFull(r, cm.ConsensusEngineID[:])
+	if err != nil {
+		return err
+	}
+
+	sd := scale.Decoder{Reader: r}
+	cm.Data, err = sd.DecodeByteArray()
+	return err
+}
+
+// Id returns the Hash of ConsensusMessage
+func (cm *ConsensusMessage) Id() string {
+	encMsg, err := cm.Encode()
+	if err != nil {
+		return ""
+	}
+	hash, err := common.Blake2bHash(encMsg)
+	if err != nil {
+		return ""
+	}
+	return hash.String()
+}
+
 func readByte(r io.Reader) (byte, error) {
 	buf := make([]byte, 1)
 	_, err := r.Read(buf)
@@ -601,3 +601,33 @@ func TestDecodeTransactionMessageTwoExtrinsics(t *testing.T) {
 		t.Fatalf("Fail: got: %v expected %v", *decodedMessage, expected)
 	}
 }
+
+func TestEncodeDecodeConsensusMessage(t *testing.T) {
+	msg := &ConsensusMessage{
+		ConsensusEngineID: types.GrandpaEngineID,
+		Data:              []byte{0x01, 0x02, 0x03},
+	}
+
+	enc, err := msg.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := common.HexToBytes("0x0546524e4b0c010203")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(enc, expected) {
+		t.Fatalf("Fail: got %x expected %x", enc, expected)
+	}
+
+	decoded, err := DecodeMessage(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, msg) {
+		t.Fatalf("Fail: got %v expected %v", decoded, msg)
+	}
+}
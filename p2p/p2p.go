@@ -18,52 +18,89 @@ package p2p
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 
+	"github.com/ChainSafe/gossamer/common"
+
+	"github.com/ChainSafe/gossamer/core/types"
 	module "github.com/ChainSafe/gossamer/internal/api/modules"
+	"github.com/ChainSafe/gossamer/internal/events"
 	"github.com/ChainSafe/gossamer/internal/services"
 	log "github.com/ChainSafe/log15"
 
 	net "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
 var _ services.Service = &Service{}
+var _ services.HealthReporter = &Service{}
+
+// maxSeenMsgs is the maximum number of broadcast messages of each type remembered, so they are not broadcast again
+const maxSeenMsgs = 8192
 
 // Service describes a p2p service, including host and dht
 type Service struct {
 	ctx  context.Context
 	host *host
 
-	msgSendChan      chan<- []byte
-	msgRecChan       <-chan BlockAnnounceMessage
-	blockReqRec      map[string]bool
-	blockRespRec     map[string]bool
-	blockAnnounceRec map[string]bool
-	txMessageRec     map[string]bool
+	bus              *events.Bus
+	blockSub         *events.Subscription
+	txSub            *events.Subscription
+	consensusSub     *events.Subscription
+	requestSub       *events.Subscription
+	txGossip         *txGossip
+	txGossipInterval time.Duration
+	blockSource      BlockSource
+	requester        *blockRequester
+
+	seenLock sync.Mutex
+	seen     map[int]*knownSet // hashes of the IDs of the broadcast messages of each type
 }
 
-// NewService creates a new p2p.Service using the service config. It initializes the host and dht
-func NewService(conf *Config, msgSendChan chan<- []byte, msgRecChan <-chan BlockAnnounceMessage) (*Service, error) {
+// NewService creates a new p2p.Service using the service config. It initializes the host and dht.
+// Messages received from peers are published on the event bus.
+func NewService(conf *Config, bus *events.Bus) (*Service, error) {
 	ctx := context.Background()
 	h, err := newHost(ctx, conf)
 	if err != nil {
 		return nil, err
 	}
 
+	interval := conf.TxGossipInterval
+	if interval == 0 {
+		interval = DefaultTxGossipInterval
+	}
+	batchSize := conf.TxGossipBatchSize
+	if batchSize == 0 {
+		batchSize = DefaultTxGossipBatchSize
+	}
+	receiveLimit := conf.TxReceiveLimit
+	if receiveLimit == 0 {
+		receiveLimit = DefaultTxReceiveLimit
+	}
+
 	s := &Service{
-		ctx:         ctx,
-		host:        h,
-		msgSendChan: msgSendChan,
-		msgRecChan:  msgRecChan,
+		ctx:              ctx,
+		host:             h,
+		bus:              bus,
+		txGossip:         newTxGossip(batchSize, receiveLimit),
+		txGossipInterval: interval,
+		requester:        newBlockRequester(),
+		seen:             make(map[int]*knownSet),
 	}
 
 	h.registerStreamHandler(s.handleStream)
-
-	s.blockReqRec = make(map[string]bool)
-	s.blockRespRec = make(map[string]bool)
-	s.blockAnnounceRec = make(map[string]bool)
-	s.txMessageRec = make(map[string]bool)
+	h.h.Network().Notify(&net.NotifyBundle{
+		ConnectedF:    s.peerConnected,
+		DisconnectedF: s.peerDisconnected,
+	})
 
 	return s, err
 }
@@ -76,11 +113,23 @@ func (s *Service) Start() error {
 
 	log.Info("Listening for connections...")
 
-	log.Debug("Starting Message Polling for Block Announce Messages from BABE")
+	if s.bus != nil {
+		log.Debug("Subscribing to blocks produced by BABE")
+		s.blockSub = s.bus.Subscribe(events.BlockProducedTopic)
+		go s.handleBlockProduced(s.blockSub)
+
+		log.Debug("Subscribing to imported transactions")
+		s.txSub = s.bus.Subscribe(events.TransactionImportedTopic)
+		go s.handleTransactions(s.txSub)
 
-	e := make(chan error)
+		log.Debug("Subscribing to consensus messages")
+		s.consensusSub = s.bus.Subscribe(events.ConsensusMessageProducedTopic)
+		go s.handleConsensusMessages(s.consensusSub)
 
-	go s.MsgRecPoll(e)
+		log.Debug("Subscribing to block requests")
+		s.requestSub = s.bus.Subscribe(events.BlockRequestProducedTopic)
+		go s.handleBlockRequests(s.requestSub)
+	}
 
 	return nil
 }
@@ -92,60 +141,127 @@ func (s *Service) Stop() error {
 		log.Error("error closing host", "err", err)
 	}
 
-	if s.msgSendChan != nil {
-		close(s.msgSendChan)
+	if s.blockSub != nil {
+		s.blockSub.Unsubscribe()
+	}
+
+	if s.txSub != nil {
+		s.txSub.Unsubscribe()
+	}
+
+	if s.consensusSub != nil {
+		s.consensusSub.Unsubscribe()
+	}
+
+	if s.requestSub != nil {
+		s.requestSub.Unsubscribe()
 	}
 
 	return nil
 }
 
-// MsgRecPoll starts polling the msgRecChan channel for any blocks
-func (s *Service) MsgRecPoll(e chan error) {
+// handleBlockProduced announces every block produced by BABE to our peers
+func (s *Service) handleBlockProduced(sub *events.Subscription) {
+	for {
+		select {
+		case e := <-sub.Chan():
+			block := e.(*events.BlockProduced).Block
+			log.Info(s.host.hostAddr.String()+" received block", "number", block.Header.Number)
+
+			blockAnnounceMsg := &BlockAnnounceMessage{
+				ParentHash:     block.Header.ParentHash,
+				Number:         block.Header.Number,
+				StateRoot:      block.Header.StateRoot,
+				ExtrinsicsRoot: block.Header.ExtrinsicsRoot,
+				Digest:         block.Header.Digest,
+			}
+
+			err := s.Broadcast(blockAnnounceMsg)
+			if err != nil {
+				log.Error("failed to broadcast block announce", "error", err)
+			}
+		case <-sub.Done():
+			return
+		}
+	}
+}
+
+// handleTransactions queues imported transactions that should be propagated, and announces them to our peers
+// in batches every gossip interval
+func (s *Service) handleTransactions(sub *events.Subscription) {
+	ticker := time.NewTicker(s.txGossipInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-sub.Chan():
+			vt := e.(*events.TransactionImported).Transaction
+			if !vt.Validity.Propagate {
+				continue
+			}
+
+			err := s.txGossip.add(*vt.Extrinsic)
+			if err != nil {
+				log.Error("failed to queue transaction for gossip", "error", err)
+			}
+		case <-ticker.C:
+			s.gossipTransactions()
+		case <-sub.Done():
+			return
+		}
+	}
+}
+
+// handleConsensusMessages gossips the messages of consensus engines, such as GRANDPA votes, to our peers
+func (s *Service) handleConsensusMessages(sub *events.Subscription) {
 	for {
-		// Receives block from babe
-		blockAnnounceMsg := <-s.msgRecChan
-		msg := s.host.hostAddr.String() + " received block"
-		log.Info(msg, "block", blockAnnounceMsg)
+		select {
+		case e := <-sub.Chan():
+			ev := e.(*events.ConsensusMessageProduced)
+			err := s.Broadcast(&ConsensusMessage{ConsensusEngineID: ev.EngineID, Data: ev.Data})
+			if err != nil {
+				log.Error("failed to broadcast consensus message", "error", err)
+			}
+		case <-sub.Done():
+			return
+		}
+	}
+}
+
+// gossipTransactions sends each peer a message with the pending transactions it doesn't know yet
+func (s *Service) gossipTransactions() {
+	batches := s.txGossip.batches(s.host.h.Network().Peers())
+	for p, exts := range batches {
+		msg := &TransactionMessage{Extrinsics: exts}
+		encMsg, err := msg.Encode()
+		if err != nil {
+			log.Error("failed to encode transaction message", "error", err)
+			continue
+		}
 
-		// Broadcast the received message
-		err := s.Broadcast(&blockAnnounceMsg)
+		err = s.host.send(s.host.dht.FindLocal(p), encMsg)
 		if err != nil {
-			e <- err
-			break
+			log.Debug("failed to send transactions", "peer", p, "error", err)
 		}
 	}
 }
 
 // Broadcast sends a message to all peers
 func (s *Service) Broadcast(msg Message) (err error) {
-	//If the node hasn't received the message yet, add it to a list of received messages & rebroadcast it
+	// messages already broadcast are not broadcast again
 	msgType := msg.GetType()
 	switch msgType {
-	case BlockRequestMsgType:
-		if s.blockReqRec[msg.Id()] {
-			return nil
-		}
-		s.blockReqRec[msg.Id()] = true
-	case BlockResponseMsgType:
-		if s.blockRespRec[msg.Id()] {
-			return nil
-		}
-		s.blockRespRec[msg.Id()] = true
-	case BlockAnnounceMsgType:
-		if s.blockAnnounceRec[msg.Id()] {
-			return nil
-		}
-		s.blockAnnounceRec[msg.Id()] = true
-	case TransactionMsgType:
-		if s.txMessageRec[msg.Id()] {
-			return nil
-		}
-		s.txMessageRec[msg.Id()] = true
+	case BlockAnnounceMsgType, TransactionMsgType, ConsensusMsgType:
 	default:
 		log.Error("Invalid message type", "type", msgType)
 		return nil
 	}
 
+	first, err := s.markSeen(msgType, msg.Id())
+	if err != nil || !first {
+		return err
+	}
+
 	encodedMsg, err := msg.Encode()
 	if err != nil {
 		return err
@@ -156,24 +272,109 @@ func (s *Service) Broadcast(msg Message) (err error) {
 	return err
 }
 
-// handleStream handles the stream, and rebroadcasts the message based on it's type
+// markSeen remembers the ID of a message of the given type, and returns false if it was already seen. Only the
+// most recent maxSeenMsgs IDs of each type are remembered.
+func (s *Service) markSeen(msgType int, id string) (bool, error) {
+	hash, err := common.Blake2bHash([]byte(id))
+	if err != nil {
+		return false, err
+	}
+
+	s.seenLock.Lock()
+	defer s.seenLock.Unlock()
+
+	set, ok := s.seen[msgType]
+	if !ok {
+		set = newKnownSet(maxSeenMsgs)
+		s.seen[msgType] = set
+	}
+
+	if set.has(hash) {
+		return false, nil
+	}
+	set.add(hash)
+	return true, nil
+}
+
+// handleStream handles the stream, and rebroadcasts block announcements and consensus messages
 func (s *Service) handleStream(stream net.Stream) {
+	from := stream.Conn().RemotePeer()
 	msg, rawMsg, err := parseMessage(stream)
 
 	if err != nil {
 		return
 	}
 
-	// Write the message back to channel
-	s.msgSendChan <- rawMsg
+	log.Trace("received message", "msg", fmt.Sprintf("0x%x", rawMsg))
 
-	// Rebroadcast all messages except for status messages
-	if msg.GetType() != StatusMsgType {
-		err = s.Broadcast(msg)
+	switch m := msg.(type) {
+	case *TransactionMessage:
+		// Transactions are only propagated once they have been validated and imported
+		exts, err := s.txGossip.receive(from, m.Extrinsics)
+		if err != nil {
+			log.Error("failed to receive transactions", "error", err)
+			return
+		}
+
+		if len(exts) < len(m.Extrinsics) {
+			log.Debug("dropped transactions over peer's limit", "peer", from, "dropped", len(m.Extrinsics)-len(exts))
+		}
+		if len(exts) > 0 {
+			s.publish(from, &TransactionMessage{Extrinsics: exts})
+		}
+	case *BlockRequestMessage:
+		// Block requests are answered with the blocks of the block source
+		s.handleBlockRequest(from, m)
+	case *BlockResponseMessage:
+		// Only the responses to our own requests are imported
+		if !s.requester.complete(from, m.ID) {
+			log.Debug("dropping unsolicited block response", "peer", from, "id", m.ID)
+			return
+		}
+		s.publish(from, m)
+	case *BlockAnnounceMessage, *ConsensusMessage:
+		s.publish(from, m)
+
+		err = s.Broadcast(m)
 		if err != nil {
 			log.Debug("failed to broadcast message: ", err)
+		}
+	}
+}
+
+// publish converts a message received from a peer into an event and publishes it on the bus
+func (s *Service) publish(from peer.ID, msg Message) {
+	if s.bus == nil {
+		return
+	}
+
+	switch m := msg.(type) {
+	case *TransactionMessage:
+		s.bus.Publish(&events.TransactionsReceived{Extrinsics: m.Extrinsics})
+	case *BlockAnnounceMessage:
+		header, err := types.NewHeader(m.ParentHash, m.Number, m.StateRoot, m.ExtrinsicsRoot, m.Digest)
+		if err != nil {
+			log.Error("failed to create header from block announce", "error", err)
 			return
 		}
+		s.bus.Publish(&events.BlockAnnounceReceived{PeerID: from.String(), Header: header})
+	case *BlockResponseMessage:
+		s.bus.Publish(&events.BlockResponseReceived{ID: m.ID, Data: m.Data})
+	case *ConsensusMessage:
+		s.bus.Publish(&events.ConsensusMessageReceived{EngineID: m.ConsensusEngineID, Data: m.Data})
+	}
+}
+
+func (s *Service) peerConnected(n net.Network, c net.Conn) {
+	if s.bus != nil {
+		s.bus.Publish(&events.PeerConnected{PeerID: c.RemotePeer().String()})
+	}
+}
+
+func (s *Service) peerDisconnected(n net.Network, c net.Conn) {
+	s.txGossip.removePeer(c.RemotePeer())
+	if s.bus != nil {
+		s.bus.Publish(&events.PeerDisconnected{PeerID: c.RemotePeer().String()})
 	}
 }
 
@@ -199,6 +400,24 @@ func (s *Service) NoBootstrapping() bool {
 	return s.host.noBootstrap
 }
 
+// Health reports the service as degraded if it has no peers while bootstrapping is enabled
+func (s *Service) Health() services.ServiceStatus {
+	peers := s.PeerCount()
+	status := services.ServiceStatus{
+		State: services.Running,
+		Metrics: map[string]interface{}{
+			"peers": peers,
+		},
+	}
+
+	if peers == 0 && !s.NoBootstrapping() {
+		status.State = services.Degraded
+		status.LastError = "no connected peers"
+	}
+
+	return status
+}
+
 // parseMessage reads message length, message type, decodes message based on type, and returns the decoded message
 func parseMessage(stream net.Stream) (Message, []byte, error) {
 	defer func() {
@@ -209,25 +428,22 @@ func parseMessage(stream net.Stream) (Message, []byte, error) {
 
 	log.Debug("got stream", "peer", stream.Conn().RemotePeer())
 
-	rw := bufio.NewReadWriter(bufio.NewReader(stream), bufio.NewWriter(stream))
-	lengthByte, err := rw.Reader.ReadByte()
+	r := bufio.NewReader(stream)
+	length, err := readLEB128(r)
 	if err != nil {
 		log.Error("failed to read message length", "peer", stream.Conn().RemotePeer(), "error", err)
 		return nil, nil, err
 	}
 
-	// decode message length using LEB128
-	length := LEB128ToUint64([]byte{lengthByte})
-
-	// read message type byte
-	msgType, err := rw.Reader.Peek(1)
-	if err != nil {
-		log.Error("failed to read message type", "err", err)
+	if length == 0 || length > maxMessageSize {
+		err = fmt.Errorf("invalid message length %d", length)
+		log.Error("failed to read message", "peer", stream.Conn().RemotePeer(), "error", err)
 		return nil, nil, err
 	}
 
 	// read entire message
-	rawMsg, err := rw.Reader.Peek(int(length))
+	rawMsg := make([]byte, length)
+	_, err = io.ReadFull(r, rawMsg)
 	if err != nil {
 		log.Error("failed to read message", "err", err)
 		return nil, nil, err
@@ -236,13 +452,32 @@ func parseMessage(stream net.Stream) (Message, []byte, error) {
 	log.Debug("got stream", "peer", stream.Conn().RemotePeer(), "msg", fmt.Sprintf("0x%x", rawMsg))
 
 	// decode message
-	msg, err := DecodeMessage(rw.Reader)
+	msg, err := DecodeMessage(bytes.NewReader(rawMsg))
 	if err != nil {
 		log.Error("failed to decode message", "error", err)
 		return nil, nil, err
 	}
 
-	log.Debug("got message", "peer", stream.Conn().RemotePeer(), "type", msgType, "msg", msg.String())
+	log.Debug("got message", "peer", stream.Conn().RemotePeer(), "type", rawMsg[0], "msg", msg.String())
 
 	return msg, rawMsg, nil
 }
+
+// readLEB128 reads a LEB128 encoded length prefix
+func readLEB128(r io.ByteReader) (uint64, error) {
+	var buf []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		buf = append(buf, b)
+
+		if b&0x80 == 0 {
+			return LEB128ToUint64(buf), nil
+		}
+		if len(buf) == binary.MaxVarintLen64 {
+			return 0, errors.New("message length overflows uint64")
+		}
+	}
+}
@@ -23,19 +23,21 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/ChainSafe/gossamer/common"
-	"github.com/ChainSafe/gossamer/common/optional"
-	net "github.com/libp2p/go-libp2p-core/network"
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/events"
+	"github.com/ChainSafe/gossamer/internal/services"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	ps "github.com/libp2p/go-libp2p-core/peerstore"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
-func startNewService(t *testing.T, cfg *Config, msgSendChan chan []byte, msgRecChan chan BlockAnnounceMessage) *Service {
-	node, err := NewService(cfg, msgSendChan, msgRecChan)
+func startNewService(t *testing.T, cfg *Config, bus *events.Bus) *Service {
+	node, err := NewService(cfg, bus)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -100,7 +102,11 @@ func TestBootstrapConnect(t *testing.T) {
 		NoMdns:         true,
 	}
 
-	bootnode := startNewService(t, bootnodeCfg, nil, nil)
+	bootnodeBus := events.NewBus()
+	sub := bootnodeBus.Subscribe(events.PeerConnectedTopic)
+	defer sub.Unsubscribe()
+
+	bootnode := startNewService(t, bootnodeCfg, bootnodeBus)
 	defer bootnode.Stop()
 	bootnodeAddr := bootnode.host.fullAddrs()[0]
 
@@ -112,7 +118,7 @@ func TestBootstrapConnect(t *testing.T) {
 		NoMdns:         true,
 	}
 
-	node := startNewService(t, nodeCfg, nil, nil)
+	node := startNewService(t, nodeCfg, nil)
 	defer node.Stop()
 	// Allow everything to finish connecting
 	time.Sleep(1 * time.Second)
@@ -120,6 +126,15 @@ func TestBootstrapConnect(t *testing.T) {
 	if bootnode.host.peerCount() != 1 {
 		t.Errorf("expected peer count: %d got: %d", 1, bootnode.host.peerCount())
 	}
+
+	select {
+	case e := <-sub.Chan():
+		if e.(*events.PeerConnected).PeerID != node.ID() {
+			t.Errorf("expected connected peer: %s got: %s", node.ID(), e.(*events.PeerConnected).PeerID)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("did not receive PeerConnected event")
+	}
 }
 
 func TestNoBootstrap(t *testing.T) {
@@ -129,10 +144,30 @@ func TestNoBootstrap(t *testing.T) {
 		RandSeed:    1,
 	}
 
-	sa := startNewService(t, testServiceConfigA, nil, nil)
+	sa := startNewService(t, testServiceConfigA, nil)
 	sa.Stop()
 }
 
+func TestService_Health(t *testing.T) {
+	testServiceConfigA := &Config{
+		NoBootstrap: false,
+		NoMdns:      true,
+		Port:        7007,
+		RandSeed:    1,
+	}
+
+	sa := startNewService(t, testServiceConfigA, nil)
+	defer sa.Stop()
+
+	status := sa.Health()
+	if status.State != services.Degraded {
+		t.Fatalf("expected state: %s got: %s", services.Degraded, status.State)
+	}
+	if status.Metrics["peers"] != 0 {
+		t.Fatalf("expected peers: %d got: %v", 0, status.Metrics["peers"])
+	}
+}
+
 func TestService_PeerCount(t *testing.T) {
 	testServiceConfigA := &Config{
 		NoBootstrap: true,
@@ -140,7 +175,7 @@ func TestService_PeerCount(t *testing.T) {
 		RandSeed:    1,
 	}
 
-	sa := startNewService(t, testServiceConfigA, nil, nil)
+	sa := startNewService(t, testServiceConfigA, nil)
 	defer sa.Stop()
 
 	testServiceConfigB := &Config{
@@ -149,7 +184,7 @@ func TestService_PeerCount(t *testing.T) {
 		RandSeed:    2,
 	}
 
-	sb := startNewService(t, testServiceConfigB, nil, nil)
+	sb := startNewService(t, testServiceConfigB, nil)
 	defer sb.Stop()
 
 	sb.host.h.Peerstore().AddAddrs(sa.host.h.ID(), sa.host.h.Addrs(), ps.PermanentAddrTTL)
@@ -182,7 +217,7 @@ func TestPing(t *testing.T) {
 		DataDir:     path.Join(os.TempDir(), "gossamer"),
 	}
 
-	sa := startNewService(t, testServiceConfigA, nil, nil)
+	sa := startNewService(t, testServiceConfigA, nil)
 	defer sa.Stop()
 
 	testServiceConfigB := &Config{
@@ -192,8 +227,7 @@ func TestPing(t *testing.T) {
 		DataDir:     path.Join(os.TempDir(), "gossamer2"),
 	}
 
-	msgChan := make(chan []byte)
-	sb := startNewService(t, testServiceConfigB, msgChan, nil)
+	sb := startNewService(t, testServiceConfigB, nil)
 	defer sb.Stop()
 
 	sb.host.h.Peerstore().AddAddrs(sa.host.h.ID(), sa.host.h.Addrs(), ps.PermanentAddrTTL)
@@ -226,7 +260,7 @@ func TestSend(t *testing.T) {
 		DataDir:     path.Join(os.TempDir(), "gossamer"),
 	}
 
-	sa := startNewService(t, testServiceConfigA, nil, nil)
+	sa := startNewService(t, testServiceConfigA, nil)
 	defer sa.Stop()
 
 	testServiceConfigB := &Config{
@@ -236,8 +270,11 @@ func TestSend(t *testing.T) {
 		DataDir:     path.Join(os.TempDir(), "gossamer2"),
 	}
 
-	msgChan := make(chan []byte)
-	sb := startNewService(t, testServiceConfigB, msgChan, nil)
+	bus := events.NewBus()
+	sub := bus.Subscribe(events.BlockAnnounceReceivedTopic)
+	defer sub.Unsubscribe()
+
+	sb := startNewService(t, testServiceConfigB, bus)
 	defer sb.Stop()
 
 	sb.host.h.Peerstore().AddAddrs(sa.host.h.ID(), sa.host.h.Addrs(), ps.PermanentAddrTTL)
@@ -261,18 +298,8 @@ func TestSend(t *testing.T) {
 		t.Fatalf("could not find peer: %s", err)
 	}
 
-	endBlock, err := common.HexToHash("0xfd19d9ebac759c993fd2e05a1cff9e757d8741c2704c8682c15b5503496b6aa1")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	bm := &BlockRequestMessage{
-		ID:            7,
-		RequestedData: 1,
-		StartingBlock: []byte{1, 1},
-		EndBlockHash:  optional.NewHash(true, endBlock),
-		Direction:     1,
-		Max:           optional.NewUint32(true, 1),
+	bm := &BlockAnnounceMessage{
+		Number: big.NewInt(7),
 	}
 
 	encMsg, err := bm.Encode()
@@ -286,7 +313,11 @@ func TestSend(t *testing.T) {
 	}
 
 	select {
-	case <-msgChan:
+	case e := <-sub.Chan():
+		res := e.(*events.BlockAnnounceReceived).Header
+		if res.Number.Cmp(bm.Number) != 0 {
+			t.Fatalf("Didn't receive the correct message\ngot: %+v\nexpected: %+v", res, bm)
+		}
 	case <-time.After(30 * time.Second):
 		t.Fatalf("Did not receive message from %s", sa.host.hostAddr)
 	}
@@ -302,7 +333,7 @@ func TestGossiping(t *testing.T) {
 		RandSeed:       1,
 	}
 
-	nodeA := startNewService(t, nodeConfigA, nil, nil)
+	nodeA := startNewService(t, nodeConfigA, nil)
 	defer nodeA.Stop()
 	nodeAAddr := nodeA.host.fullAddrs()[0]
 
@@ -316,8 +347,11 @@ func TestGossiping(t *testing.T) {
 		RandSeed: 2,
 	}
 
-	msgChanB := make(chan []byte)
-	nodeB := startNewService(t, nodeConfigB, msgChanB, nil)
+	busB := events.NewBus()
+	subB := busB.Subscribe(events.BlockAnnounceReceivedTopic)
+	defer subB.Unsubscribe()
+
+	nodeB := startNewService(t, nodeConfigB, busB)
 	defer nodeB.Stop()
 	nodeBAddr := nodeB.host.fullAddrs()[0]
 
@@ -331,64 +365,115 @@ func TestGossiping(t *testing.T) {
 		RandSeed: 3,
 	}
 
-	msgChanC := make(chan []byte)
-	nodeC := startNewService(t, nodeConfigC, msgChanC, nil)
-	defer nodeC.Stop()
+	busC := events.NewBus()
+	subC := busC.Subscribe(events.BlockAnnounceReceivedTopic)
+	defer subC.Unsubscribe()
 
-	// Meaningless hash
-	endBlock, err := common.HexToHash("0xfd19d9ebac759c993fd2e05a1cff9e757d8741c2704c8682c15b5503496b6aa1")
-	if err != nil {
-		t.Errorf("Can't convert hex to hash")
-	}
+	nodeC := startNewService(t, nodeConfigC, busC)
+	defer nodeC.Stop()
 
-	// Create mock BlockRequestMessage to broadcast
-	bm := &BlockRequestMessage{
-		ID:            7,
-		RequestedData: 1,
-		StartingBlock: []byte{1, 1},
-		EndBlockHash:  optional.NewHash(true, endBlock),
-		Direction:     1,
-		Max:           optional.NewUint32(true, 1),
+	// Create mock BlockAnnounceMessage to broadcast
+	bm := &BlockAnnounceMessage{
+		Number: big.NewInt(7),
 	}
 
-	err = nodeA.Broadcast(bm)
+	err := nodeA.Broadcast(bm)
 	if err != nil {
 		t.Error(err)
 	}
 
-	// Check returned values from channels in the 2 other nodes
+	// Check the events published by the 2 other nodes
 	select {
-	case res := <-msgChanB:
-		bmEnc, err := bm.Encode()
-		if err != nil {
-			t.Fatalf("Can't decode original message")
-		}
-
-		// Compare the byte arrays of the original & returned message
-		if !reflect.DeepEqual(bmEnc, res) {
+	case e := <-subB.Chan():
+		res := e.(*events.BlockAnnounceReceived).Header
+		if res.Number.Cmp(bm.Number) != 0 {
 			t.Fatalf("Didn't receive the correct message")
 		}
 	case <-time.After(30 * time.Second):
 		t.Fatalf("Did not receive message from %s", nodeA.host.hostAddr)
 	}
 	select {
-	case res := <-msgChanC:
-		bmEnc, err := bm.Encode()
-		if err != nil {
-			t.Fatalf("Can't decode original message")
-		}
-
-		// Compare the byte arrays of the original & returned message
-		if !reflect.DeepEqual(bmEnc, res) {
+	case e := <-subC.Chan():
+		res := e.(*events.BlockAnnounceReceived).Header
+		if res.Number.Cmp(bm.Number) != 0 {
 			t.Fatalf("Didn't receive the correct message")
 		}
 	case <-time.After(30 * time.Second):
 		t.Fatalf("Did not receive message from %s", nodeB.host.hostAddr)
 	}
+}
+
+func TestTransactionGossip(t *testing.T) {
+	nodeConfigA := &Config{
+		BootstrapNodes:   nil,
+		Port:             7000,
+		NoBootstrap:      true,
+		NoMdns:           true,
+		RandSeed:         1,
+		TxGossipInterval: 100 * time.Millisecond,
+	}
+
+	busA := events.NewBus()
+	nodeA := startNewService(t, nodeConfigA, busA)
+	defer nodeA.Stop()
+	nodeAAddr := nodeA.host.fullAddrs()[0]
+
+	nodeConfigB := &Config{
+		BootstrapNodes: []string{
+			nodeAAddr.String(),
+		},
+		Port:     7001,
+		NoMdns:   true,
+		RandSeed: 2,
+	}
+
+	busB := events.NewBus()
+	subB := busB.Subscribe(events.TransactionsReceivedTopic)
+	defer subB.Unsubscribe()
+
+	nodeB := startNewService(t, nodeConfigB, busB)
+	defer nodeB.Stop()
+
+	// Allow nodeB to connect to nodeA
+	time.Sleep(1 * time.Second)
+
+	// an extrinsic long enough to need a multi-byte length prefix
+	ext := make(types.Extrinsic, 200)
+	for i := range ext {
+		ext[i] = byte(i)
+	}
+	private := types.Extrinsic{1, 2, 3}
+
+	busA.Publish(&events.TransactionImported{
+		Transaction: tx.NewValidTransaction(&private, tx.NewValidity(1, nil, nil, 64, false)),
+	})
+	busA.Publish(&events.TransactionImported{
+		Transaction: tx.NewValidTransaction(&ext, tx.NewValidity(1, nil, nil, 64, true)),
+	})
+
+	select {
+	case e := <-subB.Chan():
+		res := e.(*events.TransactionsReceived).Extrinsics
+		if !reflect.DeepEqual(res, []types.Extrinsic{ext}) {
+			t.Fatalf("Didn't receive the correct transactions\ngot: %x\nexpected: %x", res, ext)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Did not receive transactions from node A")
+	}
+
+	// node B is known to have the transaction, so it is not sent again
+	busA.Publish(&events.TransactionImported{
+		Transaction: tx.NewValidTransaction(&ext, tx.NewValidity(1, nil, nil, 64, true)),
+	})
 
+	select {
+	case e := <-subB.Chan():
+		t.Fatalf("Received transactions again: %x", e.(*events.TransactionsReceived).Extrinsics)
+	case <-time.After(500 * time.Millisecond):
+	}
 }
 
-func TestP2pReceiveChan(t *testing.T) {
+func TestBlockProducedBroadcast(t *testing.T) {
 	//Create nodeA
 	testServiceConfigA := &Config{
 		BootstrapNodes: nil,
@@ -398,9 +483,8 @@ func TestP2pReceiveChan(t *testing.T) {
 		RandSeed:       1,
 	}
 
-	msgRecChan := make(chan BlockAnnounceMessage)
-
-	nodeA := startNewService(t, testServiceConfigA, nil, msgRecChan)
+	busA := events.NewBus()
+	nodeA := startNewService(t, testServiceConfigA, busA)
 	defer nodeA.Stop()
 
 	// Create nodeB
@@ -413,42 +497,85 @@ func TestP2pReceiveChan(t *testing.T) {
 		NoMdns:   true,
 		RandSeed: 2,
 	}
-	msgSendChan := make(chan []byte)
-	nodeB := startNewService(t, testServiceConfigB, msgSendChan, nil)
-	defer nodeB.Stop()
 
-	// node B only handles the stream, and doesn't need to rebroadcast it
-	nodeB.host.registerStreamHandler(func(stream net.Stream) {
+	busB := events.NewBus()
+	subB := busB.Subscribe(events.BlockAnnounceReceivedTopic)
+	defer subB.Unsubscribe()
 
-		_, rawMsg, err := parseMessage(stream)
+	nodeB := startNewService(t, testServiceConfigB, busB)
+	defer nodeB.Stop()
 
-		nodeB.msgSendChan <- rawMsg
+	// Allow nodeB to connect to nodeA
+	time.Sleep(1 * time.Second)
 
-		if err != nil {
-			return
-		}
-	})
+	// Publish a produced block on node A's bus for broadcasting
+	block := &types.Block{
+		Header: types.BlockHeader{
+			Number: big.NewInt(10),
+		},
+	}
+	busA.Publish(&events.BlockProduced{Block: block})
 
-	//Create a blockAnnounceMessage & send to node A for broadcasting
-	blockAnnounceMsg := BlockAnnounceMessage{
-		Number: big.NewInt(10),
+	// Check that node B receives the block announcement
+	select {
+	case e := <-subB.Chan():
+		header := e.(*events.BlockAnnounceReceived).Header
+		if header.Number.Cmp(block.Header.Number) != 0 {
+			t.Fatalf("Node B service didn't receive the correct block\ngot: %+v\nexpected: %+v", header, block.Header)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatalf("Did not receive block announce for %+v", block.Header)
 	}
+}
 
-	encodedBlockAnnounceMsg, err := blockAnnounceMsg.Encode()
+func TestService_markSeen(t *testing.T) {
+	s := &Service{seen: make(map[int]*knownSet)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := s.markSeen(ConsensusMsgType, fmt.Sprint(j))
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	first, err := s.markSeen(ConsensusMsgType, "0")
 	if err != nil {
-		t.Fatalf("Can't encode the block announce message")
+		t.Fatal(err)
+	}
+	if first {
+		t.Fatal("Fail: seen message was marked as first")
 	}
 
-	// Send message down the nodeA receive channel
-	msgRecChan <- blockAnnounceMsg
+	// the same ID of another message type is not seen yet
+	first, err = s.markSeen(TransactionMsgType, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first {
+		t.Fatal("Fail: message of another type was marked as seen")
+	}
 
-	// Check that we receive the same message in nodeB
-	select {
-	case receivedBlockAnnounceMsg := <-msgSendChan:
-		if !reflect.DeepEqual(receivedBlockAnnounceMsg, encodedBlockAnnounceMsg) {
-			t.Fatalf("Node B service didn't receive the correct block\ngot: %+v\nexpected: %+v", receivedBlockAnnounceMsg, encodedBlockAnnounceMsg)
+	// the oldest IDs are forgotten once the set is full
+	for i := 100; i < maxSeenMsgs+1; i++ {
+		_, err = s.markSeen(ConsensusMsgType, fmt.Sprint(i))
+		if err != nil {
+			t.Fatal(err)
 		}
-	case <-time.After(30 * time.Second):
-		t.Fatalf("Did not receive message %+v", encodedBlockAnnounceMsg)
+	}
+
+	first, err = s.markSeen(ConsensusMsgType, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first {
+		t.Fatal("Fail: oldest message was not forgotten")
 	}
 }
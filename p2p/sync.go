@@ -0,0 +1,294 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/common/optional"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/events"
+	log "github.com/ChainSafe/log15"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Bits of BlockRequestMessage.RequestedData selecting the fields of the block data sent in the response
+const (
+	RequestedDataHeader        = byte(1)
+	RequestedDataBody          = byte(2)
+	RequestedDataReceipt       = byte(4)
+	RequestedDataMessageQueue  = byte(8)
+	RequestedDataJustification = byte(16)
+)
+
+// Directions in which the blocks of a block request are returned, starting from its starting block
+const (
+	DirectionAscending  = byte(0)
+	DirectionDescending = byte(1)
+)
+
+// MaxBlocksInResponse is the maximum number of blocks sent in response to a block request
+const MaxBlocksInResponse = 128
+
+const (
+	// blockRequestTimeout is how long a block request waits for its response; later responses are dropped
+	blockRequestTimeout = 30 * time.Second
+	// maxPendingRequests is the maximum number of block requests waiting for their response
+	maxPendingRequests = 256
+)
+
+// ErrTooManyRequests is returned when a block request is sent while maxPendingRequests are waiting for responses
+var ErrTooManyRequests = errors.New("too many block requests are waiting for responses")
+
+// BlockSource provides the blocks sent in response to block requests; it is implemented by the block tree
+type BlockSource interface {
+	// GetBlockHash returns the hash of the block with the given number on the best chain
+	GetBlockHash(number *big.Int) (common.Hash, error)
+	// GetBlockData returns the header, body and finality justification of the block with the given hash
+	GetBlockData(hash common.Hash) (*types.BlockData, error)
+}
+
+// pendingRequest is a block request waiting for the response of the peer it was sent to
+type pendingRequest struct {
+	peer peer.ID
+	sent time.Time
+}
+
+// blockRequester tracks the block requests sent to peers, so only the responses to them are accepted
+type blockRequester struct {
+	lock    sync.Mutex
+	nextID  uint64
+	pending map[uint64]pendingRequest
+	now     func() time.Time
+}
+
+func newBlockRequester() *blockRequester {
+	return &blockRequester{
+		nextID:  uint64(time.Now().UnixNano()),
+		pending: make(map[uint64]pendingRequest),
+		now:     time.Now,
+	}
+}
+
+// add records a request sent to the peer and returns its ID
+func (r *blockRequester) add(p peer.ID) (uint64, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.expire()
+	if len(r.pending) >= maxPendingRequests {
+		return 0, ErrTooManyRequests
+	}
+
+	r.nextID++
+	r.pending[r.nextID] = pendingRequest{peer: p, sent: r.now()}
+	return r.nextID, nil
+}
+
+// complete removes the request with the ID, and returns true if it was sent to the peer and has not expired
+func (r *blockRequester) complete(p peer.ID, id uint64) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.expire()
+	req, ok := r.pending[id]
+	if !ok || req.peer != p {
+		return false
+	}
+
+	delete(r.pending, id)
+	return true
+}
+
+// expire removes the requests that have waited longer than blockRequestTimeout
+func (r *blockRequester) expire() {
+	for id, req := range r.pending {
+		if r.now().Sub(req.sent) > blockRequestTimeout {
+			delete(r.pending, id)
+		}
+	}
+}
+
+// handleBlockRequests sends the block requests produced by other services to the peers they are for
+func (s *Service) handleBlockRequests(sub *events.Subscription) {
+	for {
+		select {
+		case e := <-sub.Chan():
+			ev := e.(*events.BlockRequestProduced)
+			err := s.requestBlocks(ev)
+			if err != nil {
+				log.Debug("failed to request blocks", "peer", ev.PeerID, "hash", ev.Hash, "error", err)
+			}
+		case <-sub.Done():
+			return
+		}
+	}
+}
+
+// requestBlocks sends the peer a request for the headers, bodies and justifications of the requested blocks
+func (s *Service) requestBlocks(ev *events.BlockRequestProduced) error {
+	p, err := peer.IDB58Decode(ev.PeerID)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.requester.add(p)
+	if err != nil {
+		return err
+	}
+
+	req := &BlockRequestMessage{
+		ID:            id,
+		RequestedData: RequestedDataHeader | RequestedDataBody | RequestedDataJustification,
+		StartingBlock: append([]byte{0}, ev.Hash[:]...),
+		EndBlockHash:  optional.NewHash(false, common.Hash{}),
+		Direction:     DirectionDescending,
+		Max:           optional.NewUint32(true, ev.Max),
+	}
+
+	enc, err := req.Encode()
+	if err != nil {
+		s.requester.complete(p, id)
+		return err
+	}
+
+	err = s.host.send(s.host.dht.FindLocal(p), enc)
+	if err != nil {
+		s.requester.complete(p, id)
+	}
+	return err
+}
+
+// SetBlockSource sets the source of the blocks sent to peers in response to block requests. Block requests are
+// not answered until it is set.
+func (s *Service) SetBlockSource(src BlockSource) {
+	s.blockSource = src
+}
+
+// handleBlockRequest sends the peer the response to its block request
+func (s *Service) handleBlockRequest(p peer.ID, req *BlockRequestMessage) {
+	if s.blockSource == nil {
+		return
+	}
+
+	resp, err := blockResponse(s.blockSource, req)
+	if err != nil {
+		log.Debug("cannot respond to block request", "peer", p, "request", req, "error", err)
+		return
+	}
+
+	enc, err := resp.Encode()
+	if err != nil {
+		log.Error("failed to encode block response", "error", err)
+		return
+	}
+
+	err = s.host.send(s.host.dht.FindLocal(p), enc)
+	if err != nil {
+		log.Debug("failed to send block response", "peer", p, "error", err)
+	}
+}
+
+// blockResponse returns the response to a block request: the requested fields of the block data of up to
+// MaxBlocksInResponse blocks, from the starting block to the end block in the requested direction
+func blockResponse(src BlockSource, req *BlockRequestMessage) (*BlockResponseMessage, error) {
+	hash, err := startingBlockHash(src, req.StartingBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	max := uint32(MaxBlocksInResponse)
+	if req.Max != nil && req.Max.Exists() && req.Max.Value() < max {
+		max = req.Max.Value()
+	}
+
+	var bds []*types.BlockData
+	for uint32(len(bds)) < max {
+		bd, err := src.GetBlockData(hash)
+		if err != nil {
+			if len(bds) == 0 {
+				return nil, err
+			}
+			break
+		}
+
+		header := bd.Header
+		bds = append(bds, requestedData(bd, req.RequestedData))
+
+		if req.EndBlockHash != nil && req.EndBlockHash.Exists() && req.EndBlockHash.Value() == hash {
+			break
+		}
+
+		if req.Direction == DirectionDescending {
+			if header == nil || header.Number.Sign() == 0 {
+				break
+			}
+			hash = header.ParentHash
+			continue
+		}
+
+		if header == nil {
+			break
+		}
+		hash, err = src.GetBlockHash(new(big.Int).Add(header.Number, big.NewInt(1)))
+		if err != nil {
+			break
+		}
+	}
+
+	data, err := types.EncodeBlockDataArray(bds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockResponseMessage{ID: req.ID, Data: data}, nil
+}
+
+// startingBlockHash returns the hash of the starting block of a block request, which is either a hash or a
+// block number on the best chain
+func startingBlockHash(src BlockSource, start []byte) (common.Hash, error) {
+	if len(start) == 33 && start[0] == 0 {
+		return common.BytesToHash(start[1:]), nil
+	}
+
+	if len(start) == 9 && start[0] == 1 {
+		number := new(big.Int).SetUint64(binary.LittleEndian.Uint64(start[1:]))
+		return src.GetBlockHash(number)
+	}
+
+	return common.Hash{}, errors.New("invalid starting block of block request")
+}
+
+// requestedData returns the block data with only the requested fields set
+func requestedData(bd *types.BlockData, requested byte) *types.BlockData {
+	res := &types.BlockData{Hash: bd.Hash}
+	if requested&RequestedDataHeader != 0 {
+		res.Header = bd.Header
+	}
+	if requested&RequestedDataBody != 0 {
+		res.Body = bd.Body
+	}
+	if requested&RequestedDataJustification != 0 {
+		res.Justification = bd.Justification
+	}
+	return res
+}
@@ -0,0 +1,208 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/common/optional"
+	"github.com/ChainSafe/gossamer/core/blocktree"
+	"github.com/ChainSafe/gossamer/core/types"
+	db "github.com/ChainSafe/gossamer/polkadb"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var _ BlockSource = &blocktree.BlockTree{}
+
+// newTestBlockSource returns a block tree with a chain of blocks, where block 3 has a justification
+func newTestBlockSource(t *testing.T, length int) (*blocktree.BlockTree, []*types.Block) {
+	genesis := types.Block{
+		Header: types.BlockHeader{Number: big.NewInt(0), Hash: common.Hash{0x00}},
+		Body:   types.BlockBody{},
+	}
+	bt := blocktree.NewBlockTreeFromGenesis(genesis, &db.BlockDB{Db: db.NewMemDatabase()})
+
+	blocks := []*types.Block{}
+	parent := genesis.Header.Hash
+	for i := 1; i <= length; i++ {
+		body, err := types.NewBlockBody([]types.Extrinsic{{byte(i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block := &types.Block{
+			Header: types.BlockHeader{ParentHash: parent, Number: big.NewInt(int64(i)), Hash: common.Hash{byte(i)}},
+			Body:   body,
+		}
+		bt.AddBlock(*block)
+		blocks = append(blocks, block)
+		parent = block.Header.Hash
+	}
+
+	err := bt.SetJustification(blocks[2].Header.Hash, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bt, blocks
+}
+
+func decodeResponse(t *testing.T, resp *BlockResponseMessage) []*types.BlockData {
+	bds, err := types.DecodeBlockDataArray(bytes.NewReader(resp.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bds
+}
+
+func TestBlockResponse_Ascending(t *testing.T) {
+	bt, blocks := newTestBlockSource(t, 5)
+
+	start := make([]byte, 9)
+	start[0] = 1
+	binary.LittleEndian.PutUint64(start[1:], 2)
+
+	req := &BlockRequestMessage{
+		ID:            7,
+		RequestedData: RequestedDataHeader | RequestedDataJustification,
+		StartingBlock: start,
+		EndBlockHash:  optional.NewHash(false, common.Hash{}),
+		Direction:     DirectionAscending,
+		Max:           optional.NewUint32(true, 3),
+	}
+
+	resp, err := blockResponse(bt, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != 7 {
+		t.Fatalf("Fail: got response ID %d expected 7", resp.ID)
+	}
+
+	bds := decodeResponse(t, resp)
+	if len(bds) != 3 {
+		t.Fatalf("Fail: got %d blocks expected 3", len(bds))
+	}
+
+	for i, bd := range bds {
+		expected := blocks[i+1]
+		if bd.Hash != expected.Header.Hash || bd.Header == nil || bd.Header.Number.Cmp(expected.Header.Number) != 0 {
+			t.Fatalf("Fail: got block %v expected %v", bd, expected)
+		}
+		if bd.Body != nil {
+			t.Fatal("Fail: got body that was not requested")
+		}
+	}
+
+	if bds[0].Justification != nil || !bytes.Equal(bds[1].Justification, []byte{1, 2, 3}) {
+		t.Fatal("Fail: did not get justification of block 3 only")
+	}
+}
+
+func TestBlockResponse_Descending(t *testing.T) {
+	bt, blocks := newTestBlockSource(t, 5)
+
+	req := &BlockRequestMessage{
+		ID:            1,
+		RequestedData: RequestedDataBody,
+		StartingBlock: append([]byte{0}, blocks[3].Header.Hash[:]...),
+		EndBlockHash:  optional.NewHash(true, blocks[1].Header.Hash),
+		Direction:     DirectionDescending,
+		Max:           optional.NewUint32(false, 0),
+	}
+
+	resp, err := blockResponse(bt, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bds := decodeResponse(t, resp)
+	if len(bds) != 3 {
+		t.Fatalf("Fail: got %d blocks expected 3", len(bds))
+	}
+
+	for i, bd := range bds {
+		expected := blocks[3-i]
+		if bd.Hash != expected.Header.Hash || bd.Body == nil || !bytes.Equal(*bd.Body, expected.Body) {
+			t.Fatalf("Fail: got block %v expected %v", bd, expected)
+		}
+		if bd.Header != nil || bd.Justification != nil {
+			t.Fatal("Fail: got data that was not requested")
+		}
+	}
+
+	// unknown starting block
+	req.StartingBlock = append([]byte{0}, make([]byte, 31)...)
+	req.StartingBlock = append(req.StartingBlock, 0xff)
+	_, err = blockResponse(bt, req)
+	if err == nil {
+		t.Fatal("Fail: expected error for unknown starting block")
+	}
+}
+
+func TestBlockRequester(t *testing.T) {
+	r := newBlockRequester()
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	peerA, peerB := peer.ID("a"), peer.ID("b")
+
+	id, err := r.add(peerA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// responses are only accepted from the peer the request was sent to, and only once
+	if r.complete(peerB, id) {
+		t.Fatal("Fail: accepted response from another peer")
+	}
+	if r.complete(peerA, id+1) {
+		t.Fatal("Fail: accepted response to unknown request")
+	}
+	if !r.complete(peerA, id) {
+		t.Fatal("Fail: did not accept response to request")
+	}
+	if r.complete(peerA, id) {
+		t.Fatal("Fail: accepted second response to request")
+	}
+
+	// late responses are dropped
+	id, err = r.add(peerA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(blockRequestTimeout + time.Second)
+	if r.complete(peerA, id) {
+		t.Fatal("Fail: accepted response to expired request")
+	}
+
+	for i := 0; i < maxPendingRequests; i++ {
+		_, err = r.add(peerA)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = r.add(peerA)
+	if err != ErrTooManyRequests {
+		t.Fatalf("Fail: got %v expected %v", err, ErrTooManyRequests)
+	}
+}
@@ -17,8 +17,12 @@
 package rpc
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/ChainSafe/gossamer/internal/api"
 	log "github.com/ChainSafe/log15"
@@ -29,14 +33,20 @@ type HttpServer struct {
 	Port      uint32  // Listening port
 	Host      string  // Listening hostname
 	rpcServer *Server // Actual RPC call handler
+	api       *api.Api
+	server    *http.Server
 }
 
+// shutdownTimeout is the time in-flight requests are given to complete when the server is stopped
+const shutdownTimeout = 5 * time.Second
+
 // NewHttpServer creates a new http server and registers an associated rpc server
 func NewHttpServer(api *api.Api, codec Codec, host string, port uint32, modules []api.Module) *HttpServer {
 	server := &HttpServer{
 		Port:      port,
 		Host:      host,
 		rpcServer: NewApiServer(modules, api),
+		api:       api,
 	}
 
 	server.rpcServer.RegisterCodec(codec)
@@ -45,14 +55,50 @@ func NewHttpServer(api *api.Api, codec Codec, host string, port uint32, modules
 }
 
 // Start registers the rpc handler function and starts the server listening on `h.port`
-func (h *HttpServer) Start() {
+func (h *HttpServer) Start() error {
 	log.Debug("[rpc] Starting HTTP Server...", "port", h.Port)
-	http.HandleFunc("/rpc", h.rpcServer.ServeHTTP)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rpc", h.rpcServer.ServeHTTP)
+	mux.HandleFunc("/health", h.healthHandler)
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", h.Host, h.Port))
+	if err != nil {
+		return err
+	}
 
+	h.server = &http.Server{Handler: mux}
 	go func() {
-		err := http.ListenAndServe(fmt.Sprintf("%s:%d", h.Host, h.Port), nil)
-		if err != nil {
+		err := h.server.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
 			log.Error("[rpc] http error", "err", err)
 		}
 	}()
+
+	return nil
+}
+
+// Stop shuts down the server, waiting for in-flight requests to complete
+func (h *HttpServer) Stop() error {
+	if h.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return h.server.Shutdown(ctx)
+}
+
+// healthHandler responds with the status of each service. The status code is 503 if any service is unhealthy.
+func (h *HttpServer) healthHandler(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	if !h.api.HealthModule.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(h.api.HealthModule.Services())
+	if err != nil {
+		log.Error("[rpc] failed to write health response", "err", err)
+	}
 }
@@ -0,0 +1,82 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ChainSafe/gossamer/internal/api"
+	module "github.com/ChainSafe/gossamer/internal/api/modules"
+	"github.com/ChainSafe/gossamer/internal/services"
+)
+
+type mockHealthApi struct {
+	services map[string]services.ServiceStatus
+}
+
+func (a *mockHealthApi) Health() map[string]services.ServiceStatus {
+	return a.services
+}
+
+func (a *mockHealthApi) Healthy() bool {
+	for _, status := range a.services {
+		if !status.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHttpServer_Health(t *testing.T) {
+	healthApi := &mockHealthApi{
+		services: map[string]services.ServiceStatus{
+			"p2p.Service":  {State: services.Degraded, LastError: "no connected peers"},
+			"core.Service": {State: services.Running},
+		},
+	}
+
+	h := &HttpServer{
+		api: &api.Api{HealthModule: module.NewHealthModule(healthApi)},
+	}
+
+	// Degraded services are still healthy
+	w := httptest.NewRecorder()
+	h.healthHandler(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status. got: %d expected: %d", w.Code, http.StatusOK)
+	}
+
+	res := make(map[string]services.ServiceStatus)
+	err := json.Unmarshal(w.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["p2p.Service"].State != services.Degraded {
+		t.Fatalf("unexpected p2p state. got: %s expected: %s", res["p2p.Service"].State, services.Degraded)
+	}
+
+	// A failed service makes the node unhealthy
+	healthApi.services["core.Service"] = services.ServiceStatus{State: services.Failed, LastError: "event loop crashed"}
+	w = httptest.NewRecorder()
+	h.healthHandler(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status. got: %d expected: %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
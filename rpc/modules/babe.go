@@ -0,0 +1,44 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package modules
+
+import (
+	"net/http"
+
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/api"
+)
+
+type BabeEquivocationsResponse []*types.EquivocationProof
+
+// BabeModule is an RPC module providing access to BABE consensus information.
+type BabeModule struct {
+	api *api.Api
+}
+
+// NewBabeModule creates a new Babe module.
+func NewBabeModule(api *api.Api) *BabeModule {
+	return &BabeModule{
+		api: api,
+	}
+}
+
+// Equivocations returns the proofs of the equivocations most recently detected by the node
+func (bm *BabeModule) Equivocations(r *http.Request, req *EmptyRequest, res *BabeEquivocationsResponse) error {
+	*res = bm.api.BabeModule.Equivocations()
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package modules
+
+import (
+	"testing"
+
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/internal/api"
+	module "github.com/ChainSafe/gossamer/internal/api/modules"
+)
+
+var testEquivocation = &types.EquivocationProof{Offender: [32]byte{1}, Slot: 7}
+
+type mockBabeApi struct{}
+
+func (a *mockBabeApi) Equivocations() []*types.EquivocationProof {
+	return []*types.EquivocationProof{testEquivocation}
+}
+
+func TestBabeModule_Equivocations(t *testing.T) {
+	babe := NewBabeModule(&api.Api{BabeModule: module.NewBabeModule(&mockBabeApi{})})
+
+	res := &BabeEquivocationsResponse{}
+	err := babe.Equivocations(nil, &EmptyRequest{}, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*res) != 1 || (*res)[0] != testEquivocation {
+		t.Fatalf("Babe.Equivocations: expected: %v got: %v\n", testEquivocation, *res)
+	}
+
+	// without a BABE session there are no equivocations
+	babe = NewBabeModule(&api.Api{BabeModule: &module.BabeModule{}})
+	res = &BabeEquivocationsResponse{}
+	err = babe.Equivocations(nil, &EmptyRequest{}, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*res) != 0 {
+		t.Fatalf("Babe.Equivocations: expected none got: %v\n", *res)
+	}
+}
@@ -49,22 +49,41 @@ func NewChainModule(api *api.Api) *ChainModule {
 	}
 }
 
-func (cm *ChainModule) GetBlock(r *http.Request, req *ChainHashRequest, res *ChainBlockResponse) {
-	_ = cm.api
+func (cm *ChainModule) GetBlock(r *http.Request, req *ChainHashRequest, res *ChainBlockResponse) error {
+	return nil
 }
 
-func (cm *ChainModule) GetBlockHash(r *http.Request, req *ChainBlockNumberRequest, res *ChainHashResponse) {
+// GetBlockHash returns the hash of the block with the given number, or the best block hash if no number is given
+func (cm *ChainModule) GetBlockHash(r *http.Request, req *ChainBlockNumberRequest, res *ChainHashResponse) error {
+	var number *big.Int
+	if req != nil {
+		number = *req
+	}
+
+	hash, err := cm.api.BlockModule.GetBlockHash(number)
+	if err != nil {
+		return err
+	}
+
+	res.ChainHash = hash
+	return nil
 }
 
-func (cm *ChainModule) GetFinalizedHead(r *http.Request, req *EmptyRequest, res *ChainHashResponse) {
+// GetFinalizedHead returns the hash of the last finalized block
+func (cm *ChainModule) GetFinalizedHead(r *http.Request, req *EmptyRequest, res *ChainHashResponse) error {
+	res.ChainHash = cm.api.BlockModule.FinalizedHash()
+	return nil
 }
 
 //DB isn't implemented properly yet. Doesn't return block headers
-func (cm *ChainModule) GetHeader(r *http.Request, req *ChainHashRequest, res *ChainBlockHeaderResponse) {
+func (cm *ChainModule) GetHeader(r *http.Request, req *ChainHashRequest, res *ChainBlockHeaderResponse) error {
+	return nil
 }
 
-func (cm *ChainModule) SubscribeFinalizedHeads(r *http.Request, req *EmptyRequest, res *ChainBlockHeaderResponse) {
+func (cm *ChainModule) SubscribeFinalizedHeads(r *http.Request, req *EmptyRequest, res *ChainBlockHeaderResponse) error {
+	return nil
 }
 
-func (cm *ChainModule) SubscribeNewHead(r *http.Request, req *EmptyRequest, res *ChainBlockHeaderResponse) {
+func (cm *ChainModule) SubscribeNewHead(r *http.Request, req *EmptyRequest, res *ChainBlockHeaderResponse) error {
+	return nil
 }
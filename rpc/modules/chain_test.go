@@ -0,0 +1,109 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package modules
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ChainSafe/gossamer/common"
+	"github.com/ChainSafe/gossamer/internal/api"
+	module "github.com/ChainSafe/gossamer/internal/api/modules"
+)
+
+var (
+	testGenesisHash   = common.Hash{0x01}
+	testBestHash      = common.Hash{0x02}
+	testFinalizedHash = common.Hash{0x03}
+)
+
+type mockBlockApi struct{}
+
+// Mock block API
+func (a *mockBlockApi) GenesisHash() common.Hash {
+	return testGenesisHash
+}
+
+func (a *mockBlockApi) BestBlockHash() common.Hash {
+	return testBestHash
+}
+
+func (a *mockBlockApi) FinalizedHash() common.Hash {
+	return testFinalizedHash
+}
+
+func (a *mockBlockApi) GetBlockHash(number *big.Int) (common.Hash, error) {
+	if number.Cmp(big.NewInt(0)) == 0 {
+		return testGenesisHash, nil
+	}
+	return common.Hash{}, errors.New("block not found")
+}
+
+func newMockChainApi() *api.Api {
+	return &api.Api{
+		BlockModule: module.NewBlockModule(&mockBlockApi{}),
+	}
+}
+
+func TestChainModule_GetBlockHash(t *testing.T) {
+	chain := NewChainModule(newMockChainApi())
+
+	//Test RPC's Chain.GetBlockHash() response for the genesis block
+	var req ChainBlockNumberRequest = big.NewInt(0)
+	res := &ChainHashResponse{}
+	err := chain.GetBlockHash(nil, &req, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.ChainHash != testGenesisHash {
+		t.Errorf("Chain.GetBlockHash: expected: %x got: %x\n", testGenesisHash, res.ChainHash)
+	}
+
+	//Test RPC's Chain.GetBlockHash() response with no block number
+	req = nil
+	res = &ChainHashResponse{}
+	err = chain.GetBlockHash(nil, &req, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.ChainHash != testBestHash {
+		t.Errorf("Chain.GetBlockHash: expected: %x got: %x\n", testBestHash, res.ChainHash)
+	}
+
+	req = big.NewInt(1)
+	err = chain.GetBlockHash(nil, &req, &ChainHashResponse{})
+	if err == nil {
+		t.Error("Chain.GetBlockHash: expected error for unknown block")
+	}
+}
+
+func TestChainModule_GetFinalizedHead(t *testing.T) {
+	chain := NewChainModule(newMockChainApi())
+
+	res := &ChainHashResponse{}
+	err := chain.GetFinalizedHead(nil, &EmptyRequest{}, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.ChainHash != testFinalizedHash {
+		t.Errorf("Chain.GetFinalizedHead: expected: %x got: %x\n", testFinalizedHash, res.ChainHash)
+	}
+}
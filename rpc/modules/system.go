@@ -22,6 +22,7 @@ import (
 
 	"github.com/ChainSafe/gossamer/common"
 	"github.com/ChainSafe/gossamer/internal/api"
+	"github.com/ChainSafe/gossamer/internal/services"
 )
 
 // SystemModule is an RPC module providing access to core API points.
@@ -35,9 +36,10 @@ type EmptyRequest struct{}
 type StringResponse string
 
 type SystemHealthResponse struct {
-	Peers           int  `json:"peers"`
-	IsSyncing       bool `json:"isSyncing"`
-	ShouldHavePeers bool `json:"shouldHavePeers"`
+	Peers           int                               `json:"peers"`
+	IsSyncing       bool                              `json:"isSyncing"`
+	ShouldHavePeers bool                              `json:"shouldHavePeers"`
+	Services        map[string]services.ServiceStatus `json:"services"`
 }
 
 type SystemNetworkStateResponse struct {
@@ -81,6 +83,7 @@ func (sm *SystemModule) Health(r *http.Request, req *EmptyRequest, res *SystemHe
 	res.Peers = len(sm.api.P2pModule.Peers())
 	res.IsSyncing = sm.api.P2pModule.IsSyncing()
 	res.ShouldHavePeers = !sm.api.P2pModule.NoBootstrapping()
+	res.Services = sm.api.HealthModule.Services()
 	return nil
 }
 
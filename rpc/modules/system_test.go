@@ -17,10 +17,12 @@
 package modules
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/ChainSafe/gossamer/internal/api"
 	module "github.com/ChainSafe/gossamer/internal/api/modules"
+	"github.com/ChainSafe/gossamer/internal/services"
 )
 
 var (
@@ -34,6 +36,7 @@ var (
 
 type mockruntimeApi struct{}
 type mockP2PApi struct{}
+type mockHealthApi struct{}
 
 //Mock runtime API
 func (a *mockruntimeApi) Version() string {
@@ -61,13 +64,29 @@ func (a *mockP2PApi) ID() string {
 	return testPeerId
 }
 
+//Mock health API
+var testServices = map[string]services.ServiceStatus{
+	"p2p.Service":  {State: services.Running, Metrics: map[string]interface{}{"peers": len(peers)}},
+	"core.Service": {State: services.Failed, LastError: "event loop crashed"},
+}
+
+func (a *mockHealthApi) Health() map[string]services.ServiceStatus {
+	return testServices
+}
+
+func (a *mockHealthApi) Healthy() bool {
+	return false
+}
+
 func newMockApi() *api.Api {
 	runtimeApi := &mockruntimeApi{}
 	p2pApi := &mockP2PApi{}
+	healthApi := &mockHealthApi{}
 
 	return &api.Api{
 		P2pModule:     module.NewP2PModule(p2pApi),
 		RuntimeModule: module.NewRuntimeModule(runtimeApi),
+		HealthModule:  module.NewHealthModule(healthApi),
 	}
 }
 
@@ -128,4 +147,8 @@ func TestSystemModule_Health(t *testing.T) {
 		t.Errorf("System.Health.ShouldHavePeers: expected: %+v got: %+v\n", netHealth.ShouldHavePeers, expectedHealth.ShouldHavePeers)
 	}
 
+	if !reflect.DeepEqual(netHealth.Services, testServices) {
+		t.Errorf("System.Health.Services: expected: %+v got: %+v\n", testServices, netHealth.Services)
+	}
+
 }
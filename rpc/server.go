@@ -74,6 +74,10 @@ func (s *Server) RegisterModules(mods []api.Module) {
 		switch mod {
 		case "system":
 			srvc = modules.NewSystemModule(s.api)
+		case "chain":
+			srvc = modules.NewChainModule(s.api)
+		case "babe":
+			srvc = modules.NewBabeModule(s.api)
 		default:
 			log.Warn("[rpc] Unrecognized module", "module", mod)
 			continue
@@ -0,0 +1,366 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	scale "github.com/ChainSafe/gossamer/codec"
+	"github.com/ChainSafe/gossamer/common"
+	tx "github.com/ChainSafe/gossamer/common/transaction"
+	"github.com/ChainSafe/gossamer/core/types"
+	wasm "github.com/wasmerio/go-ext-wasm/wasmer"
+)
+
+const (
+	coreVersion                = "Core_version"
+	coreExecuteBlock           = "Core_execute_block"
+	coreInitializeBlock        = "Core_initialize_block"
+	metadataMetadata           = "Metadata_metadata"
+	validateTransaction        = "TaggedTransactionQueue_validate_transaction"
+	blockBuilderApplyExtrinsic = "BlockBuilder_apply_extrinsic"
+	blockBuilderInherents      = "BlockBuilder_inherent_extrinsics"
+	blockBuilderFinalizeBlock  = "BlockBuilder_finalize_block"
+	blockBuilderCheckInherents = "BlockBuilder_check_inherents"
+)
+
+// requiredExports are the runtime API functions every runtime code has to export to be loaded
+var requiredExports = []string{
+	coreVersion,
+	coreExecuteBlock,
+	coreInitializeBlock,
+	metadataMetadata,
+	validateTransaction,
+	blockBuilderApplyExtrinsic,
+	blockBuilderInherents,
+	blockBuilderFinalizeBlock,
+	blockBuilderCheckInherents,
+}
+
+// ErrEmptyResult is returned when a runtime API function returns no result where one is expected
+var ErrEmptyResult = errors.New("runtime returned an empty result")
+
+// ErrBuildDone is returned when using a block build that has already been committed or discarded
+var ErrBuildDone = errors.New("block build is already committed or discarded")
+
+// ErrInvalidTransaction is returned when the runtime reports that a transaction is invalid
+var ErrInvalidTransaction = errors.New("could not validate transaction")
+
+// ApplyError is the reason the runtime gives for rejecting an extrinsic applied to a block
+type ApplyError byte
+
+// The errors in the ApplyExtrinsicResult of BlockBuilder_apply_extrinsic
+const (
+	ErrBadSignature ApplyError = 0
+	ErrStale        ApplyError = 1
+	ErrFuture       ApplyError = 2
+	ErrCantPay      ApplyError = 3
+	ErrFullBlock    ApplyError = 255
+)
+
+func (e ApplyError) Error() string {
+	switch e {
+	case ErrBadSignature:
+		return "extrinsic has a bad signature"
+	case ErrStale:
+		return "extrinsic is stale"
+	case ErrFuture:
+		return "extrinsic is from the future"
+	case ErrCantPay:
+		return "extrinsic sender cannot pay the fees"
+	case ErrFullBlock:
+		return "block is full"
+	default:
+		return fmt.Sprintf("extrinsic rejected with unknown apply error %d", byte(e))
+	}
+}
+
+// checkExports returns an error if the module does not export one of the required runtime API functions
+func checkExports(module wasm.Module) error {
+	exports := make(map[string]bool)
+	for _, export := range module.Exports {
+		if export.Kind == wasm.ImportExportKindFunction {
+			exports[export.Name] = true
+		}
+	}
+
+	for _, name := range requiredExports {
+		if !exports[name] {
+			return fmt.Errorf("runtime code does not export %s", name)
+		}
+	}
+
+	return nil
+}
+
+// Core calls the functions of the runtime's Core API
+type Core struct {
+	rt *Runtime
+}
+
+// Core returns the runtime's Core API
+func (r *Runtime) Core() *Core {
+	return &Core{rt: r}
+}
+
+// Version returns the version of the runtime by calling Core_version
+func (c *Core) Version() (*Version, error) {
+	ret, err := c.rt.Call(coreVersion, []byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := decodeToInterface(ret, &Version{})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Version), nil
+}
+
+// ExecuteBlock executes the block by calling Core_execute_block, and returns an error if the runtime rejects it
+func (c *Core) ExecuteBlock(block *types.Block) error {
+	enc, err := block.Encode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.rt.Exec(coreExecuteBlock, enc)
+	return err
+}
+
+// ExecuteBlockWithCode is like ExecuteBlock, but executes the block with the runtime code with the given hash
+func (c *Core) ExecuteBlockWithCode(hash common.Hash, block *types.Block) error {
+	enc, err := block.Encode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.rt.ExecWithCode(hash, coreExecuteBlock, enc)
+	return err
+}
+
+// Metadata returns the SCALE encoded metadata of the runtime by calling Metadata_metadata
+func (r *Runtime) Metadata() ([]byte, error) {
+	ret, err := r.Call(metadataMetadata, []byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	sd := scale.Decoder{Reader: bytes.NewReader(ret)}
+	return sd.DecodeByteArray()
+}
+
+// TaggedTransactionQueue calls the functions of the runtime's TaggedTransactionQueue API
+type TaggedTransactionQueue struct {
+	rt *Runtime
+}
+
+// TaggedTransactionQueue returns the runtime's TaggedTransactionQueue API
+func (r *Runtime) TaggedTransactionQueue() *TaggedTransactionQueue {
+	return &TaggedTransactionQueue{rt: r}
+}
+
+// Validate returns the validity of the transaction by calling TaggedTransactionQueue_validate_transaction, or
+// ErrInvalidTransaction if the runtime reports that it is invalid
+func (q *TaggedTransactionQueue) Validate(ext types.Extrinsic) (*tx.Validity, error) {
+	ret, err := q.rt.Call(validateTransaction, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ret) == 0 {
+		return nil, ErrEmptyResult
+	}
+
+	if ret[0] != 0 {
+		return nil, ErrInvalidTransaction
+	}
+
+	v := new(tx.Validity)
+	err = v.Decode(bytes.NewReader(ret[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// BlockBuilder calls the functions of the runtime's BlockBuilder API
+type BlockBuilder struct {
+	rt *Runtime
+}
+
+// BlockBuilder returns the runtime's BlockBuilder API
+func (r *Runtime) BlockBuilder() *BlockBuilder {
+	return &BlockBuilder{rt: r}
+}
+
+// BuildBlock starts building a block with the given header on the block execution instance by calling
+// Core_initialize_block. The build must be committed or discarded, and other blocks are executed after it.
+func (b *BlockBuilder) BuildBlock(header *types.BlockHeader) (*BlockBuild, error) {
+	enc, err := header.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	b.rt.blockLock.Lock()
+	build := &BlockBuild{
+		rt:   b.rt,
+		code: b.rt.currentCode(),
+	}
+	build.code.block.storage.begin()
+
+	_, err = build.exec(coreInitializeBlock, enc)
+	if err != nil {
+		build.Discard()
+		return nil, err
+	}
+
+	return build, nil
+}
+
+// BlockBuild is a block being built. The changes it makes to the state are kept in an overlay, which is written to
+// the trie when the build is committed and dropped when it is discarded, so a block that fails to build leaves the
+// state unchanged.
+type BlockBuild struct {
+	rt   *Runtime
+	code *code
+	done bool
+}
+
+func (b *BlockBuild) exec(function string, data []byte) ([]byte, error) {
+	if b.done {
+		return nil, ErrBuildDone
+	}
+
+	b.rt.lock.Lock()
+	defer b.rt.lock.Unlock()
+
+	return b.code.block.exec(function, data)
+}
+
+// Commit writes the changes the block made to the state to the trie
+func (b *BlockBuild) Commit() error {
+	if b.done {
+		return ErrBuildDone
+	}
+	b.done = true
+	defer b.rt.blockLock.Unlock()
+
+	b.rt.lock.Lock()
+	defer b.rt.lock.Unlock()
+
+	return b.code.block.storage.commit()
+}
+
+// Discard drops the changes the block made to the state. It does nothing if the build is already done, so it can be
+// deferred.
+func (b *BlockBuild) Discard() {
+	if b.done {
+		return
+	}
+	b.done = true
+
+	b.code.block.storage.discard()
+	b.rt.blockLock.Unlock()
+}
+
+// ApplyExtrinsic applies the extrinsic to the block by calling BlockBuilder_apply_extrinsic. It returns an
+// ApplyError if the runtime rejected the extrinsic, in which case it must not be included in the block.
+func (b *BlockBuild) ApplyExtrinsic(ext types.Extrinsic) error {
+	ret, err := b.exec(blockBuilderApplyExtrinsic, ext)
+	if err != nil {
+		return err
+	}
+
+	if len(ret) == 0 {
+		return ErrEmptyResult
+	}
+
+	// the result is Ok(outcome) or Err(error); an extrinsic whose dispatch failed is still included
+	if ret[0] == 0 {
+		return nil
+	}
+
+	if len(ret) < 2 {
+		return ErrEmptyResult
+	}
+
+	return ApplyError(ret[1])
+}
+
+// InherentExtrinsics returns the inherent extrinsics created by the runtime from the inherent data by calling
+// BlockBuilder_inherent_extrinsics
+func (b *BlockBuild) InherentExtrinsics(data *types.InherentData) ([]types.Extrinsic, error) {
+	enc, err := data.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := b.exec(blockBuilderInherents, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.BlockBody(ret).Extrinsics()
+}
+
+// FinalizeBlock finishes the execution of the block and returns its header by calling BlockBuilder_finalize_block
+func (b *BlockBuild) FinalizeBlock() (*types.BlockHeader, error) {
+	ret, err := b.exec(blockBuilderFinalizeBlock, []byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	header := new(types.BlockHeader)
+	err = header.Decode(bytes.NewReader(ret))
+	if err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// CheckInherents checks the inherent extrinsics of the block against the inherent data by calling
+// BlockBuilder_check_inherents
+func (b *BlockBuilder) CheckInherents(block *types.Block, data *types.InherentData) (*types.CheckInherentsResult, error) {
+	enc, err := block.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := data.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := b.rt.Call(blockBuilderCheckInherents, append(enc, d...))
+	if err != nil {
+		return nil, err
+	}
+
+	res := new(types.CheckInherentsResult)
+	err = res.Decode(bytes.NewReader(ret))
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
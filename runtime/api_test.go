@@ -0,0 +1,168 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/trie"
+)
+
+func TestCore_Version(t *testing.T) {
+	expected := &Version{
+		Spec_name:         []byte("test"),
+		Impl_name:         []byte("parity-test"),
+		Authoring_version: 1,
+		Spec_version:      1,
+		Impl_version:      1,
+	}
+
+	r, err := newRuntime(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := r.Core().Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(version, expected) {
+		t.Fatalf("Fail: got %v expected %v", version, expected)
+	}
+}
+
+func TestNewRuntime_MissingExports(t *testing.T) {
+	// a wasm module which only exports an empty Core_version function
+	code := []byte{
+		0, 'a', 's', 'm', 1, 0, 0, 0,
+		1, 4, 1, 0x60, 0, 0, // type section: func() -> ()
+		3, 2, 1, 0, // function section
+		7, 16, 1, 12, 'C', 'o', 'r', 'e', '_', 'v', 'e', 'r', 's', 'i', 'o', 'n', 0, 0, // export section
+		10, 4, 1, 2, 0, 0x0b, // code section
+	}
+
+	_, err := NewRuntime(code, &trie.Trie{})
+	if err == nil || err.Error() != "runtime code does not export Core_execute_block" {
+		t.Fatalf("Fail: got %v expected missing export error", err)
+	}
+}
+
+func TestApplyError(t *testing.T) {
+	for _, e := range []ApplyError{ErrBadSignature, ErrStale, ErrFuture, ErrCantPay, ErrFullBlock, ApplyError(4)} {
+		var err error = e
+		if err.Error() == "" {
+			t.Fatalf("Fail: no message for apply error %d", e)
+		}
+	}
+
+	if ErrFullBlock.Error() != "block is full" {
+		t.Fatalf("Fail: got %s", ErrFullBlock.Error())
+	}
+}
+
+func TestBlockBuild(t *testing.T) {
+	r, err := newRuntime(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := r.StorageRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := &types.BlockHeader{Number: big.NewInt(1)}
+
+	// a discarded block leaves the state unchanged
+	build, err := r.BlockBuilder().BuildBlock(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = build.FinalizeBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	build.Discard()
+
+	after, err := r.StorageRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != root {
+		t.Fatalf("Fail: got root %s after discarding block expected %s", after, root)
+	}
+
+	_, err = build.FinalizeBlock()
+	if err != ErrBuildDone {
+		t.Fatalf("Fail: got %v expected %v", err, ErrBuildDone)
+	}
+
+	// a committed block changes the state to the state root in its header
+	build, err = r.BlockBuilder().BuildBlock(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer build.Discard()
+
+	finalized, err := build.FinalizeBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = build.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err = r.StorageRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != finalized.StateRoot {
+		t.Fatalf("Fail: got root %s after committing block expected %s", after, finalized.StateRoot)
+	}
+}
+
+func TestBabeAPI_Configuration(t *testing.T) {
+	r, err := newRuntime(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := r.BabeAPI().Configuration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// see: https://github.com/paritytech/substrate/blob/7b1d822446982013fa5b7ad5caff35ca84f8b7d0/core/test-runtime/src/lib.rs#L621
+	expected := &BabeConfiguration{
+		SlotDuration:       1000,
+		EpochLength:        6,
+		C1:                 3,
+		C2:                 10,
+		GenesisAuthorities: []Authority{},
+	}
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("Fail: got %v expected %v", cfg, expected)
+	}
+}
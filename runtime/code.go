@@ -0,0 +1,181 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/ChainSafe/gossamer/common"
+	allocator "github.com/ChainSafe/gossamer/runtime/allocator"
+	trie "github.com/ChainSafe/gossamer/trie"
+	log "github.com/ChainSafe/log15"
+	wasm "github.com/wasmerio/go-ext-wasm/wasmer"
+)
+
+// code is a compiled version of the runtime code with the instances created from it: a dedicated
+// instance for block execution and a pool of instances for read-only calls
+type code struct {
+	hash   common.Hash
+	module wasm.Module
+	trie   *trie.Trie
+	block  *instance
+
+	pool      chan *instance
+	instances []*instance
+	size      int
+	mutex     sync.Mutex
+}
+
+// newCode compiles the wasm bytecode, checks that it exports the runtime API and instantiates its
+// block execution instance. Up to size instances are created for read-only calls when they are needed.
+func newCode(bytecode []byte, t *trie.Trie, size int) (*code, error) {
+	hash, err := common.Blake2bHash(bytecode)
+	if err != nil {
+		return nil, err
+	}
+
+	module, err := wasm.Compile(bytecode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkExports(module)
+	if err != nil {
+		module.Close()
+		return nil, err
+	}
+
+	c := &code{
+		hash:   hash,
+		module: module,
+		trie:   t,
+		pool:   make(chan *instance, size),
+		size:   size,
+	}
+
+	c.block, err = c.newInstance(false)
+	if err != nil {
+		module.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// newInstance instantiates the module and adds the instance's context to the registry
+func (c *code) newInstance(readOnly bool) (*instance, error) {
+	imports, err := registerImports()
+	if err != nil {
+		return nil, err
+	}
+
+	vm, err := c.module.InstantiateWithImports(imports)
+	if err != nil {
+		return nil, err
+	}
+
+	inst := &instance{
+		vm:      vm,
+		storage: newStorage(c.trie, readOnly),
+		memory:  vm.Memory,
+	}
+	inst.allocator = allocator.NewAllocator(&inst.memory, 0)
+
+	// add runtimeCtx to registry
+	// lock access to registry to avoid possible concurrent access
+	mutex.Lock()
+	index := handlers
+	handlers++
+	if registry == nil {
+		registry = make(map[int]RuntimeCtx)
+	}
+	registry[index] = RuntimeCtx{
+		storage:   inst.storage,
+		allocator: inst.allocator,
+		memory:    &inst.memory,
+	}
+	mutex.Unlock()
+
+	log.Debug("[NewRuntime]", "index", index, "readOnly", readOnly, "code", c.hash)
+	//nolint:gosec
+	data := unsafe.Pointer(&index)
+	inst.vm.SetContextData(data)
+	inst.index = index
+
+	// Core_version allocates its output, which sets the instance's memory before anything is
+	// stored in it
+	_, err = inst.vm.Exports[coreVersion](0, 0)
+	if err != nil {
+		inst.vm.Close()
+		return nil, err
+	}
+
+	return inst, nil
+}
+
+// checkout returns an idle read-only instance, instantiating a new one if none is idle and the
+// pool is not full yet
+func (c *code) checkout() (*instance, error) {
+	select {
+	case inst := <-c.pool:
+		return inst, nil
+	default:
+	}
+
+	c.mutex.Lock()
+	if len(c.instances) < c.size {
+		inst, err := c.newInstance(true)
+		if err == nil {
+			c.instances = append(c.instances, inst)
+		}
+		c.mutex.Unlock()
+		return inst, err
+	}
+	c.mutex.Unlock()
+
+	return <-c.pool, nil
+}
+
+// release discards the storage changes of the last call and returns the instance to the pool
+func (c *code) release(inst *instance) {
+	inst.storage.reset()
+	c.pool <- inst
+}
+
+// indices returns the registry indices of the code's instances
+func (c *code) indices() []int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	indices := []int{c.block.index}
+	for _, inst := range c.instances {
+		indices = append(indices, inst.index)
+	}
+	return indices
+}
+
+func (c *code) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.block.vm.Close()
+	for _, inst := range c.instances {
+		inst.vm.Close()
+	}
+	c.module.Close()
+}
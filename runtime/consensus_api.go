@@ -0,0 +1,214 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	scale "github.com/ChainSafe/gossamer/codec"
+	"github.com/ChainSafe/gossamer/core/types"
+	"github.com/ChainSafe/gossamer/crypto"
+)
+
+const (
+	babeAPIConfiguration             = "BabeApi_configuration"
+	babeAPIGenerateKeyOwnershipProof = "BabeApi_generate_key_ownership_proof"
+	babeAPISubmitReportEquivocation  = "BabeApi_submit_report_equivocation_unsigned_extrinsic"
+	auraAPISlotDuration              = "AuraApi_slot_duration"
+	auraAPIAuthorities               = "AuraApi_authorities"
+	grandpaAPIGrandpaAuthorities     = "GrandpaApi_grandpa_authorities"
+)
+
+// Authority is the public key and weight of a consensus authority
+type Authority struct {
+	Key    [32]byte
+	Weight uint64
+}
+
+// BabeConfiguration is the BABE configuration of the runtime
+type BabeConfiguration struct {
+	SlotDuration       uint64 // milliseconds
+	EpochLength        uint64 // duration of epoch in slots
+	C1                 uint64 // (1-(c1/c2)) is the probability of a slot being empty
+	C2                 uint64
+	GenesisAuthorities []Authority
+	Randomness         [32]byte
+	SecondarySlots     bool
+}
+
+// BabeAPI calls the functions of the runtime's BabeApi
+type BabeAPI struct {
+	rt *Runtime
+}
+
+// BabeAPI returns the runtime's BabeApi
+func (r *Runtime) BabeAPI() *BabeAPI {
+	return &BabeAPI{rt: r}
+}
+
+// Configuration returns the BABE configuration by calling BabeApi_configuration
+func (b *BabeAPI) Configuration() (*BabeConfiguration, error) {
+	ret, err := b.rt.Call(babeAPIConfiguration, []byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &BabeConfiguration{GenesisAuthorities: []Authority{}}
+	_, err = scale.Decode(ret, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// GenerateKeyOwnershipProof returns a proof that the key was part of the authority set at the slot by calling
+// BabeApi_generate_key_ownership_proof, or nil if the runtime cannot prove it
+func (b *BabeAPI) GenerateKeyOwnershipProof(slot uint64, key [32]byte) ([]byte, error) {
+	in := make([]byte, 8, 40)
+	binary.LittleEndian.PutUint64(in, slot)
+	in = append(in, key[:]...)
+
+	ret, err := b.rt.Exec(babeAPIGenerateKeyOwnershipProof, in)
+	if err != nil {
+		return nil, err
+	}
+
+	// the proof is an Option<Vec<u8>>, which is passed on as is without the option byte
+	if len(ret) == 0 || ret[0] == 0 {
+		return nil, nil
+	}
+
+	return ret[1:], nil
+}
+
+// SubmitReportEquivocation submits an equivocation report extrinsic with the key ownership proof of the offender by
+// calling BabeApi_submit_report_equivocation_unsigned_extrinsic, and returns whether the runtime submitted it
+func (b *BabeAPI) SubmitReportEquivocation(proof *types.EquivocationProof, keyOwnershipProof []byte) (bool, error) {
+	enc, err := proof.Encode()
+	if err != nil {
+		return false, err
+	}
+
+	ret, err := b.rt.Exec(babeAPISubmitReportEquivocation, append(enc, keyOwnershipProof...))
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(ret, []byte{1}), nil
+}
+
+// AuraAPI calls the functions of the runtime's AuraApi
+type AuraAPI struct {
+	rt *Runtime
+}
+
+// AuraAPI returns the runtime's AuraApi
+func (r *Runtime) AuraAPI() *AuraAPI {
+	return &AuraAPI{rt: r}
+}
+
+// SlotDuration returns the slot duration in milliseconds by calling AuraApi_slot_duration
+func (a *AuraAPI) SlotDuration() (uint64, error) {
+	ret, err := a.rt.Call(auraAPISlotDuration, []byte{})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(ret) != 8 {
+		return 0, errors.New("invalid Aura slot duration")
+	}
+
+	return binary.LittleEndian.Uint64(ret), nil
+}
+
+// Authorities returns the authorities by calling AuraApi_authorities
+func (a *AuraAPI) Authorities() ([]*crypto.Sr25519PublicKey, error) {
+	ret, err := a.rt.Call(auraAPIAuthorities, []byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(ret)
+	sd := scale.Decoder{Reader: r}
+	n, err := sd.DecodeInteger()
+	if err != nil {
+		return nil, err
+	}
+
+	authorities := make([]*crypto.Sr25519PublicKey, n)
+	for i := range authorities {
+		buf := [32]byte{}
+		_, err = io.ReadFull(r, buf[:])
+		if err != nil {
+			return nil, err
+		}
+
+		authorities[i] = new(crypto.Sr25519PublicKey)
+		err = authorities[i].Decode(buf[:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return authorities, nil
+}
+
+// GrandpaAPI calls the functions of the runtime's GrandpaApi
+type GrandpaAPI struct {
+	rt *Runtime
+}
+
+// GrandpaAPI returns the runtime's GrandpaApi
+func (r *Runtime) GrandpaAPI() *GrandpaAPI {
+	return &GrandpaAPI{rt: r}
+}
+
+// Authorities returns the GRANDPA authority set by calling GrandpaApi_grandpa_authorities
+func (g *GrandpaAPI) Authorities() ([]Authority, error) {
+	ret, err := g.rt.Call(grandpaAPIGrandpaAuthorities, []byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(ret)
+	sd := scale.Decoder{Reader: r}
+	n, err := sd.DecodeInteger()
+	if err != nil {
+		return nil, err
+	}
+
+	authorities := make([]Authority, n)
+	buf := make([]byte, 8)
+	for i := range authorities {
+		_, err = io.ReadFull(r, authorities[i].Key[:])
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = io.ReadFull(r, buf)
+		if err != nil {
+			return nil, err
+		}
+		authorities[i].Weight = binary.LittleEndian.Uint64(buf)
+	}
+
+	return authorities, nil
+}
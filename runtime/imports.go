@@ -72,7 +72,7 @@ import (
 	wasm "github.com/wasmerio/go-ext-wasm/wasmer"
 )
 
-// registry stores the RuntimeCtx for Runtimes to work around the limitation of
+// registry stores the RuntimeCtx for runtime instances to work around the limitation of
 // CGo which prevents passing Go pointers that point to other Go pointers
 // across the FFI.
 var registry map[int]RuntimeCtx
@@ -93,6 +93,9 @@ func ext_malloc(context unsafe.Pointer, size int32) int32 {
 	runtimeCtx := registry[*(*int)(instanceContext.Data())]
 	mutex.RUnlock()
 
+	// the allocator uses the instance memory, which is only known here
+	*runtimeCtx.memory = *instanceContext.Memory()
+
 	// Allocate memory
 	res, err := runtimeCtx.allocator.Allocate(uint32(size))
 	if err != nil {
@@ -151,10 +154,10 @@ func ext_get_storage_into(context unsafe.Pointer, keyData, keyLen, valueData, va
 	mutex.RLock()
 	runtimeCtx := registry[*(*int)(instanceContext.Data())]
 	mutex.RUnlock()
-	t := runtimeCtx.trie
+	s := runtimeCtx.storage
 
 	key := memory[keyData : keyData+keyLen]
-	val, err := t.Get(key)
+	val, err := s.get(key)
 	if err != nil {
 		log.Error("[ext_get_storage_into]", "err", err)
 		ret := 1<<32 - 1
@@ -186,12 +189,14 @@ func ext_set_storage(context unsafe.Pointer, keyData, keyLen, valueData, valueLe
 	mutex.RLock()
 	runtimeCtx := registry[*(*int)(instanceContext.Data())]
 	mutex.RUnlock()
-	t := runtimeCtx.trie
+	s := runtimeCtx.storage
 
 	key := memory[keyData : keyData+keyLen]
-	val := memory[valueData : valueData+valueLen]
+	// copy the value out of wasm memory, which the runtime will reuse
+	val := make([]byte, valueLen)
+	copy(val, memory[valueData:valueData+valueLen])
 	log.Trace("[ext_set_storage]", "key", key, "val", val)
-	err := t.Put(key, val)
+	err := s.put(key, val)
 	if err != nil {
 		log.Error("[ext_set_storage]", "error", err)
 	}
@@ -221,9 +226,9 @@ func ext_storage_root(context unsafe.Pointer, resultPtr int32) {
 	mutex.RLock()
 	runtimeCtx := registry[*(*int)(instanceContext.Data())]
 	mutex.RUnlock()
-	t := runtimeCtx.trie
+	s := runtimeCtx.storage
 
-	root, err := t.Hash()
+	root, err := s.root()
 	if err != nil {
 		log.Error("[ext_storage_root]", "error", err)
 		return
@@ -251,10 +256,10 @@ func ext_get_allocated_storage(context unsafe.Pointer, keyData, keyLen, writtenO
 	mutex.RLock()
 	runtimeCtx := registry[*(*int)(instanceContext.Data())]
 	mutex.RUnlock()
-	t := runtimeCtx.trie
+	s := runtimeCtx.storage
 
 	key := memory[keyData : keyData+keyLen]
-	val, err := t.Get(key)
+	val, err := s.get(key)
 	if err == nil && len(val) >= (1<<32) {
 		err = errors.New("retrieved value length exceeds 2^32")
 	}
@@ -264,25 +269,26 @@ func ext_get_allocated_storage(context unsafe.Pointer, keyData, keyLen, writtenO
 		return 0
 	}
 
-	// writtenOut stores the location of the 4 bytes of memory that was allocated
-	var lenPtr int32 = 1
-	memory[writtenOut] = byte(lenPtr)
+	// writtenOut is the location the length of the value is written to, or u32::MAX if it doesn't exist
 	if val == nil {
-		copy(memory[lenPtr:lenPtr+4], []byte{0xff, 0xff, 0xff, 0xff})
+		copy(memory[writtenOut:writtenOut+4], []byte{0xff, 0xff, 0xff, 0xff})
 		return 0
 	}
 
-	// copy value to memory
-	var ptr int32 = lenPtr + 4
-	copy(memory[ptr:ptr+int32(len(val))], val)
+	// copy value to newly allocated memory
+	ptr, err := runtimeCtx.allocator.Allocate(uint32(len(val)))
+	if err != nil {
+		log.Error("[ext_get_allocated_storage]", "error", err)
+		copy(memory[writtenOut:writtenOut+4], []byte{0xff, 0xff, 0xff, 0xff})
+		return 0
+	}
+	copy(memory[ptr:ptr+uint32(len(val))], val)
 
 	// copy length to memory
-	byteLen := make([]byte, 4)
-	binary.LittleEndian.PutUint32(byteLen, uint32(len(val)))
-	copy(memory[lenPtr:lenPtr+4], byteLen)
+	binary.LittleEndian.PutUint32(memory[writtenOut:writtenOut+4], uint32(len(val)))
 
 	// return ptr to value
-	return ptr
+	return int32(ptr)
 }
 
 // deletes the trie entry with key at memory location `keyData` with length `keyLen`
@@ -296,10 +302,10 @@ func ext_clear_storage(context unsafe.Pointer, keyData, keyLen int32) {
 	mutex.RLock()
 	runtimeCtx := registry[*(*int)(instanceContext.Data())]
 	mutex.RUnlock()
-	t := runtimeCtx.trie
+	s := runtimeCtx.storage
 
 	key := memory[keyData : keyData+keyLen]
-	err := t.Delete(key)
+	err := s.delete(key)
 	if err != nil {
 		log.Error("[ext_storage_root]", "error", err)
 	}
@@ -316,13 +322,13 @@ func ext_clear_prefix(context unsafe.Pointer, prefixData, prefixLen int32) {
 	mutex.RLock()
 	runtimeCtx := registry[*(*int)(instanceContext.Data())]
 	mutex.RUnlock()
-	t := runtimeCtx.trie
+	s := runtimeCtx.storage
 
 	prefix := memory[prefixData : prefixData+prefixLen]
-	entries := t.Entries()
+	entries := s.entries()
 	for k := range entries {
 		if bytes.Equal([]byte(k)[:prefixLen], prefix) {
-			err := t.Delete([]byte(k))
+			err := s.delete([]byte(k))
 			if err != nil {
 				log.Error("[ext_clear_prefix]", "err", err)
 			}
@@ -0,0 +1,128 @@
+// Copyright 2019 ChainSafe Systems (ON) Corp.
+// This file is part of gossamer.
+//
+// The gossamer library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The gossamer library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the gossamer library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"github.com/ChainSafe/gossamer/common"
+	trie "github.com/ChainSafe/gossamer/trie"
+)
+
+// storage is the view of the state trie that an instance's import functions read and write.
+// Instances serving read-only calls keep their writes in an overlay that is discarded after
+// every call, so those calls never modify the trie and can run alongside each other. The block
+// execution instance keeps its writes in an overlay while a block is built, until the block is
+// committed or discarded.
+type storage struct {
+	trie    *trie.Trie
+	overlay map[string][]byte // nil if writes go to the trie, a nil value marks a deleted key
+}
+
+func newStorage(t *trie.Trie, readOnly bool) *storage {
+	s := &storage{trie: t}
+	if readOnly {
+		s.overlay = make(map[string][]byte)
+	}
+	return s
+}
+
+// begin makes writes go to an overlay until they are committed or discarded
+func (s *storage) begin() {
+	s.overlay = make(map[string][]byte)
+}
+
+// commit writes the overlay to the trie, after which writes go to the trie again
+func (s *storage) commit() error {
+	for k, v := range s.overlay {
+		var err error
+		if v == nil {
+			err = s.trie.Delete([]byte(k))
+		} else {
+			err = s.trie.Put([]byte(k), v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	s.overlay = nil
+	return nil
+}
+
+// discard drops the overlay, after which writes go to the trie again
+func (s *storage) discard() {
+	s.overlay = nil
+}
+
+// reset discards the writes of the last call
+func (s *storage) reset() {
+	if s.overlay != nil {
+		s.overlay = make(map[string][]byte)
+	}
+}
+
+func (s *storage) get(key []byte) ([]byte, error) {
+	if s.overlay != nil {
+		if val, ok := s.overlay[string(key)]; ok {
+			return val, nil
+		}
+	}
+	return s.trie.Get(key)
+}
+
+func (s *storage) put(key, value []byte) error {
+	if s.overlay != nil {
+		s.overlay[string(key)] = value
+		return nil
+	}
+	return s.trie.Put(key, value)
+}
+
+func (s *storage) delete(key []byte) error {
+	if s.overlay != nil {
+		s.overlay[string(key)] = nil
+		return nil
+	}
+	return s.trie.Delete(key)
+}
+
+func (s *storage) entries() map[string][]byte {
+	entries := s.trie.Entries()
+	for k, v := range s.overlay {
+		if v == nil {
+			delete(entries, k)
+		} else {
+			entries[k] = v
+		}
+	}
+	return entries
+}
+
+// root returns the trie root as it would be with the overlay applied
+func (s *storage) root() (common.Hash, error) {
+	if len(s.overlay) == 0 {
+		return s.trie.Hash()
+	}
+
+	t := &trie.Trie{}
+	for k, v := range s.entries() {
+		err := t.Put([]byte(k), v)
+		if err != nil {
+			return common.Hash{}, err
+		}
+	}
+	return t.Hash()
+}
@@ -19,10 +19,8 @@ package runtime
 import (
 	"bytes"
 	"errors"
-	"fmt"
 	"runtime"
 	"sync"
-	"unsafe"
 
 	scale "github.com/ChainSafe/gossamer/codec"
 	"github.com/ChainSafe/gossamer/common"
@@ -32,15 +30,65 @@ import (
 	wasm "github.com/wasmerio/go-ext-wasm/wasmer"
 )
 
+// ErrExportFunctionNotFound is returned when the runtime does not export the called function
+var ErrExportFunctionNotFound = errors.New("could not find exported function")
+
+// ErrUnknownCode is returned when executing a version of the runtime code the runtime has not loaded
+var ErrUnknownCode = errors.New("unknown runtime code")
+
+// CodeKey is the storage key of the runtime wasm code
+var CodeKey = []byte(":code")
+
+// DefaultInstances is the number of instances a runtime creates at most for read-only calls
+const DefaultInstances = 4
+
 type RuntimeCtx struct {
-	trie      *trie.Trie
+	storage   *storage
+	allocator *allocator.FreeingBumpHeapAllocator
+	memory    *wasm.Memory
+}
+
+// instance is a single instantiation of the runtime module with its own memory, allocator and
+// storage context
+type instance struct {
+	vm        wasm.Instance
 	allocator *allocator.FreeingBumpHeapAllocator
+	storage   *storage
+	index     int
+
+	// memory is the instance's memory. The memory exported by wasm.Instance refers to the memory
+	// of whichever instance was created last, so it is replaced with the memory from the instance
+	// context the first time the instance calls ext_malloc.
+	memory wasm.Memory
 }
 
+// Runtime executes calls on instances of the runtime code stored in the trie. Calls that change
+// the state are serialised on a dedicated block execution instance, while read-only calls are
+// checked out to a pool of instances and run in parallel with each other.
+//
+// Exec takes blockLock and then lock for writing, and Call holds lock for reading, so read-only
+// calls wait while a block is executed, and a block execution waits for the running calls to
+// finish; a read-only call never sees the state of a half-executed block. A block build takes
+// blockLock until it is committed or discarded, and lock for writing only while one of its
+// functions runs, so read-only calls run between the steps of a build and see the state from
+// before it.
+//
+// When a block changes the code, the new code is compiled and used for later calls, while the
+// previous versions are kept for executing blocks on top of older states until they are pruned.
 type Runtime struct {
-	vm    wasm.Instance
-	trie  *trie.Trie
-	mutex sync.Mutex
+	trie *trie.Trie
+	size int
+
+	// lock is held for writing while a block instance runs and for reading by read-only calls
+	lock sync.RWMutex
+
+	// blockLock is held while a block is executed, and by a block build until it is committed or
+	// discarded, so the block execution instance only works on one block at a time
+	blockLock sync.Mutex
+
+	codeLock sync.RWMutex
+	current  *code
+	codes    map[common.Hash]*code
 }
 
 // NewRuntimeFromFile instantiates a runtime from a .wasm file
@@ -56,56 +104,45 @@ func NewRuntimeFromFile(fp string, t *trie.Trie) (*Runtime, error) {
 
 // NewRuntime instantiates a runtime from raw wasm bytecode
 func NewRuntime(code []byte, t *trie.Trie) (*Runtime, error) {
+	return NewRuntimeWithInstances(code, t, DefaultInstances)
+}
+
+// NewRuntimeWithInstances instantiates a runtime from raw wasm bytecode which uses up to n instances
+// for read-only calls. The module is compiled once and instantiated for every instance.
+func NewRuntimeWithInstances(bytecode []byte, t *trie.Trie, n int) (*Runtime, error) {
 	if t == nil {
 		return nil, errors.New("runtime does not have storage trie")
 	}
 
-	imports, err := registerImports()
-	if err != nil {
-		return nil, err
+	if n < 1 {
+		return nil, errors.New("runtime needs at least one instance for read-only calls")
 	}
 
-	// Instantiates the WebAssembly module.
-	instance, err := wasm.NewInstanceWithImports(code, imports)
+	c, err := newCode(bytecode, t, n)
 	if err != nil {
 		return nil, err
 	}
 
-	memAllocator := allocator.NewAllocator(&instance.Memory, 0)
-
-	runtimeCtx := &RuntimeCtx{
-		trie:      t,
-		allocator: memAllocator,
-	}
-	// add runtimeCtx to registry
-	// lock access to registry to avoid possible concurrent access
-	mutex.Lock()
-	index := handlers
-	handlers++
-	if registry == nil {
-		registry = make(map[int]RuntimeCtx)
-	}
-	registry[index] = *runtimeCtx
-	mutex.Unlock()
-
-	log.Debug("[NewRuntime]", "index", index)
-	log.Debug("[NewRuntime]", "runtimeCtx", runtimeCtx)
-	//nolint:gosec
-	data := unsafe.Pointer(&index)
-	instance.SetContextData(data)
-
 	r := &Runtime{
-		vm:    instance,
-		trie:  t,
-		mutex: sync.Mutex{},
+		trie:    t,
+		size:    n,
+		current: c,
+		codes:   map[common.Hash]*code{c.hash: c},
 	}
 
 	// Clean up the registry if r is GC'd
-	runtime.SetFinalizer(r, func(_ *Runtime) {
+	runtime.SetFinalizer(r, func(r *Runtime) {
+		indices := []int{}
+		for _, c := range r.codes {
+			indices = append(indices, c.indices()...)
+		}
+
 		// Launch a goroutine to avoid blocking the GC...
 		go func() {
 			mutex.Lock()
-			delete(registry, index)
+			for _, index := range indices {
+				delete(registry, index)
+			}
 			mutex.Unlock()
 		}()
 	})
@@ -114,33 +151,214 @@ func NewRuntime(code []byte, t *trie.Trie) (*Runtime, error) {
 }
 
 func (r *Runtime) Stop() {
-	r.vm.Close()
+	r.codeLock.Lock()
+	defer r.codeLock.Unlock()
+
+	for _, c := range r.codes {
+		c.close()
+	}
 }
 
 func (r *Runtime) StorageRoot() (common.Hash, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
 	return r.trie.Hash()
 }
 
-func (r *Runtime) Store(data []byte, location int32) {
-	mem := r.vm.Memory.Data()
+// StoreState writes the state trie and its root hash to the trie's database, if it has one, so the node resumes
+// from this state when it restarts. It waits for the block being executed or built, if any.
+func (r *Runtime) StoreState() error {
+	r.blockLock.Lock()
+	defer r.blockLock.Unlock()
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.trie.Db() == nil {
+		return nil
+	}
+
+	err := r.trie.StoreInDB()
+	if err != nil {
+		return err
+	}
+	return r.trie.StoreHash()
+}
+
+// CodeHash returns the hash of the runtime code that calls are executed with
+func (r *Runtime) CodeHash() common.Hash {
+	r.codeLock.RLock()
+	defer r.codeLock.RUnlock()
+	return r.current.hash
+}
+
+// UpdateCode switches to the code stored in the trie at CodeKey if a block execution changed it,
+// and returns whether it did. Calls made while the new code is compiled still use the old code.
+func (r *Runtime) UpdateCode() (bool, error) {
+	r.lock.RLock()
+	bytecode, err := r.trie.Get(CodeKey)
+	r.lock.RUnlock()
+	if err != nil {
+		return false, err
+	}
+
+	if len(bytecode) == 0 {
+		return false, nil
+	}
+
+	hash, err := common.Blake2bHash(bytecode)
+	if err != nil {
+		return false, err
+	}
+
+	r.codeLock.RLock()
+	c, ok := r.codes[hash]
+	current := r.current.hash
+	r.codeLock.RUnlock()
+
+	if hash == current {
+		return false, nil
+	}
+
+	if !ok {
+		c, err = newCode(bytecode, r.trie, r.size)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	r.codeLock.Lock()
+	r.codes[hash] = c
+	r.current = c
+	r.codeLock.Unlock()
+
+	log.Info("[runtime] switched runtime code", "previous", current, "code", hash)
+	return true, nil
+}
+
+func (r *Runtime) currentCode() *code {
+	r.codeLock.RLock()
+	defer r.codeLock.RUnlock()
+	return r.current
+}
+
+// PruneCodes closes and removes the runtime codes that blocks are no longer executed with, which are all codes but
+// the current one and those with the given hashes. It waits for the block being executed or built, if any, and for
+// the running read-only calls.
+func (r *Runtime) PruneCodes(keep []common.Hash) {
+	r.blockLock.Lock()
+	defer r.blockLock.Unlock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	kept := make(map[common.Hash]bool)
+	for _, hash := range keep {
+		kept[hash] = true
+	}
+
+	r.codeLock.Lock()
+	defer r.codeLock.Unlock()
+
+	for hash, c := range r.codes {
+		if c == r.current || kept[hash] {
+			continue
+		}
+
+		indices := c.indices()
+		c.close()
+		delete(r.codes, hash)
+
+		mutex.Lock()
+		for _, index := range indices {
+			delete(registry, index)
+		}
+		mutex.Unlock()
+
+		log.Debug("[runtime] pruned runtime code", "code", hash)
+	}
+}
+
+// Exec calls the exported runtime function with the data as its input on the block execution
+// instance, and returns its output. Changes the function makes to storage are written to the trie.
+func (r *Runtime) Exec(function string, data []byte) ([]byte, error) {
+	r.blockLock.Lock()
+	defer r.blockLock.Unlock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.currentCode().block.exec(function, data)
+}
+
+// ExecWithCode is like Exec, but runs the function with the runtime code with the given hash, which
+// is the code a block has to be executed with if it builds on an older state
+func (r *Runtime) ExecWithCode(hash common.Hash, function string, data []byte) ([]byte, error) {
+	r.blockLock.Lock()
+	defer r.blockLock.Unlock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// the code is looked up under the locks, so it cannot be pruned while it runs
+	r.codeLock.RLock()
+	c, ok := r.codes[hash]
+	r.codeLock.RUnlock()
+	if !ok {
+		return nil, ErrUnknownCode
+	}
+
+	return c.block.exec(function, data)
+}
+
+// Call calls the exported runtime function with the data as its input on an instance from the
+// pool, and returns its output. Changes the function makes to storage are discarded, so any
+// number of calls can run in parallel.
+func (r *Runtime) Call(function string, data []byte) ([]byte, error) {
+	// the code is checked out under the lock, so it cannot be pruned while it runs
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	c := r.currentCode()
+	inst, err := c.checkout()
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(inst)
+
+	return inst.exec(function, data)
+}
+
+func (inst *instance) store(data []byte, location int32) {
+	mem := inst.memory.Data()
 	copy(mem[location:location+int32(len(data))], data)
 }
 
-func (r *Runtime) Load(location, length int32) []byte {
-	mem := r.vm.Memory.Data()
+func (inst *instance) load(location, length int32) []byte {
+	mem := inst.memory.Data()
 	return mem[location : location+length]
 }
 
-func (r *Runtime) Exec(function string, loc int32, data []byte) ([]byte, error) {
-	r.mutex.Lock()
+func (inst *instance) exec(function string, data []byte) ([]byte, error) {
+	// Store the data in memory allocated from the heap, so the runtime does not allocate over it while running
+	ptr, err := inst.allocator.Allocate(uint32(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := inst.allocator.Deallocate(ptr)
+		if err != nil {
+			log.Error("[Exec] cannot free input data", "error", err)
+		}
+	}()
 
-	// Store the data into memory
-	r.Store(data, loc)
+	loc := int32(ptr)
+	inst.store(data, loc)
 	leng := int32(len(data))
 
-	runtimeFunc, ok := r.vm.Exports[function]
+	runtimeFunc, ok := inst.vm.Exports[function]
 	if !ok {
-		return nil, errors.New("could not find exported function")
+		return nil, ErrExportFunctionNotFound
 	}
 	res, err := runtimeFunc(loc, leng)
 	if err != nil {
@@ -150,12 +368,9 @@ func (r *Runtime) Exec(function string, loc int32, data []byte) ([]byte, error)
 
 	length := int32(resi >> 32)
 	offset := int32(resi)
-	fmt.Printf("offset %d length %d\n", offset, length)
-	mem := r.vm.Memory.Data()
+	log.Trace("[Exec]", "function", function, "offset", offset, "length", length)
 	rawdata := make([]byte, length)
-	copy(rawdata, mem[offset:offset+length])
-
-	r.mutex.Unlock()
+	copy(rawdata, inst.load(offset, length))
 
 	return rawdata, err
 }
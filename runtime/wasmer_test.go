@@ -21,7 +21,9 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -106,7 +108,7 @@ func TestExecVersion(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	ret, err := r.Exec("Core_version", 1, []byte{})
+	ret, err := r.Exec("Core_version", []byte{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -182,7 +184,7 @@ func TestExt_get_storage_into(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 
 	// store kv pair in trie
 	key := []byte(":noot")
@@ -200,7 +202,7 @@ func TestExt_get_storage_into(t *testing.T) {
 	valueOffset := 0
 	copy(mem[keyData:keyData+len(key)], key)
 
-	testFunc, ok := runtime.vm.Exports["test_ext_get_storage_into"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_get_storage_into"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -232,7 +234,7 @@ func TestExt_set_storage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 
 	// key,value we wish to store in the trie
 	key := []byte(":noot")
@@ -244,7 +246,7 @@ func TestExt_set_storage(t *testing.T) {
 	copy(mem[keyData:keyData+len(key)], key)
 	copy(mem[valueData:valueData+len(value)], value)
 
-	testFunc, ok := runtime.vm.Exports["test_ext_set_storage"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_set_storage"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -272,7 +274,7 @@ func TestExt_storage_root(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 	// save result at `resultPtr` in memory
 	resultPtr := 170
 	hash, err := runtime.trie.Hash()
@@ -280,7 +282,7 @@ func TestExt_storage_root(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	testFunc, ok := runtime.vm.Exports["test_ext_storage_root"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_storage_root"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -301,7 +303,7 @@ func TestExt_get_allocated_storage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 	// put kv pair in trie
 	key := []byte(":noot")
 	value := []byte{1, 3, 3, 7}
@@ -316,7 +318,7 @@ func TestExt_get_allocated_storage(t *testing.T) {
 	// memory location where length of return value is stored
 	var writtenOut int32 = 169
 
-	testFunc, ok := runtime.vm.Exports["test_ext_get_allocated_storage"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_get_allocated_storage"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -328,8 +330,7 @@ func TestExt_get_allocated_storage(t *testing.T) {
 
 	// returns memory location where value is stored
 	retInt := uint32(ret.ToI32())
-	loc := uint32(mem[writtenOut])
-	length := binary.LittleEndian.Uint32(mem[loc : loc+4])
+	length := binary.LittleEndian.Uint32(mem[writtenOut : writtenOut+4])
 	if length != uint32(len(value)) {
 		t.Error("did not save correct value length to memory")
 	} else if !bytes.Equal(mem[retInt:retInt+length], value) {
@@ -353,7 +354,7 @@ func TestExt_clear_storage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 	// save kv pair in trie
 	key := []byte(":noot")
 	value := []byte{1, 3, 3, 7}
@@ -366,7 +367,7 @@ func TestExt_clear_storage(t *testing.T) {
 	keyData := 170
 	copy(mem[keyData:keyData+len(key)], key)
 
-	testFunc, ok := runtime.vm.Exports["test_ext_clear_storage"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_clear_storage"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -392,7 +393,7 @@ func TestExt_clear_prefix(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 
 	// store some values in the trie
 	tests := []struct {
@@ -435,7 +436,7 @@ func TestExt_clear_prefix(t *testing.T) {
 	prefixData := 170
 	copy(mem[prefixData:prefixData+len(prefix)], prefix)
 
-	testFunc, ok := runtime.vm.Exports["test_ext_clear_prefix"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_clear_prefix"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -466,14 +467,14 @@ func TestExt_blake2_128(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 	// save data in memory
 	data := []byte("helloworld")
 	pos := 170
 	out := 180
 	copy(mem[pos:pos+len(data)], data)
 
-	testFunc, ok := runtime.vm.Exports["test_ext_blake2_128"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_blake2_128"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -499,14 +500,14 @@ func TestExt_blake2_256(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 	// save data in memory
 	data := []byte("helloworld")
 	pos := 170
 	out := 180
 	copy(mem[pos:pos+len(data)], data)
 
-	testFunc, ok := runtime.vm.Exports["test_ext_blake2_256"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_blake2_256"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -532,7 +533,7 @@ func TestExt_ed25519_verify(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 
 	// copy message into memory
 	msg := []byte("helloworld")
@@ -554,7 +555,7 @@ func TestExt_ed25519_verify(t *testing.T) {
 	sigData := 222
 	copy(mem[sigData:sigData+len(sig)], sig)
 
-	testFunc, ok := runtime.vm.Exports["test_ext_ed25519_verify"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_ed25519_verify"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -584,7 +585,7 @@ func TestExt_blake2_256_enumerated_trie_root(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 
 	// construct expected trie
 	tests := []struct {
@@ -626,7 +627,7 @@ func TestExt_blake2_256_enumerated_trie_root(t *testing.T) {
 	copy(mem[valuesData:valuesData+len(valuesArray)], valuesArray)
 	copy(mem[lensData:lensData+len(lensArray)], lensArray)
 
-	testFunc, ok := runtime.vm.Exports["test_ext_blake2_256_enumerated_trie_root"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_blake2_256_enumerated_trie_root"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -655,7 +656,7 @@ func TestExt_twox_64(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 	// save data in memory
 	// test for empty []byte
 	data := []byte(nil)
@@ -664,7 +665,7 @@ func TestExt_twox_64(t *testing.T) {
 	copy(mem[pos:pos+len(data)], data)
 
 	// call wasm function
-	testFunc, ok := runtime.vm.Exports["test_ext_twox_64"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_twox_64"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -685,7 +686,7 @@ func TestExt_twox_64(t *testing.T) {
 	copy(mem[pos:pos+len(data)], data)
 
 	// call wasm function
-	testFunc, ok = runtime.vm.Exports["test_ext_twox_64"]
+	testFunc, ok = runtime.current.block.vm.Exports["test_ext_twox_64"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -709,7 +710,7 @@ func TestExt_twox_128(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 	// save data in memory
 	// test for empty []byte
 	data := []byte(nil)
@@ -718,7 +719,7 @@ func TestExt_twox_128(t *testing.T) {
 	copy(mem[pos:pos+len(data)], data)
 
 	// call wasm function
-	testFunc, ok := runtime.vm.Exports["test_ext_twox_128"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_twox_128"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -739,7 +740,7 @@ func TestExt_twox_128(t *testing.T) {
 	copy(mem[pos:pos+len(data)], data)
 
 	// call wasm function
-	testFunc, ok = runtime.vm.Exports["test_ext_twox_128"]
+	testFunc, ok = runtime.current.block.vm.Exports["test_ext_twox_128"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -762,7 +763,7 @@ func TestExt_keccak_256(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 
 	data := []byte(nil)
 	pos := 170
@@ -770,7 +771,7 @@ func TestExt_keccak_256(t *testing.T) {
 	copy(mem[pos:pos+len(data)], data)
 
 	// call wasm function
-	testFunc, ok := runtime.vm.Exports["test_ext_keccak_256"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_keccak_256"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -799,7 +800,7 @@ func TestExt_malloc(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	testFunc, ok := runtime.vm.Exports["test_ext_malloc"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_malloc"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -822,7 +823,7 @@ func TestExt_free(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	initFunc, ok := runtime.vm.Exports["test_ext_malloc"]
+	initFunc, ok := runtime.current.block.vm.Exports["test_ext_malloc"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -836,7 +837,7 @@ func TestExt_free(t *testing.T) {
 	}
 
 	// when
-	testFunc, ok := runtime.vm.Exports["test_ext_free"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_free"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -855,7 +856,7 @@ func TestExt_secp256k1_ecdsa_recover(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	mem := runtime.vm.Memory.Data()
+	mem := runtime.current.block.memory.Data()
 
 	msgData, err := common.HexToBytes("0xce0677bb30baa8cf067c88db9811f4333d131bf8bcf12fe7065d211dce971008")
 	if err != nil {
@@ -872,7 +873,7 @@ func TestExt_secp256k1_ecdsa_recover(t *testing.T) {
 	pubkeyData := sigPos + len(sigData)
 
 	// call wasm function
-	testFunc, ok := runtime.vm.Exports["test_ext_secp256k1_ecdsa_recover"]
+	testFunc, ok := runtime.current.block.vm.Exports["test_ext_secp256k1_ecdsa_recover"]
 	if !ok {
 		t.Fatal("could not find exported function")
 	}
@@ -902,9 +903,233 @@ func TestConcurrentRuntimeCalls(t *testing.T) {
 
 	// Execute 2 concurrent calls to the runtime
 	go func() {
-		_, _ = r.Exec("Core_version", 1, []byte{})
+		_, _ = r.Exec("Core_version", []byte{})
 	}()
 	go func() {
-		_, _ = r.Exec("Core_version", 1, []byte{})
+		_, _ = r.Exec("Core_version", []byte{})
 	}()
 }
+
+func TestCall_Concurrent(t *testing.T) {
+	r, err := newRuntime(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := r.Exec("Core_version", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := DefaultInstances * 4
+	errs := make(chan error, calls)
+	for i := 0; i < calls; i++ {
+		go func() {
+			ret, err := r.Call("Core_version", []byte{})
+			if err == nil && !bytes.Equal(ret, expected) {
+				err = fmt.Errorf("got %x expected %x", ret, expected)
+			}
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < calls; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(r.current.instances) > DefaultInstances {
+		t.Fatalf("created %d instances, expected at most %d", len(r.current.instances), DefaultInstances)
+	}
+}
+
+func TestCall_ExportNotFound(t *testing.T) {
+	r, err := newRuntime(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Call("not_a_function", []byte{})
+	if err != ErrExportFunctionNotFound {
+		t.Fatalf("got %v expected %v", err, ErrExportFunctionNotFound)
+	}
+
+	// the instance must be back in the pool
+	if len(r.current.pool) != len(r.current.instances) {
+		t.Fatalf("got %d idle instances expected %d", len(r.current.pool), len(r.current.instances))
+	}
+}
+
+func TestStorage_Overlay(t *testing.T) {
+	tt := &trie.Trie{}
+	err := tt.Put([]byte("noot"), []byte("washere"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tt.Put([]byte("gossamer"), []byte("node"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := tt.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newStorage(tt, true)
+	err = s.put([]byte("noot"), []byte("wasnothere"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.delete([]byte("gossamer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := s.get([]byte("noot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, []byte("wasnothere")) {
+		t.Fatalf("got %s expected wasnothere", val)
+	}
+
+	val, err = s.get([]byte("gossamer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != nil {
+		t.Fatalf("got %s for deleted key", val)
+	}
+
+	expected := &trie.Trie{}
+	err = expected.Put([]byte("noot"), []byte("wasnothere"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRoot, err := expected.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overlayRoot, err := s.root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overlayRoot != expectedRoot {
+		t.Fatalf("got root %s expected %s", overlayRoot, expectedRoot)
+	}
+
+	// the trie must not have been modified
+	trieRoot, err := tt.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trieRoot != root {
+		t.Fatal("read-only storage modified the trie")
+	}
+
+	s.reset()
+	val, err = s.get([]byte("noot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, []byte("washere")) {
+		t.Fatalf("got %s expected washere after reset", val)
+	}
+}
+
+func TestUpdateCode(t *testing.T) {
+	r, err := newRuntime(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bytecode, err := ioutil.ReadFile(POLKADOT_RUNTIME_FP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no :code in storage
+	updated, err := r.UpdateCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated {
+		t.Fatal("updated code without :code in storage")
+	}
+
+	err = r.trie.Put(CodeKey, bytecode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err = r.UpdateCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated {
+		t.Fatal("updated code to the code already in use")
+	}
+
+	// appending a custom section changes the code without changing what it does
+	newBytecode := append(append([]byte{}, bytecode...), 0, 5, 4, 't', 'e', 's', 't')
+	err = r.trie.Put(CodeKey, newBytecode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldHash := r.CodeHash()
+	updated, err = r.UpdateCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated {
+		t.Fatal("did not update code")
+	}
+
+	newHash, err := common.Blake2bHash(newBytecode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CodeHash() != newHash {
+		t.Fatalf("got code hash %s expected %s", r.CodeHash(), newHash)
+	}
+
+	expected, err := r.Exec("Core_version", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := r.ExecWithCode(oldHash, "Core_version", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ret, expected) {
+		t.Fatalf("got %x expected %x", ret, expected)
+	}
+
+	_, err = r.ExecWithCode(common.Hash{0x01}, "Core_version", []byte{})
+	if err != ErrUnknownCode {
+		t.Fatalf("got %v expected %v", err, ErrUnknownCode)
+	}
+
+	r.PruneCodes([]common.Hash{oldHash})
+	_, err = r.ExecWithCode(oldHash, "Core_version", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the current code is never pruned
+	r.PruneCodes(nil)
+	_, err = r.ExecWithCode(oldHash, "Core_version", []byte{})
+	if err != ErrUnknownCode {
+		t.Fatalf("got %v expected %v", err, ErrUnknownCode)
+	}
+
+	_, err = r.Exec("Core_version", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
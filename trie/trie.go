@@ -142,7 +142,9 @@ func (t *Trie) insert(parent node, key []byte, value node) (ok bool, n node, err
 		br := &branch{dirty: true}
 		length := lenCommonPrefix(key, p.key)
 
+		// replace the leaf, keeping its key
 		if bytes.Equal(p.key, key) && len(key) == length {
+			value.setKey(key)
 			return true, value, nil
 		}
 
@@ -326,6 +326,24 @@ func TestPutAndGetOddKeyLengths(t *testing.T) {
 	runTests(t, trie, tests)
 }
 
+func TestPutAndGetOverwrite(t *testing.T) {
+	trie := newEmpty()
+
+	tests := []trieTest{
+		{key: []byte(":code"), value: []byte("noot"), op: PUT},
+		{key: []byte(":code"), value: []byte("nootagain"), op: PUT},
+		{key: []byte(":code"), value: []byte("nootagain"), op: GET},
+		{key: []byte{0x01, 0x35}, value: []byte("spaghetti"), op: PUT},
+		{key: []byte{0x01, 0x36}, value: []byte("gnocchi"), op: PUT},
+		{key: []byte{0x01, 0x36}, value: []byte("ramen"), op: PUT},
+		{key: []byte{0x01, 0x35}, value: []byte("spaghetti"), op: GET},
+		{key: []byte{0x01, 0x36}, value: []byte("ramen"), op: GET},
+		{key: []byte(":code"), value: []byte("nootagain"), op: GET},
+	}
+
+	runTests(t, trie, tests)
+}
+
 func TestPutAndGet(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		trie := newEmpty()